@@ -0,0 +1,27 @@
+// Package compress 为nhr注册br和zstd响应解码器
+// 为了保持核心包的依赖精简，这两种编码放在单独的模块中，匿名导入即可生效:
+//
+//	import _ "github.com/Lyzin/go-requests/contrib/compress"
+package compress
+
+import (
+	"io"
+	"io/ioutil"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func init() {
+	nhr.RegisterContentDecoder("br", func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(brotli.NewReader(r)), nil
+	})
+	nhr.RegisterContentDecoder("zstd", func(r io.Reader) (io.ReadCloser, error) {
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	})
+}
@@ -0,0 +1,99 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var plain = bytes.Repeat([]byte(`{"message":"hello"}`), 100)
+
+func brotliBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := brotli.NewWriter(&buf)
+	writer.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+	return encoder.EncodeAll(data, nil)
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func fetchEncoded(t *testing.T, encoding string, body []byte) ([]byte, error) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept-Encoding"); got != "br, zstd, gzip" {
+			t.Errorf("Accept-Encoding = %q", got)
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(body)
+	}))
+	defer server.Close()
+	response, err := nhr.Get(server.URL, nhr.WithAcceptEncoding("br", "zstd", "gzip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	return io.ReadAll(response.Body)
+}
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{name: "br", encoding: "br", body: brotliBytes(t, plain)},
+		{name: "zstd", encoding: "zstd", body: zstdBytes(t, plain)},
+		{name: "gzip then br", encoding: "gzip, br", body: brotliBytes(t, gzipBytes(t, plain))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fetchEncoded(t, tt.encoding, tt.body)
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Fatalf("body = %v bytes, %v, want the %v body decoded", len(got), err, tt.encoding)
+			}
+		})
+	}
+}
+
+func TestCorruptBody(t *testing.T) {
+	for _, encoding := range []string{"br", "zstd"} {
+		t.Run(encoding, func(t *testing.T) {
+			_, err := fetchEncoded(t, encoding, []byte("definitely not compressed"))
+			var decodeErr *nhr.ContentDecodeError
+			if !errors.As(err, &decodeErr) || decodeErr.Encoding != encoding {
+				t.Fatalf("error = %v, want a ContentDecodeError for %v", err, encoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/Lyzin/go-requests/contrib/compress
+
+go 1.18
+
+require (
+	github.com/Lyzin/go-requests v0.0.0
+	github.com/andybalholm/brotli v1.0.5
+	github.com/klauspost/compress v1.16.7
+)
+
+require (
+	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+)
+
+replace github.com/Lyzin/go-requests => ../..
@@ -0,0 +1,133 @@
+// Package otel 为nhr的请求创建OpenTelemetry span，并通过traceparent请求头传递链路信息
+// 为了保持核心包的依赖精简，OpenTelemetry的实现放在单独的模块中:
+//
+//	client, err := nhr.NewClient(nhr.WithMiddleware(otel.Middleware()))
+//	response, err := client.Get(url, nhr.WithContext(ctx))
+package otel
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Lyzin/go-requests/contrib/otel"
+
+// Option Middleware的配置
+type Option func(*config)
+
+type config struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// WithTracerProvider 创建span使用的TracerProvider，默认使用otel.GetTracerProvider()
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = provider
+	}
+}
+
+// WithPropagator 向请求头注入链路信息使用的propagator，默认只注入W3C traceparent/tracestate
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = propagator
+	}
+}
+
+// Middleware 请求的context中有span时，为每次尝试创建一个client span作为其子span，并注入traceparent请求头
+// context中没有span时直接发送请求，不创建span也不注入请求头
+// span在出错时，或者响应body读到末尾或被关闭时结束；url.full不包含查询参数，避免token等敏感值进入链路数据
+func Middleware(options ...Option) nhr.Middleware {
+	c := &config{propagator: propagation.TraceContext{}}
+	for _, option := range options {
+		option(c)
+	}
+	provider := c.provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	tracer := provider.Tracer(instrumentationName)
+	return func(next nhr.RoundTripFunc) nhr.RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if !trace.SpanContextFromContext(req.Context()).IsValid() {
+				return next(req)
+			}
+			ctx, span := tracer.Start(req.Context(), "HTTP "+req.Method,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(requestAttributes(req)...))
+			// Clone会复制请求头，注入的traceparent不会影响调用方的请求
+			req = req.Clone(ctx)
+			c.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+			response, err := next(req)
+			if err != nil || response == nil {
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+				}
+				span.End()
+				return response, err
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+			if response.StatusCode >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, http.StatusText(response.StatusCode))
+			}
+			response.Body = &spanBody{ReadCloser: response.Body, span: span}
+			return response, nil
+		}
+	}
+}
+
+// requestAttributes 按HTTP语义约定生成请求的span属性
+func requestAttributes(req *http.Request) []attribute.KeyValue {
+	u := *req.URL
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Hostname()),
+		attribute.String("url.full", u.String()),
+	}
+	if port, err := strconv.Atoi(req.URL.Port()); err == nil {
+		attrs = append(attrs, attribute.Int("server.port", port))
+	}
+	return attrs
+}
+
+// spanBody 响应body读到末尾或关闭时结束span
+type spanBody struct {
+	io.ReadCloser
+	span trace.Span
+	once sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		if err != io.EOF {
+			b.span.RecordError(err)
+			b.span.SetStatus(codes.Error, err.Error())
+		}
+		b.end()
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.end()
+	return err
+}
+
+func (b *spanBody) end() {
+	b.once.Do(func() {
+		b.span.End()
+	})
+}
@@ -0,0 +1,203 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	parentTraceID = trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	parentSpanID  = trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	childSpanID   = trace.SpanID{0x53, 0x99, 0x5c, 0x3f, 0x42, 0xcd, 0x8a, 0xd8}
+)
+
+// recordingSpan 记录结束状态、属性和错误的span，其他方法使用noop实现
+type recordingSpan struct {
+	trace.Span
+	mu     sync.Mutex
+	name   string
+	ended  int
+	status codes.Code
+	attrs  map[attribute.Key]attribute.Value
+	errs   []error
+}
+
+func (s *recordingSpan) SpanContext() trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: parentTraceID, SpanID: childSpanID, TraceFlags: trace.FlagsSampled})
+}
+
+func (s *recordingSpan) End(...trace.SpanEndOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended++
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = code
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, err)
+}
+
+func (s *recordingSpan) endCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ended
+}
+
+// recordingProvider 记录创建的span
+type recordingProvider struct {
+	trace.TracerProvider
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func newRecordingProvider() *recordingProvider {
+	return &recordingProvider{TracerProvider: trace.NewNoopTracerProvider()}
+}
+
+func (p *recordingProvider) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return &recordingTracer{Tracer: p.TracerProvider.Tracer(name, options...), provider: p}
+}
+
+func (p *recordingProvider) started() []*recordingSpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*recordingSpan(nil), p.spans...)
+}
+
+type recordingTracer struct {
+	trace.Tracer
+	provider *recordingProvider
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, noop := t.Tracer.Start(ctx, name, options...)
+	span := &recordingSpan{Span: noop, name: name, attrs: map[attribute.Key]attribute.Value{}}
+	config := trace.NewSpanStartConfig(options...)
+	for _, attr := range config.Attributes() {
+		span.attrs[attr.Key] = attr.Value
+	}
+	t.provider.mu.Lock()
+	t.provider.spans = append(t.provider.spans, span)
+	t.provider.mu.Unlock()
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func parentContext() context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    parentTraceID,
+		SpanID:     parentSpanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+}
+
+// traceparentServer 记录最近一次请求的traceparent请求头，/500返回500
+func traceparentServer(t *testing.T) (*httptest.Server, func() string) {
+	var mu sync.Mutex
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = r.Header.Get("traceparent")
+		mu.Unlock()
+		if r.URL.Path == "/500" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return got
+	}
+}
+
+func TestMiddlewareWithoutSpan(t *testing.T) {
+	server, traceparent := traceparentServer(t)
+	provider := newRecordingProvider()
+	response, err := nhr.Get(server.URL, nhr.WithMiddleware(Middleware(WithTracerProvider(provider))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if traceparent() != "" || len(provider.started()) != 0 {
+		t.Fatalf("traceparent = %q, %v spans, want neither without a span in the ctx", traceparent(), len(provider.started()))
+	}
+}
+
+func TestMiddlewareCreatesChildSpan(t *testing.T) {
+	server, traceparent := traceparentServer(t)
+	provider := newRecordingProvider()
+	response, err := nhr.Get(server.URL+"/orders?token=secret",
+		nhr.WithMiddleware(Middleware(WithTracerProvider(provider))), nhr.WithContext(parentContext()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "00-" + parentTraceID.String() + "-" + childSpanID.String() + "-01"; traceparent() != want {
+		t.Fatalf("traceparent = %q, want %q", traceparent(), want)
+	}
+	spans := provider.started()
+	if len(spans) != 1 || spans[0].name != "HTTP GET" {
+		t.Fatalf("spans = %+v, want one HTTP GET span", spans)
+	}
+	span := spans[0]
+	if span.endCount() != 0 {
+		t.Fatal("the span should stay open until the body is closed")
+	}
+	response.Body.Close()
+	response.Body.Close()
+	if span.endCount() != 1 {
+		t.Fatalf("span ended %v times, want once", span.endCount())
+	}
+	if got := span.attrs["url.full"].AsString(); got != server.URL+"/orders" {
+		t.Fatalf("url.full = %q, want the url without its query", got)
+	}
+	if span.attrs["http.response.status_code"].AsInt64() != http.StatusOK || span.attrs["server.address"].AsString() != "127.0.0.1" || span.status != codes.Unset {
+		t.Fatalf("attributes = %v, status = %v", span.attrs, span.status)
+	}
+}
+
+func TestMiddlewareRecordsErrors(t *testing.T) {
+	server, _ := traceparentServer(t)
+	provider := newRecordingProvider()
+	middleware := nhr.WithMiddleware(Middleware(WithTracerProvider(provider)))
+	response, err := nhr.Get(server.URL+"/500", middleware, nhr.WithContext(parentContext()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if _, err := nhr.Get("http://127.0.0.1:1", middleware, nhr.WithContext(parentContext())); err == nil {
+		t.Fatal("the request to a closed port should fail")
+	}
+	spans := provider.started()
+	if len(spans) != 2 {
+		t.Fatalf("%v spans, want 2", len(spans))
+	}
+	if spans[0].status != codes.Error || len(spans[0].errs) != 0 {
+		t.Fatalf("5xx span status = %v, errors = %v", spans[0].status, spans[0].errs)
+	}
+	if spans[1].status != codes.Error || len(spans[1].errs) != 1 || spans[1].endCount() != 1 {
+		t.Fatalf("failed span status = %v, errors = %v, ended %v times", spans[1].status, spans[1].errs, spans[1].endCount())
+	}
+}
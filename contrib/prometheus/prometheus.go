@@ -0,0 +1,229 @@
+// Package prometheus 将nhr的请求监控数据转为Prometheus指标
+// 为了保持核心包的依赖精简，Prometheus的实现放在单独的模块中:
+//
+//	collector := prometheus.NewCollector(prometheus.Opts{Namespace: "myapp"})
+//	registry.MustRegister(collector)
+//	client, err := nhr.NewClient(nhr.WithMetrics(collector))
+package prometheus
+
+import (
+	"strconv"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Opts Collector的配置，为空时使用默认值
+type Opts struct {
+	// Namespace 指标名称的前缀，为空时为nhr
+	Namespace string
+	// ConstLabels 所有指标都带上的固定标签
+	ConstLabels prometheus.Labels
+	// DurationBuckets 请求耗时直方图的区间（秒），为空时使用prometheus.DefBuckets
+	DurationBuckets []float64
+	// SizeBuckets 响应大小直方图的区间（字节），为空时为100B到100MB之间按10倍增长
+	SizeBuckets []float64
+	// HostLabel 将host转为host标签的值，例如把api-1.example.com、api-2.example.com合并为api.example.com
+	// 为空时直接使用host，RequestMetrics.Host已经去掉了端口
+	HostLabel func(host string) string
+}
+
+// Collector 同时实现nhr.MetricsCollector和prometheus.Collector，注册到Registry后即可采集
+// 指标带有method、host和status标签，没有收到响应时status为error
+type Collector struct {
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+	responseSize *prometheus.HistogramVec
+	queueWait    *prometheus.HistogramVec
+	connections  *prometheus.CounterVec
+	bypassed     *prometheus.CounterVec
+
+	rateLimitRemaining *prometheus.GaugeVec
+	rateLimitLimit     *prometheus.GaugeVec
+	rateLimitReset     *prometheus.GaugeVec
+	costRemaining      prometheus.Gauge
+
+	hostLabel func(host string) string
+}
+
+var (
+	_ nhr.MetricsCollector    = (*Collector)(nil)
+	_ nhr.RateLimitCollector  = (*Collector)(nil)
+	_ nhr.CostBudgetCollector = (*Collector)(nil)
+	_ prometheus.Collector    = (*Collector)(nil)
+)
+
+// NewCollector 创建Collector，同一个Registry中只能注册一个Namespace相同的Collector
+func NewCollector(opts Opts) *Collector {
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = "nhr"
+	}
+	durationBuckets := opts.DurationBuckets
+	if len(durationBuckets) == 0 {
+		durationBuckets = prometheus.DefBuckets
+	}
+	sizeBuckets := opts.SizeBuckets
+	if len(sizeBuckets) == 0 {
+		sizeBuckets = prometheus.ExponentialBuckets(100, 10, 7)
+	}
+	hostLabel := opts.HostLabel
+	if hostLabel == nil {
+		hostLabel = func(host string) string { return host }
+	}
+	labels := []string{"method", "host", "status"}
+	return &Collector{
+		hostLabel: hostLabel,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "requests_total",
+			Help:        "Total number of HTTP requests sent, counted per attempt.",
+			ConstLabels: opts.ConstLabels,
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "request_duration_seconds",
+			Help:        "Time from sending the request to receiving the response headers.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     durationBuckets,
+		}, labels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "requests_in_flight",
+			Help:        "Number of requests whose response body has not been fully read or closed yet.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"method", "host"}),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "response_size_bytes",
+			Help:        "Number of response body bytes read, before decompression.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     sizeBuckets,
+		}, labels),
+		queueWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "queue_wait_seconds",
+			Help:        "Time spent waiting for an in-flight slot set by WithMaxInFlight.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     durationBuckets,
+		}, []string{"method", "host"}),
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "connections_total",
+			Help:        "Connections used by requests that received a response, by whether the connection was reused.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"host", "reused"}),
+		bypassed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "bypassed_requests_total",
+			Help:        "Attempts that skipped retries or rate limiting via WithNoRetry or WithNoRateLimit.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"host", "bypass"}),
+		rateLimitRemaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "ratelimit_remaining",
+			Help:        "Remaining request quota reported by the server, recorded by WithAdaptiveRateLimit.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"host"}),
+		rateLimitLimit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "ratelimit_limit",
+			Help:        "Request quota per window reported by the server.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"host"}),
+		rateLimitReset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "ratelimit_reset_timestamp_seconds",
+			Help:        "Unix time at which the server resets the request quota.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"host"}),
+		costRemaining: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "client",
+			Name:        "cost_budget_remaining",
+			Help:        "Cost units left in the current window, recorded by WithCostBudget.",
+			ConstLabels: opts.ConstLabels,
+		}),
+	}
+}
+
+// RequestStarted 实现nhr.MetricsCollector
+func (c *Collector) RequestStarted(method, host string) {
+	c.inFlight.WithLabelValues(method, c.hostLabel(host)).Inc()
+}
+
+// RequestFinished 实现nhr.MetricsCollector
+func (c *Collector) RequestFinished(metrics *nhr.RequestMetrics) {
+	host := c.hostLabel(metrics.Host)
+	c.inFlight.WithLabelValues(metrics.Method, host).Dec()
+	status := "error"
+	if metrics.Status > 0 {
+		status = strconv.Itoa(metrics.Status)
+	}
+	c.requests.WithLabelValues(metrics.Method, host, status).Inc()
+	c.queueWait.WithLabelValues(metrics.Method, host).Observe(metrics.QueueWait.Seconds())
+	c.duration.WithLabelValues(metrics.Method, host, status).Observe(metrics.Duration.Seconds())
+	if metrics.Status > 0 {
+		c.responseSize.WithLabelValues(metrics.Method, host, status).Observe(float64(metrics.ResponseSize))
+		c.connections.WithLabelValues(host, strconv.FormatBool(metrics.ConnectionReused)).Inc()
+	}
+	if metrics.Bypass != "" {
+		c.bypassed.WithLabelValues(host, metrics.Bypass).Inc()
+	}
+}
+
+// RateLimitUpdated 实现nhr.RateLimitCollector，Limit未知时不更新ratelimit_limit
+func (c *Collector) RateLimitUpdated(host string, state nhr.RateLimitState) {
+	host = c.hostLabel(host)
+	c.rateLimitRemaining.WithLabelValues(host).Set(float64(state.Remaining))
+	if state.Limit >= 0 {
+		c.rateLimitLimit.WithLabelValues(host).Set(float64(state.Limit))
+	}
+	c.rateLimitReset.WithLabelValues(host).Set(float64(state.Reset.Unix()))
+}
+
+// CostBudgetUpdated 实现nhr.CostBudgetCollector
+func (c *Collector) CostBudgetUpdated(state nhr.CostBudgetState) {
+	c.costRemaining.Set(state.Remaining)
+}
+
+// Describe 实现prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.duration.Describe(ch)
+	c.inFlight.Describe(ch)
+	c.responseSize.Describe(ch)
+	c.queueWait.Describe(ch)
+	c.connections.Describe(ch)
+	c.bypassed.Describe(ch)
+	c.rateLimitRemaining.Describe(ch)
+	c.rateLimitLimit.Describe(ch)
+	c.rateLimitReset.Describe(ch)
+	c.costRemaining.Describe(ch)
+}
+
+// Collect 实现prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.duration.Collect(ch)
+	c.inFlight.Collect(ch)
+	c.responseSize.Collect(ch)
+	c.queueWait.Collect(ch)
+	c.connections.Collect(ch)
+	c.bypassed.Collect(ch)
+	c.rateLimitRemaining.Collect(ch)
+	c.rateLimitLimit.Collect(ch)
+	c.rateLimitReset.Collect(ch)
+	c.costRemaining.Collect(ch)
+}
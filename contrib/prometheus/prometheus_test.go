@@ -0,0 +1,117 @@
+package prometheus
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorRecordsRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	collector := NewCollector(Opts{Namespace: "test"})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	client, err := nhr.NewClient(nhr.WithMetrics(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/", "/", "/missing"} {
+		response, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(response.Body)
+		response.Body.Close()
+	}
+	if _, err := client.Get("http://127.0.0.1:1", nhr.WithRetry(1, 0)); err == nil {
+		t.Fatal("the request to a closed port should fail")
+	}
+
+	for _, tt := range []struct {
+		status string
+		want   float64
+	}{{"200", 2}, {"404", 1}, {"error", 1}} {
+		if got := testutil.ToFloat64(collector.requests.WithLabelValues(http.MethodGet, "127.0.0.1", tt.status)); got != tt.want {
+			t.Fatalf("requests_total{status=%q} = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+	if got := testutil.ToFloat64(collector.inFlight.WithLabelValues(http.MethodGet, "127.0.0.1")); got != 0 {
+		t.Fatalf("requests_in_flight = %v, want 0", got)
+	}
+	if problems, err := testutil.GatherAndLint(registry); err != nil || len(problems) != 0 {
+		t.Fatalf("lint = %v, %v", problems, err)
+	}
+}
+
+func TestCollectorInFlightDropsForAbandonedBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	collector := NewCollector(Opts{})
+	inFlight := collector.inFlight.WithLabelValues(http.MethodGet, "127.0.0.1")
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := nhr.Get(server.URL, nhr.WithMetrics(collector), nhr.WithContext(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(inFlight); got != 1 {
+		t.Fatalf("requests_in_flight = %v, want 1 while the body is open", got)
+	}
+	cancel()
+	waitFor(t, func() bool { return testutil.ToFloat64(inFlight) == 0 })
+	if got := testutil.ToFloat64(collector.requests.WithLabelValues(http.MethodGet, "127.0.0.1", "200")); got != 1 {
+		t.Fatalf("requests_total = %v, want the abandoned request counted", got)
+	}
+}
+
+func TestCollectorHostLabel(t *testing.T) {
+	collector := NewCollector(Opts{HostLabel: func(host string) string {
+		if strings.HasSuffix(host, ".shards.example.com") {
+			return "shards.example.com"
+		}
+		return host
+	}})
+	for _, host := range []string{"a.shards.example.com", "b.shards.example.com"} {
+		collector.RequestStarted(http.MethodGet, host)
+		collector.RequestFinished(&nhr.RequestMetrics{Method: http.MethodGet, Host: host, Status: http.StatusOK})
+	}
+	collector.RateLimitUpdated("a.shards.example.com", nhr.RateLimitState{Remaining: 7, Limit: -1})
+
+	if got := testutil.ToFloat64(collector.requests.WithLabelValues(http.MethodGet, "shards.example.com", "200")); got != 2 {
+		t.Fatalf("requests_total = %v, want both hosts under one label", got)
+	}
+	if got := testutil.ToFloat64(collector.inFlight.WithLabelValues(http.MethodGet, "shards.example.com")); got != 0 {
+		t.Fatalf("requests_in_flight = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(collector.rateLimitRemaining.WithLabelValues("shards.example.com")); got != 7 {
+		t.Fatalf("ratelimit_remaining = %v, want 7", got)
+	}
+	if got := testutil.CollectAndCount(collector.requests); got != 1 {
+		t.Fatalf("requests_total has %v series, want 1", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 2s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
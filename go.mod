@@ -2,7 +2,12 @@ module github.com/Lyzin/go-requests
 
 go 1.18
 
-require github.com/json-iterator/go v1.1.12
+require (
+	github.com/json-iterator/go v1.1.12
+	go.uber.org/goleak v1.2.1
+	golang.org/x/net v0.17.0
+	golang.org/x/text v0.13.0
+)
 
 require (
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
@@ -0,0 +1,133 @@
+package nhr
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithBasicAuth 使用HTTP Basic认证，Authorization为 Basic base64(user:pass)
+func WithBasicAuth(user, pass string) Option {
+	return withAuthorization("Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+}
+
+// WithBearerToken 使用Bearer token认证，Authorization为 Bearer token
+func WithBearerToken(token string) Option {
+	return withAuthorization("Bearer " + token)
+}
+
+// withAuthorization 设置Authorization请求头，WithConfigTrace中来源记为ConfigSourceAuth
+func withAuthorization(value string) Option {
+	return func(req *HttpRequests) {
+		req.setHeader("Authorization", value)
+		req.authSource = true
+	}
+}
+
+// TokenProvider 每次发送请求之前获取token，可以在其中缓存和刷新会过期的OAuth2、JWT token
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenProviderFunc 将普通函数转为TokenProvider
+type TokenProviderFunc func(ctx context.Context) (string, error)
+
+func (f TokenProviderFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// TokenRefresher 可选接口，响应为401时调用RefreshToken强制刷新，rejected为被服务端拒绝的token
+// TokenProvider没有实现该接口时重新调用Token，得到相同的token时不再重试
+type TokenRefresher interface {
+	RefreshToken(ctx context.Context, rejected string) (string, error)
+}
+
+// WithTokenProvider 每次发送请求(包括重试)之前通过provider获取token并设置 Authorization: Bearer token
+// 响应为401时刷新token并重新发送一次，body无法重新读取时不重试
+// 可以作为NewClient的默认配置，Client的所有请求共用同一个provider
+func WithTokenProvider(provider TokenProvider) Option {
+	return WithMiddleware(tokenMiddleware(provider))
+}
+
+// tokenMiddleware 注入token，401时刷新并重试一次
+func tokenMiddleware(provider TokenProvider) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			token, err := provider.Token(req.Context())
+			if err != nil {
+				return nil, fmt.Errorf("get token error:%w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			response, err := next(req)
+			if err != nil || response.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+				return response, err
+			}
+			refreshed, err := refreshToken(req.Context(), provider, token)
+			if err != nil || refreshed == token {
+				return response, nil
+			}
+			retry := req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return response, nil
+				}
+				retry.Body = body
+			}
+			drainBody(response.Body)
+			retry.Header.Set("Authorization", "Bearer "+refreshed)
+			return next(retry)
+		}
+	}
+}
+
+func refreshToken(ctx context.Context, provider TokenProvider, rejected string) (string, error) {
+	if refresher, ok := provider.(TokenRefresher); ok {
+		return refresher.RefreshToken(ctx, rejected)
+	}
+	return provider.Token(ctx)
+}
+
+// CachedTokenProvider 缓存Fetch获取的token，过期前Leeway时间内或被服务端拒绝时重新获取
+// 同一时间只有一个goroutine调用Fetch，可以被多个goroutine同时使用
+type CachedTokenProvider struct {
+	// Fetch 获取新的token以及过期时间，expiresAt为零值时一直有效，直到被服务端拒绝
+	Fetch func(ctx context.Context) (token string, expiresAt time.Time, err error)
+	// Leeway 提前刷新的时间，避免请求发出时token刚好过期
+	Leeway time.Duration
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func (p *CachedTokenProvider) Token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && (p.expiresAt.IsZero() || timeNow().Add(p.Leeway).Before(p.expiresAt)) {
+		return p.token, nil
+	}
+	return p.fetchLocked(ctx)
+}
+
+func (p *CachedTokenProvider) RefreshToken(ctx context.Context, rejected string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 其他goroutine已经刷新过时直接使用新的token
+	if p.token != "" && p.token != rejected {
+		return p.token, nil
+	}
+	return p.fetchLocked(ctx)
+}
+
+func (p *CachedTokenProvider) fetchLocked(ctx context.Context) (string, error) {
+	token, expiresAt, err := p.Fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	p.token, p.expiresAt = token, expiresAt
+	return token, nil
+}
@@ -0,0 +1,277 @@
+package nhr
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// headerServer 记录最近一次请求的method、请求头和查询参数
+func headerServer(t *testing.T) (*httptest.Server, **http.Request) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	t.Cleanup(server.Close)
+	return server, &got
+}
+
+func TestBearerTokenKeepsDefaultHeaders(t *testing.T) {
+	server, got := headerServer(t)
+	response, err := Get(server.URL, WithBearerToken("tok"), WithParams(map[string]string{"page": "2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	r := *got
+	if r.Header.Get("Authorization") != "Bearer tok" {
+		t.Fatalf("Authorization = %q", r.Header.Get("Authorization"))
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Content-Type = %q, want the default kept", r.Header.Get("Content-Type"))
+	}
+	if r.URL.Query().Get("page") != "2" {
+		t.Fatalf("query = %q", r.URL.RawQuery)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	server, got := headerServer(t)
+	response, err := Get(server.URL, WithBasicAuth("alice", "p@ss:word"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	user, pass, ok := (*got).BasicAuth()
+	if !ok || user != "alice" || pass != "p@ss:word" {
+		t.Fatalf("BasicAuth = %q, %q, %v", user, pass, ok)
+	}
+}
+
+func TestHeadersMerge(t *testing.T) {
+	server, got := headerServer(t)
+	response, err := Get(server.URL,
+		WithBearerToken("tok"),
+		WithHeaders(map[string]string{"X-Trace": "1"}),
+		WithHeader("x-trace", "2"),
+		WithHeader("X-Tenant", "acme"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	header := (*got).Header
+	if header.Get("Authorization") != "Bearer tok" || header.Get("Content-Type") != "application/json" || header.Get("X-Tenant") != "acme" {
+		t.Fatalf("headers = %v, want every header merged", header)
+	}
+	if values := header.Values("X-Trace"); len(values) != 1 || values[0] != "2" {
+		t.Fatalf("X-Trace = %v, want the later value only", values)
+	}
+}
+
+func TestMethodShortcuts(t *testing.T) {
+	server, got := headerServer(t)
+	shortcuts := map[string]func(string, ...Option) (*http.Response, error){
+		http.MethodGet:    Get,
+		http.MethodPost:   Post,
+		http.MethodPut:    Put,
+		http.MethodPatch:  Patch,
+		http.MethodDelete: Delete,
+		http.MethodHead:   Head,
+	}
+	for method, shortcut := range shortcuts {
+		response, err := shortcut(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if (*got).Method != method {
+			t.Fatalf("shortcut for %v sent %v", method, (*got).Method)
+		}
+	}
+}
+
+// tokenServer 只接受Authorization为 Bearer valid 的请求，其余返回401，记录每次请求的token和body
+type tokenServer struct {
+	*httptest.Server
+	valid string
+	// arrived 不为nil时，无效token的请求在返回401之前等待所有请求到达
+	arrived *sync.WaitGroup
+	mu      sync.Mutex
+	tokens  []string
+	bodies  []string
+}
+
+func newTokenServer(t *testing.T, valid string) *tokenServer {
+	s := &tokenServer{valid: valid}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		s.tokens = append(s.tokens, r.Header.Get("Authorization"))
+		s.bodies = append(s.bodies, string(body))
+		arrived := s.arrived
+		s.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+s.valid {
+			if arrived != nil {
+				arrived.Done()
+				arrived.Wait()
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *tokenServer) requests() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tokens...), append([]string(nil), s.bodies...)
+}
+
+// countingFetch 依次返回tokens中的token，之后一直返回最后一个
+func countingFetch(expiresAt func() time.Time, tokens ...string) (func(ctx context.Context) (string, time.Time, error), *int32) {
+	var calls int32
+	return func(ctx context.Context) (string, time.Time, error) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if n > len(tokens) {
+			n = len(tokens)
+		}
+		var expires time.Time
+		if expiresAt != nil {
+			expires = expiresAt()
+		}
+		return tokens[n-1], expires, nil
+	}, &calls
+}
+
+func TestCachedTokenProviderReused(t *testing.T) {
+	server := newTokenServer(t, "t1")
+	fetch, calls := countingFetch(func() time.Time { return time.Now().Add(time.Minute) }, "t1", "t1")
+	provider := &CachedTokenProvider{Fetch: fetch, Leeway: 10 * time.Second}
+	client, err := NewClient(WithTokenProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("status = %v, want 200", response.StatusCode)
+		}
+	}
+	if *calls != 1 {
+		t.Fatalf("Fetch called %v times, want the token cached across requests", *calls)
+	}
+	// 剩余的有效期小于Leeway时提前刷新
+	provider.Leeway = 2 * time.Minute
+	if _, err := provider.Token(context.Background()); err != nil || *calls != 2 {
+		t.Fatalf("Fetch called %v times, %v, want a refresh inside the leeway", *calls, err)
+	}
+}
+
+func TestCachedTokenProviderConcurrentRefresh(t *testing.T) {
+	const callers = 8
+	server := newTokenServer(t, "t2")
+	server.arrived = &sync.WaitGroup{}
+	server.arrived.Add(callers)
+	fetch, calls := countingFetch(nil, "t1", "t2")
+	provider := &CachedTokenProvider{Fetch: fetch}
+	// 先取得会被拒绝的t1，所有请求都带着t1到达服务端之后才返回401
+	if _, err := provider.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	statuses := make([]int, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, err := Get(server.URL, WithTokenProvider(provider))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			response.Body.Close()
+			statuses[i] = response.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	for i, status := range statuses {
+		if status != http.StatusOK {
+			t.Fatalf("caller %v status = %v, want 200 after the refresh", i, status)
+		}
+	}
+	if *calls != 2 {
+		t.Fatalf("Fetch called %v times, want exactly one refresh for %v rejected callers", *calls, callers)
+	}
+}
+
+func TestTokenProviderRetriesOnceWithBody(t *testing.T) {
+	server := newTokenServer(t, "fresh")
+	provider := &refreshingProvider{token: "stale", refreshed: "fresh"}
+	response, err := Post(server.URL, WithPostJsonBody(map[string]interface{}{"id": 1}), WithTokenProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	tokens, bodies := server.requests()
+	if response.StatusCode != http.StatusOK || len(tokens) != 2 || tokens[0] != "Bearer stale" || tokens[1] != "Bearer fresh" {
+		t.Fatalf("status = %v, tokens = %v, want one retry with the refreshed token", response.StatusCode, tokens)
+	}
+	if bodies[0] != `{"id":1}` || bodies[1] != bodies[0] {
+		t.Fatalf("bodies = %q, want the body replayed on the retry", bodies)
+	}
+	if provider.rejected != "stale" {
+		t.Fatalf("rejected = %q, want the token refused by the server", provider.rejected)
+	}
+}
+
+func TestTokenProviderSecond401Returned(t *testing.T) {
+	server := newTokenServer(t, "never")
+	fetch, calls := countingFetch(nil, "a", "b", "c")
+	response, err := Get(server.URL, WithTokenProvider(&CachedTokenProvider{Fetch: fetch}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	tokens, _ := server.requests()
+	if response.StatusCode != http.StatusUnauthorized || len(tokens) != 2 || *calls != 2 {
+		t.Fatalf("status = %v, tokens = %v, fetches = %v, want the second 401 returned without another refresh", response.StatusCode, tokens, *calls)
+	}
+
+	// 刷新后得到相同的token时不重试
+	same := TokenProviderFunc(func(ctx context.Context) (string, error) { return "a", nil })
+	response, err = Get(server.URL, WithTokenProvider(same))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if tokens, _ = server.requests(); len(tokens) != 3 {
+		t.Fatalf("requests = %v, want no retry with an unchanged token", len(tokens))
+	}
+}
+
+// refreshingProvider 实现TokenRefresher，记录被拒绝的token
+type refreshingProvider struct {
+	token, refreshed, rejected string
+}
+
+func (p *refreshingProvider) Token(ctx context.Context) (string, error) {
+	return p.token, nil
+}
+
+func (p *refreshingProvider) RefreshToken(ctx context.Context, rejected string) (string, error) {
+	p.rejected = rejected
+	return p.refreshed, nil
+}
@@ -0,0 +1,186 @@
+package nhr
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Backoff 重试退避策略，返回第attempt次重试前需要等待的时间
+// attempt从1开始，resp和err为上一次尝试的结果，两者可能为nil
+type Backoff interface {
+	NextDelay(attempt int, resp *http.Response, err error) time.Duration
+}
+
+// BackoffFunc 将普通函数转为Backoff
+type BackoffFunc func(attempt int, resp *http.Response, err error) time.Duration
+
+func (f BackoffFunc) NextDelay(attempt int, resp *http.Response, err error) time.Duration {
+	return f(attempt, resp, err)
+}
+
+// lockedRand 并发安全的随机数源，Rand为nil时使用全局随机数
+type lockedRand struct {
+	mu sync.Mutex
+}
+
+// int63n 返回[0, n)之间的随机数，n小于等于0时返回0
+func (l *lockedRand) int63n(r *rand.Rand, n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	if r == nil {
+		return rand.Int63n(n)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return r.Int63n(n)
+}
+
+// clampDelay 将等待时间限制在[min, max]之间，max为0时不限制上限
+func clampDelay(d, min, max time.Duration) time.Duration {
+	if max > 0 && d > max {
+		d = max
+	}
+	if d < min {
+		d = min
+	}
+	return d
+}
+
+// exponentialCap 计算min*2^(attempt-1)，并防止溢出
+func exponentialCap(attempt int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 1; i < attempt; i++ {
+		if max > 0 && d >= max {
+			return max
+		}
+		if d > time.Duration(1<<62) {
+			break
+		}
+		d *= 2
+	}
+	return clampDelay(d, min, max)
+}
+
+// ExponentialJitterBackoff 指数退避 + 完全抖动(full jitter)
+// 第attempt次重试的等待时间在[Min, min(Max, Min*2^(attempt-1))]之间均匀分布
+type ExponentialJitterBackoff struct {
+	Min  time.Duration
+	Max  time.Duration
+	Rand *rand.Rand
+
+	lr lockedRand
+}
+
+func (b *ExponentialJitterBackoff) NextDelay(attempt int, _ *http.Response, _ error) time.Duration {
+	ceil := exponentialCap(attempt, b.Min, b.Max)
+	return b.Min + time.Duration(b.lr.int63n(b.Rand, int64(ceil-b.Min)+1))
+}
+
+// EqualJitterBackoff 指数退避 + 等量抖动(equal jitter)
+// 保留一半的指数退避时间，另一半随机，结果不小于Min且不大于Max
+type EqualJitterBackoff struct {
+	Min  time.Duration
+	Max  time.Duration
+	Rand *rand.Rand
+
+	lr lockedRand
+}
+
+func (b *EqualJitterBackoff) NextDelay(attempt int, _ *http.Response, _ error) time.Duration {
+	half := exponentialCap(attempt, b.Min, b.Max) / 2
+	d := half + time.Duration(b.lr.int63n(b.Rand, int64(half)+1))
+	return clampDelay(d, b.Min, b.Max)
+}
+
+// DecorrelatedJitterBackoff 去相关抖动(decorrelated jitter)
+// 等待时间在[Min, 上一次等待时间*3]之间随机，结果不大于Max
+// 该策略有状态，attempt为1时重新开始计算，同一个实例不要在并发的调用之间共享
+type DecorrelatedJitterBackoff struct {
+	Min  time.Duration
+	Max  time.Duration
+	Rand *rand.Rand
+
+	lr   lockedRand
+	mu   sync.Mutex
+	prev time.Duration
+}
+
+func (b *DecorrelatedJitterBackoff) NextDelay(attempt int, _ *http.Response, _ error) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if attempt <= 1 || b.prev < b.Min {
+		b.prev = b.Min
+	}
+	upper := b.prev * 3
+	if b.Max > 0 && upper > b.Max {
+		upper = b.Max
+	}
+	d := b.Min + time.Duration(b.lr.int63n(b.Rand, int64(upper-b.Min)+1))
+	b.prev = clampDelay(d, b.Min, b.Max)
+	return b.prev
+}
+
+// ConstantBackoff 每次重试都等待固定的时间
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+func (b *ConstantBackoff) NextDelay(int, *http.Response, error) time.Duration {
+	return b.Delay
+}
+
+// FibonacciBackoff 按斐波那契数列增长的退避，第attempt次重试等待Min*fib(attempt)，结果不大于Max
+type FibonacciBackoff struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+func (b *FibonacciBackoff) NextDelay(attempt int, _ *http.Response, _ error) time.Duration {
+	prev, cur := time.Duration(0), b.Min
+	for i := 1; i < attempt; i++ {
+		if b.Max > 0 && cur >= b.Max {
+			return b.Max
+		}
+		prev, cur = cur, prev+cur
+	}
+	return clampDelay(cur, b.Min, b.Max)
+}
+
+// RetryAfter 解析响应中的Retry-After头，支持秒数和HTTP日期两种格式
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		d := date.Sub(timeNow())
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// RespectRetryAfter 包装退避策略，响应中带有Retry-After头时优先使用服务端要求的等待时间
+func RespectRetryAfter(b Backoff) Backoff {
+	return BackoffFunc(func(attempt int, resp *http.Response, err error) time.Duration {
+		if d, ok := RetryAfter(resp); ok {
+			return d
+		}
+		return b.NextDelay(attempt, resp, err)
+	})
+}
@@ -0,0 +1,104 @@
+package nhr
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffWithinBounds(t *testing.T) {
+	const (
+		min = 50 * time.Millisecond
+		max = 5 * time.Second
+	)
+	strategies := map[string]func(r *rand.Rand) Backoff{
+		"full jitter":         func(r *rand.Rand) Backoff { return &ExponentialJitterBackoff{Min: min, Max: max, Rand: r} },
+		"equal jitter":        func(r *rand.Rand) Backoff { return &EqualJitterBackoff{Min: min, Max: max, Rand: r} },
+		"decorrelated jitter": func(r *rand.Rand) Backoff { return &DecorrelatedJitterBackoff{Min: min, Max: max, Rand: r} },
+		"fibonacci":           func(*rand.Rand) Backoff { return &FibonacciBackoff{Min: min, Max: max} },
+	}
+	for name, newBackoff := range strategies {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			b := newBackoff(r)
+			for run := 0; run < 100; run++ {
+				// 每一轮模拟一次调用中的多次重试，attempt足够大时覆盖指数溢出的情况
+				attempts := 1 + r.Intn(100)
+				for attempt := 1; attempt <= attempts; attempt++ {
+					d := b.NextDelay(attempt, nil, nil)
+					if d < min || d > max {
+						t.Fatalf("run %v attempt %v: delay %v outside [%v, %v]", run, attempt, d, min, max)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFullJitterCeilingGrows(t *testing.T) {
+	b := &ExponentialJitterBackoff{Min: 10 * time.Millisecond, Max: time.Second, Rand: rand.New(rand.NewSource(2))}
+	for attempt := 1; attempt <= 10; attempt++ {
+		ceil := exponentialCap(attempt, b.Min, b.Max)
+		for i := 0; i < 1000; i++ {
+			if d := b.NextDelay(attempt, nil, nil); d > ceil {
+				t.Fatalf("attempt %v: delay %v above ceiling %v", attempt, d, ceil)
+			}
+		}
+	}
+}
+
+func TestConstantAndFibonacciSequence(t *testing.T) {
+	constant := &ConstantBackoff{Delay: time.Second}
+	fib := &FibonacciBackoff{Min: time.Millisecond, Max: 10 * time.Millisecond}
+	want := []time.Duration{1, 1, 2, 3, 5, 8, 10, 10}
+	for i, w := range want {
+		if d := constant.NextDelay(i+1, nil, nil); d != time.Second {
+			t.Fatalf("constant attempt %v = %v", i+1, d)
+		}
+		if d := fib.NextDelay(i+1, nil, nil); d != w*time.Millisecond {
+			t.Fatalf("fibonacci attempt %v = %v, want %v", i+1, d, w*time.Millisecond)
+		}
+	}
+}
+
+func TestRetryAfterTakesPrecedence(t *testing.T) {
+	b := RespectRetryAfter(&ConstantBackoff{Delay: time.Hour})
+	resp := &http.Response{Header: http.Header{"Retry-After": {"2"}}}
+	if d := b.NextDelay(1, resp, nil); d != 2*time.Second {
+		t.Fatalf("delay = %v, want 2s from Retry-After", d)
+	}
+	if d := b.NextDelay(1, &http.Response{Header: http.Header{}}, nil); d != time.Hour {
+		t.Fatalf("delay = %v, want the strategy's 1h", d)
+	}
+}
+
+func TestWithBackoffUsedByRetry(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var calls int32
+	backoff := BackoffFunc(func(int, *http.Response, error) time.Duration {
+		atomic.AddInt32(&calls, 1)
+		return 0
+	})
+	// WithBackoff在WithRetry之前也生效
+	response, err := Get(server.URL, WithBackoff(backoff), WithRetry(3, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want 200", response.StatusCode)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("backoff called %v times, want 2", n)
+	}
+}
@@ -0,0 +1,119 @@
+package nhr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BatchItemError 批量请求中单个请求的错误，Index为请求在批量中的下标
+type BatchItemError struct {
+	Index    int
+	URL      string
+	Attempts int
+	Err      error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("request %v (%v, %v attempts) error:%v", e.Index, e.URL, e.Attempts, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// BatchAbortedError 批量中的请求没有发送，Err为ctx结束或者等待限速失败的原因
+// errors.Is(err, ErrBatchAborted)为true，errors.Is、errors.As也可以检查Err
+type BatchAbortedError struct {
+	Err error
+}
+
+func (e *BatchAbortedError) Error() string {
+	return fmt.Sprintf("batch aborted:%v", e.Err)
+}
+
+func (e *BatchAbortedError) Unwrap() error {
+	return e.Err
+}
+
+// Is Go 1.18没有多个%w，通过Is匹配ErrBatchAborted
+func (e *BatchAbortedError) Is(target error) bool {
+	return target == ErrBatchAborted
+}
+
+// BatchError 批量请求部分或全部失败时返回，Total为请求总数，Errors按下标排序
+// errors.Is、errors.As会逐个检查Errors中的错误
+type BatchError struct {
+	Total  int
+	Errors []*BatchItemError
+}
+
+func (e *BatchError) Error() string {
+	kinds := map[string]int{}
+	for _, item := range e.Errors {
+		kinds[failureKind(item.Err)]++
+	}
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if kinds[names[i]] != kinds[names[j]] {
+			return kinds[names[i]] > kinds[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > 3 {
+		names = names[:3]
+	}
+	summary := make([]string, 0, len(names))
+	for _, kind := range names {
+		summary = append(summary, fmt.Sprintf("%v x%v", kind, kinds[kind]))
+	}
+	return fmt.Sprintf("%v of %v requests failed: %v", len(e.Errors), e.Total, strings.Join(summary, ", "))
+}
+
+// Unwrap 返回所有请求的错误，Go 1.20起errors.Is、errors.As会直接遍历
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, item := range e.Errors {
+		errs = append(errs, item)
+	}
+	return errs
+}
+
+// Is 兼容Go 1.20之前不支持Unwrap() []error的errors.Is
+func (e *BatchError) Is(target error) bool {
+	for _, item := range e.Errors {
+		if errors.Is(item, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As 兼容Go 1.20之前不支持Unwrap() []error的errors.As
+func (e *BatchError) As(target interface{}) bool {
+	for _, item := range e.Errors {
+		if errors.As(item, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// failureKind 返回错误链中最具体的类别，*url.Error和普通的wrap错误只在没有其他类别时使用
+func failureKind(err error) string {
+	kind := "error"
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch k := errorKind(err); k {
+		case "error", "retries_exhausted":
+		case "url":
+			kind = k
+		default:
+			return k
+		}
+	}
+	return kind
+}
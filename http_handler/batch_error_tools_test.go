@@ -0,0 +1,67 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestBatchErrorSummary(t *testing.T) {
+	items := []*BatchItemError{
+		{Index: 0, Err: &StatusError{StatusCode: 503}},
+		{Index: 1, Err: &RetryError{Attempts: 3, Err: &StatusError{StatusCode: 503}}},
+		{Index: 2, Err: &url.Error{Op: "Get", URL: "https://a.example", Err: context.DeadlineExceeded}},
+		{Index: 3, Err: &url.Error{Op: "Get", URL: "https://a.example", Err: errors.New("connection reset")}},
+		{Index: 4, Err: &BusinessError{Code: "40013"}},
+		{Index: 5, Err: &BatchAbortedError{Err: context.Canceled}},
+	}
+	err := &BatchError{Total: 10, Errors: items}
+	// 类别按数量从多到少、数量相同时按名称排序，最多列出3个
+	if want := "6 of 10 requests failed: status x2, batch_aborted x1, business x1"; err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+	one := &BatchError{Total: 1, Errors: items[3:4]}
+	if want := "1 of 1 requests failed: url x1"; one.Error() != want {
+		t.Fatalf("Error() = %q, want %q", one.Error(), want)
+	}
+}
+
+func TestBatchErrorIsAs(t *testing.T) {
+	errDenied := errors.New("denied")
+	err := fmt.Errorf("batch error:%w", &BatchError{Total: 2, Errors: []*BatchItemError{
+		{Index: 0, URL: "https://a.example", Attempts: 1, Err: &StatusError{StatusCode: 404}},
+		{Index: 1, URL: "https://b.example", Attempts: 2, Err: errDenied},
+	}})
+	if !errors.Is(err, errDenied) || errors.Is(err, context.Canceled) {
+		t.Fatal("errors.Is should check every item")
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 404 {
+		t.Fatalf("errors.As = %v, want the 404 item", statusErr)
+	}
+	var item *BatchItemError
+	if !errors.As(err, &item) || item.Index != 0 || item.Error() != "request 0 (https://a.example, 1 attempts) error:unexpected response status code 404" {
+		t.Fatalf("item = %v", item)
+	}
+}
+
+func TestFailureKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: errors.New("plain"), want: "error"},
+		{err: &RetryError{Err: &StatusError{StatusCode: 500}}, want: "status"},
+		{err: &url.Error{Op: "Get", URL: "https://a.example", Err: context.DeadlineExceeded}, want: "timeout"},
+		{err: &url.Error{Op: "Get", URL: "https://a.example", Err: errors.New("reset")}, want: "url"},
+		{err: fmt.Errorf("fetch:%w", &BatchAbortedError{Err: context.Canceled}), want: "batch_aborted"},
+		{err: ErrBatchAborted, want: "batch_aborted"},
+	}
+	for _, tt := range tests {
+		if got := failureKind(tt.err); got != tt.want {
+			t.Fatalf("failureKind(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
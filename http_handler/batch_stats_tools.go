@@ -0,0 +1,113 @@
+package nhr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BatchStats 批量请求的汇总统计
+// 分位数使用排序后的副本按最近秩(nearest-rank)计算，结果是某个请求实际的耗时，内存占用与请求数成正比
+type BatchStats struct {
+	// Count 请求总数，Succeeded、Failed、Aborted 成功、失败和没有发送的请求数，Skipped WithBatchCheckpoint跳过的请求数
+	Count     int
+	Succeeded int
+	Failed    int
+	Aborted   int
+	Skipped   int
+	// StatusCounts 按响应状态码计数，没有收到响应的请求不计入
+	StatusCounts map[int]int
+	// Min、Mean、P50、P95、P99、Max 已发送请求的耗时统计
+	Min  time.Duration
+	Mean time.Duration
+	P50  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+	// Bytes 读取的响应body总字节数(解压之后)
+	Bytes int64
+	// Wall 第一个请求开始到最后一个请求结束的时间，Total 所有请求耗时之和
+	Wall  time.Duration
+	Total time.Duration
+}
+
+// Concurrency 实际达到的平均并发数，即Total/Wall
+func (s *BatchStats) Concurrency() float64 {
+	if s.Wall <= 0 {
+		return 0
+	}
+	return float64(s.Total) / float64(s.Wall)
+}
+
+// Stats 计算批量请求的汇总统计
+func (r BatchResults) Stats() *BatchStats {
+	stats := &BatchStats{Count: len(r), StatusCounts: map[int]int{}}
+	durations := make([]time.Duration, 0, len(r))
+	var first, last time.Time
+	for _, result := range r {
+		switch {
+		case result.Skipped:
+			stats.Skipped++
+			continue
+		case result.Start.IsZero():
+			stats.Aborted++
+			continue
+		case result.Err != nil:
+			stats.Failed++
+		default:
+			stats.Succeeded++
+		}
+		// StatusError时Response也不为nil
+		if result.Response != nil {
+			stats.StatusCounts[result.Response.StatusCode()]++
+			stats.Bytes += int64(len(result.Response.Bytes()))
+		}
+		durations = append(durations, result.Duration)
+		stats.Total += result.Duration
+		end := result.Start.Add(result.Duration)
+		if first.IsZero() || result.Start.Before(first) {
+			first = result.Start
+		}
+		if end.After(last) {
+			last = end
+		}
+	}
+	if len(durations) == 0 {
+		return stats
+	}
+	stats.Wall = last.Sub(first)
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats.Min = durations[0]
+	stats.Max = durations[len(durations)-1]
+	stats.Mean = stats.Total / time.Duration(len(durations))
+	stats.P50 = percentile(durations, 50)
+	stats.P95 = percentile(durations, 95)
+	stats.P99 = percentile(durations, 99)
+	return stats
+}
+
+// percentile 最近秩法计算已排序耗时的第p百分位
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// String 输出一行适合写入日志的统计
+func (s *BatchStats) String() string {
+	statuses := make([]int, 0, len(s.StatusCounts))
+	for status := range s.StatusCounts {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	parts := make([]string, len(statuses))
+	for i, status := range statuses {
+		parts[i] = fmt.Sprintf("%v:%v", status, s.StatusCounts[status])
+	}
+	return fmt.Sprintf("count=%v ok=%v failed=%v aborted=%v skipped=%v status=[%v] min=%v mean=%v p50=%v p95=%v p99=%v max=%v bytes=%v wall=%v total=%v concurrency=%.2f",
+		s.Count, s.Succeeded, s.Failed, s.Aborted, s.Skipped, strings.Join(parts, " "),
+		s.Min, s.Mean, s.P50, s.P95, s.P99, s.Max, s.Bytes, s.Wall, s.Total, s.Concurrency())
+}
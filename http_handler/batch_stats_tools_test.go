@@ -0,0 +1,96 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchResultsStats(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	var results BatchResults
+	// 100个请求，耗时1ms到100ms，每10个请求同时开始
+	for i := 0; i < 100; i++ {
+		result := BatchResult{
+			Index:    i,
+			Start:    start.Add(time.Duration(i/10) * 10 * time.Millisecond),
+			Duration: time.Duration(i+1) * time.Millisecond,
+			Response: &Response{raw: &http.Response{StatusCode: http.StatusOK}, body: []byte("ok")},
+		}
+		if i%25 == 0 {
+			result.Response = &Response{raw: &http.Response{StatusCode: http.StatusBadGateway}}
+			result.Err = &StatusError{StatusCode: http.StatusBadGateway}
+		}
+		results = append(results, result)
+	}
+	results = append(results, BatchResult{Index: 100, Err: ErrBatchAborted})
+
+	stats := results.Stats()
+	if stats.Count != 101 || stats.Succeeded != 96 || stats.Failed != 4 || stats.Aborted != 1 {
+		t.Fatalf("counts = %+v", stats)
+	}
+	if stats.StatusCounts[200] != 96 || stats.StatusCounts[502] != 4 {
+		t.Fatalf("StatusCounts = %v", stats.StatusCounts)
+	}
+	checks := map[string][2]time.Duration{
+		"min":  {stats.Min, time.Millisecond},
+		"p50":  {stats.P50, 50 * time.Millisecond},
+		"p95":  {stats.P95, 95 * time.Millisecond},
+		"p99":  {stats.P99, 99 * time.Millisecond},
+		"max":  {stats.Max, 100 * time.Millisecond},
+		"mean": {stats.Mean, 50500 * time.Microsecond},
+		// 最后一批在90ms开始，最长的请求耗时100ms
+		"wall": {stats.Wall, 190 * time.Millisecond},
+	}
+	for name, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%v = %v, want %v", name, c[0], c[1])
+		}
+	}
+	if stats.Bytes != 96*2 {
+		t.Errorf("Bytes = %v, want %v", stats.Bytes, 96*2)
+	}
+	if c := stats.Concurrency(); c < 26 || c > 27 {
+		t.Errorf("Concurrency = %v, want about 26.6", c)
+	}
+	line := stats.String()
+	for _, want := range []string{"count=101", "status=[200:96 502:4]", "p99=99ms", "aborted=1"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("String() = %q, missing %q", line, want)
+		}
+	}
+}
+
+func TestBatchResultsStatsEmpty(t *testing.T) {
+	stats := BatchResults{{Err: ErrBatchAborted}}.Stats()
+	if stats.Aborted != 1 || stats.Max != 0 || stats.Concurrency() != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestBatchRecordsTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	requests := make([]BatchRequest, 4)
+	for i := range requests {
+		requests[i] = BatchRequest{Method: http.MethodGet, URL: server.URL}
+	}
+	results, err := Batch(context.Background(), requests, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := results.Stats()
+	if stats.Succeeded != 4 || stats.Bytes != 20 || stats.Min < 20*time.Millisecond {
+		t.Fatalf("stats = %v", stats)
+	}
+	if stats.Concurrency() < 1.5 {
+		t.Fatalf("concurrency = %.2f, want the requests to overlap", stats.Concurrency())
+	}
+}
@@ -0,0 +1,230 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrBatchAborted 请求没有发送，例如fail-fast模式下有请求失败之后、ctx结束或者等待限速时失败，原因见*BatchAbortedError
+var ErrBatchAborted = errors.New("batch aborted after an earlier request failed")
+
+// BatchRequest 批量请求中的一个请求，Options在Client的默认配置之后执行
+type BatchRequest struct {
+	Method  string
+	URL     string
+	Options []Option
+	// Key WithBatchCheckpoint识别请求使用的key，为空时使用下标、method和URL
+	Key string
+}
+
+// BatchResult 单个请求的结果，Index与传入的requests一一对应
+// 状态码不在可以接受的范围时Response和Err(*StatusError)同时不为nil
+type BatchResult struct {
+	Index    int
+	Response *Response
+	Err      error
+	// Start 开始发送的时间，Duration 从发送到读完body的时间(包含重试)，没有发送的请求为零值
+	Start    time.Time
+	Duration time.Duration
+	// Skipped 请求在WithBatchCheckpoint的store中已经完成，这次没有执行，Checkpoint为之前的记录，Response为nil
+	Skipped    bool
+	Checkpoint *CheckpointEntry
+}
+
+// BatchResults Batch返回的结果，可以通过Stats计算汇总的耗时统计
+type BatchResults []BatchResult
+
+// BatchOption 批量请求的配置
+type BatchOption func(*batchConfig)
+
+type batchConfig struct {
+	failFast       bool
+	partialSuccess bool
+	rps            float64
+	burst          int
+	checkpoint     CheckpointStore
+}
+
+// WithBatchFailFast 有请求失败时取消正在进行的请求，尚未开始的请求返回ErrBatchAborted
+// 默认会执行所有请求并收集全部结果
+func WithBatchFailFast() BatchOption {
+	return func(c *batchConfig) {
+		c.failFast = true
+	}
+}
+
+// WithBatchPartialSuccess 至少有一个请求成功时Batch不返回错误，失败的请求仍然可以通过BatchResult.Err查看
+// 全部失败时依然返回*BatchError
+func WithBatchPartialSuccess() BatchOption {
+	return func(c *batchConfig) {
+		c.partialSuccess = true
+	}
+}
+
+// WithBatchRateLimit 按host限制每秒发起的请求数(令牌桶)，burst为允许的突发请求数，小于1时为1
+func WithBatchRateLimit(rps float64, burst int) BatchOption {
+	return func(c *batchConfig) {
+		c.rps = rps
+		c.burst = burst
+	}
+}
+
+// Batch 使用DefaultClient发起批量请求，见Client.Batch
+func Batch(ctx context.Context, requests []BatchRequest, concurrency int, options ...BatchOption) (BatchResults, error) {
+	return DefaultClient.Batch(ctx, requests, concurrency, options...)
+}
+
+// Batch 最多concurrency个并发执行requests，concurrency小于1时为1，返回的结果与requests的顺序相同
+// 响应body会被完整读取，连接可以立即复用；任何请求失败时同时返回*BatchError，见WithBatchPartialSuccess
+func (c *Client) Batch(ctx context.Context, requests []BatchRequest, concurrency int, options ...BatchOption) (BatchResults, error) {
+	config := &batchConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var completed map[string]CheckpointEntry
+	if config.checkpoint != nil {
+		var err error
+		if completed, err = config.checkpoint.Completed(); err != nil {
+			return nil, fmt.Errorf("load batch checkpoint error:%w", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limiter := newHostLimiter(config.rps, config.burst)
+	results := make(BatchResults, len(requests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(requests); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = c.batchOne(ctx, index, requests[index], limiter)
+				if results[index].Err == nil && config.checkpoint != nil {
+					if err := config.checkpoint.Record(checkpointEntry(batchKey(index, requests[index]), results[index].Response)); err != nil {
+						results[index].Err = fmt.Errorf("record batch checkpoint error:%w", err)
+					}
+				}
+				if results[index].Err != nil && config.failFast {
+					cancel()
+				}
+			}
+		}()
+	}
+	for index, request := range requests {
+		if entry, ok := completed[batchKey(index, request)]; ok {
+			results[index] = BatchResult{Index: index, Skipped: true, Checkpoint: &entry}
+			continue
+		}
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	var errs []*BatchItemError
+	for index, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		errs = append(errs, &BatchItemError{Index: index, URL: redactSecrets(requests[index].URL), Attempts: attemptsOf(result.Err), Err: result.Err})
+	}
+	if len(errs) == 0 || config.partialSuccess && len(errs) < len(requests) {
+		return results, nil
+	}
+	return results, &BatchError{Total: len(requests), Errors: errs}
+}
+
+// attemptsOf 失败的请求实际尝试的次数，没有发出时为0
+func attemptsOf(err error) int {
+	var retryErr *RetryError
+	switch {
+	case errors.Is(err, ErrBatchAborted):
+		return 0
+	case errors.As(err, &retryErr):
+		return retryErr.Attempts
+	}
+	return 1
+}
+
+// batchOne 执行一个请求，ctx已经取消时不再发送
+func (c *Client) batchOne(ctx context.Context, index int, request BatchRequest, limiter *hostLimiter) BatchResult {
+	result := BatchResult{Index: index}
+	if err := ctx.Err(); err != nil {
+		result.Err = &BatchAbortedError{Err: err}
+		return result
+	}
+	if err := limiter.wait(ctx, request.URL); err != nil {
+		result.Err = &BatchAbortedError{Err: err}
+		return result
+	}
+	// 预算不足时等到窗口结束再发起请求，WithNoRateLimit的请求在中间件中也不会等待
+	if c.costLimiter != nil && !newHttpRequests("", "", request.Options...).NoRateLimit {
+		if err := c.costLimiter.available(ctx, true); err != nil {
+			result.Err = &BatchAbortedError{Err: err}
+			return result
+		}
+	}
+	options := append(append([]Option(nil), request.Options...), WithContext(ctx))
+	result.Start = timeNow()
+	result.Response, result.Err = c.Fetch(request.Method, request.URL, options...)
+	result.Duration = timeNow().Sub(result.Start)
+	return result
+}
+
+// hostLimiter 按host分别计算的令牌桶，rps小于等于0时不限制
+type hostLimiter struct {
+	rps   float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newHostLimiter(rps float64, burst int) *hostLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostLimiter{rps: rps, burst: float64(burst), buckets: map[string]*tokenBucket{}}
+}
+
+// wait 取出一个令牌，没有令牌时等待，ctx结束时返回ctx.Err()
+func (l *hostLimiter) wait(ctx context.Context, rawURL string) error {
+	if l.rps <= 0 {
+		return nil
+	}
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	l.mu.Lock()
+	now := timeNow()
+	bucket, ok := l.buckets[host]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[host] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rps)
+	bucket.last = now
+	// 先预留令牌再等待，令牌数可以为负，之后的请求会按顺序排在后面
+	bucket.tokens--
+	var delay time.Duration
+	if bucket.tokens < 0 {
+		delay = time.Duration(-bucket.tokens / l.rps * float64(time.Second))
+	}
+	l.mu.Unlock()
+	return sleepContext(ctx, delay)
+}
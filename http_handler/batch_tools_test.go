@@ -0,0 +1,125 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statusPathServer 按路径返回状态码，例如/404返回404，其他路径返回200
+func statusPathServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status int
+		if _, err := fmt.Sscanf(r.URL.Path, "/%d", &status); err == nil {
+			w.WriteHeader(status)
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBatchCollectsResultsInOrder(t *testing.T) {
+	server := statusPathServer(t)
+	var requests []BatchRequest
+	for _, path := range []string{"/a", "/404", "/b", "/503", "/c", "/404"} {
+		requests = append(requests, BatchRequest{Method: http.MethodGet, URL: server.URL + path})
+	}
+	results, err := Batch(context.Background(), requests, 3)
+	for i, result := range results {
+		if result.Index != i || result.Response == nil || result.Response.String() != strings.TrimPrefix(requests[i].URL, server.URL) {
+			t.Fatalf("result %v = %+v, want the response for %v", i, result, requests[i].URL)
+		}
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Total != 6 || len(batchErr.Errors) != 3 {
+		t.Fatalf("error = %v, want *BatchError with 3 of 6 failed", err)
+	}
+	for i, index := range []int{1, 3, 5} {
+		if item := batchErr.Errors[i]; item.Index != index || item.Attempts != 1 || item.URL != requests[index].URL {
+			t.Fatalf("error %v = %+v, want request %v", i, item, index)
+		}
+	}
+	if want := "3 of 6 requests failed: status x3"; err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("errors.As(*StatusError) = %v, want the first failure", statusErr)
+	}
+}
+
+func TestBatchPartialSuccess(t *testing.T) {
+	server := statusPathServer(t)
+	requests := []BatchRequest{
+		{Method: http.MethodGet, URL: server.URL + "/ok"},
+		{Method: http.MethodGet, URL: server.URL + "/500"},
+	}
+	results, err := Batch(context.Background(), requests, 2, WithBatchPartialSuccess())
+	if err != nil {
+		t.Fatalf("error = %v, want nil when some requests succeeded", err)
+	}
+	if results[1].Err == nil {
+		t.Fatal("the failed request should still report its error")
+	}
+
+	_, err = Batch(context.Background(), requests[1:], 1, WithBatchPartialSuccess())
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 {
+		t.Fatalf("error = %v, want *BatchError when every request failed", err)
+	}
+}
+
+func TestBatchAbortedWrapsCause(t *testing.T) {
+	server := statusPathServer(t)
+	requests := []BatchRequest{
+		{Method: http.MethodGet, URL: server.URL + "/503"},
+		{Method: http.MethodGet, URL: server.URL + "/a"},
+		{Method: http.MethodGet, URL: server.URL + "/b"},
+	}
+	deadline, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		options []BatchOption
+		first   int
+		cause   error
+	}{
+		{name: "fail fast", ctx: context.Background(), options: []BatchOption{WithBatchFailFast()}, first: 1, cause: context.Canceled},
+		{name: "canceled ctx", ctx: canceled, first: 0, cause: context.Canceled},
+		// 每秒一个请求，第二个请求等待令牌时超过截止时间
+		{name: "rate limit wait", ctx: deadline, options: []BatchOption{WithBatchRateLimit(1, 1)}, first: 1, cause: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Batch(tt.ctx, requests, 1, tt.options...)
+			for _, result := range results[tt.first:] {
+				var aborted *BatchAbortedError
+				if !errors.Is(result.Err, ErrBatchAborted) || !errors.Is(result.Err, tt.cause) || !errors.As(result.Err, &aborted) {
+					t.Fatalf("result %v error = %v, want ErrBatchAborted caused by %v", result.Index, result.Err, tt.cause)
+				}
+			}
+			var batchErr *BatchError
+			if !errors.As(err, &batchErr) {
+				t.Fatalf("error = %v", err)
+			}
+			for _, item := range batchErr.Errors {
+				if item.Index >= tt.first && item.Attempts != 0 {
+					t.Fatalf("item %v reports %v attempts, want 0 for a request that was not sent", item.Index, item.Attempts)
+				}
+			}
+			if !strings.Contains(err.Error(), "batch_aborted") {
+				t.Fatalf("Error() = %q, want aborted requests summarized", err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package nhr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ErrBodyOnSafeMethod GET/HEAD请求携带了body，服务端通常会忽略
+var ErrBodyOnSafeMethod = errors.New("request body on GET/HEAD request")
+
+// WithStrictBodySemantics GET/HEAD请求携带body时直接返回ErrBodyOnSafeMethod，默认只打印告警
+func WithStrictBodySemantics() Option {
+	return func(req *HttpRequests) {
+		req.StrictBodySemantics = true
+	}
+}
+
+// WithAllowGetBody 明确允许GET/HEAD请求携带body，不再检查
+func WithAllowGetBody() Option {
+	return func(req *HttpRequests) {
+		req.AllowGetBody = true
+	}
+}
+
+// WithBodyAsQuery GET/HEAD请求时，把WithPostJsonBody设置的JSON对象编码为查询参数，不发送body
+// 字符串原样使用，数组展开为多个同名参数，其他值使用JSON文本
+func WithBodyAsQuery() Option {
+	return func(req *HttpRequests) {
+		req.BodyAsQuery = true
+	}
+}
+
+// isSafeBodyMethod 是否是不应该携带body的method
+func isSafeBodyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// applyBodySemantics 检查GET/HEAD请求上的body，返回body转成的查询参数以及实际发送的body
+// 不修改requestIns，重试时每次尝试得到相同的结果
+func applyBodySemantics(ctx context.Context, requestIns *HttpRequests) (query, body string, err error) {
+	if requestIns.PostBody == "" || !isSafeBodyMethod(requestIns.Method) || requestIns.AllowGetBody {
+		return "", requestIns.PostBody, nil
+	}
+	if requestIns.BodyAsQuery {
+		query, err := bodyToQuery(requestIns.PostBody)
+		if err != nil {
+			return "", "", fmt.Errorf("encode body as query error:%w", err)
+		}
+		return query, "", nil
+	}
+	if requestIns.StrictBodySemantics {
+		return "", "", fmt.Errorf("create request error:%w", ErrBodyOnSafeMethod)
+	}
+	requestIns.warnOnce(ctx, "body-on-safe-method", "request body is usually ignored by servers, use WithBodyAsQuery or WithAllowGetBody")
+	return "", requestIns.PostBody, nil
+}
+
+// bodyToQuery 把JSON对象编码为查询参数，key按字典序排列
+func bodyToQuery(body string) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := FastJsonUnMarshal([]byte(body), &fields); err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := url.Values{}
+	for _, key := range keys {
+		raw := fields[key]
+		var items []json.RawMessage
+		if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") && FastJsonUnMarshal(raw, &items) == nil {
+			for _, item := range items {
+				values.Add(key, rawJSONText(item))
+			}
+			continue
+		}
+		values.Add(key, rawJSONText(raw))
+	}
+	return values.Encode(), nil
+}
@@ -0,0 +1,111 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// entryRecorder 记录Logger收到的全部告警
+type entryRecorder struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+func (e *entryRecorder) LogRequest(_ context.Context, entry *LogEntry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if entry.Warning != "" {
+		e.entries = append(e.entries, *entry)
+	}
+}
+
+func (e *entryRecorder) list() []LogEntry {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]LogEntry(nil), e.entries...)
+}
+
+func TestBodyOnGetWarnsOncePerRequest(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	recorder := &entryRecorder{}
+	response, err := Get(server.URL+"/search?token=secret-value",
+		WithPostJsonBody(map[string]interface{}{"q": "x"}),
+		WithRetry(3, 0), WithBackoff(noWait), WithLogger(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if atomic.LoadInt32(&attempts) != 3 {
+		t.Fatalf("attempts = %v, want 3", attempts)
+	}
+	entries := recorder.list()
+	if len(entries) != 1 {
+		t.Fatalf("warnings = %+v, want exactly one for the request", entries)
+	}
+	if entries[0].Method != http.MethodGet || strings.Contains(entries[0].URL, "secret-value") {
+		t.Fatalf("warning entry = %+v, want a GET with the token redacted", entries[0])
+	}
+}
+
+func TestBodyOnGetOptions(t *testing.T) {
+	var query, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+	data := map[string]interface{}{"q": "x", "page": 2}
+
+	response, err := Get(server.URL, WithPostJsonBody(data), WithBodyAsQuery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if query != "page=2&q=x" || body != "" {
+		t.Fatalf("WithBodyAsQuery sent query %q body %q", query, body)
+	}
+
+	recorder := &entryRecorder{}
+	response, err = Get(server.URL, WithPostJsonBody(data), WithAllowGetBody(), WithLogger(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if body == "" || len(recorder.list()) != 0 {
+		t.Fatalf("WithAllowGetBody sent body %q with warnings %+v", body, recorder.list())
+	}
+
+	_, err = Get(server.URL, WithPostJsonBody(data), WithStrictBodySemantics())
+	if !errors.Is(err, ErrBodyOnSafeMethod) {
+		t.Fatalf("error = %v, want ErrBodyOnSafeMethod", err)
+	}
+}
+
+func TestPackageLoggerReceivesWarnings(t *testing.T) {
+	recorder := &entryRecorder{}
+	SetLogger(recorder)
+	defer SetLogger(nil)
+
+	if got := MontageUrl("api.example.com", "example.com/path?token=secret-value"); got != "" {
+		t.Fatalf("MontageUrl = %q, want empty string", got)
+	}
+	entries := recorder.list()
+	if len(entries) != 1 || !strings.HasPrefix(entries[0].Warning, "MontageUrl:") || strings.Contains(entries[0].Warning, "secret-value") {
+		t.Fatalf("warnings = %+v, want one redacted MontageUrl warning", entries)
+	}
+}
@@ -0,0 +1,50 @@
+package nhr
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBodyIdleTimeout 读取响应body时，服务端超过空闲超时时间没有发送任何数据
+var ErrBodyIdleTimeout error = &kindError{kind: "body_idle_timeout", message: "response body idle timeout"}
+
+// idleTimeoutBody 带看门狗的响应body，每次成功读取到数据后重置计时
+// 超过空闲时间没有读到数据时关闭底层body，使阻塞中的Read立即返回
+type idleTimeoutBody struct {
+	body     io.ReadCloser
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut int32
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration) *idleTimeoutBody {
+	b := &idleTimeoutBody{body: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, b.expire)
+	return b
+}
+
+func (b *idleTimeoutBody) expire() {
+	atomic.StoreInt32(&b.timedOut, 1)
+	_ = b.body.Close()
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if atomic.LoadInt32(&b.timedOut) == 1 {
+		return n, ErrBodyIdleTimeout
+	}
+	if err != nil {
+		b.timer.Stop()
+		return n, err
+	}
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, nil
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
@@ -0,0 +1,97 @@
+package nhr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stallingServer 先发送first，停顿stall之后再发送second
+func stallingServer(t *testing.T, first, second []byte, stall time.Duration, header http.Header) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.Write(first)
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(stall):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write(second)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIdleReadTimeoutCutsOffStalledBody(t *testing.T) {
+	server := stallingServer(t, []byte("first"), []byte("second"), time.Second, nil)
+
+	response, err := Get(server.URL, WithTimeout(0), WithIdleReadTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if !errors.Is(err, ErrBodyIdleTimeout) {
+		t.Fatalf("read error = %v, want ErrBodyIdleTimeout", err)
+	}
+	if string(body) != "first" {
+		t.Fatalf("body = %q, want the chunk sent before the stall", body)
+	}
+}
+
+func TestIdleReadTimeoutResetByEachRead(t *testing.T) {
+	// 停顿短于空闲超时，整个body的读取时间长于空闲超时
+	server := stallingServer(t, []byte("first"), []byte("second"), 150*time.Millisecond, nil)
+
+	response, err := Get(server.URL, WithTimeout(0), WithIdleReadTimeout(300*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	time.Sleep(200 * time.Millisecond)
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if string(body) != "firstsecond" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestIdleReadTimeoutWithDecompression(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte("hello"))
+	writer.Flush()
+	first := append([]byte(nil), compressed.Bytes()...)
+	writer.Close()
+	server := stallingServer(t, first, compressed.Bytes()[len(first):], time.Second, http.Header{"Content-Encoding": {"gzip"}})
+
+	response, err := Get(server.URL, WithTimeout(0), WithAcceptEncoding("gzip"), WithIdleReadTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if !errors.Is(err, ErrBodyIdleTimeout) {
+		t.Fatalf("read error = %v, want ErrBodyIdleTimeout", err)
+	}
+	if string(body) != "hello" {
+		t.Fatalf("body = %q, want the decompressed first chunk", body)
+	}
+}
+
+func TestIdleReadTimeoutDisabledByDefault(t *testing.T) {
+	requestIns := newHttpRequests(http.MethodGet, "http://example.com")
+	if requestIns.IdleReadTimeout != 0 {
+		t.Fatalf("IdleReadTimeout = %v, want 0", requestIns.IdleReadTimeout)
+	}
+}
@@ -0,0 +1,50 @@
+package nhr
+
+import (
+	"context"
+	"strings"
+)
+
+// 被单次请求跳过的功能，见RequestMetrics.Bypass
+const (
+	BypassRetry     = "retry"
+	BypassRateLimit = "rate_limit"
+)
+
+// WithNoRetry 本次请求不重试，覆盖Client默认配置中的WithRetry、WithRetryPolicy，例如不应该重试的健康检查
+// 单次请求的option在默认配置之后执行，所以总是优先于Client的配置
+func WithNoRetry() Option {
+	return func(req *HttpRequests) {
+		req.NoRetry = true
+	}
+}
+
+// WithNoRateLimit 本次请求不等待WithAdaptiveRateLimit的配额，响应中的配额信息照常记录
+func WithNoRateLimit() Option {
+	return func(req *HttpRequests) {
+		req.NoRateLimit = true
+	}
+}
+
+type bypassContextKey struct{}
+
+// contextWithBypass 将跳过的功能存入context，供监控打上标签
+func contextWithBypass(ctx context.Context, requestIns *HttpRequests) context.Context {
+	var bypass []string
+	if requestIns.NoRetry {
+		bypass = append(bypass, BypassRetry)
+	}
+	if requestIns.NoRateLimit {
+		bypass = append(bypass, BypassRateLimit)
+	}
+	if len(bypass) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, bypassContextKey{}, strings.Join(bypass, ","))
+}
+
+// bypassOf 返回请求跳过的功能，以,分隔，没有时为空字符串
+func bypassOf(ctx context.Context) string {
+	bypass, _ := ctx.Value(bypassContextKey{}).(string)
+	return bypass
+}
@@ -0,0 +1,76 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithNoRetryOverridesClientRetry(t *testing.T) {
+	server, hits := countingServer(t, http.StatusServiceUnavailable)
+	recorder := &metricsRecorder{}
+	client, err := NewClient(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: noWait}), WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	response, err := client.Get(server.URL, WithNoRetry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Fatalf("server received %v requests, want 1 with WithNoRetry", n)
+	}
+	response, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if n := atomic.LoadInt32(hits); n != 4 {
+		t.Fatalf("server received %v requests, want the Client retry policy to apply again", n)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.metrics) != 4 || recorder.metrics[0].Bypass != BypassRetry || recorder.metrics[1].Bypass != "" {
+		t.Fatalf("metrics = %+v, want only the first attempt labeled %q", recorder.metrics, BypassRetry)
+	}
+}
+
+func TestWithNoRateLimitOverridesClientLimiter(t *testing.T) {
+	server, hits := quotaServer(t, 0, 60)
+	recorder := &metricsRecorder{}
+	client, err := NewClient(WithAdaptiveRateLimit(GitHubRateLimitHeaders), WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	// 配额已用完，Client的请求等不到重置
+	_, err = client.Get(server.URL, WithOverallTimeout(50*time.Millisecond))
+	if !errors.Is(err, ErrRateLimitExhausted) {
+		t.Fatalf("error = %v, want ErrRateLimitExhausted", err)
+	}
+	response, err = client.Get(server.URL, WithNoRateLimit(), WithOverallTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Fatalf("server received %v requests, want 2", n)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if last := recorder.metrics[len(recorder.metrics)-1]; last.Bypass != BypassRateLimit {
+		t.Fatalf("last metrics = %+v, want Bypass %q", last, BypassRateLimit)
+	}
+}
@@ -0,0 +1,203 @@
+package nhr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ChainAssert 检查一个步骤的响应，返回非nil时Chain停止执行
+type ChainAssert func(response *http.Response, body []byte) error
+
+// chainStep Chain中的一个步骤
+type chainStep struct {
+	name     string
+	method   string
+	url      string
+	options  []Option
+	extracts [][2]string
+	asserts  []ChainAssert
+}
+
+// Chain 按顺序执行的一组请求，前面步骤的响应中提取的值可以用{name}的形式用在后面步骤的URL、请求头和body中
+// 每个步骤的超时等配置通过Step的options设置
+type Chain struct {
+	baseURL string
+	steps   []*chainStep
+}
+
+// ChainStepResult 一个步骤的执行结果，Response.Body已被读取，可以通过Body获取内容
+type ChainStepResult struct {
+	Name     string
+	Response *http.Response
+	Body     []byte
+}
+
+// ChainError Chain中某个步骤失败时返回，Step为失败步骤的名称
+type ChainError struct {
+	Step  string
+	Index int
+	Err   error
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("chain step %v (%q) failed:%v", e.Index, e.Step, e.Err)
+}
+
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
+
+// NewChain 创建一个空的Chain
+func NewChain() *Chain {
+	return &Chain{}
+}
+
+// BaseURL 设置相对URL步骤使用的base，按照ResolveURL的规则拼接
+func (c *Chain) BaseURL(base string) *Chain {
+	c.baseURL = base
+	return c
+}
+
+// Step 添加一个步骤，urlTemplate中的{name}会被替换为已提取的值并进行path转义
+func (c *Chain) Step(name, method, urlTemplate string, options ...Option) *Chain {
+	c.steps = append(c.steps, &chainStep{name: name, method: method, url: urlTemplate, options: options})
+	return c
+}
+
+// Extract 从最近添加的步骤的JSON响应中按路径提取值，保存为name，路径用.分隔，数组使用下标，如data.items.0.id
+func (c *Chain) Extract(name, path string) *Chain {
+	if step := c.lastStep(); step != nil {
+		step.extracts = append(step.extracts, [2]string{name, path})
+	}
+	return c
+}
+
+// Assert 为最近添加的步骤增加响应检查
+func (c *Chain) Assert(assert ChainAssert) *Chain {
+	if step := c.lastStep(); step != nil {
+		step.asserts = append(step.asserts, assert)
+	}
+	return c
+}
+
+func (c *Chain) lastStep() *chainStep {
+	if len(c.steps) == 0 {
+		return nil
+	}
+	return c.steps[len(c.steps)-1]
+}
+
+// Run 按顺序执行所有步骤，非2xx响应、提取失败或检查失败时停止，返回已执行步骤的结果和*ChainError
+func (c *Chain) Run(ctx context.Context) ([]*ChainStepResult, error) {
+	vars := map[string]string{}
+	results := make([]*ChainStepResult, 0, len(c.steps))
+	for i, step := range c.steps {
+		result, err := c.runStep(ctx, step, vars)
+		if result != nil {
+			results = append(results, result)
+		}
+		if err != nil {
+			return results, &ChainError{Step: step.name, Index: i, Err: err}
+		}
+	}
+	return results, nil
+}
+
+func (c *Chain) runStep(ctx context.Context, step *chainStep, vars map[string]string) (*ChainStepResult, error) {
+	requestURL, err := expandPathTemplate(step.url, vars)
+	if err != nil {
+		return nil, err
+	}
+	if c.baseURL != "" {
+		if requestURL, err = ResolveURL(c.baseURL, requestURL); err != nil {
+			return nil, err
+		}
+	}
+	requestIns := newLayeredRequest(step.method, requestURL, nil, []configLayer{{source: ConfigSourceRequest, options: step.options}})
+	if len(vars) > 0 {
+		replacer := chainReplacer(vars)
+		for key, value := range requestIns.Headers {
+			requestIns.Headers[key] = replacer.Replace(value)
+			if requestIns.configTrace != nil {
+				requestIns.configTrace.record(ConfigKindHeader, key, ConfigSourceTemplate, requestIns.Headers[key])
+			}
+		}
+		requestIns.PostBody = replacer.Replace(requestIns.PostBody)
+	}
+
+	response, err := doRequest(ctx, requestIns)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read from response.Body failed:%w", err)
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	result := &ChainStepResult{Name: step.name, Response: response, Body: body}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return result, fmt.Errorf("request status code not 2xx，actually status code is %v", response.StatusCode)
+	}
+	for _, extract := range step.extracts {
+		value, err := extractJSONPath(body, extract[1])
+		if err != nil {
+			return result, fmt.Errorf("extract %v error:%w", extract[0], err)
+		}
+		vars[extract[0]] = value
+	}
+	for _, assert := range step.asserts {
+		if err := assert(response, body); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// chainReplacer 把请求头和body中的{name}替换为提取的值，不认识的{...}保持原样
+func chainReplacer(vars map[string]string) *strings.Replacer {
+	pairs := make([]string, 0, 2*len(vars))
+	for name, value := range vars {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// extractJSONPath 按.分隔的路径从JSON中取值，字符串返回其内容，其他值返回JSON文本
+func extractJSONPath(body []byte, path string) (string, error) {
+	raw := json.RawMessage(body)
+	for _, part := range strings.Split(path, ".") {
+		trimmed := bytes.TrimSpace(raw)
+		if len(trimmed) > 0 && trimmed[0] == '[' {
+			index, err := strconv.Atoi(part)
+			if err != nil {
+				return "", fmt.Errorf("path %q: %q is not an array index", path, part)
+			}
+			var items []json.RawMessage
+			if err := FastJsonUnMarshal(raw, &items); err != nil {
+				return "", fmt.Errorf("path %q: %v", path, err)
+			}
+			if index < 0 || index >= len(items) {
+				return "", fmt.Errorf("path %q: index %v out of range", path, index)
+			}
+			raw = items[index]
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := FastJsonUnMarshal(raw, &fields); err != nil {
+			return "", fmt.Errorf("path %q: %v", path, err)
+		}
+		value, ok := fields[part]
+		if !ok {
+			return "", fmt.Errorf("path %q: field %q is missing", path, part)
+		}
+		raw = value
+	}
+	return rawJSONText(raw), nil
+}
@@ -0,0 +1,143 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// chainServer /login返回token和订单列表，/orders/下的请求需要带上token，返回收到的path和body
+func chainServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			w.Write([]byte(`{"data":{"token":"t1","items":[{"id":"a b","count":3}]}}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.URL.EscapedPath() + " " + string(body)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestChainRun(t *testing.T) {
+	server := chainServer(t)
+	results, err := NewChain().BaseURL(server.URL).
+		Step("login", http.MethodPost, "/login").
+		Extract("token", "data.token").
+		Extract("id", "data.items.0.id").
+		Extract("count", "data.items.0.count").
+		Step("order", http.MethodPost, "/orders/{id}",
+			WithHeader("Authorization", "Bearer {token}"),
+			WithPostStringBody(`{"count":{count},"other":"{unknown}"}`)).
+		Assert(func(response *http.Response, body []byte) error {
+			if !strings.HasPrefix(string(body), "/orders/") {
+				return errors.New("unexpected body")
+			}
+			return nil
+		}).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Name != "login" || results[1].Name != "order" {
+		t.Fatalf("results = %+v", results)
+	}
+	if got := string(results[1].Body); got != `/orders/a%20b {"count":3,"other":"{unknown}"}` {
+		t.Fatalf("body = %q, want the extracted values substituted", got)
+	}
+	// Body已被读取，Response.Body可以再次读取
+	if body, _ := io.ReadAll(results[1].Response.Body); string(body) != string(results[1].Body) {
+		t.Fatalf("Response.Body = %q", body)
+	}
+}
+
+func TestChainStops(t *testing.T) {
+	server := chainServer(t)
+	errAssert := errors.New("assert failed")
+	tests := []struct {
+		name    string
+		chain   *Chain
+		index   int
+		results int
+		want    string
+	}{
+		{
+			name:    "status",
+			chain:   NewChain().Step("orders", http.MethodGet, "/orders/1").Step("never", http.MethodGet, "/never"),
+			results: 1,
+			want:    "status code not 2xx",
+		},
+		{
+			name:    "extract",
+			chain:   NewChain().Step("login", http.MethodPost, "/login").Extract("id", "data.items.5.id"),
+			results: 1,
+			want:    "index 5 out of range",
+		},
+		{
+			name: "assert",
+			chain: NewChain().Step("login", http.MethodPost, "/login").
+				Step("check", http.MethodPost, "/login").Assert(func(*http.Response, []byte) error { return errAssert }),
+			index:   1,
+			results: 2,
+			want:    "assert failed",
+		},
+		{
+			name:    "missing var",
+			chain:   NewChain().Step("order", http.MethodGet, "/orders/{id}"),
+			results: 0,
+			want:    "missing value for path variable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := tt.chain.BaseURL(server.URL).Run(context.Background())
+			var chainErr *ChainError
+			if !errors.As(err, &chainErr) || chainErr.Index != tt.index || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want step %v to fail with %q", err, tt.index, tt.want)
+			}
+			if len(results) != tt.results {
+				t.Fatalf("%v results, want %v", len(results), tt.results)
+			}
+		})
+	}
+}
+
+func TestExtractJSONPath(t *testing.T) {
+	body := []byte(`{"data":{"id":7,"name":"n","tags":["a","b"],"meta":{"ok":true},"none":null}}`)
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "data.id", want: "7"},
+		{path: "data.name", want: "n"},
+		{path: "data.tags.1", want: "b"},
+		{path: "data.meta", want: `{"ok":true}`},
+		{path: "data.none", want: ""},
+		{path: "data.missing", wantErr: `field "missing" is missing`},
+		{path: "data.tags.x", wantErr: "is not an array index"},
+		{path: "data.tags.2", wantErr: "out of range"},
+		{path: "data.id.value", wantErr: `path "data.id.value"`},
+	}
+	for _, tt := range tests {
+		got, err := extractJSONPath(body, tt.path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("extractJSONPath(%q) = %q, %v, want %q", tt.path, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("extractJSONPath(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package nhr
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// ErrCheckpointConflict 断点文件被其他写入者修改，例如两个进程同时使用了同一个文件
+var ErrCheckpointConflict = errors.New("checkpoint file was modified by another writer")
+
+// CheckpointEntry 一个已经完成的请求，Digest为响应body的sha256
+type CheckpointEntry struct {
+	Key    string `json:"key"`
+	Status int    `json:"status"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// CheckpointStore 记录批量请求中已经完成的请求，用于中断之后继续执行
+// 同一个store同时只能被一个Batch使用，Record会被多个goroutine同时调用
+type CheckpointStore interface {
+	// Completed 返回之前已经完成的请求，key为CheckpointEntry.Key
+	Completed() (map[string]CheckpointEntry, error)
+	// Record 记录一个完成的请求
+	Record(entry CheckpointEntry) error
+}
+
+// WithBatchCheckpoint 请求成功之后记录到store，store中已经完成的请求不再执行，BatchResult.Skipped为true
+// 请求通过BatchRequest.Key识别，为空时使用下标、method和URL，重新执行时requests的顺序需要相同
+// 读取store失败时Batch不发送任何请求，记录失败时该请求的Err为记录的错误
+func WithBatchCheckpoint(store CheckpointStore) BatchOption {
+	return func(c *batchConfig) {
+		c.checkpoint = store
+	}
+}
+
+// batchKey 请求在断点中的key
+func batchKey(index int, request BatchRequest) string {
+	if request.Key != "" {
+		return request.Key
+	}
+	return strconv.Itoa(index) + " " + request.Method + " " + request.URL
+}
+
+// checkpointEntry 根据请求的结果生成断点记录
+func checkpointEntry(key string, response *Response) CheckpointEntry {
+	entry := CheckpointEntry{Key: key}
+	if response != nil {
+		sum := sha256.Sum256(response.Bytes())
+		entry.Status = response.StatusCode()
+		entry.Digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return entry
+}
+
+// FileCheckpointStore 基于文件的CheckpointStore，第一行记录批量的id，之后每行一个JSON格式的CheckpointEntry
+// 文件通过临时文件原子地创建，每条记录通过一次write追加，进程崩溃时最多丢失最后一条不完整的记录
+// 同一个进程内可以并发写入；每条记录带有递增的序号，写入之前检查文件大小，发现其他写入者时返回ErrCheckpointConflict
+type FileCheckpointStore struct {
+	path   string
+	writer string
+
+	mu        sync.Mutex
+	file      *os.File
+	size      int64
+	seq       int64
+	completed map[string]CheckpointEntry
+}
+
+// checkpointHeader 断点文件的第一行
+type checkpointHeader struct {
+	Version int    `json:"version"`
+	Batch   string `json:"batch"`
+}
+
+// checkpointLine 断点文件中的一条记录
+type checkpointLine struct {
+	Seq    int64  `json:"seq"`
+	Writer string `json:"writer"`
+	CheckpointEntry
+}
+
+// NewFileCheckpointStore 打开path处的断点文件，文件不存在时创建
+// 文件中记录的批量id与batchID不同时返回错误，避免误用其他批量的断点
+func NewFileCheckpointStore(path, batchID string) (*FileCheckpointStore, error) {
+	if err := createCheckpointFile(path, batchID); err != nil {
+		return nil, err
+	}
+	writer := make([]byte, 8)
+	if _, err := rand.Read(writer); err != nil {
+		return nil, fmt.Errorf("checkpoint writer id error:%w", err)
+	}
+	store := &FileCheckpointStore{path: path, writer: hex.EncodeToString(writer), completed: map[string]CheckpointEntry{}}
+	if err := store.load(batchID); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open checkpoint error:%w", err)
+	}
+	store.file = file
+	return store, nil
+}
+
+// createCheckpointFile 通过临时文件和硬链接原子地创建断点文件，已经存在时不覆盖
+func createCheckpointFile(path, batchID string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	header, err := json.Marshal(checkpointHeader{Version: 1, Batch: batchID})
+	if err != nil {
+		return fmt.Errorf("create checkpoint error:%w", err)
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("create checkpoint error:%w", err)
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(append(header, '\n'))
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("create checkpoint error:%w", err)
+	}
+	// 其他写入者同时创建了文件时使用它的文件
+	if err := os.Link(temp.Name(), path); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("create checkpoint error:%w", err)
+	}
+	return nil
+}
+
+// load 读取已经完成的请求，去掉末尾不完整的记录，序号不连续时说明有其他写入者
+func (s *FileCheckpointStore) load(batchID string) error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("read checkpoint error:%w", err)
+	}
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	scanner := bufio.NewScanner(bytes.NewReader(data[:complete]))
+	scanner.Buffer(nil, 1<<20)
+	if !scanner.Scan() {
+		return fmt.Errorf("read checkpoint %v error:missing header", s.path)
+	}
+	var header checkpointHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return fmt.Errorf("read checkpoint %v header error:%w", s.path, err)
+	}
+	if header.Batch != batchID {
+		return fmt.Errorf("read checkpoint %v error:written for batch %q, not %q", s.path, header.Batch, batchID)
+	}
+	for scanner.Scan() {
+		var line checkpointLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("read checkpoint %v line %v error:%w", s.path, s.seq+2, err)
+		}
+		if line.Seq != s.seq+1 {
+			return fmt.Errorf("read checkpoint %v error:%w: record %v follows %v", s.path, ErrCheckpointConflict, line.Seq, s.seq)
+		}
+		s.seq = line.Seq
+		s.completed[line.Key] = line.CheckpointEntry
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read checkpoint %v error:%w", s.path, err)
+	}
+	if complete < len(data) {
+		if err := os.Truncate(s.path, int64(complete)); err != nil {
+			return fmt.Errorf("truncate checkpoint error:%w", err)
+		}
+	}
+	s.size = int64(complete)
+	return nil
+}
+
+// Completed 实现CheckpointStore
+func (s *FileCheckpointStore) Completed() (map[string]CheckpointEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	completed := make(map[string]CheckpointEntry, len(s.completed))
+	for key, entry := range s.completed {
+		completed[key] = entry
+	}
+	return completed, nil
+}
+
+// Record 实现CheckpointStore，文件大小与上一次写入之后不同时返回ErrCheckpointConflict
+func (s *FileCheckpointStore) Record(entry CheckpointEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("record checkpoint error:%w", os.ErrClosed)
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("record checkpoint error:%w", err)
+	}
+	if info.Size() != s.size {
+		return fmt.Errorf("record checkpoint %v error:%w: size %v, want %v", s.path, ErrCheckpointConflict, info.Size(), s.size)
+	}
+	line, err := json.Marshal(checkpointLine{Seq: s.seq + 1, Writer: s.writer, CheckpointEntry: entry})
+	if err != nil {
+		return fmt.Errorf("record checkpoint error:%w", err)
+	}
+	n, err := s.file.Write(append(line, '\n'))
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("record checkpoint error:%w", err)
+	}
+	s.seq++
+	s.completed[entry.Key] = entry
+	return nil
+}
+
+// Close 关闭断点文件，之后Record返回错误
+func (s *FileCheckpointStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
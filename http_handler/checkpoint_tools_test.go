@@ -0,0 +1,203 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// pathHitServer 按路径计数，/503返回503，其他路径返回200
+func pathHitServer(t *testing.T) (*httptest.Server, func(path string) int) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/503" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	t.Cleanup(server.Close)
+	return server, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[path]
+	}
+}
+
+func openCheckpoint(t *testing.T, path, batchID string) *FileCheckpointStore {
+	store, err := NewFileCheckpointStore(path, batchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBatchCheckpointResume(t *testing.T) {
+	server, hits := pathHitServer(t)
+	var requests []BatchRequest
+	for _, path := range []string{"/a", "/503", "/b"} {
+		requests = append(requests, BatchRequest{Method: http.MethodGet, URL: server.URL + path})
+	}
+	path := filepath.Join(t.TempDir(), "nightly.checkpoint")
+
+	store := openCheckpoint(t, path, "nightly")
+	if _, err := Batch(context.Background(), requests, 2, WithBatchCheckpoint(store)); err == nil {
+		t.Fatal("the first run should fail on /503")
+	}
+	store.Close()
+
+	store = openCheckpoint(t, path, "nightly")
+	results, err := Batch(context.Background(), requests, 2, WithBatchCheckpoint(store))
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 || batchErr.Errors[0].Index != 1 {
+		t.Fatalf("error = %v, want only /503 to fail again", err)
+	}
+	for _, index := range []int{0, 2} {
+		result := results[index]
+		if !result.Skipped || result.Response != nil || result.Checkpoint == nil || result.Checkpoint.Status != http.StatusOK || !strings.HasPrefix(result.Checkpoint.Digest, "sha256:") {
+			t.Fatalf("result %v = %+v, want it skipped via the checkpoint", index, result)
+		}
+	}
+	if results[1].Skipped || results[1].Response == nil {
+		t.Fatalf("result 1 = %+v, want the failed request executed again", results[1])
+	}
+	for path, want := range map[string]int{"/a": 1, "/b": 1, "/503": 2} {
+		if got := hits(path); got != want {
+			t.Fatalf("%v received %v requests, want %v", path, got, want)
+		}
+	}
+	if stats := results.Stats(); stats.Skipped != 2 || stats.Failed != 1 || stats.Aborted != 0 {
+		t.Fatalf("stats = %v, want 2 skipped and 1 failed", stats)
+	}
+}
+
+func TestBatchCheckpointUsesKey(t *testing.T) {
+	server, hits := pathHitServer(t)
+	store := openCheckpoint(t, filepath.Join(t.TempDir(), "keys.checkpoint"), "keys")
+	if err := store.Record(CheckpointEntry{Key: "user-1", Status: http.StatusOK}); err != nil {
+		t.Fatal(err)
+	}
+	requests := []BatchRequest{
+		{Method: http.MethodGet, URL: server.URL + "/users/1", Key: "user-1"},
+		{Method: http.MethodGet, URL: server.URL + "/users/2", Key: "user-2"},
+	}
+	results, err := Batch(context.Background(), requests, 1, WithBatchCheckpoint(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Skipped || results[1].Skipped || hits("/users/1") != 0 || hits("/users/2") != 1 {
+		t.Fatalf("results = %+v, want only user-2 executed", results)
+	}
+	if completed, _ := store.Completed(); len(completed) != 2 {
+		t.Fatalf("completed = %v, want user-2 recorded", completed)
+	}
+}
+
+// failingCheckpoint Completed返回错误的CheckpointStore
+type failingCheckpoint struct{}
+
+func (failingCheckpoint) Completed() (map[string]CheckpointEntry, error) {
+	return nil, errors.New("disk unavailable")
+}
+func (failingCheckpoint) Record(CheckpointEntry) error { return nil }
+
+func TestBatchCheckpointLoadError(t *testing.T) {
+	server, hits := pathHitServer(t)
+	_, err := Batch(context.Background(), []BatchRequest{{Method: http.MethodGet, URL: server.URL + "/a"}}, 1, WithBatchCheckpoint(failingCheckpoint{}))
+	if err == nil || !strings.Contains(err.Error(), "disk unavailable") {
+		t.Fatalf("error = %v, want the store error", err)
+	}
+	if hits("/a") != 0 {
+		t.Fatal("no request should be sent when the checkpoint cannot be loaded")
+	}
+}
+
+func TestFileCheckpointStoreConcurrentRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "concurrent.checkpoint")
+	store := openCheckpoint(t, path, "concurrent")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := store.Record(CheckpointEntry{Key: fmt.Sprint(i), Status: http.StatusOK}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	store.Close()
+	completed, err := openCheckpoint(t, path, "concurrent").Completed()
+	if err != nil || len(completed) != 50 {
+		t.Fatalf("completed = %v entries, %v, want 50", len(completed), err)
+	}
+}
+
+func TestFileCheckpointStoreDetectsOtherWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.checkpoint")
+	first := openCheckpoint(t, path, "shared")
+	second := openCheckpoint(t, path, "shared")
+	if err := first.Record(CheckpointEntry{Key: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Record(CheckpointEntry{Key: "b"}); !errors.Is(err, ErrCheckpointConflict) {
+		t.Fatalf("error = %v, want ErrCheckpointConflict", err)
+	}
+
+	// 两个写入者交错写入的文件在打开时报错
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if err := os.WriteFile(path, []byte(string(data)+lines[1]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileCheckpointStore(path, "shared"); !errors.Is(err, ErrCheckpointConflict) {
+		t.Fatalf("error = %v, want ErrCheckpointConflict for a repeated sequence number", err)
+	}
+}
+
+func TestFileCheckpointStoreOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "open.checkpoint")
+	store := openCheckpoint(t, path, "open")
+	if err := store.Record(CheckpointEntry{Key: "a", Status: http.StatusOK}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if err := store.Record(CheckpointEntry{Key: "b"}); err == nil {
+		t.Fatal("Record after Close should fail")
+	}
+
+	if _, err := NewFileCheckpointStore(path, "other"); err == nil || !strings.Contains(err.Error(), `"open"`) {
+		t.Fatalf("error = %v, want a batch id mismatch", err)
+	}
+
+	// 崩溃时写了一半的记录被丢弃，之后的记录可以继续追加
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"seq":2,"key":"b`)
+	file.Close()
+	store = openCheckpoint(t, path, "open")
+	if err := store.Record(CheckpointEntry{Key: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	completed, err := openCheckpoint(t, path, "open").Completed()
+	if err != nil || len(completed) != 2 || completed["a"].Status != http.StatusOK {
+		t.Fatalf("completed = %v, %v, want a and c", completed, err)
+	}
+}
@@ -0,0 +1,144 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrClientClosed Client.Close之后发起的请求返回该错误
+var ErrClientClosed = errors.New("client closed")
+
+// clientState 记录Client进行中的请求和后台goroutine，供Close等待和取消
+type clientState struct {
+	mu       sync.Mutex
+	closed   bool
+	nextID   uint64
+	inflight map[uint64]context.CancelFunc
+	// idle Close之后进行中的请求全部结束时关闭
+	idle chan struct{}
+
+	// background 后台goroutine使用的context，Close时取消
+	background       context.Context
+	cancelBackground context.CancelFunc
+	backgroundWG     sync.WaitGroup
+}
+
+func newClientState() *clientState {
+	background, cancel := context.WithCancel(context.Background())
+	return &clientState{
+		inflight:         map[uint64]context.CancelFunc{},
+		idle:             make(chan struct{}),
+		background:       background,
+		cancelBackground: cancel,
+	}
+}
+
+// begin 登记一个进行中的请求，为其设置可以被Close取消的context
+// 请求失败或响应body关闭时调用requestIns.release，Client已经关闭时返回ErrClientClosed
+func (s *clientState) begin(requestIns *HttpRequests) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClientClosed
+	}
+	parent := requestIns.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	id := s.nextID
+	s.nextID++
+	s.inflight[id] = cancel
+	requestIns.Context = ctx
+	var once sync.Once
+	requestIns.release = func() {
+		once.Do(func() {
+			cancel()
+			s.end(id)
+		})
+	}
+	return nil
+}
+
+func (s *clientState) end(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inflight, id)
+	if s.closed && len(s.inflight) == 0 {
+		s.closeIdle()
+	}
+}
+
+// closeIdle 在持有锁时调用，可以重复调用
+func (s *clientState) closeIdle() {
+	select {
+	case <-s.idle:
+	default:
+		close(s.idle)
+	}
+}
+
+// goBackground 启动随Client关闭而退出的后台goroutine，Close会等待fn返回
+// Client已经关闭时不再启动，返回false
+func (s *clientState) goBackground(fn func(ctx context.Context)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.backgroundWG.Add(1)
+	go func() {
+		defer s.backgroundWG.Done()
+		fn(s.background)
+	}()
+	return true
+}
+
+// Close 关闭Client：停止后台goroutine，等待进行中的请求结束，最后关闭连接池中的空闲连接
+// 响应body关闭之后请求才算结束；ctx结束时取消所有进行中的请求并返回ctx.Err()
+// 之后发起的请求返回ErrClientClosed，重复调用Close是安全的；DefaultClient被包级别的函数共用，不应该关闭
+func (c *Client) Close(ctx context.Context) error {
+	s := c.state
+	if s == nil {
+		c.CloseIdleConnections()
+		return nil
+	}
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		s.cancelBackground()
+		if len(s.inflight) == 0 {
+			s.closeIdle()
+		}
+	}
+	s.mu.Unlock()
+
+	var err error
+	select {
+	case <-s.idle:
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.mu.Lock()
+		for _, cancel := range s.inflight {
+			cancel()
+		}
+		s.mu.Unlock()
+	}
+	s.backgroundWG.Wait()
+	if c.ownsTransport {
+		c.CloseIdleConnections()
+	}
+	return err
+}
+
+// call 使用Client发起请求，Close之后返回ErrClientClosed
+func (c *Client) call(requestIns *HttpRequests) (*http.Response, error) {
+	if c.state != nil {
+		if err := c.state.begin(requestIns); err != nil {
+			return nil, err
+		}
+	}
+	return callRequest(requestIns)
+}
@@ -0,0 +1,122 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestClientCloseWaitsForInFlight(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- client.Close(context.Background()) }()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v before the body was closed", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return after the body was closed")
+	}
+
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("Get after Close error = %v, want ErrClientClosed", err)
+	}
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatalf("second Close error: %v", err)
+	}
+}
+
+func TestClientCloseCancelsOnDeadline(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewClient(WithTimeout(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.Get(server.URL)
+		errs <- err
+	}()
+	// 等待请求发出
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close error = %v, want context.DeadlineExceeded", err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("in-flight request error = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("in-flight request was not canceled")
+	}
+}
+
+func TestClientCloseStopsBackground(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	client.state.goBackground(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("background goroutine still running after Close")
+	}
+	if client.state.goBackground(func(context.Context) {}) {
+		t.Fatal("goBackground started after Close")
+	}
+}
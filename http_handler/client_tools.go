@@ -0,0 +1,370 @@
+package nhr
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// maxTransportClients transportClients最多缓存的http.Client数量
+const maxTransportClients = 64
+
+// transportClients 按transport配置缓存的http.Client，配置相同的请求共用同一个连接池
+// TLSConfig按指针比较，每个请求新建*tls.Config时不会复用连接池，超过maxTransportClients时淘汰最久没有使用的
+var transportClients = newTransportCache(maxTransportClients)
+
+// Client 持有自己的http.Client和连接池，options作为每个请求的默认配置
+// WithProxy、WithTLSConfig、WithMaxIdleConns等transport相关的选项在NewClient时生效，单次请求中设置不再生效
+// Client可以被多个goroutine同时使用
+type Client struct {
+	client   *http.Client
+	defaults []Option
+	// state 进行中的请求，为nil时Close只关闭空闲连接
+	state *clientState
+	// ownsTransport 连接池由Client创建，Close时关闭空闲连接
+	ownsTransport bool
+	// rateLimiter 默认配置中WithAdaptiveRateLimit的限速器，用于查询配额
+	rateLimiter *adaptiveLimiter
+	// costLimiter 默认配置中WithCostBudget的限速器，用于查询预算和Batch发起请求之前检查预算
+	costLimiter *costLimiter
+	// hostDefaults SetHostDefaults设置的按host的默认配置
+	hostDefaults *hostDefaults
+	// poolStats 连接复用的统计，派生的Client有自己的统计
+	poolStats *poolStats
+	// methods Client.AllowMethods注册的自定义method
+	methods *methodSet
+	// jsonCodec 默认配置中WithJSONCodec选择的codec，在每个请求的所有配置之前生效
+	jsonCodec JSONCodec
+}
+
+// DefaultClient 包级别的HttpCaller、Get、Post等函数使用的Client
+// 没有自己的http.Client，按请求的transport配置选择本包共享的连接池
+var DefaultClient = &Client{
+	state:        newClientState(),
+	hostDefaults: &hostDefaults{},
+	poolStats:    newPoolStats(),
+	methods:      &methodSet{},
+}
+
+// NewClient 创建Client，根据options中transport相关的配置创建独立的http.Transport
+// options中有WithHTTPClient时直接使用该http.Client，transport相关的配置不再生效
+// 代理地址不合法或客户端证书无法加载时返回错误
+func NewClient(options ...Option) (*Client, error) {
+	template := newHttpRequests("", "", options...)
+	if template.client != nil {
+		return &Client{
+			client:       template.client,
+			defaults:     append([]Option(nil), options...),
+			state:        newClientState(),
+			rateLimiter:  template.rateLimiter,
+			costLimiter:  template.costLimiter,
+			hostDefaults: &hostDefaults{},
+			poolStats:    newPoolStats(),
+			methods:      &methodSet{},
+			jsonCodec:    template.JSONCodec,
+		}, nil
+	}
+	transport, err := newTransport(requestTransportKey(template))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		client:        &http.Client{Transport: transport},
+		defaults:      append([]Option(nil), options...),
+		state:         newClientState(),
+		ownsTransport: true,
+		rateLimiter:   template.rateLimiter,
+		costLimiter:   template.costLimiter,
+		hostDefaults:  &hostDefaults{},
+		poolStats:     newPoolStats(),
+		methods:       &methodSet{},
+		jsonCodec:     template.JSONCodec,
+	}, nil
+}
+
+// With 返回派生的Client，默认配置为当前Client的默认配置加上options，不会修改当前Client
+// 派生的Client与当前Client共用http.Client、连接池以及WithMaxInFlight、WithAdaptiveRateLimit、WithCostBudget等限制器，options中设置了新的限制器时使用新的
+// transport相关的选项在派生的Client上不生效，需要不同的transport时使用NewClient或WithHTTPClient
+// SetHostDefaults的配置在派生时复制，之后两边各自修改互不影响
+// 派生的Client有自己的进行中请求，Close只等待和取消自己发起的请求，不会关闭共用的连接池
+func (c *Client) With(options ...Option) *Client {
+	defaults := append(append([]Option(nil), c.defaults...), options...)
+	derived := &Client{
+		client:       c.client,
+		defaults:     defaults,
+		state:        newClientState(),
+		rateLimiter:  c.rateLimiter,
+		costLimiter:  c.costLimiter,
+		hostDefaults: c.hostDefaults.clone(),
+		poolStats:    newPoolStats(),
+		methods:      c.methods.clone(),
+		jsonCodec:    c.jsonCodec,
+	}
+	template := newHttpRequests("", "", options...)
+	if template.JSONCodec != DefaultJSONCodec {
+		derived.jsonCodec = template.JSONCodec
+	}
+	if template.rateLimiter != nil {
+		derived.rateLimiter = template.rateLimiter
+	}
+	if template.costLimiter != nil {
+		derived.costLimiter = template.costLimiter
+	}
+	return derived
+}
+
+// WithHTTPClient 使用指定的http.Client发送请求，例如在测试中使用mock.Transport
+// 设置之后WithProxy、WithTLSConfig等transport相关的配置不再生效
+func WithHTTPClient(client *http.Client) Option {
+	return func(req *HttpRequests) {
+		req.client = client
+	}
+}
+
+// HTTPClient 返回Client使用的http.Client，DefaultClient返回没有transport配置的请求共用的http.Client
+func (c *Client) HTTPClient() *http.Client {
+	if c.client == nil {
+		client, _ := transportClientFor(&HttpRequests{})
+		return client
+	}
+	return c.client
+}
+
+// CloseIdleConnections 关闭连接池中的空闲连接
+func (c *Client) CloseIdleConnections() {
+	c.HTTPClient().CloseIdleConnections()
+}
+
+// HttpCaller 使用Client发起请求，单次请求的options在默认配置之后执行，请求头按key合并
+func (c *Client) HttpCaller(method, url string, options ...Option) (*http.Response, error) {
+	return c.call(c.newRequest(method, url, c.defaults, options))
+}
+
+// newRequest 依次执行Client的默认配置、匹配host的默认配置和单次请求的配置
+func (c *Client) newRequest(method, url string, defaults, options []Option) *HttpRequests {
+	if c.jsonCodec != DefaultJSONCodec {
+		// 默认配置中的WithPostJsonBody也使用Client的codec
+		defaults = append([]Option{WithJSONCodec(c.jsonCodec)}, defaults...)
+	}
+	layers := []configLayer{{source: ConfigSourceClient, options: defaults}}
+	if !c.hostDefaults.empty() {
+		layers = append(layers, configLayer{source: ConfigSourceHost, options: c.hostDefaults.match(hostOf(url))})
+	}
+	requestIns := newLayeredRequest(method, url, c.client, append(layers, configLayer{source: ConfigSourceRequest, options: options}))
+	requestIns.hostDefaults = c.hostDefaults
+	requestIns.poolStats = c.poolStats
+	requestIns.methods = c.methods
+	// Client注册的自定义method按注册时的大小写发送，单次请求通过WithMethod修改的method不受影响
+	if custom, ok := c.methods.lookup(method); ok && requestIns.Method == normalizeMethod(method) {
+		requestIns.Method = custom
+	}
+	return requestIns
+}
+
+// Do 使用Client以任意标准method或者注册过的自定义method发起请求
+func (c *Client) Do(method, url string, options ...Option) (*http.Response, error) {
+	return c.HttpCaller(method, url, options...)
+}
+
+// Get 使用Client发起GET请求
+func (c *Client) Get(url string, options ...Option) (*http.Response, error) {
+	return c.HttpCaller(http.MethodGet, url, options...)
+}
+
+// Post 使用Client发起POST请求
+func (c *Client) Post(url string, options ...Option) (*http.Response, error) {
+	return c.HttpCaller(http.MethodPost, url, options...)
+}
+
+// Put 使用Client发起PUT请求
+func (c *Client) Put(url string, options ...Option) (*http.Response, error) {
+	return c.HttpCaller(http.MethodPut, url, options...)
+}
+
+// Patch 使用Client发起PATCH请求
+func (c *Client) Patch(url string, options ...Option) (*http.Response, error) {
+	return c.HttpCaller(http.MethodPatch, url, options...)
+}
+
+// Delete 使用Client发起DELETE请求
+func (c *Client) Delete(url string, options ...Option) (*http.Response, error) {
+	return c.HttpCaller(http.MethodDelete, url, options...)
+}
+
+// Head 使用Client发起HEAD请求
+func (c *Client) Head(url string, options ...Option) (*http.Response, error) {
+	return c.HttpCaller(http.MethodHead, url, options...)
+}
+
+// newRequestWithDefaults 依次执行默认配置和单次请求的配置，默认配置不会被修改
+func newRequestWithDefaults(method, url string, client *http.Client, defaults, options []Option) *HttpRequests {
+	return newLayeredRequest(method, url, client, []configLayer{{source: ConfigSourceClient, options: defaults}, {source: ConfigSourceRequest, options: options}})
+}
+
+// newLayeredRequest 依次执行各层配置，第一层是默认配置，之后各层合并到默认配置的副本中
+func newLayeredRequest(method, url string, client *http.Client, layers []configLayer) *HttpRequests {
+	requestIns := newHttpRequests(method, url, layers[0].options...)
+	// 复制默认请求头，单次请求的WithHeaders合并到副本中，不会修改默认配置
+	headers := make(map[string]string, len(requestIns.Headers))
+	for key, value := range requestIns.Headers {
+		headers[key] = value
+	}
+	requestIns.Headers = headers
+	// 复制默认的cookies，避免不同请求之间共用同一个slice
+	if len(requestIns.Cookies) > 0 {
+		cookies := make([]*http.Cookie, len(requestIns.Cookies))
+		for i, cookie := range requestIns.Cookies {
+			copied := *cookie
+			cookies[i] = &copied
+		}
+		requestIns.Cookies = cookies
+	}
+	for _, layer := range layers[1:] {
+		for _, opt := range layer.options {
+			opt(requestIns)
+		}
+	}
+	if requestIns.ConfigTrace {
+		requestIns.configTrace = traceConfig(method, url, layers, requestIns)
+	}
+	// 单次请求通过WithHTTPClient指定的http.Client优先
+	if requestIns.client == nil {
+		requestIns.client = client
+	}
+	return requestIns
+}
+
+// httpClientFor 返回发送请求使用的http.Client
+// 设置了重定向控制或生产环境写保护时额外检查重定向
+func httpClientFor(requestIns *HttpRequests) (*http.Client, error) {
+	client, err := transportClientFor(requestIns)
+	if err != nil {
+		return nil, err
+	}
+	return guardRedirects(client, requestIns), nil
+}
+
+// transportClientFor 返回transport配置与请求匹配的http.Client
+// Client和Session的请求使用它们自己的http.Client，不再按单次请求的transport配置选择连接池
+func transportClientFor(requestIns *HttpRequests) (*http.Client, error) {
+	if requestIns.client != nil {
+		return requestIns.client, nil
+	}
+	key := requestTransportKey(requestIns)
+	if client, ok := transportClients.get(key); ok {
+		return client, nil
+	}
+	transport, err := newTransport(key)
+	if err != nil {
+		// http.DefaultTransport被替换时，没有transport配置的请求直接使用http.DefaultClient
+		if key == (transportKey{}) {
+			return http.DefaultClient, nil
+		}
+		return nil, err
+	}
+	return transportClients.add(key, &http.Client{Transport: transport}), nil
+}
+
+// transportCache 按transport配置缓存http.Client的LRU，淘汰时关闭空闲连接，正在进行的请求不受影响
+type transportCache struct {
+	max int
+
+	mu sync.Mutex
+	// order 最近使用的在前面，元素为*transportCacheEntry
+	order   *list.List
+	entries map[transportKey]*list.Element
+}
+
+type transportCacheEntry struct {
+	key    transportKey
+	client *http.Client
+}
+
+func newTransportCache(max int) *transportCache {
+	return &transportCache{max: max, order: list.New(), entries: map[transportKey]*list.Element{}}
+}
+
+// get 返回key对应的http.Client并标记为最近使用
+func (c *transportCache) get(key transportKey) (*http.Client, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*transportCacheEntry).client, true
+}
+
+// add 缓存client，其他goroutine已经缓存了相同的key时返回已有的http.Client并关闭client的空闲连接
+func (c *transportCache) add(key transportKey, client *http.Client) *http.Client {
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		client.CloseIdleConnections()
+		return element.Value.(*transportCacheEntry).client
+	}
+	c.entries[key] = c.order.PushFront(&transportCacheEntry{key: key, client: client})
+	var evicted []*http.Client
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		entry := c.order.Remove(oldest).(*transportCacheEntry)
+		delete(c.entries, entry.key)
+		evicted = append(evicted, entry.client)
+	}
+	c.mu.Unlock()
+	for _, old := range evicted {
+		old.CloseIdleConnections()
+	}
+	return client
+}
+
+// len 缓存的http.Client数量
+func (c *transportCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// defaultMaxResponseHeaderBytes 本包创建的transport允许的响应头最大字节数，net/http默认为10MB
+const defaultMaxResponseHeaderBytes = 1 << 20
+
+// newTransport 复制http.DefaultTransport并应用transport配置
+func newTransport(key transportKey) (*http.Transport, error) {
+	defaultTransport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("http.DefaultTransport is not *http.Transport, cannot customize transport")
+	}
+	transport := defaultTransport.Clone()
+	transport.MaxResponseHeaderBytes = defaultMaxResponseHeaderBytes
+	if key.maxResponseHeaderBytes > 0 {
+		transport.MaxResponseHeaderBytes = key.maxResponseHeaderBytes
+	}
+	if key.maxIdleConns > 0 {
+		transport.MaxIdleConns = key.maxIdleConns
+	}
+	if key.maxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = key.maxIdleConnsPerHost
+	}
+	if key.idleConnTimeout > 0 {
+		transport.IdleConnTimeout = key.idleConnTimeout
+	}
+	transport.DisableKeepAlives = key.disableKeepAlives
+	if key.proxy != "" {
+		proxyURL, err := parseProxyURL(key.proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	tlsConfig, err := tlsConfigFor(key)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
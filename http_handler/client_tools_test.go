@@ -0,0 +1,185 @@
+package nhr
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientWithDoesNotMutateParent(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	cookies := []*http.Cookie{{Name: "session", Value: "parent"}}
+	parent, err := NewClient(WithHeaders(map[string]string{"X-Service": "base"}), WithCookies(cookies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close(context.Background())
+	derived := parent.With(WithHeaders(map[string]string{"X-Tenant": "acme"}))
+	derived.SetHostDefaults(mustHost(t, server.URL), WithHeaders(map[string]string{"X-Derived-Host": "1"}))
+
+	response, err := derived.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if got.Get("X-Service") != "base" || got.Get("X-Tenant") != "acme" || got.Get("X-Derived-Host") != "1" {
+		t.Fatalf("derived client headers = %v", got)
+	}
+
+	response, err = parent.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if got.Get("X-Tenant") != "" || got.Get("X-Derived-Host") != "" {
+		t.Fatalf("derived options leaked into the parent: %v", got)
+	}
+	if derived.HTTPClient() != parent.HTTPClient() {
+		t.Fatal("derived client should share the parent's http.Client")
+	}
+
+	// 修改一个请求得到的cookie不影响默认配置
+	requestIns := parent.newRequest(http.MethodGet, server.URL, parent.defaults, nil)
+	requestIns.Cookies[0].Value = "changed"
+	if again := parent.newRequest(http.MethodGet, server.URL, parent.defaults, nil); again.Cookies[0].Value != "parent" {
+		t.Fatalf("cookie changes leaked between requests: %v", again.Cookies[0])
+	}
+}
+
+func TestClientWithSharesLimiter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	parent, err := NewClient(WithMaxInFlight(1), WithQueue(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close(context.Background())
+	derived := parent.With(WithTimeout(time.Second))
+
+	held, err := parent.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := derived.Get(server.URL); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("derived request error = %v, want the shared limiter to be full", err)
+	}
+	held.Body.Close()
+
+	// 派生时设置新的限制器则不再共用
+	own := parent.With(WithMaxInFlight(1))
+	held, err = parent.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Body.Close()
+	response, err := own.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with its own limiter = %v", err)
+	}
+	response.Body.Close()
+}
+
+func TestClientWithCloseOwnership(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	parent, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close(context.Background())
+	derived := parent.With()
+
+	held, err := parent.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Body.Close()
+
+	// 父Client的请求仍在进行，派生Client的Close不需要等待它
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := derived.Close(ctx); err != nil {
+		t.Fatalf("derived Close = %v, want it to ignore the parent's requests", err)
+	}
+	if _, err := derived.Get(server.URL); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("request on closed derived client = %v", err)
+	}
+	response, err := parent.Get(server.URL)
+	if err != nil {
+		t.Fatalf("parent request after derived Close = %v", err)
+	}
+	response.Body.Close()
+	if body, err := ReadResult(held); err != nil || string(body.Body) != "ok" {
+		t.Fatalf("parent's in-flight response after derived Close = %v, %v", body, err)
+	}
+}
+
+// closeRecorder 记录CloseIdleConnections调用次数的RoundTripper
+type closeRecorder struct {
+	http.RoundTripper
+	closed int
+}
+
+func (r *closeRecorder) CloseIdleConnections() {
+	r.closed++
+}
+
+func TestTransportCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newTransportCache(2)
+	transports := make([]*closeRecorder, 3)
+	keys := make([]transportKey, 3)
+	for i := range transports {
+		transports[i] = &closeRecorder{}
+		keys[i] = transportKey{maxIdleConns: i + 1}
+	}
+	cache.add(keys[0], &http.Client{Transport: transports[0]})
+	cache.add(keys[1], &http.Client{Transport: transports[1]})
+	// 使用过的key[0]保留，淘汰最久没有使用的key[1]
+	if _, ok := cache.get(keys[0]); !ok {
+		t.Fatal("key 0 should be cached")
+	}
+	cache.add(keys[2], &http.Client{Transport: transports[2]})
+	if cache.len() != 2 {
+		t.Fatalf("cache holds %v clients, want 2", cache.len())
+	}
+	if _, ok := cache.get(keys[1]); ok {
+		t.Fatal("key 1 should be evicted")
+	}
+	if transports[1].closed != 1 || transports[0].closed != 0 || transports[2].closed != 0 {
+		t.Fatalf("CloseIdleConnections calls = %v, %v, %v, want only the evicted client closed", transports[0].closed, transports[1].closed, transports[2].closed)
+	}
+
+	// 重复添加同一个key时返回已有的client，并关闭新建的client
+	duplicate := &closeRecorder{}
+	if got := cache.add(keys[2], &http.Client{Transport: duplicate}); got.Transport != transports[2] || duplicate.closed != 1 {
+		t.Fatalf("add returned %v, duplicate closed %v times", got.Transport, duplicate.closed)
+	}
+}
+
+func TestTransportClientsBounded(t *testing.T) {
+	server, _ := countingServer(t, http.StatusOK)
+	for i := 0; i < maxTransportClients+10; i++ {
+		// 每个请求新建的*tls.Config都是不同的key
+		response, err := Get(server.URL, WithTLSConfig(&tls.Config{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+	if n := transportClients.len(); n > maxTransportClients {
+		t.Fatalf("transportClients holds %v clients, want at most %v", n, maxTransportClients)
+	}
+}
@@ -0,0 +1,236 @@
+package nhr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ConfigSource 请求头或查询参数的值来自哪一层配置
+type ConfigSource string
+
+const (
+	// ConfigSourceBuiltin 本包的默认值，例如默认的Content-Type
+	ConfigSourceBuiltin ConfigSource = "builtin"
+	// ConfigSourceClient NewClient、NewSession时设置的默认配置
+	ConfigSourceClient ConfigSource = "client"
+	// ConfigSourceHost Client.SetHostDefaults按host设置的默认配置
+	ConfigSourceHost ConfigSource = "host"
+	// ConfigSourceRequest 单次请求的option
+	ConfigSourceRequest ConfigSource = "request"
+	// ConfigSourceAuth WithBasicAuth、WithBearerToken等认证选项，无论在哪一层设置
+	ConfigSourceAuth ConfigSource = "auth"
+	// ConfigSourceTemplate Chain把{name}替换为之前步骤提取的值
+	ConfigSourceTemplate ConfigSource = "template"
+	// ConfigSourceURL 请求URL中原有的查询参数
+	ConfigSourceURL ConfigSource = "url"
+)
+
+// ConfigKind 配置项的类型
+type ConfigKind string
+
+const (
+	ConfigKindHeader ConfigKind = "header"
+	ConfigKindQuery  ConfigKind = "query"
+)
+
+// ConfigValue 某一层配置设置的值
+type ConfigValue struct {
+	Source ConfigSource
+	Value  string
+}
+
+// ConfigTraceEntry 一个请求头或查询参数的最终值、提供最终值的配置层以及被覆盖的值
+type ConfigTraceEntry struct {
+	Kind   ConfigKind
+	Name   string
+	Value  string
+	Source ConfigSource
+	// Overridden 被覆盖的值，按设置的先后顺序
+	Overridden []ConfigValue
+}
+
+// ConfigTrace 请求头和查询参数的来源，通过WithConfigTrace开启
+// 只包含各层配置设置的值，发送时由本包计算的请求头(例如multipart的Content-Type、Accept-Encoding)不在其中
+type ConfigTrace struct {
+	Entries []ConfigTraceEntry
+}
+
+// Lookup 查找请求头(不区分大小写)或查询参数的来源
+func (t *ConfigTrace) Lookup(kind ConfigKind, name string) (ConfigTraceEntry, bool) {
+	if t == nil {
+		return ConfigTraceEntry{}, false
+	}
+	for _, entry := range t.Entries {
+		if entry.Kind == kind && (entry.Name == name || kind == ConfigKindHeader && entry.Name == http.CanonicalHeaderKey(name)) {
+			return entry, true
+		}
+	}
+	return ConfigTraceEntry{}, false
+}
+
+// String 每行输出一个配置项，敏感的请求头和URL参数会被替换为***
+func (t *ConfigTrace) String() string {
+	if t == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, entry := range t.Entries {
+		fmt.Fprintf(&b, "%v %v=%q from %v", entry.Kind, entry.Name, traceValue(entry.Kind, entry.Name, entry.Value), entry.Source)
+		for _, overridden := range entry.Overridden {
+			fmt.Fprintf(&b, ", overrides %q from %v", traceValue(entry.Kind, entry.Name, overridden.Value), overridden.Source)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// traceValue 替换敏感的值
+func traceValue(kind ConfigKind, name, value string) string {
+	if kind == ConfigKindHeader && sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return "***"
+	}
+	if probe := "?" + url.QueryEscape(name) + "=x"; kind == ConfigKindQuery && redactSecrets(probe) != probe {
+		return "***"
+	}
+	return value
+}
+
+// record 记录source把kind/name设置为value，值没有变化时不记录，请求头的名称转为规范格式
+func (t *ConfigTrace) record(kind ConfigKind, name string, source ConfigSource, value string) {
+	if kind == ConfigKindHeader {
+		name = http.CanonicalHeaderKey(name)
+	}
+	for i := range t.Entries {
+		entry := &t.Entries[i]
+		if entry.Kind != kind || entry.Name != name {
+			continue
+		}
+		if entry.Value == value {
+			return
+		}
+		entry.Overridden = append(entry.Overridden, ConfigValue{Source: entry.Source, Value: entry.Value})
+		entry.Value, entry.Source = value, source
+		return
+	}
+	t.Entries = append(t.Entries, ConfigTraceEntry{Kind: kind, Name: name, Value: value, Source: source})
+}
+
+// WithConfigTrace 记录每个请求头和查询参数由哪一层配置提供，通过Response.ConfigTrace或ConfigTraceOf查看，WithDump会一并输出
+// 开启时会按顺序重新执行一遍各层的option来记录来源，不开启时没有额外开销
+func WithConfigTrace() Option {
+	return func(req *HttpRequests) {
+		req.ConfigTrace = true
+	}
+}
+
+// configLayer 一层配置以及它的来源
+type configLayer struct {
+	source  ConfigSource
+	options []Option
+}
+
+// traceConfig 按顺序在一个新的请求实例上重新执行各层option，比较每个option前后的请求头和查询参数
+// 只保留最终实际发送的请求头和查询参数
+func traceConfig(method, rawURL string, layers []configLayer, final *HttpRequests) *ConfigTrace {
+	trace := &ConfigTrace{}
+	if parsed, err := url.Parse(rawURL); err == nil {
+		for name, values := range parsed.Query() {
+			trace.record(ConfigKindQuery, name, ConfigSourceURL, strings.Join(values, ","))
+		}
+	}
+	scratch := newHttpRequests(method, rawURL)
+	for key, value := range scratch.Headers {
+		trace.record(ConfigKindHeader, key, ConfigSourceBuiltin, value)
+	}
+	params := ""
+	for _, layer := range layers {
+		for _, opt := range layer.options {
+			before := make(map[string]string, len(scratch.Headers))
+			for key, value := range scratch.Headers {
+				before[key] = value
+			}
+			scratch.authSource = false
+			opt(scratch)
+			source := layer.source
+			if scratch.authSource {
+				source = ConfigSourceAuth
+			}
+			for key, value := range scratch.Headers {
+				if before[key] != value {
+					trace.record(ConfigKindHeader, key, source, value)
+				}
+			}
+			if scratch.Params != params {
+				previous, _ := url.ParseQuery(params)
+				current, _ := url.ParseQuery(scratch.Params)
+				for name, values := range current {
+					if strings.Join(previous[name], ",") != strings.Join(values, ",") {
+						trace.record(ConfigKindQuery, name, source, strings.Join(values, ","))
+					}
+				}
+				params = scratch.Params
+			}
+		}
+	}
+	return trace.keep(final)
+}
+
+// keep 去掉最终没有发送的配置项，并按类型和名称排序
+func (t *ConfigTrace) keep(final *HttpRequests) *ConfigTrace {
+	sent := map[string]bool{}
+	if parsed, err := url.Parse(final.URL); err == nil {
+		for name := range parsed.Query() {
+			sent["query:"+name] = true
+		}
+	}
+	if params, err := url.ParseQuery(final.Params); err == nil {
+		for name := range params {
+			sent["query:"+name] = true
+		}
+	}
+	for key := range final.Headers {
+		sent["header:"+http.CanonicalHeaderKey(key)] = true
+	}
+	kept := t.Entries[:0]
+	for _, entry := range t.Entries {
+		if sent[string(entry.Kind)+":"+entry.Name] {
+			kept = append(kept, entry)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].Kind != kept[j].Kind {
+			return kept[i].Kind < kept[j].Kind
+		}
+		return kept[i].Name < kept[j].Name
+	})
+	t.Entries = kept
+	return t
+}
+
+type configTraceContextKey struct{}
+
+// contextWithConfigTrace 将配置来源存入请求的context
+func contextWithConfigTrace(ctx context.Context, trace *ConfigTrace) context.Context {
+	if trace == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, configTraceContextKey{}, trace)
+}
+
+// ConfigTraceOf 获取响应对应请求的配置来源，没有通过WithConfigTrace开启时返回nil
+func ConfigTraceOf(responseIns *http.Response) *ConfigTrace {
+	if responseIns == nil || responseIns.Request == nil {
+		return nil
+	}
+	trace, _ := responseIns.Request.Context().Value(configTraceContextKey{}).(*ConfigTrace)
+	return trace
+}
+
+// ConfigTrace 请求头和查询参数的来源，没有通过WithConfigTrace开启时返回nil
+func (r *Response) ConfigTrace() *ConfigTrace {
+	return ConfigTraceOf(r.raw)
+}
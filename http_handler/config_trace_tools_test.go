@@ -0,0 +1,104 @@
+package nhr
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigTraceLayers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := NewClient(
+		WithHeaders(map[string]string{"X-Team": "core", "X-Env": "prod"}),
+		WithBearerToken("client-token"),
+		WithParams(map[string]string{"lang": "en"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	client.SetHostDefaults("127.0.0.1", WithHeader("X-Env", "staging"))
+
+	response, err := client.Fetch(http.MethodGet, server.URL+"/v1?page=2",
+		WithConfigTrace(), WithHeader("x-env", "qa"), WithBasicAuth("user", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := response.ConfigTrace()
+	tests := []struct {
+		kind       ConfigKind
+		name       string
+		value      string
+		source     ConfigSource
+		overridden []ConfigSource
+	}{
+		{kind: ConfigKindHeader, name: "Content-Type", value: "application/json", source: ConfigSourceBuiltin},
+		{kind: ConfigKindHeader, name: "X-Team", value: "core", source: ConfigSourceClient},
+		{kind: ConfigKindHeader, name: "X-Env", value: "qa", source: ConfigSourceRequest, overridden: []ConfigSource{ConfigSourceClient, ConfigSourceHost}},
+		{kind: ConfigKindHeader, name: "Authorization", value: "Basic dXNlcjpwYXNz", source: ConfigSourceAuth, overridden: []ConfigSource{ConfigSourceAuth}},
+		{kind: ConfigKindQuery, name: "page", value: "2", source: ConfigSourceURL},
+		{kind: ConfigKindQuery, name: "lang", value: "en", source: ConfigSourceClient},
+	}
+	for _, tt := range tests {
+		entry, ok := trace.Lookup(tt.kind, tt.name)
+		if !ok {
+			t.Errorf("%v %v missing from trace %+v", tt.kind, tt.name, trace)
+			continue
+		}
+		if entry.Value != tt.value || entry.Source != tt.source || len(entry.Overridden) != len(tt.overridden) {
+			t.Errorf("%v %v = %+v, want %q from %v", tt.kind, tt.name, entry, tt.value, tt.source)
+			continue
+		}
+		for i, source := range tt.overridden {
+			if entry.Overridden[i].Source != source {
+				t.Errorf("%v %v overridden = %+v, want sources %v", tt.kind, tt.name, entry.Overridden, tt.overridden)
+			}
+		}
+	}
+	if len(trace.Entries) != len(tests) {
+		t.Errorf("trace has %v entries, want %v: %+v", len(trace.Entries), len(tests), trace.Entries)
+	}
+	if text := trace.String(); strings.Contains(text, "dXNlcjpwYXNz") || strings.Contains(text, "client-token") {
+		t.Errorf("trace text leaks the Authorization header:\n%v", text)
+	}
+}
+
+func TestConfigTraceDisabledByDefault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	response, err := Fetch(http.MethodGet, server.URL, WithHeader("X-Team", "core"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace := response.ConfigTrace(); trace != nil {
+		t.Fatalf("ConfigTrace = %+v, want nil without WithConfigTrace", trace)
+	}
+}
+
+func TestConfigTraceInDumpAndChain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"42"}`))
+	}))
+	defer server.Close()
+
+	var dump bytes.Buffer
+	results, err := NewChain().BaseURL(server.URL).
+		Step("create", http.MethodPost, "/orders").Extract("id", "id").
+		Step("get", http.MethodGet, "/orders/{id}", WithHeader("X-Order", "{id}"), WithConfigTrace(), WithDump(&dump)).
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := ConfigTraceOf(results[1].Response).Lookup(ConfigKindHeader, "x-order")
+	if !ok || entry.Value != "42" || entry.Source != ConfigSourceTemplate || len(entry.Overridden) != 1 || entry.Overridden[0].Value != "{id}" {
+		t.Fatalf("X-Order trace = %+v, want the template value overriding the option", entry)
+	}
+	if !strings.Contains(dump.String(), "config trace:\nheader Content-Type=\"application/json\" from builtin\n") {
+		t.Fatalf("dump does not include the config trace:\n%v", dump.String())
+	}
+}
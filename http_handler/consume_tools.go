@@ -0,0 +1,119 @@
+package nhr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrBodyAlreadyConsumed 响应body已经被读取或关闭，不能再次解析
+var ErrBodyAlreadyConsumed = errors.New("response body already consumed")
+
+// BodyConsumedError 重复解析响应body时返回，Site为第一次读取body的调用位置，仅在开启调试时记录
+type BodyConsumedError struct {
+	Site string
+}
+
+func (e *BodyConsumedError) Error() string {
+	if e.Site == "" {
+		return ErrBodyAlreadyConsumed.Error()
+	}
+	return fmt.Sprintf("%v, first consumed at %v", ErrBodyAlreadyConsumed, e.Site)
+}
+
+// Is errors.Is(err, ErrBodyAlreadyConsumed)返回true
+func (e *BodyConsumedError) Is(target error) bool {
+	return target == ErrBodyAlreadyConsumed
+}
+
+// bodyConsumeDebug 为1时记录第一次读取body的调用位置
+var bodyConsumeDebug int32
+
+// EnableBodyConsumeDebug 开启或关闭body读取位置的记录，开启后每个响应多一次runtime.Caller调用
+func EnableBodyConsumeDebug(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&bodyConsumeDebug, v)
+}
+
+// trackedBody 记录body是否已经被读取或关闭
+type trackedBody struct {
+	io.ReadCloser
+	once     sync.Once
+	consumed int32
+	site     string
+}
+
+// trackBodyConsumption 为响应body安装读取记录
+func trackBodyConsumption(responseIns *http.Response) {
+	responseIns.Body = &trackedBody{ReadCloser: responseIns.Body}
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	b.markConsumed()
+	return b.ReadCloser.Read(p)
+}
+
+func (b *trackedBody) Close() error {
+	b.markConsumed()
+	return b.ReadCloser.Close()
+}
+
+func (b *trackedBody) markConsumed() {
+	b.once.Do(func() {
+		if atomic.LoadInt32(&bodyConsumeDebug) == 1 {
+			b.site = consumerSite()
+		}
+		atomic.StoreInt32(&b.consumed, 1)
+	})
+}
+
+// checkBodyConsumable body已被读取过时返回*BodyConsumedError
+func checkBodyConsumable(responseIns *http.Response) error {
+	if b, ok := responseIns.Body.(*trackedBody); ok && atomic.LoadInt32(&b.consumed) == 1 {
+		return &BodyConsumedError{Site: b.site}
+	}
+	return nil
+}
+
+// consumerSite 返回调用栈中第一个不属于本包和标准库的位置
+func consumerSite() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !isConsumeInternalFrame(frame.Function) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// isConsumeInternalFrame 函数是否属于本包或标准库，标准库包路径的第一段不含.
+func isConsumeInternalFrame(function string) bool {
+	if strings.HasPrefix(function, "github.com/Lyzin/go-requests/http_handler.") {
+		return true
+	}
+	pkg := function
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		if j := strings.Index(pkg[i:], "."); j >= 0 {
+			pkg = pkg[:i+j]
+		}
+	} else if j := strings.Index(pkg, "."); j >= 0 {
+		pkg = pkg[:j]
+	}
+	if pkg == "main" {
+		return false
+	}
+	first := strings.SplitN(pkg, "/", 2)[0]
+	return !strings.Contains(first, ".")
+}
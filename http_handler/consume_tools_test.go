@@ -0,0 +1,81 @@
+package nhr
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestBodyConsumedTwice(t *testing.T) {
+	server := contentServer(t, "application/json", `{"id":7}`)
+	tests := []struct {
+		name    string
+		consume func(t *testing.T, body io.ReadCloser)
+	}{
+		{name: "read", consume: func(t *testing.T, body io.ReadCloser) { io.ReadAll(body) }},
+		{name: "closed", consume: func(t *testing.T, body io.ReadCloser) { body.Close() }},
+		{name: "decoded", consume: func(t *testing.T, body io.ReadCloser) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.consume(t, response.Body)
+			var v struct{ ID int }
+			if tt.name == "decoded" {
+				if err := ResponseToStruct(response, &v); err != nil || v.ID != 7 {
+					t.Fatalf("first decode = %+v, %v", v, err)
+				}
+			}
+			err = ResponseToStruct(response, &v)
+			var consumedErr *BodyConsumedError
+			if !errors.Is(err, ErrBodyAlreadyConsumed) || !errors.As(err, &consumedErr) {
+				t.Fatalf("error = %v, want ErrBodyAlreadyConsumed", err)
+			}
+			if _, err := ReadResult(response); !errors.Is(err, ErrBodyAlreadyConsumed) {
+				t.Fatalf("ReadResult error = %v, want ErrBodyAlreadyConsumed", err)
+			}
+		})
+	}
+}
+
+func TestBodyConsumeDebug(t *testing.T) {
+	server := contentServer(t, "application/json", `{}`)
+	EnableBodyConsumeDebug(true)
+	defer EnableBodyConsumeDebug(false)
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	// 测试函数属于本包，调用栈中没有外部调用位置，Site为空
+	var consumedErr *BodyConsumedError
+	if err := ResponseToStruct(response, &struct{}{}); !errors.As(err, &consumedErr) || consumedErr.Site != "" {
+		t.Fatalf("error = %v, want no site recorded from inside the package", err)
+	}
+	if msg := (&BodyConsumedError{Site: "main.go:12"}).Error(); msg != "response body already consumed, first consumed at main.go:12" {
+		t.Fatalf("Error() = %q", msg)
+	}
+}
+
+func TestIsConsumeInternalFrame(t *testing.T) {
+	tests := map[string]bool{
+		"github.com/Lyzin/go-requests/http_handler.ResponseToStruct":    true,
+		"github.com/Lyzin/go-requests/http_handler.(*trackedBody).Read": true,
+		"io.ReadAll":                      true,
+		"encoding/json.(*Decoder).Decode": true,
+		"net/http.(*Client).Do":           true,
+		"main.main":                       false,
+		"main.(*handler).ServeHTTP":       false,
+		"github.com/acme/billing/client.(*Client).Invoice":           false,
+		"github.com/Lyzin/go-requests/contrib/otel.(*spanBody).Read": false,
+		"example.com/internal/fetch.Run.func1":                       false,
+	}
+	for function, want := range tests {
+		if got := isConsumeInternalFrame(function); got != want {
+			t.Fatalf("isConsumeInternalFrame(%q) = %v, want %v", function, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package nhr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SavedCookie ExportCookies导出的cookie，URL为设置该cookie的响应对应的请求地址
+type SavedCookie struct {
+	URL      string        `json:"url"`
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Path     string        `json:"path,omitempty"`
+	Domain   string        `json:"domain,omitempty"`
+	Expires  time.Time     `json:"expires,omitempty"`
+	Secure   bool          `json:"secure,omitempty"`
+	HttpOnly bool          `json:"http_only,omitempty"`
+	SameSite http.SameSite `json:"same_site,omitempty"`
+}
+
+// recordingJar 包装cookiejar，记录服务端设置的完整cookie，标准库的cookiejar无法列出所有cookie
+type recordingJar struct {
+	http.CookieJar
+
+	mu      sync.Mutex
+	cookies map[string]SavedCookie
+}
+
+func newRecordingJar(jar http.CookieJar) *recordingJar {
+	return &recordingJar{CookieJar: jar, cookies: map[string]SavedCookie{}}
+}
+
+// maxCookiesPerResponse、maxJarCookies 会话从一个响应中接受的cookie数量以及会话保存的cookie总数上限
+// 有的服务一个响应会设置两三百个cookie，单个响应的上限需要留出余量；超出的cookie被丢弃，删除已有cookie不受限制
+const (
+	maxCookiesPerResponse = 512
+	maxJarCookies         = 3000
+)
+
+func (j *recordingJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if len(cookies) > maxCookiesPerResponse {
+		cookies = cookies[:maxCookiesPerResponse]
+	}
+	now := timeNow()
+	j.mu.Lock()
+	accepted := make([]*http.Cookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		saved := SavedCookie{
+			URL:      (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			SameSite: cookie.SameSite,
+		}
+		if cookie.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+		domain := cookie.Domain
+		if domain == "" {
+			domain = u.Hostname()
+		}
+		key := domain + ";" + cookie.Path + ";" + cookie.Name
+		if cookie.MaxAge < 0 || (!saved.Expires.IsZero() && !saved.Expires.After(now)) {
+			delete(j.cookies, key)
+			accepted = append(accepted, cookie)
+			continue
+		}
+		if _, ok := j.cookies[key]; !ok && len(j.cookies) >= maxJarCookies {
+			continue
+		}
+		j.cookies[key] = saved
+		accepted = append(accepted, cookie)
+	}
+	j.mu.Unlock()
+	j.CookieJar.SetCookies(u, accepted)
+}
+
+// export 返回没有过期的cookie，按key排序使导出结果稳定
+func (j *recordingJar) export() []SavedCookie {
+	now := timeNow()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	keys := make([]string, 0, len(j.cookies))
+	for key, cookie := range j.cookies {
+		if cookie.Expires.IsZero() || cookie.Expires.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	cookies := make([]SavedCookie, 0, len(keys))
+	for _, key := range keys {
+		cookies = append(cookies, j.cookies[key])
+	}
+	return cookies
+}
+
+// ExportCookies 将会话中没有过期的cookie序列化为JSON，用于进程重启后通过ImportCookies恢复会话
+// 只包含服务端通过Set-Cookie设置或通过ImportCookies导入的cookie
+func (s *Session) ExportCookies() ([]byte, error) {
+	return FastJsonMarshal(s.jar.export())
+}
+
+// ImportCookies 导入ExportCookies导出的cookie，已经过期的cookie会被忽略
+func (s *Session) ImportCookies(data []byte) error {
+	var cookies []SavedCookie
+	if err := FastJsonUnMarshal(data, &cookies); err != nil {
+		return fmt.Errorf("unMarshal cookies error:%v", err)
+	}
+	for _, saved := range cookies {
+		u, err := url.Parse(saved.URL)
+		if err != nil {
+			return fmt.Errorf("import cookie %v error:%w", saved.Name, err)
+		}
+		s.jar.SetCookies(u, []*http.Cookie{{
+			Name:     saved.Name,
+			Value:    saved.Value,
+			Path:     saved.Path,
+			Domain:   saved.Domain,
+			Expires:  saved.Expires,
+			Secure:   saved.Secure,
+			HttpOnly: saved.HttpOnly,
+			SameSite: saved.SameSite,
+		}})
+	}
+	return nil
+}
+
+// SaveCookies 将ExportCookies的结果写入文件
+func (s *Session) SaveCookies(path string) error {
+	data, err := s.ExportCookies()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("save cookies error:%w", err)
+	}
+	return nil
+}
+
+// LoadCookies 从SaveCookies写入的文件导入cookie
+func (s *Session) LoadCookies(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("load cookies error:%w", err)
+	}
+	return s.ImportCookies(data)
+}
@@ -0,0 +1,158 @@
+package nhr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionCookiesPerResponseCap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 2*maxCookiesPerResponse; i++ {
+			w.Header().Add("Set-Cookie", fmt.Sprintf("c%d=v", i))
+		}
+	}))
+	defer server.Close()
+
+	session := NewSession(server.URL)
+	response, err := session.Get("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if n := len(session.jar.export()); n != maxCookiesPerResponse {
+		t.Fatalf("session kept %v cookies from one response, want %v", n, maxCookiesPerResponse)
+	}
+	if n := len(session.Jar().Cookies(response.Request.URL)); n != maxCookiesPerResponse {
+		t.Fatalf("cookie jar sends %v cookies, want %v", n, maxCookiesPerResponse)
+	}
+}
+
+func TestRecordingJarTotalCap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	session := NewSession(server.URL)
+	u := mustParseURL(t, server.URL)
+
+	for i := 0; i < maxJarCookies/maxCookiesPerResponse+1; i++ {
+		cookies := make([]*http.Cookie, maxCookiesPerResponse)
+		for j := range cookies {
+			cookies[j] = &http.Cookie{Name: fmt.Sprintf("c%d_%d", i, j), Value: "v"}
+		}
+		session.jar.SetCookies(u, cookies)
+	}
+	if n := len(session.jar.export()); n != maxJarCookies {
+		t.Fatalf("session kept %v cookies, want the total cap %v", n, maxJarCookies)
+	}
+	// 达到上限之后依然可以删除cookie
+	session.jar.SetCookies(u, []*http.Cookie{{Name: "c0_0", MaxAge: -1}})
+	if n := len(session.jar.export()); n != maxJarCookies-1 {
+		t.Fatalf("deleting a cookie at the cap left %v cookies", n)
+	}
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestSessionKeepsEveryCookieOfLargeResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 250; i++ {
+			w.Header().Add("Set-Cookie", fmt.Sprintf("c%d=v%d", i, i))
+		}
+	}))
+	defer server.Close()
+
+	session := NewSession(server.URL)
+	response, err := session.Get("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	cookies := session.Jar().Cookies(response.Request.URL)
+	if len(cookies) != 250 {
+		t.Fatalf("cookie jar kept %v of 250 cookies", len(cookies))
+	}
+}
+
+func TestSessionCookiesSaveAndLoad(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s1", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "remember", Value: "r1", Path: "/", MaxAge: 3600})
+		case "/echo":
+			received = received[:0]
+			for _, cookie := range r.Cookies() {
+				received = append(received, cookie.Name+"="+cookie.Value)
+			}
+			sort.Strings(received)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	session := NewSession(server.URL)
+	response, err := session.Post("/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	if err := session.SaveCookies(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟文件保存之后已经过期的cookie
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []SavedCookie
+	if err := FastJsonUnMarshal(data, &saved); err != nil || len(saved) != 2 {
+		t.Fatalf("saved = %+v, %v, want both cookies", saved, err)
+	}
+	saved = append(saved, SavedCookie{URL: saved[0].URL, Name: "stale", Value: "x", Path: "/", Expires: time.Now().Add(-time.Hour)})
+	if data, err = FastJsonMarshal(saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewSession(server.URL)
+	if err := restored.LoadCookies(path); err != nil {
+		t.Fatal(err)
+	}
+	response, err = restored.Get("/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if strings.Join(received, ";") != "remember=r1;sid=s1" {
+		t.Fatalf("cookies sent = %v, want the saved cookies without the expired one", received)
+	}
+	exported, err := restored.ExportCookies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(exported), "stale") {
+		t.Fatalf("exported = %s, want the expired cookie dropped", exported)
+	}
+
+	if err := restored.LoadCookies(filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "load cookies error") {
+		t.Fatalf("error = %v, want a missing file reported", err)
+	}
+}
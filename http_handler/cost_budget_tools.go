@@ -0,0 +1,217 @@
+package nhr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCostBudgetExhausted 成本预算已经用完，ctx的截止时间早于预算重置的时间
+var ErrCostBudgetExhausted = errors.New("cost budget exhausted")
+
+// CostBudget 按响应报告的成本限速，例如按查询复杂度计费的GraphQL接口和按单位计费的云服务API
+type CostBudget struct {
+	// Budget 每个Window内可以消耗的成本，Window从第一个请求开始计算
+	Budget float64
+	Window time.Duration
+	// Header 响应中报告成本的响应头，例如X-Cost
+	Header string
+	// JSONPath 响应body中成本的路径，以.分隔，例如extensions.cost.actualQueryCost，响应头中没有成本时使用
+	// 设置之后中间件会读取整个响应body，不适合流式响应
+	JSONPath string
+	// DefaultCost 发送之前预留的成本，收到响应后按实际成本修正，响应中没有成本时按它计算，小于等于0时为1
+	DefaultCost float64
+}
+
+// CostBudgetState 当前窗口的成本预算，Spent包含已经预留但还没有收到响应的成本
+type CostBudgetState struct {
+	Budget    float64
+	Spent     float64
+	Remaining float64
+	// Reset 当前窗口结束、预算重置的时间
+	Reset time.Time
+}
+
+// CostBudgetCollector 可选的监控接口，MetricsCollector同时实现它时，通过WithMetrics接收预算的变化
+type CostBudgetCollector interface {
+	CostBudgetUpdated(state CostBudgetState)
+}
+
+// WithCostBudget 按响应报告的成本限速，发送之前预留DefaultCost，剩余预算不足时暂停到窗口结束
+// 需要等待的时间超过ctx的截止时间时直接返回ErrCostBudgetExhausted，WithNoRateLimit的请求不等待但仍然计入成本
+// 同一个Option的所有请求共享预算(不区分host)，通常在NewClient时设置，之后通过Client.CostBudgetState查询
+// 重试的每次尝试分别计算成本；Client.Batch在发起下一个请求之前检查预算
+func WithCostBudget(budget CostBudget) Option {
+	if budget.DefaultCost <= 0 {
+		budget.DefaultCost = 1
+	}
+	limiter := &costLimiter{config: budget}
+	return func(req *HttpRequests) {
+		req.costLimiter = limiter
+		req.Middlewares = append(append([]Middleware(nil), req.Middlewares...), limiter.middleware(req))
+	}
+}
+
+// CostBudgetState 返回当前窗口的成本预算，Client没有设置WithCostBudget时返回false
+func (c *Client) CostBudgetState() (CostBudgetState, bool) {
+	if c.costLimiter == nil {
+		return CostBudgetState{}, false
+	}
+	return c.costLimiter.state(), true
+}
+
+// costLimiter 记录当前窗口已经消耗的成本
+type costLimiter struct {
+	config CostBudget
+
+	mu sync.Mutex
+	// start 当前窗口开始的时间，spent 当前窗口已经消耗和预留的成本
+	start time.Time
+	spent float64
+}
+
+// costReservation 一个请求预留的成本，start用于判断修正时是否还在同一个窗口
+type costReservation struct {
+	start    time.Time
+	estimate float64
+}
+
+func (l *costLimiter) middleware(requestIns *HttpRequests) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			reservation, err := l.reserve(req.Context(), !requestIns.NoRateLimit)
+			if err != nil {
+				return nil, err
+			}
+			response, err := next(req)
+			if err == nil && response != nil {
+				var cost float64
+				var ok bool
+				if cost, ok, err = l.cost(response); ok {
+					l.settle(reservation, cost)
+				}
+				if err != nil {
+					response = nil
+				}
+			}
+			requestIns.reportCostBudget(l.state())
+			return response, err
+		}
+	}
+}
+
+// rollover 窗口已经结束时开始新的窗口，调用时需要持有锁
+func (l *costLimiter) rollover(now time.Time) {
+	if l.start.IsZero() || !now.Before(l.start.Add(l.config.Window)) {
+		l.start = now
+		l.spent = 0
+	}
+}
+
+// available 等待剩余预算足够预留DefaultCost，wait为false时不等待
+// 窗口内还没有消耗时总是可以发送，单个请求的成本超过Budget时不会一直等待
+func (l *costLimiter) available(ctx context.Context, wait bool) error {
+	for {
+		l.mu.Lock()
+		now := timeNow()
+		l.rollover(now)
+		if !wait || l.spent == 0 || l.spent+l.config.DefaultCost <= l.config.Budget {
+			l.mu.Unlock()
+			return nil
+		}
+		reset := l.start.Add(l.config.Window)
+		l.mu.Unlock()
+
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(reset) {
+			return fmt.Errorf("%w: resets at %v", ErrCostBudgetExhausted, reset.Format(time.RFC3339))
+		}
+		if err := sleepContext(ctx, reset.Sub(now)); err != nil {
+			return err
+		}
+	}
+}
+
+// reserve 等待预算并预留DefaultCost
+func (l *costLimiter) reserve(ctx context.Context, wait bool) (costReservation, error) {
+	for {
+		if err := l.available(ctx, wait); err != nil {
+			return costReservation{}, err
+		}
+		l.mu.Lock()
+		l.rollover(timeNow())
+		// 等待之后其他请求可能先预留了预算，重新检查
+		if !wait || l.spent == 0 || l.spent+l.config.DefaultCost <= l.config.Budget {
+			l.spent += l.config.DefaultCost
+			reservation := costReservation{start: l.start, estimate: l.config.DefaultCost}
+			l.mu.Unlock()
+			return reservation, nil
+		}
+		l.mu.Unlock()
+	}
+}
+
+// settle 按实际成本修正预留的成本，窗口已经重置时不再修正
+func (l *costLimiter) settle(reservation costReservation, cost float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.start.Equal(reservation.start) {
+		return
+	}
+	l.spent += cost - reservation.estimate
+	if l.spent < 0 {
+		l.spent = 0
+	}
+}
+
+// cost 从响应头或响应body中读取成本，读取body之后替换为可以重新读取的body，没有成本时返回false
+// 只有读取body失败时返回错误
+func (l *costLimiter) cost(response *http.Response) (float64, bool, error) {
+	if l.config.Header != "" {
+		if value := strings.TrimSpace(response.Header.Get(l.config.Header)); value != "" {
+			cost, err := strconv.ParseFloat(value, 64)
+			return cost, err == nil && cost >= 0, nil
+		}
+	}
+	if l.config.JSONPath == "" || response.Body == nil || response.Body == http.NoBody {
+		return 0, false, nil
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return 0, false, fmt.Errorf("read cost from response body error:%w", err)
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	value, err := extractJSONPath(body, l.config.JSONPath)
+	if err != nil {
+		return 0, false, nil
+	}
+	cost, err := strconv.ParseFloat(value, 64)
+	return cost, err == nil && cost >= 0, nil
+}
+
+func (l *costLimiter) state() CostBudgetState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(timeNow())
+	remaining := l.config.Budget - l.spent
+	if remaining < 0 {
+		remaining = 0
+	}
+	return CostBudgetState{Budget: l.config.Budget, Spent: l.spent, Remaining: remaining, Reset: l.start.Add(l.config.Window)}
+}
+
+// reportCostBudget 将预算的变化上报给实现了CostBudgetCollector的监控
+func (r *HttpRequests) reportCostBudget(state CostBudgetState) {
+	for _, collector := range r.collectors {
+		if c, ok := collector.(CostBudgetCollector); ok {
+			c.CostBudgetUpdated(state)
+		}
+	}
+}
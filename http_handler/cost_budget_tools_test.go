@@ -0,0 +1,196 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// costServer 每个响应都在X-Cost中报告cost，cost为空时不返回X-Cost
+func costServer(t *testing.T, cost, body string) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if cost != "" {
+			w.Header().Set("X-Cost", cost)
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+// costBudgetRecorder 记录CostBudgetUpdated收到的预算
+type costBudgetRecorder struct {
+	mu     sync.Mutex
+	states []CostBudgetState
+}
+
+func (r *costBudgetRecorder) RequestStarted(string, string)   {}
+func (r *costBudgetRecorder) RequestFinished(*RequestMetrics) {}
+func (r *costBudgetRecorder) CostBudgetUpdated(state CostBudgetState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, state)
+}
+
+func TestCostBudgetCorrectsEstimate(t *testing.T) {
+	server, _ := costServer(t, "3", "")
+	recorder := &costBudgetRecorder{}
+	client, err := NewClient(WithMetrics(recorder), WithCostBudget(CostBudget{Budget: 10, Window: time.Hour, Header: "X-Cost"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	for i := 0; i < 2; i++ {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+	state, ok := client.CostBudgetState()
+	if !ok || state.Spent != 6 || state.Remaining != 4 || state.Budget != 10 {
+		t.Fatalf("state = %+v, %v, want 6 spent and 4 remaining", state, ok)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.states) != 2 || recorder.states[1].Remaining != 4 {
+		t.Fatalf("collector received %+v", recorder.states)
+	}
+}
+
+func TestCostBudgetDefaultCostWithoutHeader(t *testing.T) {
+	server, _ := costServer(t, "", "")
+	client, err := NewClient(WithCostBudget(CostBudget{Budget: 10, Window: time.Hour, Header: "X-Cost", DefaultCost: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if state, _ := client.CostBudgetState(); state.Spent != 2 {
+		t.Fatalf("Spent = %v, want the default estimate when the response reports no cost", state.Spent)
+	}
+}
+
+func TestCostBudgetFromJSONPath(t *testing.T) {
+	body := `{"data":{},"extensions":{"cost":{"actualQueryCost":2.5}}}`
+	server, _ := costServer(t, "", body)
+	client, err := NewClient(WithCostBudget(CostBudget{Budget: 10, Window: time.Hour, Header: "X-Cost", JSONPath: "extensions.cost.actualQueryCost"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	got, err := ioutil.ReadAll(response.Body)
+	if err != nil || string(got) != body {
+		t.Fatalf("body = %q, %v, want the body to stay readable", got, err)
+	}
+	if state, _ := client.CostBudgetState(); state.Spent != 2.5 {
+		t.Fatalf("Spent = %v, want the cost from the JSON path", state.Spent)
+	}
+}
+
+func TestCostBudgetExhausted(t *testing.T) {
+	server, hits := costServer(t, "5", "")
+	client, err := NewClient(WithCostBudget(CostBudget{Budget: 5, Window: time.Hour, Header: "X-Cost"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	// 截止时间早于窗口结束时不等待
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.Get(server.URL, WithContext(ctx))
+	if !errors.Is(err, ErrCostBudgetExhausted) {
+		t.Fatalf("error = %v, want ErrCostBudgetExhausted", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("waited %v although the deadline is before the reset", elapsed)
+	}
+
+	// WithNoRateLimit不等待，但仍然计入成本
+	response, err = client.Get(server.URL, WithContext(ctx), WithNoRateLimit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Fatalf("server received %v requests, want 2", n)
+	}
+	if state, _ := client.CostBudgetState(); state.Spent != 10 || state.Remaining != 0 {
+		t.Fatalf("state = %+v, want the bypassed request counted", state)
+	}
+}
+
+func TestCostBudgetPausesUntilWindowEnds(t *testing.T) {
+	server, _ := costServer(t, "1", "")
+	client, err := NewClient(WithCostBudget(CostBudget{Budget: 1, Window: 300 * time.Millisecond, Header: "X-Cost"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatalf("second request sent after %v, want a pause until the window ends", elapsed)
+	}
+}
+
+func TestBatchChecksCostBudget(t *testing.T) {
+	server, hits := costServer(t, "5", "")
+	client, err := NewClient(WithCostBudget(CostBudget{Budget: 5, Window: time.Hour, Header: "X-Cost"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	requests := make([]BatchRequest, 3)
+	for i := range requests {
+		requests[i] = BatchRequest{Method: http.MethodGet, URL: server.URL}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	results, err := client.Batch(ctx, requests, 1)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+		t.Fatalf("error = %v, want 2 items stopped by the budget", err)
+	}
+	for _, item := range batchErr.Errors {
+		if !errors.Is(item.Err, ErrCostBudgetExhausted) || item.Attempts != 0 {
+			t.Fatalf("item %v = %v after %v attempts, want ErrCostBudgetExhausted before sending", item.Index, item.Err, item.Attempts)
+		}
+	}
+	if results[0].Err != nil {
+		t.Fatalf("first item error = %v", results[0].Err)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Fatalf("server received %v requests, want 1", n)
+	}
+}
@@ -0,0 +1,187 @@
+package nhr
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// CSVOption ResponseToCSV系列函数的配置
+type CSVOption func(*csvConfig)
+
+type csvConfig struct {
+	delimiter rune
+	charset   string
+}
+
+// WithCSVDelimiter 设置字段分隔符，默认为逗号
+func WithCSVDelimiter(delimiter rune) CSVOption {
+	return func(c *csvConfig) {
+		c.delimiter = delimiter
+	}
+}
+
+// WithCSVCharset 设置body的字符集，如gbk、shift_jis，默认使用Content-Type中的charset，都没有时按UTF-8处理
+func WithCSVCharset(charset string) CSVOption {
+	return func(c *csvConfig) {
+		c.charset = charset
+	}
+}
+
+// ResponseToCSV 流式读取CSV响应，每读到一条记录调用一次fn，fn返回错误时停止读取并返回该错误
+// 与ResponseToStruct一样只接受2xx响应；开头的UTF-8 BOM会被去掉，引号中的换行按字段内容处理
+func ResponseToCSV(responseIns *http.Response, fn func(record []string) error, options ...CSVOption) error {
+	if err := checkBodyConsumable(responseIns); err != nil {
+		return err
+	}
+	defer responseIns.Body.Close()
+	if err := checkResponseStatus(responseIns); err != nil {
+		return err
+	}
+	reader, err := newCSVReader(responseIns, options)
+	if err != nil {
+		return err
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read csv error:%w", err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// ResponseToCSVMaps 第一行作为表头，之后每条记录转为表头到字段值的map后调用fn
+func ResponseToCSVMaps(responseIns *http.Response, fn func(record map[string]string) error, options ...CSVOption) error {
+	var header []string
+	return ResponseToCSV(responseIns, func(record []string) error {
+		if header == nil {
+			header = record
+			return nil
+		}
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(record) {
+				row[name] = record[i]
+			}
+		}
+		return fn(row)
+	}, options...)
+}
+
+// ResponseToCSVStructs 第一行作为表头，把记录解码到v指向的结构体切片中
+// 字段通过csv标签与表头对应，规则和支持的类型与ParseQueryInto的url标签相同，表头中没有的字段和空值保持零值
+func ResponseToCSVStructs(responseIns *http.Response, v interface{}, options ...CSVOption) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("ResponseToCSVStructs requires a non-nil pointer to slice")
+	}
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	structType := elemType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("ResponseToCSVStructs requires a slice of structs, got %v", slice.Type())
+	}
+
+	var columns []csvColumn
+	line := 0
+	return ResponseToCSV(responseIns, func(record []string) error {
+		line++
+		if columns == nil {
+			columns = csvColumns(structType, record)
+			return nil
+		}
+		elem := reflect.New(structType).Elem()
+		for _, column := range columns {
+			if column.index >= len(record) || record[column.index] == "" {
+				continue
+			}
+			if err := setQueryScalar(elem.Field(column.field), record[column.index], column.tag); err != nil {
+				return fmt.Errorf("decode csv line %v column %q into field %v failed:%v", line, column.tag.name, structType.Field(column.field).Name, err)
+			}
+		}
+		if elemType.Kind() == reflect.Ptr {
+			elem = elem.Addr()
+		}
+		slice.Set(reflect.Append(slice, elem))
+		return nil
+	}, options...)
+}
+
+// csvColumn 结构体字段与CSV列的对应关系
+type csvColumn struct {
+	field int
+	index int
+	tag   urlTag
+}
+
+// csvColumns 按表头匹配结构体的导出字段
+func csvColumns(structType reflect.Type, header []string) []csvColumn {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		if _, ok := positions[name]; !ok {
+			positions[name] = i
+		}
+	}
+	columns := []csvColumn{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag, skip := parseFieldTag(field, "csv")
+		if skip {
+			continue
+		}
+		if index, ok := positions[tag.name]; ok {
+			columns = append(columns, csvColumn{field: i, index: index, tag: tag})
+		}
+	}
+	return columns
+}
+
+// newCSVReader 按字符集转换body并去掉BOM
+func newCSVReader(responseIns *http.Response, options []CSVOption) (*csv.Reader, error) {
+	config := &csvConfig{delimiter: ','}
+	for _, option := range options {
+		option(config)
+	}
+	charset := config.charset
+	if charset == "" {
+		if _, params, err := mime.ParseMediaType(responseIns.Header.Get("Content-Type")); err == nil {
+			charset = params["charset"]
+		}
+	}
+	var body io.Reader = responseIns.Body
+	if charset != "" && !strings.EqualFold(charset, "utf-8") && !strings.EqualFold(charset, "utf8") {
+		encoding, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported csv charset %q:%v", charset, err)
+		}
+		body = transform.NewReader(body, encoding.NewDecoder())
+	}
+	buffered := bufio.NewReader(body)
+	if bom, err := buffered.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		_, _ = buffered.Discard(3)
+	}
+	reader := csv.NewReader(buffered)
+	reader.Comma = config.delimiter
+	return reader, nil
+}
@@ -0,0 +1,143 @@
+package nhr
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestResponseToCSV(t *testing.T) {
+	server := contentServer(t, "text/csv", "\xef\xbb\xbfid,note\n1,\"multi\nline\"\n2,\"a \"\"quoted\"\" word\"\n")
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records [][]string
+	if err := ResponseToCSV(response, func(record []string) error {
+		records = append(records, record)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][0] != "id" || records[1][1] != "multi\nline" || records[2][1] != `a "quoted" word` {
+		t.Fatalf("records = %q, want the BOM removed and quoted fields kept", records)
+	}
+}
+
+func TestResponseToCSVOptions(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String("城市;人口\n北京;2189\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		options     []CSVOption
+	}{
+		{name: "charset from content type", contentType: "text/csv; charset=gbk", options: []CSVOption{WithCSVDelimiter(';')}},
+		{name: "charset option", contentType: "text/csv", options: []CSVOption{WithCSVDelimiter(';'), WithCSVCharset("GBK")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := contentServer(t, tt.contentType, gbk)
+			response, err := Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rows []map[string]string
+			if err := ResponseToCSVMaps(response, func(row map[string]string) error {
+				rows = append(rows, row)
+				return nil
+			}, tt.options...); err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || rows[0]["城市"] != "北京" || rows[0]["人口"] != "2189" {
+				t.Fatalf("rows = %v, want the GBK body decoded", rows)
+			}
+		})
+	}
+
+	server := contentServer(t, "text/csv; charset=x-unknown", "a\n")
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ResponseToCSV(response, func([]string) error { return nil }); err == nil || !strings.Contains(err.Error(), "unsupported csv charset") {
+		t.Fatalf("error = %v, want an unsupported charset error", err)
+	}
+}
+
+func TestResponseToCSVStops(t *testing.T) {
+	server := contentServer(t, "text/csv", "a\nb\nc\n")
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errStop := errors.New("stop")
+	var seen int
+	err = ResponseToCSV(response, func([]string) error {
+		if seen++; seen == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || seen != 2 {
+		t.Fatalf("error = %v after %v records, want fn's error to stop reading", err, seen)
+	}
+
+	statusServer, _ := countingServer(t, http.StatusInternalServerError)
+	response, err = Get(statusServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statusErr *StatusError
+	if err := ResponseToCSV(response, func([]string) error { return nil }); !errors.As(err, &statusErr) {
+		t.Fatalf("error = %v, want a StatusError", err)
+	}
+}
+
+type csvOrder struct {
+	ID     int      `csv:"id"`
+	Amount float64  `csv:"amount"`
+	Paid   bool     `csv:"paid"`
+	Note   *string  `csv:"note"`
+	Tags   []string `csv:"-"`
+	hidden string
+}
+
+func TestResponseToCSVStructs(t *testing.T) {
+	server := contentServer(t, "text/csv", "amount,id,note,extra,paid\n9.5,1,first,x,true\n,2,,y,false\n")
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orders []*csvOrder
+	if err := ResponseToCSVStructs(response, &orders); err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 || orders[0].ID != 1 || orders[0].Amount != 9.5 || !orders[0].Paid || orders[0].Note == nil || *orders[0].Note != "first" {
+		t.Fatalf("orders[0] = %+v", orders[0])
+	}
+	if orders[1].ID != 2 || orders[1].Amount != 0 || orders[1].Note != nil {
+		t.Fatalf("orders[1] = %+v, want empty values left as zero", orders[1])
+	}
+
+	server = contentServer(t, "text/csv", "id\nabc\n")
+	response, err = Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bad []csvOrder
+	if err := ResponseToCSVStructs(response, &bad); err == nil || !strings.Contains(err.Error(), `decode csv line 2 column "id" into field ID`) {
+		t.Fatalf("error = %v, want the line and column reported", err)
+	}
+	if err := ResponseToCSVStructs(response, []csvOrder{}); err == nil {
+		t.Fatal("a non-pointer should be rejected")
+	}
+	if err := ResponseToCSVStructs(response, &[]int{}); err == nil {
+		t.Fatal("a slice of non-structs should be rejected")
+	}
+}
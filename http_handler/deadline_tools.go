@@ -0,0 +1,71 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultDeadlineHeader 传递剩余时间预算的默认请求头，值为毫秒数
+const DefaultDeadlineHeader = "X-Request-Timeout-Ms"
+
+// ErrDeadlineBudgetExhausted 剩余时间预算减去安全余量后低于下限，不再发起请求
+var ErrDeadlineBudgetExhausted error = &kindError{kind: "deadline_budget", message: "deadline budget exhausted"}
+
+// WithDeadlinePropagation 将ctx截止时间的剩余毫秒数写入headerName请求头，headerName为空时使用DefaultDeadlineHeader
+// ctx没有截止时间时不设置该请求头；单次尝试的超时不计入预算
+func WithDeadlinePropagation(headerName string) Option {
+	return func(req *HttpRequests) {
+		if headerName == "" {
+			headerName = DefaultDeadlineHeader
+		}
+		req.DeadlineHeader = headerName
+	}
+}
+
+// WithDeadlineBudget 单次尝试的超时不超过ctx的剩余时间减去margin，传递的预算同样减去margin
+// 剩余时间减去margin后低于floor时不发起请求，返回ErrDeadlineBudgetExhausted
+func WithDeadlineBudget(margin, floor time.Duration) Option {
+	return func(req *HttpRequests) {
+		req.DeadlineBudget = true
+		req.DeadlineMargin = margin
+		req.DeadlineFloor = floor
+	}
+}
+
+// deadlineBudget 根据ctx的截止时间计算单次尝试的超时和需要传递的预算
+func deadlineBudget(ctx context.Context, requestIns *HttpRequests) (time.Duration, string, error) {
+	timeout := requestIns.Timeout
+	deadline, ok := ctx.Deadline()
+	if !ok || (requestIns.DeadlineHeader == "" && !requestIns.DeadlineBudget) {
+		return timeout, "", nil
+	}
+	remaining := deadline.Sub(timeNow())
+	if requestIns.DeadlineBudget {
+		remaining -= requestIns.DeadlineMargin
+		if remaining <= 0 || remaining < requestIns.DeadlineFloor {
+			return 0, "", ErrDeadlineBudgetExhausted
+		}
+		if timeout <= 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	return timeout, strconv.FormatInt(int64(remaining/time.Millisecond), 10), nil
+}
+
+// ContextWithDeadlineHeader 服务端使用，按请求头中的剩余毫秒数为请求的context设置截止时间
+// headerName为空时使用DefaultDeadlineHeader，请求头不存在或不合法时只返回可取消的context
+func ContextWithDeadlineHeader(r *http.Request, headerName string) (context.Context, context.CancelFunc) {
+	if headerName == "" {
+		headerName = DefaultDeadlineHeader
+	}
+	ms, err := strconv.ParseInt(r.Header.Get(headerName), 10, 64)
+	if err != nil || ms < 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), time.Duration(ms)*time.Millisecond)
+}
@@ -0,0 +1,112 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeadlineBudget(t *testing.T) {
+	clock := newFakeClock(t)
+	withDeadline := func(d time.Duration) context.Context {
+		ctx, cancel := context.WithDeadline(context.Background(), clock.now.Add(d))
+		t.Cleanup(cancel)
+		return ctx
+	}
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		options []Option
+		timeout time.Duration
+		header  string
+		err     error
+	}{
+		{name: "no deadline", ctx: context.Background(), options: []Option{WithTimeout(time.Second), WithDeadlinePropagation("")}, timeout: time.Second},
+		{name: "propagation only", ctx: withDeadline(3 * time.Second), options: []Option{WithTimeout(time.Second), WithDeadlinePropagation("")}, timeout: time.Second, header: "3000"},
+		{name: "neither option", ctx: withDeadline(3 * time.Second), options: []Option{WithTimeout(time.Second)}, timeout: time.Second},
+		{name: "budget caps timeout", ctx: withDeadline(3 * time.Second), options: []Option{WithTimeout(5 * time.Second), WithDeadlineBudget(500*time.Millisecond, 0)}, timeout: 2500 * time.Millisecond, header: "2500"},
+		{name: "budget without timeout", ctx: withDeadline(3 * time.Second), options: []Option{WithTimeout(0), WithDeadlineBudget(0, 0)}, timeout: 3 * time.Second, header: "3000"},
+		{name: "shorter timeout kept", ctx: withDeadline(3 * time.Second), options: []Option{WithTimeout(time.Second), WithDeadlineBudget(0, 0)}, timeout: time.Second, header: "3000"},
+		{name: "below floor", ctx: withDeadline(time.Second), options: []Option{WithDeadlineBudget(800*time.Millisecond, 500*time.Millisecond)}, err: ErrDeadlineBudgetExhausted},
+		{name: "margin exceeds remaining", ctx: withDeadline(time.Second), options: []Option{WithDeadlineBudget(2*time.Second, 0)}, err: ErrDeadlineBudgetExhausted},
+		{name: "expired propagation", ctx: withDeadline(-time.Second), options: []Option{WithDeadlinePropagation("X-Budget")}, timeout: defaultTimeoutFor(t), header: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestIns := newHttpRequests(http.MethodGet, "", tt.options...)
+			timeout, header, err := deadlineBudget(tt.ctx, requestIns)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil || timeout != tt.timeout || header != tt.header {
+				t.Fatalf("deadlineBudget = %v, %q, %v, want %v, %q", timeout, header, err, tt.timeout, tt.header)
+			}
+		})
+	}
+}
+
+// defaultTimeoutFor 没有设置WithTimeout时请求的默认超时
+func defaultTimeoutFor(t *testing.T) time.Duration {
+	t.Helper()
+	return newHttpRequests(http.MethodGet, "").Timeout
+}
+
+func TestDeadlinePropagationRoundTrip(t *testing.T) {
+	var remaining int64 = -1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := ContextWithDeadlineHeader(r, "")
+		defer cancel()
+		if deadline, ok := ctx.Deadline(); ok {
+			atomic.StoreInt64(&remaining, int64(time.Until(deadline)))
+		}
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	response, err := Get(server.URL, WithContext(ctx), WithDeadlineBudget(500*time.Millisecond, 100*time.Millisecond), WithDeadlinePropagation(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if got := time.Duration(atomic.LoadInt64(&remaining)); got <= time.Second || got > 1500*time.Millisecond {
+		t.Fatalf("server deadline in %v, want about 1.5s", got)
+	}
+
+	// 预算不足时不发送请求
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Get(server.URL, WithContext(ctx), WithDeadlineBudget(100*time.Millisecond, 0)); !errors.Is(err, ErrDeadlineBudgetExhausted) {
+		t.Fatalf("error = %v, want ErrDeadlineBudgetExhausted", err)
+	}
+}
+
+func TestContextWithDeadlineHeader(t *testing.T) {
+	for value, want := range map[string]bool{"250": true, "0": true, "": false, "abc": false, "-5": false} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Budget", value)
+		ctx, cancel := ContextWithDeadlineHeader(r, "X-Budget")
+		_, ok := ctx.Deadline()
+		cancel()
+		if ok != want {
+			t.Fatalf("header %q: deadline set = %v, want %v", value, ok, want)
+		}
+		if ctx.Err() == nil {
+			t.Fatalf("header %q: cancel should cancel the context", value)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(DefaultDeadlineHeader, strconv.Itoa(100))
+	ctx, cancel := ContextWithDeadlineHeader(r, "")
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > 100*time.Millisecond {
+		t.Fatalf("deadline = %v, %v, want the default header used", deadline, ok)
+	}
+}
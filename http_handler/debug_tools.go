@@ -0,0 +1,363 @@
+package nhr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogEntry 一次尝试的请求和响应，敏感的请求头、响应头和URL参数已经替换为***
+type LogEntry struct {
+	Method          string
+	URL             string
+	RequestHeaders  http.Header
+	RequestBody     string
+	Status          int
+	ResponseHeaders http.Header
+	ResponseBody    string
+	// Elapsed 发送请求到收到响应头的时间，不包含读取body的时间
+	Elapsed time.Duration
+	Err     error
+	// Warning 不为空时是本包对这个请求的告警，而不是请求日志，只有Method、URL和Labels有值
+	Warning string
+	// Labels 请求通过WithLabel、WithLabels设置的label，没有时为nil
+	Labels map[string]string
+}
+
+// Logger 接收请求日志，可以在实现中转为zap、logrus等日志库的结构化字段
+type Logger interface {
+	LogRequest(ctx context.Context, entry *LogEntry)
+}
+
+// LoggerFunc 将普通函数转为Logger
+type LoggerFunc func(ctx context.Context, entry *LogEntry)
+
+func (f LoggerFunc) LogRequest(ctx context.Context, entry *LogEntry) {
+	f(ctx, entry)
+}
+
+// NewStdLogger 使用标准库的log.Logger按行输出请求日志，l为nil时使用log的默认Logger
+func NewStdLogger(l *log.Logger) Logger {
+	printf := log.Printf
+	if l != nil {
+		printf = l.Printf
+	}
+	return LoggerFunc(func(_ context.Context, entry *LogEntry) {
+		if entry.Warning != "" && entry.Method == "" {
+			printf("nhr: warning: %v", entry.Warning)
+			return
+		}
+		if entry.Warning != "" {
+			printf("nhr: %v %v warning: %v", entry.Method, entry.URL, entry.Warning)
+			return
+		}
+		if entry.Err != nil {
+			printf("nhr: %v %v error=%v elapsed=%v", entry.Method, entry.URL, redactSecrets(entry.Err.Error()), entry.Elapsed)
+			return
+		}
+		printf("nhr: %v %v status=%v elapsed=%v request_headers=%v request_body=%q response_headers=%v response_body=%q",
+			entry.Method, entry.URL, entry.Status, entry.Elapsed, entry.RequestHeaders, entry.RequestBody, entry.ResponseHeaders, entry.ResponseBody)
+	})
+}
+
+// sensitiveHeaders 日志、fixture和dump中值会被替换为***的请求头和响应头
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// redactHeaders 复制header并将敏感的值替换为***，key转为规范格式，header为空时返回nil
+func redactHeaders(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		values = append([]string(nil), values...)
+		if sensitiveHeaders[http.CanonicalHeaderKey(key)] {
+			for i := range values {
+				values[i] = "***"
+			}
+		}
+		redacted[http.CanonicalHeaderKey(key)] = values
+	}
+	return redacted
+}
+
+// maxLoggedHeaderValues 日志中每个头部最多记录的值，例如几百个Set-Cookie只记录前几个
+const maxLoggedHeaderValues = 5
+
+// summarizeHeaders 与redactHeaders相同，每个头部最多保留maxLoggedHeaderValues个值，其余的合并为一个"(N more)"
+// 只复制保留的值，几百个重复的头部不会被整体复制
+func summarizeHeaders(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	summary := make(http.Header, len(header))
+	for key, values := range header {
+		key = http.CanonicalHeaderKey(key)
+		kept := values
+		if len(kept) > maxLoggedHeaderValues {
+			kept = kept[:maxLoggedHeaderValues]
+		}
+		copied := make([]string, len(kept), len(kept)+1)
+		for i, value := range kept {
+			if sensitiveHeaders[key] {
+				value = "***"
+			}
+			copied[i] = value
+		}
+		if len(values) > len(kept) {
+			copied = append(copied, fmt.Sprintf("(%d more)", len(values)-len(kept)))
+		}
+		summary[key] = copied
+	}
+	return summary
+}
+
+// WithLogger 设置接收告警的Logger，优先于SetLogger，例如GET请求带有body、非幂等的请求跳过了重试，同一个请求只告警一次
+func WithLogger(logger Logger) Option {
+	return func(req *HttpRequests) {
+		req.Logger = logger
+	}
+}
+
+// warnf 没有设置Logger时打印告警信息
+var warnf = log.Printf
+
+var (
+	packageLoggerMu sync.RWMutex
+	packageLogger   Logger
+)
+
+// SetLogger 设置接收告警的默认Logger，没有通过WithLogger设置Logger的请求以及MontageUrl等与请求无关的告警都使用它
+// 为nil时使用标准库的log输出
+func SetLogger(logger Logger) {
+	packageLoggerMu.Lock()
+	defer packageLoggerMu.Unlock()
+	packageLogger = logger
+}
+
+func defaultLogger() Logger {
+	packageLoggerMu.RLock()
+	defer packageLoggerMu.RUnlock()
+	return packageLogger
+}
+
+// logWarning 输出与请求无关的告警，其中的敏感参数会被替换
+func logWarning(message string) {
+	entry := &LogEntry{Warning: redactSecrets(message)}
+	if logger := defaultLogger(); logger != nil {
+		logger.LogRequest(context.Background(), entry)
+		return
+	}
+	warnf("nhr: warning: %v", entry.Warning)
+}
+
+// warnOnce 通过Logger输出告警，key相同的告警每个请求只输出一次，URL中的敏感参数会被替换
+func (r *HttpRequests) warnOnce(ctx context.Context, key, message string) {
+	if r.warned[key] {
+		return
+	}
+	if r.warned == nil {
+		r.warned = map[string]bool{}
+	}
+	r.warned[key] = true
+	entry := &LogEntry{Method: r.Method, URL: redactSecrets(r.URL), Warning: message, Labels: copyLabels(r.Labels)}
+	logger := r.Logger
+	if logger == nil {
+		logger = defaultLogger()
+	}
+	if logger != nil {
+		logger.LogRequest(ctx, entry)
+		return
+	}
+	warnf("nhr: %v %v warning: %v", entry.Method, entry.URL, entry.Warning)
+}
+
+// WithDebug 记录每次尝试的method、URL、请求头、状态码、响应头和耗时，见DebugMiddleware
+func WithDebug(logger Logger, bodyLimit int) Option {
+	return WithMiddleware(DebugMiddleware(logger, bodyLimit))
+}
+
+// DebugMiddleware 记录请求日志的中间件，可以通过Client.Use为Client的所有请求开启
+// 请求和响应body最多记录bodyLimit字节，为0时不记录body；记录的是解压之前的响应body
+// multipart和长度未知的请求body不会被读取，只记录占位文字
+// 同一个请求头或响应头最多记录maxLoggedHeaderValues个值，例如大量的Set-Cookie只记录前几个和剩余的数量
+// 记录响应body需要先读取bodyLimit字节，对于持续推送的流式响应会等到读够或者流结束
+func DebugMiddleware(logger Logger, bodyLimit int) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			entry := &LogEntry{
+				Method:         req.Method,
+				URL:            redactSecrets(req.URL.String()),
+				RequestHeaders: summarizeHeaders(req.Header),
+				Labels:         LabelsFromContext(req.Context()),
+			}
+			if bodyLimit > 0 {
+				entry.RequestBody = requestLogBody(req, bodyLimit)
+			}
+			start := timeNow()
+			response, err := next(req)
+			entry.Elapsed = timeNow().Sub(start)
+			if err != nil {
+				entry.Err = err
+				logger.LogRequest(req.Context(), entry)
+				return response, err
+			}
+			entry.Status = response.StatusCode
+			entry.ResponseHeaders = summarizeHeaders(response.Header)
+			if bodyLimit > 0 && response.Body != nil {
+				head, err := ioutil.ReadAll(io.LimitReader(response.Body, int64(bodyLimit)))
+				entry.ResponseBody = redactSecrets(string(head))
+				var rest io.Reader = response.Body
+				if err != nil {
+					rest = errReader{err}
+				}
+				response.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(head), rest), closer: response.Body}
+			}
+			logger.LogRequest(req.Context(), entry)
+			return response, nil
+		}
+	}
+}
+
+// requestLogBody 返回日志中记录的请求body
+// 只有长度已知、可以通过GetBody重新获取的body会被读取，multipart和其他流式的body读取时会与发送争抢同一个来源，只记录占位文字
+func requestLogBody(req *http.Request, limit int) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+	if strings.HasPrefix(mediaType(req.Header.Get("Content-Type")), "multipart/") {
+		return "<multipart body omitted>"
+	}
+	if req.GetBody == nil || req.ContentLength <= 0 {
+		return "<streamed body omitted>"
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	return readLogBody(body, limit)
+}
+
+// readLogBody 读取最多limit字节用于日志
+func readLogBody(body io.Reader, limit int) string {
+	head, _ := ioutil.ReadAll(io.LimitReader(body, int64(limit)))
+	return redactSecrets(string(head))
+}
+
+// prefixedBody 先返回已经读取的内容再继续读取原始body，Close关闭原始body
+type prefixedBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (b *prefixedBody) Close() error {
+	return b.closer.Close()
+}
+
+// errReader 读取时返回固定的错误
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// WithDump 将每次尝试的请求和响应以HTTP报文的格式写入w，用于提交bug时附上完整的交互过程
+// 请求和响应body会整体读入内存，不适合大文件下载；敏感的请求头和URL参数会被替换为***
+// 同时设置了WithConfigTrace时，在请求报文之前输出请求头和查询参数的来源
+func WithDump(w io.Writer) Option {
+	var mu sync.Mutex
+	return WithMiddleware(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			requestDump, err := DumpRequest(req)
+			if err != nil {
+				return nil, err
+			}
+			response, err := next(req)
+			var responseDump []byte
+			if err == nil {
+				if responseDump, err = DumpResponse(response); err != nil {
+					_ = response.Body.Close()
+					return nil, err
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if trace, ok := req.Context().Value(configTraceContextKey{}).(*ConfigTrace); ok {
+				_, _ = fmt.Fprintf(w, "config trace:\n%v\n", trace)
+			}
+			_, _ = w.Write(requestDump)
+			_, _ = io.WriteString(w, "\n\n")
+			if responseDump != nil {
+				_, _ = w.Write(responseDump)
+				_, _ = io.WriteString(w, "\n\n")
+			} else {
+				_, _ = fmt.Fprintf(w, "error: %v\n\n", redactSecrets(err.Error()))
+			}
+			return response, err
+		}
+	})
+}
+
+// DumpRequest 以HTTP报文的格式输出待发送的请求，包含body，body读取后会恢复
+// 敏感的请求头和URL参数会被替换为***
+func DumpRequest(req *http.Request) ([]byte, error) {
+	dump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		return nil, fmt.Errorf("dump request error:%w", err)
+	}
+	return redactDump(dump), nil
+}
+
+// DumpResponse 以HTTP报文的格式输出响应，包含body，body读取后会恢复
+// 敏感的响应头会被替换为***
+func DumpResponse(response *http.Response) ([]byte, error) {
+	dump, err := httputil.DumpResponse(response, true)
+	if err != nil {
+		return nil, fmt.Errorf("dump response error:%w", err)
+	}
+	return redactDump(dump), nil
+}
+
+// redactDump 替换报文头部中敏感的请求头，以及起始行和body中的敏感URL参数
+func redactDump(dump []byte) []byte {
+	var out bytes.Buffer
+	reader := bufio.NewReader(bytes.NewReader(dump))
+	inHeader := true
+	for first := true; ; first = false {
+		line, err := reader.ReadString('\n')
+		if inHeader {
+			trimmed := strings.TrimRight(line, "\r\n")
+			if trimmed == "" && !first {
+				inHeader = false
+			} else if i := strings.IndexByte(trimmed, ':'); !first && i > 0 && sensitiveHeaders[http.CanonicalHeaderKey(trimmed[:i])] {
+				line = trimmed[:i] + ": ***" + line[len(trimmed):]
+			} else if first {
+				line = redactSecrets(line)
+			}
+			out.WriteString(line)
+		} else {
+			out.WriteString(redactSecrets(line))
+		}
+		if err != nil {
+			return out.Bytes()
+		}
+	}
+}
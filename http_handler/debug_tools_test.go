@@ -0,0 +1,209 @@
+package nhr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// requestLogRecorder 记录收到的请求日志
+type requestLogRecorder struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+func (r *requestLogRecorder) LogRequest(_ context.Context, entry *LogEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, *entry)
+}
+
+func (r *requestLogRecorder) last(t *testing.T) LogEntry {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == 0 {
+		t.Fatal("no request was logged")
+	}
+	return r.entries[len(r.entries)-1]
+}
+
+// secretServer 返回带有Set-Cookie和敏感URL参数的响应
+func secretServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=s3cret")
+		w.Header().Set("X-Request-Id", "r1")
+		w.Write([]byte(`{"next":"/orders?page=2&token=t0k3n","padding":"0123456789"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// largeHeader 合成的300个响应头，其中200个是Set-Cookie
+func largeHeader() http.Header {
+	header := http.Header{}
+	for i := 0; i < 200; i++ {
+		header.Add("Set-Cookie", fmt.Sprintf("session_part_%d=%032d; Path=/; HttpOnly", i, i))
+	}
+	for i := 0; i < 100; i++ {
+		header.Set(fmt.Sprintf("X-Vendor-Trace-%d", i), fmt.Sprintf("value-%d", i))
+	}
+	return header
+}
+
+func TestSummarizeHeaders(t *testing.T) {
+	header := largeHeader()
+	header.Set("Authorization", "Bearer secret")
+	summary := summarizeHeaders(header)
+	cookies := summary["Set-Cookie"]
+	if len(cookies) != maxLoggedHeaderValues+1 || cookies[0] != "***" || cookies[maxLoggedHeaderValues] != "(195 more)" {
+		t.Fatalf("Set-Cookie summary = %v", cookies)
+	}
+	if summary.Get("Authorization") != "***" || summary.Get("X-Vendor-Trace-7") != "value-7" {
+		t.Fatalf("summary = %v", summary)
+	}
+	if len(header["Set-Cookie"]) != 200 {
+		t.Fatal("summarizeHeaders modified the original header")
+	}
+	if summarizeHeaders(nil) != nil {
+		t.Fatal("summary of empty header should be nil")
+	}
+}
+
+func BenchmarkLogHeaders(b *testing.B) {
+	header := largeHeader()
+	b.Run("redact", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			redactHeaders(header)
+		}
+	})
+	b.Run("summarize", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			summarizeHeaders(header)
+		}
+	})
+}
+
+func TestDebugMultipartUploadIntact(t *testing.T) {
+	content := strings.Repeat("0123456789", 2000)
+	readers := map[string]func() io.Reader{
+		"seekable":     func() io.Reader { return strings.NewReader(content) },
+		"not seekable": func() io.Reader { return io.MultiReader(strings.NewReader(content)) },
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			server, uploads := uploadServer(t)
+			recorder := &requestLogRecorder{}
+			response, err := Post(server.URL+"/upload", WithFileReader("doc", "a.txt", reader()), WithDebug(recorder, 500))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if got := uploads(); len(got) != 1 || got[0]["doc"] != "a.txt:"+content {
+				t.Fatalf("server received %v uploads, want the whole file", len(got))
+			}
+			if entry := recorder.last(t); entry.RequestBody != "<multipart body omitted>" {
+				t.Fatalf("request body = %q, want the multipart placeholder", entry.RequestBody)
+			}
+		})
+	}
+}
+
+func TestDebugRedactsAndTruncates(t *testing.T) {
+	server := secretServer(t)
+	recorder := &requestLogRecorder{}
+	response, err := Post(server.URL+"/orders?api_key=k3y&page=1",
+		WithBearerToken("tok"),
+		WithHeader("Cookie", "session=c00kie"),
+		WithPostStringBody(`{"callback":"https://x.test/?token=b0dy","name":"abcdefghij"}`),
+		WithDebug(recorder, 40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if !strings.HasSuffix(string(body), `"padding":"0123456789"}`) {
+		t.Fatalf("body = %q, want the logged prefix kept in the response", body)
+	}
+
+	entry := recorder.last(t)
+	if entry.URL != server.URL+"/orders?api_key=***&page=1" {
+		t.Fatalf("url = %q, want the api key redacted", entry.URL)
+	}
+	if entry.RequestHeaders.Get("Authorization") != "***" || entry.RequestHeaders.Get("Cookie") != "***" || entry.ResponseHeaders.Get("Set-Cookie") != "***" {
+		t.Fatalf("headers = %v, %v, want the credentials redacted", entry.RequestHeaders, entry.ResponseHeaders)
+	}
+	if entry.ResponseHeaders.Get("X-Request-Id") != "r1" {
+		t.Fatalf("response headers = %v, want other headers kept", entry.ResponseHeaders)
+	}
+	if entry.RequestBody != `{"callback":"https://x.test/?token=***"` || strings.Contains(entry.ResponseBody, "t0k3n") || len(entry.ResponseBody) > 40 {
+		t.Fatalf("bodies = %q, %q, want them truncated to the limit and redacted", entry.RequestBody, entry.ResponseBody)
+	}
+
+	recorder = &requestLogRecorder{}
+	if response, err = Post(server.URL, WithPostStringBody("abc"), WithDebug(recorder, 0)); err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if entry := recorder.last(t); entry.RequestBody != "" || entry.ResponseBody != "" || entry.Status != http.StatusOK {
+		t.Fatalf("entry = %+v, want no bodies with a zero limit", entry)
+	}
+}
+
+func TestRequestLogBody(t *testing.T) {
+	streamed, err := http.NewRequest(http.MethodPost, "https://api.example.com", io.MultiReader(strings.NewReader("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := requestLogBody(streamed, 10); got != "<streamed body omitted>" {
+		t.Fatalf("body = %q, want the streamed placeholder", got)
+	}
+	empty, _ := http.NewRequest(http.MethodGet, "https://api.example.com", nil)
+	if got := requestLogBody(empty, 10); got != "" {
+		t.Fatalf("body = %q, want nothing for an empty body", got)
+	}
+}
+
+func TestDumpRedacts(t *testing.T) {
+	server := secretServer(t)
+	var dump bytes.Buffer
+	response, err := Post(server.URL+"/orders?token=abc", WithBearerToken("tok"), WithHeader("Cookie", "session=c00kie"),
+		WithPostStringBody(`{"url":"/cb?password=pw"}`), WithDump(&dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if !strings.Contains(string(body), "token=t0k3n") {
+		t.Fatalf("body = %q, want the caller to see the original body", body)
+	}
+	text := dump.String()
+	for _, secret := range []string{"tok\r", "c00kie", "s3cret", "t0k3n", "=pw", "token=abc"} {
+		if strings.Contains(text, secret) {
+			t.Fatalf("dump contains %q:\n%v", secret, text)
+		}
+	}
+	for _, want := range []string{"POST /orders?token=*** HTTP/1.1", "Authorization: ***", "Cookie: ***", "Set-Cookie: ***", "X-Request-Id: r1", `password=***`} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("dump is missing %q:\n%v", want, text)
+		}
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "https://api.example.com/?sig=xyz", nil)
+	request.Header.Set("X-Api-Key", "k")
+	requestDump, err := DumpRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := string(requestDump); !strings.Contains(text, "GET /?sig=*** HTTP/1.1") || !strings.Contains(text, "X-Api-Key: ***") {
+		t.Fatalf("dump = %q, want the signature and api key redacted", text)
+	}
+}
@@ -0,0 +1,188 @@
+package nhr
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// BodyDecoder 将UTF-8的响应body解码到v，用于ResponseDecode
+type BodyDecoder func(body []byte, v interface{}) error
+
+var (
+	bodyDecodersMu sync.RWMutex
+	// customBodyDecoders 通过RegisterBodyDecoder替换过的媒体类型，内置的JSON解码器会按请求的WithJSONCodec解码
+	customBodyDecoders = map[string]bool{}
+	bodyDecoders       = map[string]BodyDecoder{
+		"application/json":                  FastJsonUnMarshal,
+		"application/xml":                   decodeXMLBody,
+		"text/xml":                          decodeXMLBody,
+		"application/x-www-form-urlencoded": decodeFormBody,
+		"text/plain":                        decodeTextBody,
+	}
+)
+
+// RegisterBodyDecoder 注册媒体类型对应的解码器，mediaType不区分大小写，不含charset等参数
+// 内置application/json、application/xml、text/xml、application/x-www-form-urlencoded和text/plain
+func RegisterBodyDecoder(mediaType string, decoder BodyDecoder) {
+	bodyDecodersMu.Lock()
+	defer bodyDecodersMu.Unlock()
+	bodyDecoders[strings.ToLower(mediaType)] = decoder
+	customBodyDecoders[strings.ToLower(mediaType)] = true
+}
+
+// lookupBodyDecoder 获取媒体类型对应的解码器
+// 没有单独注册时，+json、+xml结尾的类型按JSON、XML处理，其他text/*按纯文本处理，没有Content-Type时按JSON处理
+func lookupBodyDecoder(media string, codec JSONCodec) (decoder BodyDecoder, name string, ok bool) {
+	bodyDecodersMu.RLock()
+	defer bodyDecodersMu.RUnlock()
+	if decoder, ok := bodyDecoders[media]; ok {
+		if media == "application/json" && !customBodyDecoders[media] {
+			return codec.unmarshal, media, true
+		}
+		return decoder, media, true
+	}
+	switch {
+	case media == "" || strings.HasSuffix(media, "+json"):
+		name = "application/json"
+	case strings.HasSuffix(media, "+xml"):
+		name = "application/xml"
+	case strings.HasPrefix(media, "text/"):
+		name = "text/plain"
+	default:
+		return nil, "", false
+	}
+	if name == "application/json" && !customBodyDecoders[name] {
+		return codec.unmarshal, name, true
+	}
+	return bodyDecoders[name], name, true
+}
+
+// ResponseDecode 按响应的Content-Type选择解码器，将body解码到v，开启WithContentSniffing时使用识别出的类型
+// 响应的Content-Encoding没有被处理时先解压；charset不是UTF-8时先转为UTF-8，XML带有encoding声明时由XML解码器处理
+// 状态码的处理与ResponseToStruct相同，body为空时不修改v；JSON响应会执行业务错误检查
+func ResponseDecode(responseIns *http.Response, v interface{}) error {
+	if err := checkBodyConsumable(responseIns); err != nil {
+		return err
+	}
+	if len(parseContentEncoding(responseIns.Header)) > 0 {
+		decompressResponse(responseIns)
+	}
+	body, err := readAcceptedBody(responseIns, nil)
+	if err != nil {
+		return fmt.Errorf("response to bytes error:%w", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	_, media := ResponseContentType(responseIns)
+	decoder, name, ok := lookupBodyDecoder(media, responseConfigOf(responseIns).jsonCodec)
+	if !ok {
+		return fmt.Errorf("no body decoder registered for content type %q", media)
+	}
+	if name != "application/xml" || !hasXMLEncodingDeclaration(body) {
+		if body, err = bodyToUTF8(body, responseIns.Header.Get("Content-Type")); err != nil {
+			return err
+		}
+	}
+	if name == "application/json" {
+		if err := responseConfigOf(responseIns).checkBusinessError(body); err != nil {
+			return err
+		}
+	}
+	if err := decoder(body, v); err != nil {
+		return fmt.Errorf("decode %v response error:%w", media, err)
+	}
+	return nil
+}
+
+// bodyToUTF8 按Content-Type中的charset将body转为UTF-8，没有charset或已经是UTF-8时原样返回
+func bodyToUTF8(body []byte, contentType string) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["charset"] == "" {
+		return body, nil
+	}
+	name := params["charset"]
+	if strings.EqualFold(name, "utf-8") || strings.EqualFold(name, "utf8") {
+		return body, nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported response charset %q:%v", name, err)
+	}
+	converted, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("convert response charset %q error:%v", name, err)
+	}
+	return converted, nil
+}
+
+// hasXMLEncodingDeclaration body是否以带有encoding的XML声明开头
+func hasXMLEncodingDeclaration(body []byte) bool {
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(body, []byte("<?xml")) {
+		return false
+	}
+	end := bytes.Index(body, []byte("?>"))
+	return end > 0 && bytes.Contains(body[:end], []byte("encoding"))
+}
+
+// decodeXMLBody 解码XML，支持XML声明中的非UTF-8编码
+func decodeXMLBody(body []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder.Decode(v)
+}
+
+// decodeFormBody 解码application/x-www-form-urlencoded
+// v可以是*url.Values、*map[string][]string、*map[string]string(重复的key取第一个值)，或使用url标签的结构体指针
+func decodeFormBody(body []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+	switch out := v.(type) {
+	case *url.Values:
+		*out = values
+		return nil
+	case *map[string][]string:
+		*out = values
+		return nil
+	case *map[string]string:
+		*out = make(map[string]string, len(values))
+		for key := range values {
+			(*out)[key] = values.Get(key)
+		}
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode form body into %T", v)
+	}
+	return decodeQueryStruct(values, rv.Elem())
+}
+
+// decodeTextBody 解码纯文本，v可以是*string、*[]byte或encoding.TextUnmarshaler
+func decodeTextBody(body []byte, v interface{}) error {
+	switch out := v.(type) {
+	case *string:
+		*out = string(body)
+	case *[]byte:
+		*out = append([]byte(nil), body...)
+	case encoding.TextUnmarshaler:
+		return out.UnmarshalText(body)
+	default:
+		return fmt.Errorf("cannot decode text body into %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package nhr
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+type decodedOrder struct {
+	ID   int    `json:"id" xml:"id" url:"id"`
+	Name string `json:"name" xml:"name" url:"name"`
+}
+
+func TestResponseDecode(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String(`{"id":1,"name":"北京"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gbkXML, err := simplifiedchinese.GBK.NewEncoder().String(`<?xml version="1.0" encoding="GBK"?><order><id>4</id><name>上海</name></order>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        decodedOrder
+	}{
+		{name: "json", contentType: "application/json", body: `{"id":1,"name":"a"}`, want: decodedOrder{ID: 1, Name: "a"}},
+		{name: "vendor json", contentType: "application/problem+json", body: `{"id":2}`, want: decodedOrder{ID: 2}},
+		{name: "xml", contentType: "text/xml; charset=utf-8", body: `<order><id>4</id><name>b</name></order>`, want: decodedOrder{ID: 4, Name: "b"}},
+		{name: "vendor xml", contentType: "application/atom+xml", body: `<order><id>5</id></order>`, want: decodedOrder{ID: 5}},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: "id=6&name=c+d", want: decodedOrder{ID: 6, Name: "c d"}},
+		{name: "gbk json", contentType: "application/json; charset=GBK", body: gbk, want: decodedOrder{ID: 1, Name: "北京"}},
+		{name: "xml encoding declaration", contentType: "application/xml; charset=GBK", body: gbkXML, want: decodedOrder{ID: 4, Name: "上海"}},
+		{name: "empty body", contentType: "application/json", body: " \n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := Get(contentServer(t, tt.contentType, tt.body).URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got decodedOrder
+			if err := ResponseDecode(response, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("decoded = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupBodyDecoder(t *testing.T) {
+	tests := map[string]string{
+		"":                         "application/json",
+		"application/json":         "application/json",
+		"application/problem+json": "application/json",
+		"application/atom+xml":     "application/xml",
+		"text/xml":                 "text/xml",
+		"text/csv":                 "text/plain",
+		"application/octet-stream": "",
+	}
+	for media, want := range tests {
+		decoder, name, ok := lookupBodyDecoder(media, DefaultJSONCodec)
+		if name != want || ok != (want != "") || ok != (decoder != nil) {
+			t.Fatalf("lookupBodyDecoder(%q) = %q, %v, want %q", media, name, ok, want)
+		}
+	}
+}
+
+func TestResponseDecodeTargets(t *testing.T) {
+	server := contentServer(t, "application/x-www-form-urlencoded", "a=1&a=2&b=3")
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first map[string]string
+	if err := ResponseDecode(response, &first); err != nil || first["a"] != "1" || first["b"] != "3" {
+		t.Fatalf("decoded = %v, %v, want the first value of each key", first, err)
+	}
+	if response, err = Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	var values url.Values
+	if err := ResponseDecode(response, &values); err != nil || len(values["a"]) != 2 {
+		t.Fatalf("decoded = %v, %v, want every value kept", values, err)
+	}
+
+	text := contentServer(t, "text/csv", "a,b\n")
+	if response, err = Get(text.URL); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := ResponseDecode(response, &s); err != nil || s != "a,b\n" {
+		t.Fatalf("decoded = %q, %v, want text/* decoded as plain text", s, err)
+	}
+	if response, err = Get(text.URL); err != nil {
+		t.Fatal(err)
+	}
+	var order decodedOrder
+	if err := ResponseDecode(response, &order); err == nil || !strings.Contains(err.Error(), "cannot decode text body") {
+		t.Fatalf("error = %v, want the unsupported target reported", err)
+	}
+
+	binary := contentServer(t, "application/octet-stream", "\x00\x01")
+	if response, err = Get(binary.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResponseDecode(response, &s); err == nil || !strings.Contains(err.Error(), "no body decoder registered") {
+		t.Fatalf("error = %v, want no decoder for octet-stream", err)
+	}
+}
+
+func TestRegisterBodyDecoder(t *testing.T) {
+	const media = "application/x-test-order"
+	RegisterBodyDecoder("Application/X-Test-Order", func(body []byte, v interface{}) error {
+		order := v.(*decodedOrder)
+		order.Name = strings.ToUpper(string(body))
+		return nil
+	})
+	t.Cleanup(func() {
+		bodyDecodersMu.Lock()
+		delete(bodyDecoders, media)
+		delete(customBodyDecoders, media)
+		bodyDecodersMu.Unlock()
+	})
+	response, err := Get(contentServer(t, media+"; version=2", "abc").URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got decodedOrder
+	if err := ResponseDecode(response, &got); err != nil || got.Name != "ABC" {
+		t.Fatalf("decoded = %+v, %v, want the registered decoder used", got, err)
+	}
+}
+
+func TestResponseDecodeSniffedAndEncoded(t *testing.T) {
+	response, err := Get(contentServer(t, "text/plain", `{"id":8}`).URL, WithContentSniffing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got decodedOrder
+	if err := ResponseDecode(response, &got); err != nil || got.ID != 8 {
+		t.Fatalf("decoded = %+v, %v, want the sniffed json type used", got, err)
+	}
+
+	server, _ := encodedServer(t, "deflate", deflateBytes(t, []byte(`{"id":9}`)))
+	if response, err = Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	got = decodedOrder{}
+	if err := ResponseDecode(response, &got); err != nil || got.ID != 9 {
+		t.Fatalf("decoded = %+v, %v, want the body decompressed first", got, err)
+	}
+}
+
+func TestResponseDecodeBusinessError(t *testing.T) {
+	server := contentServer(t, "application/json", `{"code":"E1","msg":"denied","id":1}`)
+	response, err := Get(server.URL, WithBusinessCodeRule(BusinessCodeRule{CodeField: "code", MessageField: "msg", SuccessCodes: []string{"0"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got decodedOrder
+	var businessErr *BusinessError
+	if err := ResponseDecode(response, &got); !errors.As(err, &businessErr) || businessErr.Code != "E1" || got.ID != 0 {
+		t.Fatalf("error = %v, decoded = %+v, want the business error before decoding", err, got)
+	}
+	response, err = Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ResponseDecode(response, &got); err != nil || got.ID != 1 {
+		t.Fatalf("decoded = %+v, %v, want no check without a rule", got, err)
+	}
+}
+
+func TestResponseDecodeStatus(t *testing.T) {
+	server, _ := countingServer(t, http.StatusInternalServerError)
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got decodedOrder
+	if err := ResponseDecode(response, &got); err == nil {
+		t.Fatal("a 5xx response should not be decoded")
+	}
+}
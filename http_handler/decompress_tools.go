@@ -0,0 +1,201 @@
+package nhr
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ContentDecoder 根据Content-Encoding解压响应body的解码器
+type ContentDecoder func(r io.Reader) (io.ReadCloser, error)
+
+// ContentDecodeError 响应body按Content-Encoding解压失败，Encoding为出错的编码
+type ContentDecodeError struct {
+	Encoding string
+	Err      error
+}
+
+func (e *ContentDecodeError) Error() string {
+	return fmt.Sprintf("decode %v response body error:%v", e.Encoding, e.Err)
+}
+
+func (e *ContentDecodeError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	contentDecodersMu sync.RWMutex
+	contentDecoders   = map[string]ContentDecoder{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": func(r io.Reader) (io.ReadCloser, error) {
+			return zlib.NewReader(r)
+		},
+	}
+)
+
+// RegisterContentDecoder 注册Content-Encoding对应的解码器，encoding不区分大小写
+// 内置gzip和deflate，br、zstd等由contrib/compress模块在导入时注册
+func RegisterContentDecoder(encoding string, decoder ContentDecoder) {
+	contentDecodersMu.Lock()
+	defer contentDecodersMu.Unlock()
+	contentDecoders[strings.ToLower(encoding)] = decoder
+}
+
+// lookupContentDecoder 获取encoding对应的解码器
+func lookupContentDecoder(encoding string) (ContentDecoder, bool) {
+	contentDecodersMu.RLock()
+	defer contentDecodersMu.RUnlock()
+	decoder, ok := contentDecoders[strings.ToLower(encoding)]
+	return decoder, ok
+}
+
+// WithAcceptEncoding 设置Accept-Encoding请求头，只声明能够解码的编码
+// 设置之后由本包按响应的Content-Encoding解压body，支持"gzip, br"这样的多重编码
+// 未注册解码器的编码会导致请求失败
+func WithAcceptEncoding(encodings ...string) Option {
+	return func(req *HttpRequests) {
+		req.AcceptEncoding = encodings
+	}
+}
+
+// acceptEncodingHeader 校验encodings都有对应的解码器，并拼接为Accept-Encoding请求头
+func acceptEncodingHeader(encodings []string) (string, error) {
+	for _, encoding := range encodings {
+		if _, ok := lookupContentDecoder(encoding); !ok && !strings.EqualFold(encoding, "identity") {
+			return "", fmt.Errorf("no content decoder registered for encoding %q", encoding)
+		}
+	}
+	return strings.Join(encodings, ", "), nil
+}
+
+// parseContentEncoding 解析Content-Encoding响应头，返回解码顺序的编码列表
+// 编码按应用的先后顺序排列，解码时需要反向进行
+func parseContentEncoding(header http.Header) []string {
+	var encodings []string
+	for _, value := range header.Values("Content-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			if encoding != "" && encoding != "identity" {
+				encodings = append(encodings, encoding)
+			}
+		}
+	}
+	for i, j := 0, len(encodings)-1; i < j; i, j = i+1, j-1 {
+		encodings[i], encodings[j] = encodings[j], encodings[i]
+	}
+	return encodings
+}
+
+// decompressResponse 按Content-Encoding解压响应body，并移除已经失效的Content-Encoding和Content-Length
+func decompressResponse(response *http.Response) {
+	encodings := parseContentEncoding(response.Header)
+	if len(encodings) == 0 {
+		return
+	}
+	response.Body = &decodedBody{raw: response.Body, encodings: encodings}
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	response.Uncompressed = true
+}
+
+// sourceError 标记来自原始body的错误，避免被误认为是解码错误
+type sourceError struct {
+	err error
+}
+
+func (e *sourceError) Error() string {
+	return e.err.Error()
+}
+
+type sourceReader struct {
+	r io.Reader
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &sourceError{err: err}
+	}
+	return n, err
+}
+
+// decoderReader 将解码器产生的错误包装为ContentDecodeError
+type decoderReader struct {
+	encoding string
+	r        io.Reader
+}
+
+func (d *decoderReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	return n, wrapDecodeError(d.encoding, err)
+}
+
+func wrapDecodeError(encoding string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	var srcErr *sourceError
+	var decodeErr *ContentDecodeError
+	if errors.As(err, &srcErr) || errors.As(err, &decodeErr) {
+		return err
+	}
+	return &ContentDecodeError{Encoding: encoding, Err: err}
+}
+
+// decodedBody 解压后的响应body，第一次读取时才创建解码器，所以压缩数据头部损坏的错误也在Read时返回
+type decodedBody struct {
+	raw       io.ReadCloser
+	encodings []string
+
+	reader  io.Reader
+	closers []io.Closer
+	err     error
+}
+
+func (b *decodedBody) init() error {
+	var reader io.Reader = &sourceReader{r: b.raw}
+	for _, encoding := range b.encodings {
+		decoder, ok := lookupContentDecoder(encoding)
+		if !ok {
+			return &ContentDecodeError{Encoding: encoding, Err: errors.New("unsupported content encoding")}
+		}
+		decoded, err := decoder(reader)
+		if err != nil {
+			return wrapDecodeError(encoding, err)
+		}
+		b.closers = append(b.closers, decoded)
+		reader = &decoderReader{encoding: encoding, r: decoded}
+	}
+	b.reader = reader
+	return nil
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.err = b.init()
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.reader.Read(p)
+	var srcErr *sourceError
+	if errors.As(err, &srcErr) {
+		err = srcErr.err
+	}
+	return n, err
+}
+
+func (b *decodedBody) Close() error {
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		_ = b.closers[i].Close()
+	}
+	return b.raw.Close()
+}
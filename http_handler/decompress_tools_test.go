@@ -0,0 +1,133 @@
+package nhr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func deflateBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	writer.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodedServer 以encoding作为Content-Encoding返回body，并记录收到的Accept-Encoding
+func encodedServer(t *testing.T, encoding string, body []byte) (*httptest.Server, *string) {
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &accept
+}
+
+func TestDecompressResponse(t *testing.T) {
+	plain := []byte(`{"message":"hello"}`)
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{name: "gzip", encoding: "gzip", body: gzipBytes(t, plain)},
+		{name: "deflate", encoding: "deflate", body: deflateBytes(t, plain)},
+		{name: "upper case", encoding: "GZIP", body: gzipBytes(t, plain)},
+		{name: "layered", encoding: "deflate, gzip", body: gzipBytes(t, deflateBytes(t, plain))},
+		{name: "identity", encoding: "identity", body: plain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, accept := encodedServer(t, tt.encoding, tt.body)
+			response, err := Get(server.URL, WithAcceptEncoding("gzip", "deflate"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			got, err := io.ReadAll(response.Body)
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Fatalf("body = %q, %v, want %q", got, err, plain)
+			}
+			if *accept != "gzip, deflate" {
+				t.Fatalf("Accept-Encoding = %q", *accept)
+			}
+			if tt.encoding != "identity" && (response.Header.Get("Content-Encoding") != "" || response.ContentLength != -1 || !response.Uncompressed) {
+				t.Fatalf("headers = %v, length = %v, want the encoding headers removed", response.Header, response.ContentLength)
+			}
+		})
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	if _, err := Get("http://127.0.0.1:1", WithAcceptEncoding("snappy")); err == nil || !strings.Contains(err.Error(), `no content decoder registered for encoding "snappy"`) {
+		t.Fatalf("error = %v, want an unregistered encoding rejected before sending", err)
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     string
+	}{
+		{name: "corrupt gzip", encoding: "gzip", body: []byte("not gzip"), want: "gzip"},
+		{name: "truncated gzip", encoding: "gzip", body: gzipBytes(t, []byte("hello"))[:12], want: "gzip"},
+		{name: "unsupported", encoding: "x-custom", body: []byte("data"), want: "x-custom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := encodedServer(t, tt.encoding, tt.body)
+			response, err := Get(server.URL, WithAcceptEncoding("gzip"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			_, err = io.ReadAll(response.Body)
+			var decodeErr *ContentDecodeError
+			if !errors.As(err, &decodeErr) || decodeErr.Encoding != tt.want {
+				t.Fatalf("error = %v, want a ContentDecodeError for %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterContentDecoder(t *testing.T) {
+	RegisterContentDecoder("X-Reverse", func(r io.Reader) (io.ReadCloser, error) {
+		data, err := io.ReadAll(r)
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+		return io.NopCloser(bytes.NewReader(data)), err
+	})
+	server, _ := encodedServer(t, "x-reverse", []byte("olleh"))
+	response, err := Get(server.URL, WithAcceptEncoding("x-reverse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if got, err := io.ReadAll(response.Body); err != nil || string(got) != "hello" {
+		t.Fatalf("body = %q, %v, want the registered decoder used", got, err)
+	}
+}
@@ -0,0 +1,102 @@
+package nhr
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithDefaultCookies 为请求附带固定的cookie，例如功能开关、A/B分组和设备id，通常在NewClient时设置
+// 每个cookie必须设置Domain，只发送给Domain及其子域名，Path和Secure按浏览器的规则匹配，不会泄露给Client访问的其他host
+// 单次请求WithCookies设置的同名cookie优先；cookie jar中的同名cookie默认优先，见WithDefaultCookiesOverJar
+func WithDefaultCookies(cookies ...*http.Cookie) Option {
+	return func(req *HttpRequests) {
+		for _, cookie := range cookies {
+			if cookie.Domain == "" {
+				req.optionErr = fmt.Errorf("default cookie %q error:Domain is required", cookie.Name)
+				return
+			}
+		}
+		req.DefaultCookies = append(append([]*http.Cookie(nil), req.DefaultCookies...), cookies...)
+	}
+}
+
+// WithDefaultCookiesOverJar 默认cookie优先于cookie jar中的同名cookie，jar中的同名cookie不再发送
+func WithDefaultCookiesOverJar() Option {
+	return func(req *HttpRequests) {
+		req.DefaultCookiesOverJar = true
+	}
+}
+
+// applyDefaultCookies 将匹配请求地址的默认cookie加到req上，返回发送请求使用的client
+// 默认cookie优先于jar时，返回的client使用过滤掉同名cookie的jar
+func applyDefaultCookies(req *http.Request, requestIns *HttpRequests, client *http.Client) *http.Client {
+	if len(requestIns.DefaultCookies) == 0 {
+		return client
+	}
+	skip := map[string]bool{}
+	for _, cookie := range requestIns.Cookies {
+		skip[cookie.Name] = true
+	}
+	if client.Jar != nil && !requestIns.DefaultCookiesOverJar {
+		for _, cookie := range client.Jar.Cookies(req.URL) {
+			skip[cookie.Name] = true
+		}
+	}
+	applied := map[string]bool{}
+	for _, cookie := range requestIns.DefaultCookies {
+		if skip[cookie.Name] || applied[cookie.Name] || !defaultCookieMatches(cookie, req.URL) {
+			continue
+		}
+		applied[cookie.Name] = true
+		req.AddCookie(cookie)
+	}
+	if len(applied) == 0 || client.Jar == nil || !requestIns.DefaultCookiesOverJar {
+		return client
+	}
+	filtered := *client
+	filtered.Jar = &shadowedJar{CookieJar: client.Jar, names: applied}
+	return &filtered
+}
+
+// defaultCookieMatches 按RFC 6265的domain-match和path-match判断cookie是否发送给u
+func defaultCookieMatches(cookie *http.Cookie, u *url.URL) bool {
+	if cookie.Secure && u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, "."))
+	if host != domain && !strings.HasSuffix(host, "."+domain) {
+		return false
+	}
+	cookiePath := cookie.Path
+	if cookiePath == "" {
+		cookiePath = "/"
+	}
+	requestPath := u.EscapedPath()
+	if requestPath == "" {
+		requestPath = "/"
+	}
+	if requestPath == cookiePath {
+		return true
+	}
+	return strings.HasPrefix(requestPath, cookiePath) && (strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/')
+}
+
+// shadowedJar 不返回names中的cookie，服务端设置的cookie照常保存
+type shadowedJar struct {
+	http.CookieJar
+	names map[string]bool
+}
+
+func (j *shadowedJar) Cookies(u *url.URL) []*http.Cookie {
+	cookies := j.CookieJar.Cookies(u)
+	kept := cookies[:0:0]
+	for _, cookie := range cookies {
+		if !j.names[cookie.Name] {
+			kept = append(kept, cookie)
+		}
+	}
+	return kept
+}
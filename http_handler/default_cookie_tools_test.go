@@ -0,0 +1,138 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDefaultCookieMatches(t *testing.T) {
+	tests := []struct {
+		cookie http.Cookie
+		url    string
+		want   bool
+	}{
+		{http.Cookie{Domain: "api.example.com"}, "https://api.example.com/v1", true},
+		{http.Cookie{Domain: ".example.com"}, "https://api.example.com/v1", true},
+		{http.Cookie{Domain: "example.com"}, "https://example.com/", true},
+		{http.Cookie{Domain: "api.example.com"}, "https://example.com/", false},
+		{http.Cookie{Domain: "example.com"}, "https://badexample.com/", false},
+		{http.Cookie{Domain: "api.example.com"}, "https://tracker.thirdparty.io/", false},
+		{http.Cookie{Domain: "API.example.com"}, "https://api.EXAMPLE.com", true},
+		{http.Cookie{Domain: "example.com", Path: "/v1"}, "https://example.com/v1", true},
+		{http.Cookie{Domain: "example.com", Path: "/v1"}, "https://example.com/v1/orders", true},
+		{http.Cookie{Domain: "example.com", Path: "/v1"}, "https://example.com/v10", false},
+		{http.Cookie{Domain: "example.com", Path: "/v1/"}, "https://example.com/v1/x", true},
+		{http.Cookie{Domain: "example.com", Path: "/v1"}, "https://example.com/", false},
+		{http.Cookie{Domain: "example.com", Secure: true}, "http://example.com/", false},
+		{http.Cookie{Domain: "example.com", Secure: true}, "https://example.com/", true},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := defaultCookieMatches(&tt.cookie, u); got != tt.want {
+			t.Errorf("cookie %+v for %v = %v, want %v", tt.cookie, tt.url, got, tt.want)
+		}
+	}
+}
+
+// cookieEcho 记录服务端收到的Cookie请求头，/set设置一个同名的cookie
+func cookieEcho(t *testing.T) (*httptest.Server, *string) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Cookie")
+		if r.URL.Path == "/set" {
+			http.SetCookie(w, &http.Cookie{Name: "bucket", Value: "server", Path: "/"})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &got
+}
+
+func TestDefaultCookiesScopedToDomain(t *testing.T) {
+	server, got := cookieEcho(t)
+	client, err := NewClient(WithDefaultCookies(
+		&http.Cookie{Name: "flag", Value: "on", Domain: "127.0.0.1"},
+		&http.Cookie{Name: "device", Value: "abc", Domain: "api.example.com"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if *got != "flag=on" {
+		t.Fatalf("Cookie = %q, want only the cookie scoped to 127.0.0.1", *got)
+	}
+
+	// 同一个server通过localhost访问时不匹配Domain
+	response, err = client.Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if *got != "" {
+		t.Fatalf("Cookie = %q, default cookies leaked to another host", *got)
+	}
+
+	// 单次请求的同名cookie优先
+	response, err = client.Get(server.URL, WithCookies([]*http.Cookie{{Name: "flag", Value: "off"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if *got != "flag=off" {
+		t.Fatalf("Cookie = %q, want the request-level cookie to win", *got)
+	}
+}
+
+func TestDefaultCookiesAndJar(t *testing.T) {
+	bucket := &http.Cookie{Name: "bucket", Value: "default", Domain: "127.0.0.1"}
+	tests := []struct {
+		name    string
+		options []Option
+		want    string
+	}{
+		{name: "jar shadows defaults", options: []Option{WithDefaultCookies(bucket)}, want: "bucket=server"},
+		{name: "defaults over jar", options: []Option{WithDefaultCookies(bucket), WithDefaultCookiesOverJar()}, want: "bucket=default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, got := cookieEcho(t)
+			session := NewSession(server.URL, tt.options...)
+			response, err := session.Get("/set")
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if *got != "bucket=default" {
+				t.Fatalf("first request Cookie = %q, want the default before the jar has one", *got)
+			}
+			response, err = session.Get("/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if *got != tt.want {
+				t.Fatalf("Cookie = %q, want %q", *got, tt.want)
+			}
+			// jar中依然保存着服务端设置的cookie
+			if cookies := session.Jar().Cookies(response.Request.URL); len(cookies) != 1 || cookies[0].Value != "server" {
+				t.Fatalf("jar cookies = %v", cookies)
+			}
+		})
+	}
+}
+
+func TestDefaultCookiesRequireDomain(t *testing.T) {
+	_, err := Get("http://127.0.0.1:1", WithDefaultCookies(&http.Cookie{Name: "flag", Value: "on"}))
+	if err == nil || !strings.Contains(err.Error(), "Domain is required") {
+		t.Fatalf("error = %v, want a missing Domain error", err)
+	}
+}
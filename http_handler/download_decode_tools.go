@@ -0,0 +1,136 @@
+package nhr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// compressionMagics 压缩格式的文件头，用于确认body确实是压缩数据，避免对已经解压过的body重复解压
+var compressionMagics = map[string][]byte{
+	"gzip": {0x1f, 0x8b},
+	"zstd": {0x28, 0xb5, 0x2f, 0xfd},
+}
+
+// DownloadAndDecode 以GET方式下载JSON文件并流式解码到out，解压后的内容不会整体保存在内存中
+// 文件名(Content-Disposition或URL路径)以.gz、.zst结尾或Content-Type为application/gzip、application/zstd时先解压，zstd需要导入contrib/compress
+// Content-Encoding由net/http或WithAcceptEncoding处理；文件名为.ndjson、.jsonl或Content-Type为application/x-ndjson时按NDJSON处理
+// out可以是：
+// 1、func(raw []byte) error，每个JSON值调用一次，返回错误时停止
+// 2、切片指针，NDJSON的每一行追加为一个元素，普通JSON按整体解码
+// 3、其他可以被JSON codec解码的指针，codec可以通过WithJSONCodec选择
+// 单次尝试的超时同样覆盖读取body的时间，下载大文件时需要通过WithTimeout调大
+func DownloadAndDecode(ctx context.Context, rawURL string, out interface{}, options ...Option) error {
+	requestIns := newHttpRequests(http.MethodGet, rawURL, options...)
+	response, err := doRequest(ctx, requestIns)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err := checkResponseStatus(response); err != nil {
+		return err
+	}
+	name := downloadFileName(response)
+	body, err := decompressDownload(response, name)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	ndjson := isNDJSONDownload(response, name)
+
+	decoder := requestIns.JSONCodec.newDecoder(body)
+	switch fn := out.(type) {
+	case func(raw []byte) error:
+		for index := 0; decoder.More(); index++ {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return fmt.Errorf("decode download value %v error:%w", index, err)
+			}
+			if err := fn(raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("DownloadAndDecode requires a callback or a non-nil pointer")
+	}
+	if ndjson && rv.Elem().Kind() == reflect.Slice {
+		slice := rv.Elem()
+		for index := 0; decoder.More(); index++ {
+			elem := reflect.New(slice.Type().Elem())
+			if err := decoder.Decode(elem.Interface()); err != nil {
+				return fmt.Errorf("decode download line %v error:%w", index, err)
+			}
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+		return nil
+	}
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("decode download error:%w", err)
+	}
+	return nil
+}
+
+// downloadFileName 返回小写的文件名，优先使用Content-Disposition中的filename
+func downloadFileName(response *http.Response) string {
+	if _, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return strings.ToLower(params["filename"])
+	}
+	if response.Request != nil {
+		return strings.ToLower(path.Base(response.Request.URL.Path))
+	}
+	return ""
+}
+
+// decompressDownload 按文件名或Content-Type解压body，body开头不是对应的压缩格式时原样返回
+func decompressDownload(response *http.Response, name string) (io.ReadCloser, error) {
+	encoding := ""
+	switch media := mediaType(response.Header.Get("Content-Type")); {
+	case strings.HasSuffix(name, ".gz"), strings.HasSuffix(name, ".gzip"), media == "application/gzip", media == "application/x-gzip":
+		encoding = "gzip"
+	case strings.HasSuffix(name, ".zst"), strings.HasSuffix(name, ".zstd"), media == "application/zstd":
+		encoding = "zstd"
+	}
+	reader := bufio.NewReader(response.Body)
+	if encoding == "" {
+		return ioutil.NopCloser(reader), nil
+	}
+	magic := compressionMagics[encoding]
+	if head, _ := reader.Peek(len(magic)); !bytes.Equal(head, magic) {
+		return ioutil.NopCloser(reader), nil
+	}
+	decoder, ok := lookupContentDecoder(encoding)
+	if !ok {
+		return nil, &ContentDecodeError{Encoding: encoding, Err: errors.New("no decoder registered, import github.com/Lyzin/go-requests/contrib/compress")}
+	}
+	decoded, err := decoder(reader)
+	if err != nil {
+		return nil, &ContentDecodeError{Encoding: encoding, Err: err}
+	}
+	return decoded, nil
+}
+
+// isNDJSONDownload 文件名去掉压缩后缀后是否是NDJSON
+func isNDJSONDownload(response *http.Response, name string) bool {
+	switch mediaType(response.Header.Get("Content-Type")) {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return true
+	}
+	for _, suffix := range []string{".gz", ".gzip", ".zst", ".zstd"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return strings.HasSuffix(name, ".ndjson") || strings.HasSuffix(name, ".jsonl")
+}
@@ -0,0 +1,128 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// downloadFile 下载测试中的一个文件
+type downloadFile struct {
+	contentType string
+	disposition string
+	body        []byte
+}
+
+// fileServer 按路径返回files中的文件，不存在时返回404
+func fileServer(t *testing.T, files map[string]downloadFile) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if file.contentType != "" {
+			w.Header().Set("Content-Type", file.contentType)
+		}
+		if file.disposition != "" {
+			w.Header().Set("Content-Disposition", file.disposition)
+		}
+		w.Write(file.body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type downloadedRow struct {
+	ID int `json:"id"`
+}
+
+func TestDownloadAndDecode(t *testing.T) {
+	lines := []byte("{\"id\":1}\n{\"id\":2}\n\n{\"id\":3}\n")
+	server := fileServer(t, map[string]downloadFile{
+		"/rows.json":      {contentType: "application/json", body: []byte(`[{"id":1},{"id":2}]`)},
+		"/rows.ndjson":    {body: lines},
+		"/rows.jsonl.gz":  {contentType: "application/octet-stream", body: gzipBytes(t, lines)},
+		"/export":         {contentType: "application/octet-stream", disposition: `attachment; filename="Rows.NDJSON.GZ"`, body: gzipBytes(t, lines)},
+		"/stream":         {contentType: "application/x-ndjson; charset=utf-8", body: lines},
+		"/gzip":           {contentType: "application/gzip", body: gzipBytes(t, []byte(`[{"id":4}]`))},
+		"/plain.json.gz":  {contentType: "application/json", body: []byte(`[{"id":5}]`)},
+		"/rows.zst":       {body: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}},
+		"/broken.ndjson":  {body: []byte("{\"id\":1}\n{\"id\":\n")},
+		"/truncated.json": {body: []byte(`[{"id":1}`)},
+	})
+	tests := []struct {
+		path string
+		want []int
+	}{
+		{path: "/rows.json", want: []int{1, 2}},
+		{path: "/rows.ndjson", want: []int{1, 2, 3}},
+		{path: "/rows.jsonl.gz", want: []int{1, 2, 3}},
+		{path: "/export", want: []int{1, 2, 3}},
+		{path: "/stream", want: []int{1, 2, 3}},
+		{path: "/gzip", want: []int{4}},
+		// 文件名是.gz但内容没有压缩时原样解码
+		{path: "/plain.json.gz", want: []int{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var rows []downloadedRow
+			if err := DownloadAndDecode(context.Background(), server.URL+tt.path, &rows); err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("rows = %+v, want ids %v", rows, tt.want)
+			}
+			for i, id := range tt.want {
+				if rows[i].ID != id {
+					t.Fatalf("rows = %+v, want ids %v", rows, tt.want)
+				}
+			}
+		})
+	}
+
+	var contentErr *ContentDecodeError
+	if err := DownloadAndDecode(context.Background(), server.URL+"/rows.zst", &[]downloadedRow{}); !errors.As(err, &contentErr) || contentErr.Encoding != "zstd" {
+		t.Fatalf("error = %v, want zstd reported without a registered decoder", err)
+	}
+	var rows []downloadedRow
+	if err := DownloadAndDecode(context.Background(), server.URL+"/broken.ndjson", &rows); err == nil || len(rows) != 1 {
+		t.Fatalf("rows = %+v, error = %v, want the second line reported", rows, err)
+	}
+	if err := DownloadAndDecode(context.Background(), server.URL+"/truncated.json", &rows); err == nil {
+		t.Fatal("a truncated json document should fail")
+	}
+	var statusErr *StatusError
+	if err := DownloadAndDecode(context.Background(), server.URL+"/missing.json", &rows); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("error = %v, want the 404 rejected", err)
+	}
+	if err := DownloadAndDecode(context.Background(), server.URL+"/rows.json", rows); err == nil {
+		t.Fatal("a non-pointer out should be rejected")
+	}
+}
+
+func TestDownloadAndDecodeCallback(t *testing.T) {
+	server := fileServer(t, map[string]downloadFile{
+		"/rows.ndjson": {body: []byte("{\"id\":1}\n[2]\n\"three\"\n")},
+	})
+	var raws []string
+	err := DownloadAndDecode(context.Background(), server.URL+"/rows.ndjson", func(raw []byte) error {
+		raws = append(raws, string(raw))
+		return nil
+	})
+	if err != nil || len(raws) != 3 || raws[0] != `{"id":1}` || raws[2] != `"three"` {
+		t.Fatalf("values = %q, %v", raws, err)
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = DownloadAndDecode(context.Background(), server.URL+"/rows.ndjson", func(raw []byte) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Fatalf("error = %v after %v calls, want the callback error to stop decoding", err, calls)
+	}
+}
@@ -0,0 +1,174 @@
+package nhr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProgressFunc 下载进度回调，transferred为已经写入的字节数(断点续传时包含已有的部分)，total未知时为-1
+type ProgressFunc func(transferred, total int64)
+
+// WithProgress 设置Download、DownloadFile的进度回调，每次写入之后调用，回调中不要做耗时的操作
+func WithProgress(fn ProgressFunc) Option {
+	return func(req *HttpRequests) {
+		req.Progress = fn
+	}
+}
+
+// Download 使用DefaultClient下载，见Client.Download
+func Download(ctx context.Context, rawURL string, dest io.Writer, options ...Option) (int64, error) {
+	return DefaultClient.Download(ctx, rawURL, dest, options...)
+}
+
+// DownloadFile 使用DefaultClient下载到文件，见Client.DownloadFile
+func DownloadFile(ctx context.Context, rawURL, path string, options ...Option) (int64, error) {
+	return DefaultClient.DownloadFile(ctx, rawURL, path, options...)
+}
+
+// Download 以GET方式下载并把body流式写入dest，返回写入的字节数，只接受2xx响应
+// 下载默认不限制单次尝试的超时，通过ctx、WithTimeout或WithIdleReadTimeout控制
+func (c *Client) Download(ctx context.Context, rawURL string, dest io.Writer, options ...Option) (int64, error) {
+	response, requestIns, err := c.download(ctx, rawURL, 0, options)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if err := checkResponseStatus(response); err != nil {
+		return 0, err
+	}
+	return copyWithProgress(dest, response.Body, 0, response.ContentLength, requestIns.Progress)
+}
+
+// DownloadFile 下载到path，返回下载完成后文件的大小
+// path已经存在时通过Range头从已有的大小继续下载；服务端不支持Range、返回200时从头下载
+// 文件已经完整(服务端返回416且总大小与文件大小相同)时直接返回
+func (c *Client) DownloadFile(ctx context.Context, rawURL, path string, options ...Option) (int64, error) {
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+	response, requestIns, err := c.download(ctx, rawURL, offset, options)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	total := response.ContentLength
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch {
+	case response.StatusCode == http.StatusPartialContent && offset > 0:
+		start, size, ok := parseContentRange(response.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return 0, fmt.Errorf("download %v error:unexpected Content-Range %q for offset %v", path, response.Header.Get("Content-Range"), offset)
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+		total = size
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		if _, size, ok := parseContentRange(response.Header.Get("Content-Range")); ok && size == offset {
+			if requestIns.Progress != nil {
+				requestIns.Progress(offset, offset)
+			}
+			return offset, nil
+		}
+		return 0, &StatusError{StatusCode: response.StatusCode}
+	default:
+		if err := checkResponseStatus(response); err != nil {
+			return 0, err
+		}
+		offset = 0
+	}
+
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("download %v error:%w", path, err)
+	}
+	written, copyErr := copyWithProgress(file, response.Body, offset, total, requestIns.Progress)
+	if err := file.Close(); err != nil && copyErr == nil {
+		copyErr = fmt.Errorf("download %v error:%w", path, err)
+	}
+	return offset + written, copyErr
+}
+
+// download 发起下载请求，offset大于0时带上Range头
+func (c *Client) download(ctx context.Context, rawURL string, offset int64, options []Option) (*http.Response, *HttpRequests, error) {
+	defaults := append([]Option{WithAttemptTimeout(0)}, c.defaults...)
+	requestIns := c.newRequest(http.MethodGet, rawURL, defaults, options)
+	if offset > 0 {
+		requestIns.setHeader("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	requestIns.Context = ctx
+	response, err := c.call(requestIns)
+	if err != nil {
+		return nil, nil, err
+	}
+	return response, requestIns, nil
+}
+
+// parseContentRange 解析 bytes 100-199/1000 和 bytes */1000，总大小未知(*)时size为-1
+func parseContentRange(value string) (start, size int64, ok bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(strings.TrimSpace(value[len("bytes "):]), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	size = -1
+	if parts[1] != "*" {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		size = n
+	}
+	if parts[0] == "*" {
+		return 0, size, true
+	}
+	bounds := strings.SplitN(parts[0], "-", 2)
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || len(bounds) != 2 {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+// copyWithProgress 将src复制到dst，每次写入之后回调进度，total为完整的大小，断点续传时包含offset
+func copyWithProgress(dst io.Writer, src io.Reader, offset, total int64, progress ProgressFunc) (int64, error) {
+	if total < 0 {
+		total = -1
+	}
+	if progress == nil {
+		n, err := io.Copy(dst, src)
+		if err != nil {
+			return n, fmt.Errorf("copy response body error:%w", err)
+		}
+		return n, nil
+	}
+	progress(offset, total)
+	n, err := io.Copy(&progressWriter{w: dst, transferred: offset, total: total, progress: progress}, src)
+	if err != nil {
+		return n, fmt.Errorf("copy response body error:%w", err)
+	}
+	return n, nil
+}
+
+// progressWriter 写入时累计字节数并回调
+type progressWriter struct {
+	w           io.Writer
+	transferred int64
+	total       int64
+	progress    ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.transferred += int64(n)
+	p.progress(p.transferred, p.total)
+	return n, err
+}
@@ -0,0 +1,182 @@
+package nhr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeServer 通过http.ServeContent提供content，支持Range请求，记录最近一次的Range请求头
+// ranges为false时忽略Range，总是返回完整的内容
+func rangeServer(t *testing.T, content string, ranges bool) (*httptest.Server, func() string) {
+	var mu sync.Mutex
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = r.Header.Get("Range")
+		mu.Unlock()
+		if !ranges {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return got
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value string
+		start int64
+		size  int64
+		ok    bool
+	}{
+		{value: "bytes 100-199/1000", start: 100, size: 1000, ok: true},
+		{value: " bytes 0-0/1 ", start: 0, size: 1, ok: true},
+		{value: "bytes 5-9/*", start: 5, size: -1, ok: true},
+		{value: "bytes */1000", start: 0, size: 1000, ok: true},
+		{value: "bytes 100/1000"},
+		{value: "bytes a-b/1000"},
+		{value: "bytes 0-1/x"},
+		{value: "items 0-1/2"},
+		{value: ""},
+	}
+	for _, tt := range tests {
+		start, size, ok := parseContentRange(tt.value)
+		if start != tt.start || size != tt.size || ok != tt.ok {
+			t.Fatalf("parseContentRange(%q) = %v, %v, %v, want %v, %v, %v", tt.value, start, size, ok, tt.start, tt.size, tt.ok)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server, _ := rangeServer(t, "hello world", true)
+	var progress [][2]int64
+	var buf bytes.Buffer
+	n, err := Download(context.Background(), server.URL, &buf, WithProgress(func(transferred, total int64) {
+		progress = append(progress, [2]int64{transferred, total})
+	}))
+	if err != nil || n != 11 || buf.String() != "hello world" {
+		t.Fatalf("download = %v, %q, %v", n, buf.String(), err)
+	}
+	if len(progress) < 2 || progress[0] != [2]int64{0, 11} || progress[len(progress)-1] != [2]int64{11, 11} {
+		t.Fatalf("progress = %v, want it to start at 0 and end at the total", progress)
+	}
+
+	missing, _ := countingServer(t, http.StatusNotFound)
+	var statusErr *StatusError
+	if _, err := Download(context.Background(), missing.URL, &buf); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("error = %v, want the 404 rejected", err)
+	}
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	content := "0123456789abcdef"
+	server, rangeHeader := rangeServer(t, content, true)
+	path := filepath.Join(t.TempDir(), "file.bin")
+
+	if n, err := DownloadFile(context.Background(), server.URL, path); err != nil || n != int64(len(content)) || rangeHeader() != "" {
+		t.Fatalf("download = %v, %v, range = %q, want a full download", n, err, rangeHeader())
+	}
+
+	if err := os.WriteFile(path, []byte(content[:6]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var last [2]int64
+	n, err := DownloadFile(context.Background(), server.URL, path, WithProgress(func(transferred, total int64) {
+		last = [2]int64{transferred, total}
+	}))
+	if err != nil || n != int64(len(content)) || rangeHeader() != "bytes=6-" {
+		t.Fatalf("download = %v, %v, range = %q, want the download resumed", n, err, rangeHeader())
+	}
+	if got, _ := os.ReadFile(path); string(got) != content || last != [2]int64{16, 16} {
+		t.Fatalf("file = %q, progress = %v", got, last)
+	}
+
+	// 文件已经完整时服务端返回416
+	if n, err := DownloadFile(context.Background(), server.URL, path); err != nil || n != int64(len(content)) {
+		t.Fatalf("download = %v, %v, want the complete file kept", n, err)
+	}
+
+	// 本地文件比服务端的大，416的总大小与文件大小不一致
+	if err := os.WriteFile(path, []byte(content+"extra"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var statusErr *StatusError
+	if _, err := DownloadFile(context.Background(), server.URL, path); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("error = %v, want the 416 reported", err)
+	}
+}
+
+func TestDownloadFileWithoutRangeSupport(t *testing.T) {
+	server, rangeHeader := rangeServer(t, "new content", false)
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := DownloadFile(context.Background(), server.URL, path)
+	if err != nil || n != 11 || rangeHeader() != "bytes=3-" {
+		t.Fatalf("download = %v, %v, range = %q", n, err, rangeHeader())
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new content" {
+		t.Fatalf("file = %q, want it downloaded again from the start", got)
+	}
+}
+
+func TestDownloadFileUnexpectedContentRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-3/4")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("abcd"))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, []byte("ab"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DownloadFile(context.Background(), server.URL, path); err == nil || !strings.Contains(err.Error(), "unexpected Content-Range") {
+		t.Fatalf("error = %v, want the mismatched range rejected", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "ab" {
+		t.Fatalf("file = %q, want it untouched", got)
+	}
+}
+
+func TestDownloadAttemptTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a"))
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("b"))
+	}))
+	defer server.Close()
+	response, requestIns, err := DefaultClient.download(context.Background(), server.URL, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if requestIns.Timeout != 0 {
+		t.Fatalf("attempt timeout = %v, want no limit for downloads by default", requestIns.Timeout)
+	}
+
+	client, err := NewClient(WithTimeout(50 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := client.Download(context.Background(), server.URL, &buf); !errors.Is(err, context.DeadlineExceeded) || buf.String() != "a" {
+		t.Fatalf("download = %q, %v, want the client timeout to cut the body", buf.String(), err)
+	}
+}
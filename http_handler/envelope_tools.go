@@ -0,0 +1,161 @@
+package nhr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BusinessError 接口返回的业务错误码不为成功值，通常出现在HTTP状态码为200的响应中
+// Code为业务错误码的原始文本，数字错误码如40013，字符串错误码会去掉引号
+type BusinessError struct {
+	Code    string
+	Message string
+	Body    []byte
+}
+
+func (e *BusinessError) Error() string {
+	return fmt.Sprintf("business error, code:%v, message:%v", e.Code, e.Message)
+}
+
+// BusinessErrorCheck 在HTTP请求成功之后、反序列化到调用方结构体之前检查响应body，返回非nil表示业务失败
+type BusinessErrorCheck func(body []byte) error
+
+// BusinessCodeRule 声明式的业务错误码规则
+// CodeField和MessageField支持用.分隔的路径，如result.code；SuccessCodes为空时只有0表示成功
+// RetriableCodes 表示临时失败的业务码，例如系统繁忙，开启了重试的请求收到这些业务码的2xx响应时按重试策略重试
+type BusinessCodeRule struct {
+	CodeField      string
+	MessageField   string
+	SuccessCodes   []string
+	RetriableCodes []string
+}
+
+// Check 按规则检查响应body，业务码不在SuccessCodes中时返回*BusinessError
+func (r BusinessCodeRule) Check(body []byte) error {
+	var envelope map[string]json.RawMessage
+	if err := FastJsonUnMarshal(body, &envelope); err != nil {
+		return fmt.Errorf("unMarshal envelope error:%v", err)
+	}
+	return r.checkEnvelope(envelope, body)
+}
+
+// checkEnvelope 在已经解析过的顶层字段上检查业务码，避免重复解析body
+func (r BusinessCodeRule) checkEnvelope(envelope map[string]json.RawMessage, body []byte) error {
+	rawCode, ok := lookupEnvelopePath(envelope, r.CodeField)
+	if !ok {
+		return fmt.Errorf("envelope field %q is missing", r.CodeField)
+	}
+	code := rawJSONText(rawCode)
+	successCodes := r.SuccessCodes
+	if len(successCodes) == 0 {
+		successCodes = []string{"0"}
+	}
+	for _, success := range successCodes {
+		if code == success {
+			return nil
+		}
+	}
+	rawMsg, _ := lookupEnvelopePath(envelope, r.MessageField)
+	return &BusinessError{Code: code, Message: rawJSONText(rawMsg), Body: body}
+}
+
+// lookupEnvelopePath 按.分隔的路径逐层查找字段
+func lookupEnvelopePath(envelope map[string]json.RawMessage, path string) (json.RawMessage, bool) {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		raw, ok := envelope[part]
+		if !ok {
+			return nil, false
+		}
+		if i == len(parts)-1 {
+			return raw, true
+		}
+		envelope = nil
+		if err := FastJsonUnMarshal(raw, &envelope); err != nil {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// WithBusinessErrorCheck 设置业务错误检查，ResponseToStruct、ResponseToMap、DecodeEnvelope在读取body之后、反序列化之前执行
+// 用于HTTP状态码总是200、通过body中的错误码表示失败的网关
+func WithBusinessErrorCheck(check BusinessErrorCheck) Option {
+	return func(req *HttpRequests) {
+		req.BusinessErrorCheck = check
+	}
+}
+
+// WithBusinessCodeRule WithBusinessErrorCheck的声明式版本，按字段路径和成功值检查业务码
+func WithBusinessCodeRule(rule BusinessCodeRule) Option {
+	return func(req *HttpRequests) {
+		req.BusinessCodeRule = &rule
+	}
+}
+
+// checkBusinessError 对响应body执行请求上配置的业务错误检查
+func (c *responseConfig) checkBusinessError(body []byte) error {
+	if c.businessCheck != nil {
+		if err := c.businessCheck(body); err != nil {
+			return err
+		}
+	}
+	if c.businessRule != nil {
+		return c.businessRule.Check(body)
+	}
+	return nil
+}
+
+// DecodeEnvelope 解析 {"code":0,"msg":"ok","data":{...}} 这类信封格式的响应
+// 业务码不为0时返回*BusinessError，否则返回data字段的原始JSON，调用方确定类型后再用FastJsonUnMarshal反序列化
+// 请求设置了WithBusinessCodeRule时，使用规则中的成功值判断业务码，body只解析一次
+// data字段不存在时返回错误，data为null时返回json.RawMessage("null")
+func DecodeEnvelope(responseIns *http.Response, codeField, msgField, dataField string) (json.RawMessage, error) {
+	config := responseConfigOf(responseIns)
+	body, err := responseToBytes(responseIns)
+	if err != nil {
+		return nil, fmt.Errorf("response to bytes error:%w", err)
+	}
+	if config.businessCheck != nil {
+		if err := config.businessCheck(body); err != nil {
+			return nil, err
+		}
+	}
+	var envelope map[string]json.RawMessage
+	if err := config.jsonCodec.unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("unMarshal envelope error:%v", err)
+	}
+	rule := BusinessCodeRule{CodeField: codeField, MessageField: msgField}
+	if config.businessRule != nil {
+		rule.SuccessCodes = config.businessRule.SuccessCodes
+	}
+	if err := rule.checkEnvelope(envelope, body); err != nil {
+		return nil, err
+	}
+	data, ok := envelope[dataField]
+	if !ok {
+		return nil, fmt.Errorf("envelope field %q is missing", dataField)
+	}
+	// FastJsonUnMarshal将null解析为空的RawMessage
+	if len(data) == 0 {
+		data = json.RawMessage("null")
+	}
+	return data, nil
+}
+
+// rawJSONText 返回JSON值的文本形式，字符串会去掉引号，null和空值返回空字符串
+func rawJSONText(raw json.RawMessage) string {
+	text := strings.TrimSpace(string(raw))
+	if text == "" || text == "null" {
+		return ""
+	}
+	if strings.HasPrefix(text, `"`) {
+		var s string
+		if err := FastJsonUnMarshal(raw, &s); err == nil {
+			return s
+		}
+	}
+	return text
+}
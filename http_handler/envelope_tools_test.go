@@ -0,0 +1,177 @@
+package nhr
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// contentServer 以contentType返回固定的body，contentType为空时不设置Content-Type
+func contentServer(t *testing.T, contentType, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDecodeEnvelope(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		options []Option
+		want    string
+		code    string
+		message string
+	}{
+		{name: "success", body: `{"code":0,"msg":"ok","data":{"id":7}}`, want: `{"id":7}`},
+		{name: "null data", body: `{"code":0,"msg":"ok","data":null}`, want: `null`},
+		{name: "business error", body: `{"code":40013,"msg":"invalid appid","data":null}`, code: "40013", message: "invalid appid"},
+		{name: "string code", body: `{"code":"E_AUTH","msg":"expired"}`, code: "E_AUTH", message: "expired"},
+		{
+			name:    "success codes from rule",
+			body:    `{"code":"OK","msg":"","data":[1]}`,
+			options: []Option{WithBusinessCodeRule(BusinessCodeRule{CodeField: "status", SuccessCodes: []string{"OK"}})},
+			want:    `[1]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := contentServer(t, "application/json", tt.body)
+			response, err := Get(server.URL, tt.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := DecodeEnvelope(response, "code", "msg", "data")
+			if tt.code != "" {
+				var businessErr *BusinessError
+				if !errors.As(err, &businessErr) || businessErr.Code != tt.code || businessErr.Message != tt.message || string(businessErr.Body) != tt.body {
+					t.Fatalf("error = %v, want code %v", err, tt.code)
+				}
+				return
+			}
+			if err != nil || string(data) != tt.want {
+				t.Fatalf("data = %s, %v, want %s", data, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEnvelopeErrors(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"msg":"ok","data":{}}`: `"code" is missing`,
+		`{"code":0,"msg":"ok"}`:  `"data" is missing`,
+		`not json`:               "unMarshal envelope error",
+	} {
+		server := contentServer(t, "application/json", body)
+		response, err := Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeEnvelope(response, "code", "msg", "data"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("DecodeEnvelope(%q) error = %v, want %q", body, err, want)
+		}
+	}
+}
+
+func TestBusinessCodeRule(t *testing.T) {
+	rule := BusinessCodeRule{CodeField: "result.code", MessageField: "result.message", SuccessCodes: []string{"0", "200"}}
+	tests := []struct {
+		body string
+		code string
+	}{
+		{body: `{"result":{"code":200,"message":"ok"}}`},
+		{body: `{"result":{"code":0}}`},
+		{body: `{"result":{"code":500,"message":"busy"}}`, code: "500"},
+	}
+	for _, tt := range tests {
+		err := rule.Check([]byte(tt.body))
+		var businessErr *BusinessError
+		if tt.code == "" && err != nil || tt.code != "" && (!errors.As(err, &businessErr) || businessErr.Code != tt.code || businessErr.Message != "busy") {
+			t.Fatalf("Check(%s) = %v, want code %q", tt.body, err, tt.code)
+		}
+	}
+	if err := rule.Check([]byte(`{"result":"flat"}`)); err == nil || !strings.Contains(err.Error(), "is missing") {
+		t.Fatalf("error = %v, want a missing nested field", err)
+	}
+}
+
+func TestBusinessErrorCheckBeforeDecode(t *testing.T) {
+	server := contentServer(t, "application/json", `{"errcode":40001,"errmsg":"invalid credential"}`)
+	check := func(body []byte) error {
+		return BusinessCodeRule{CodeField: "errcode", MessageField: "errmsg"}.Check(body)
+	}
+	for name, option := range map[string]Option{
+		"check": WithBusinessErrorCheck(check),
+		"rule":  WithBusinessCodeRule(BusinessCodeRule{CodeField: "errcode", MessageField: "errmsg"}),
+	} {
+		response, err := Get(server.URL, option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v struct {
+			AccessToken string `json:"access_token"`
+		}
+		var businessErr *BusinessError
+		if err := ResponseToStruct(response, &v); !errors.As(err, &businessErr) || businessErr.Code != "40001" {
+			t.Fatalf("%v: error = %v, want the business error before decoding", name, err)
+		}
+	}
+}
+
+func TestRetriableBusinessCodes(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch atomic.AddInt32(&hits, 1) {
+		case 1:
+			w.Write([]byte(`{"code":"BUSY","msg":"system busy"}`))
+		case 2:
+			w.Write([]byte(`{"code":"DENIED","msg":"denied"}`))
+		default:
+			w.Write([]byte(`{"code":0,"msg":"ok","data":{"id":3}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	rule := BusinessCodeRule{CodeField: "code", MessageField: "msg", RetriableCodes: []string{"BUSY"}}
+
+	// 第一次返回可重试的业务码，第二次返回不可重试的业务码，结果交给调用方
+	response, err := Get(server.URL, WithBusinessCodeRule(rule), WithRetry(3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Data struct {
+			ID int `json:"id"`
+		} `json:"data"`
+	}
+	var businessErr *BusinessError
+	if err := ResponseToStruct(response, &v); !errors.As(err, &businessErr) || businessErr.Code != "DENIED" || atomic.LoadInt32(&hits) != 2 {
+		t.Fatalf("error = %v, hits = %v, want DENIED after one retry", err, hits)
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	response, err = Get(server.URL, WithBusinessCodeRule(BusinessCodeRule{CodeField: "code", RetriableCodes: []string{"BUSY", "DENIED"}}), WithRetry(3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ResponseToStruct(response, &v); err != nil || v.Data.ID != 3 || atomic.LoadInt32(&hits) != 3 {
+		t.Fatalf("data = %+v, %v, hits = %v, want success on the third attempt", v, err, hits)
+	}
+
+	// 没有开启重试时只请求一次
+	atomic.StoreInt32(&hits, 0)
+	response, err = Get(server.URL, WithBusinessCodeRule(rule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ResponseToStruct(response, &v); !errors.As(err, &businessErr) || businessErr.Code != "BUSY" || atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("error = %v, hits = %v, want BUSY without retry", err, hits)
+	}
+}
@@ -0,0 +1,166 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrorInfo 错误的结构化描述，供命令行工具等以JSON格式输出
+// Cause为错误链中的下一层错误
+type ErrorInfo struct {
+	Kind      string                 `json:"kind"`
+	Message   string                 `json:"message"`
+	Status    int                    `json:"status,omitempty"`
+	URL       string                 `json:"url,omitempty"`
+	Method    string                 `json:"method,omitempty"`
+	Attempts  int                    `json:"attempts,omitempty"`
+	Retriable bool                   `json:"retriable"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Cause     *ErrorInfo             `json:"cause,omitempty"`
+}
+
+// sensitiveQueryPattern 匹配URL查询参数中常见的敏感字段
+var sensitiveQueryPattern = regexp.MustCompile(`(?i)([?&](?:access_token|refresh_token|id_token|token|api_key|apikey|key|secret|client_secret|password|passwd|pwd|signature|sig|auth|authorization)=)[^&#\s"']*`)
+
+// redactSecrets 将文本中URL查询参数里的敏感值替换为***
+func redactSecrets(text string) string {
+	return sensitiveQueryPattern.ReplaceAllString(text, "${1}***")
+}
+
+// NewErrorInfo 将错误链转为ErrorInfo，普通的wrap错误也可以转换
+func NewErrorInfo(err error) *ErrorInfo {
+	if err == nil {
+		return nil
+	}
+	info := &ErrorInfo{
+		Kind:      errorKind(err),
+		Message:   redactSecrets(err.Error()),
+		Retriable: IsRetriableTransportError(err),
+	}
+	switch e := err.(type) {
+	case *RetryError:
+		info.Attempts = e.Attempts
+	case *StatusError:
+		info.Status = e.StatusCode
+	case *url.Error:
+		info.URL = redactSecrets(e.URL)
+		info.Method = strings.ToUpper(e.Op)
+	case *ContentDecodeError:
+		info.Details = map[string]interface{}{"encoding": e.Encoding}
+	case *URLPolicyError:
+		info.URL = redactSecrets(e.URL)
+		info.Details = map[string]interface{}{"violations": e.Violations}
+	case *ProductionWriteError:
+		info.Method = e.Method
+		info.Details = map[string]interface{}{"host": e.Host, "redirect": e.Redirect}
+	case *DNSError:
+		info.Details = map[string]interface{}{
+			"name":      e.Name,
+			"server":    e.Server,
+			"not_found": e.IsNotFound,
+			"timeout":   e.IsTimeout,
+			"temporary": e.IsTemporary,
+			"source":    e.Source,
+		}
+	}
+	info.Cause = NewErrorInfo(errors.Unwrap(err))
+	return info
+}
+
+// errorKind 返回错误的类别
+func errorKind(err error) string {
+	switch e := err.(type) {
+	case *DNSError:
+		return "dns"
+	case *ContentDecodeError:
+		return "content_decode"
+	case *headersTooLargeError:
+		return "response_headers_too_large"
+	case *URLPolicyError:
+		return "url_policy"
+	case *ProductionWriteError:
+		return "production_write_blocked"
+	case *BusinessError:
+		return "business"
+	case *invalidURLError:
+		return "invalid_url"
+	case *RetryError:
+		return "retries_exhausted"
+	case *StatusError:
+		return "status"
+	case *url.Error:
+		return "url"
+	case *net.DNSError:
+		return "net_dns"
+	case *net.OpError:
+		return "net"
+	case *kindError:
+		return e.kind
+	case *BatchAbortedError:
+		return "batch_aborted"
+	}
+	switch err {
+	case ErrBatchAborted:
+		return "batch_aborted"
+	case context.DeadlineExceeded:
+		return "timeout"
+	case context.Canceled:
+		return "canceled"
+	}
+	return "error"
+}
+
+// ErrorToJSON 将错误序列化为JSON，包含kind、message、status、url、method、attempts、retriable以及嵌套的cause链
+// URL查询参数中的token、key、password等敏感值会被替换为***
+func ErrorToJSON(err error) ([]byte, error) {
+	return FastJsonMarshal(NewErrorInfo(err))
+}
+
+// kindError 带有固定类别的哨兵错误，用于需要MarshalJSON的超时错误
+type kindError struct {
+	kind    string
+	message string
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+// MarshalJSON 以ErrorToJSON的格式序列化DNSError
+func (e *DNSError) MarshalJSON() ([]byte, error) {
+	return ErrorToJSON(e)
+}
+
+// MarshalJSON 以ErrorToJSON的格式序列化StatusError
+func (e *StatusError) MarshalJSON() ([]byte, error) {
+	return ErrorToJSON(e)
+}
+
+// MarshalJSON 以ErrorToJSON的格式序列化ContentDecodeError
+func (e *ContentDecodeError) MarshalJSON() ([]byte, error) {
+	return ErrorToJSON(e)
+}
+
+// MarshalJSON 以ErrorToJSON的格式序列化RetryError
+func (e *RetryError) MarshalJSON() ([]byte, error) {
+	return ErrorToJSON(e)
+}
+
+// MarshalJSON 以ErrorToJSON的格式序列化URLPolicyError
+func (e *URLPolicyError) MarshalJSON() ([]byte, error) {
+	return ErrorToJSON(e)
+}
+
+// MarshalJSON 以ErrorToJSON的格式序列化ProductionWriteError
+func (e *ProductionWriteError) MarshalJSON() ([]byte, error) {
+	return ErrorToJSON(e)
+}
+
+// MarshalJSON 以ErrorToJSON的格式序列化ErrOverallTimeout、ErrBodyIdleTimeout等超时错误
+func (e *kindError) MarshalJSON() ([]byte, error) {
+	return ErrorToJSON(e)
+}
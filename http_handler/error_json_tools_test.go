@@ -0,0 +1,122 @@
+package nhr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestErrorToJSONGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "status wrapped in retry",
+			err:  &RetryError{Attempts: 3, Err: &StatusError{StatusCode: 503}},
+			want: `{"kind":"retries_exhausted","message":"request failed after 3 attempts:unexpected response status code 503","attempts":3,"retriable":false,` +
+				`"cause":{"kind":"status","message":"unexpected response status code 503","status":503,"retriable":false}}`,
+		},
+		{
+			name: "url error with secret",
+			err:  fmt.Errorf("send request error:%w", &url.Error{Op: "Get", URL: "https://api.example.com/v1?token=abc&page=2", Err: ErrOverallTimeout}),
+			want: `{"kind":"error","message":"send request error:Get \"https://api.example.com/v1?token=***\u0026page=2\": overall timeout exhausted, attempt skipped","retriable":false,` +
+				`"cause":{"kind":"url","message":"Get \"https://api.example.com/v1?token=***\u0026page=2\": overall timeout exhausted, attempt skipped","url":"https://api.example.com/v1?token=***\u0026page=2","method":"GET","retriable":false,` +
+				`"cause":{"kind":"overall_timeout","message":"overall timeout exhausted, attempt skipped","retriable":false}}}`,
+		},
+		{
+			name: "content decode",
+			err:  &ContentDecodeError{Encoding: "gzip", Err: errors.New("bad header")},
+			want: `{"kind":"content_decode","message":"decode gzip response body error:bad header","retriable":false,"details":{"encoding":"gzip"},` +
+				`"cause":{"kind":"error","message":"bad header","retriable":false}}`,
+		},
+		{
+			name: "production write",
+			err:  &ProductionWriteError{Method: "POST", Host: "api.example.com"},
+			want: `{"kind":"production_write_blocked","message":"write request to production host blocked: POST api.example.com","method":"POST","retriable":false,"details":{"host":"api.example.com","redirect":false}}`,
+		},
+		{
+			name: "url policy",
+			err:  &URLPolicyError{URL: "http://internal/?key=k", Violations: []string{"scheme http not allowed"}},
+			want: `{"kind":"url_policy","message":"url violates policy \"http://internal/?key=***\": scheme http not allowed","url":"http://internal/?key=***","retriable":false,"details":{"violations":["scheme http not allowed"]}}`,
+		},
+		{
+			name: "idle timeout",
+			err:  ErrBodyIdleTimeout,
+			want: `{"kind":"body_idle_timeout","message":"response body idle timeout","retriable":false}`,
+		},
+		{
+			name: "deadline budget",
+			err:  ErrDeadlineBudgetExhausted,
+			want: `{"kind":"deadline_budget","message":"deadline budget exhausted","retriable":false}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ErrorToJSON(tt.err)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("ErrorToJSON:\n got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorMarshalJSONMatchesErrorToJSON(t *testing.T) {
+	errs := []error{
+		&StatusError{StatusCode: 404},
+		&ContentDecodeError{Encoding: "br", Err: errors.New("eof")},
+		&RetryError{Attempts: 2, Err: errors.New("reset")},
+		&URLPolicyError{URL: "ftp://x", Violations: []string{"scheme"}},
+		&ProductionWriteError{Method: "DELETE", Host: "prod", Redirect: true},
+		&DNSError{Name: "example.com", IsTimeout: true, Source: DNSSourceLive, err: errors.New("timeout")},
+		ErrOverallTimeout,
+		ErrBodyIdleTimeout,
+		ErrDeadlineBudgetExhausted,
+	}
+	for _, e := range errs {
+		marshaled, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("json.Marshal(%T): %v", e, err)
+		}
+		want, _ := ErrorToJSON(e)
+		if string(marshaled) != string(want) {
+			t.Fatalf("json.Marshal(%T) = %s, want %s", e, marshaled, want)
+		}
+	}
+}
+
+func TestErrorInfoRoundTrip(t *testing.T) {
+	err := fmt.Errorf("call failed:%w", &RetryError{Attempts: 4, Err: &StatusError{StatusCode: 502}})
+	data, marshalErr := ErrorToJSON(err)
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	var info ErrorInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Cause == nil || info.Cause.Attempts != 4 || info.Cause.Cause == nil || info.Cause.Cause.Status != 502 {
+		t.Fatalf("decoded %+v", info)
+	}
+	again, _ := json.Marshal(&info)
+	if string(again) != string(data) {
+		t.Fatalf("round trip changed the document:\n%s\n%s", again, data)
+	}
+}
+
+func TestErrorsKeepSentinelIdentity(t *testing.T) {
+	wrapped := fmt.Errorf("send request error:%w", ErrOverallTimeout)
+	if !errors.Is(wrapped, ErrOverallTimeout) || errors.Is(wrapped, ErrBodyIdleTimeout) {
+		t.Fatal("timeout sentinels should only match themselves")
+	}
+	if strings.Contains(ErrOverallTimeout.Error(), "{") {
+		t.Fatal("Error() should stay plain text")
+	}
+}
@@ -0,0 +1,243 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DNS解析结果的来源
+const (
+	DNSSourceLive   = "live"
+	DNSSourceCached = "cached"
+)
+
+// DNSError 域名解析失败时的详细信息，通过errors.As从请求错误中获取
+type DNSError struct {
+	// Name 解析失败的域名
+	Name string
+	// Server 返回错误的DNS服务器，可能为空
+	Server string
+	// IsNotFound 域名不存在(NXDOMAIN)
+	IsNotFound bool
+	// IsTimeout 解析超时
+	IsTimeout bool
+	// IsTemporary 临时性错误，稍后重试可能成功
+	IsTemporary bool
+	// Source 产生错误的解析路径，live表示实时解析，cached表示来自DNS缓存
+	Source string
+
+	err error
+}
+
+func (e *DNSError) Error() string {
+	var kinds []string
+	if e.IsNotFound {
+		kinds = append(kinds, "not found")
+	}
+	if e.IsTimeout {
+		kinds = append(kinds, "timeout")
+	}
+	if e.IsTemporary {
+		kinds = append(kinds, "temporary")
+	}
+	detail := fmt.Sprintf("source=%v", e.Source)
+	if e.Server != "" {
+		detail = fmt.Sprintf("server=%v, %v", e.Server, detail)
+	}
+	if len(kinds) > 0 {
+		detail = fmt.Sprintf("%v, %v", strings.Join(kinds, "/"), detail)
+	}
+	return fmt.Sprintf("dns lookup %v failed (%v): %v", e.Name, detail, e.err)
+}
+
+// Unwrap 返回原始错误，因此errors.As依然可以取到*url.Error和*net.DNSError
+func (e *DNSError) Unwrap() error {
+	return e.err
+}
+
+// ErrResponseHeadersTooLarge 响应头超过了WithMaxResponseHeaderBytes设置的上限
+var ErrResponseHeadersTooLarge = errors.New("response headers too large")
+
+// headersTooLargeError 保留原始错误链的同时可以通过errors.Is匹配ErrResponseHeadersTooLarge
+type headersTooLargeError struct {
+	err error
+}
+
+func (e *headersTooLargeError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrResponseHeadersTooLarge, e.err)
+}
+
+func (e *headersTooLargeError) Is(target error) bool {
+	return target == ErrResponseHeadersTooLarge
+}
+
+func (e *headersTooLargeError) Unwrap() error {
+	return e.err
+}
+
+// classifyTransportError 将发送请求返回的错误转为本包定义的类型化错误
+func classifyTransportError(err error) error {
+	if err == nil {
+		return nil
+	}
+	// net/http没有导出该错误，只能通过错误信息判断
+	if strings.Contains(err.Error(), "server response headers exceeded") {
+		return &headersTooLargeError{err: err}
+	}
+	return wrapDNSError(err)
+}
+
+// wrapDNSError 错误链中包含*net.DNSError时，包装为*DNSError，否则原样返回
+func wrapDNSError(err error) error {
+	var dnsErr *net.DNSError
+	if err == nil || !errors.As(err, &dnsErr) {
+		return err
+	}
+	var wrapped *DNSError
+	if errors.As(err, &wrapped) {
+		return err
+	}
+	return &DNSError{
+		Name:        dnsErr.Name,
+		Server:      dnsErr.Server,
+		IsNotFound:  dnsErr.IsNotFound,
+		IsTimeout:   dnsErr.IsTimeout,
+		IsTemporary: dnsErr.IsTemporary,
+		Source:      DNSSourceLive,
+		err:         err,
+	}
+}
+
+// attemptTrace 通过httptrace记录一次尝试进行到了哪一步，回调可能在transport的goroutine中执行
+type attemptTrace struct {
+	getConn      int32
+	gotConn      int32
+	reused       int32
+	gotFirstByte int32
+
+	// stats Client的连接统计，为nil时不统计；host为最近一次获取连接的host:port
+	stats *poolStats
+	host  atomic.Value
+	// connectStart、dialTime 最近一次建立连接的开始时间和耗时(纳秒)
+	connectStart int64
+	dialTime     int64
+}
+
+func (t *attemptTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			t.host.Store(hostPort)
+			atomic.StoreInt64(&t.connectStart, 0)
+			atomic.StoreInt32(&t.getConn, 1)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			var reused int32
+			if info.Reused {
+				reused = 1
+			}
+			atomic.StoreInt32(&t.reused, reused)
+			atomic.StoreInt32(&t.gotConn, 1)
+			t.stats.gotConn(t.hostPort(), info.Reused, info.WasIdle)
+		},
+		ConnectStart: func(network, addr string) {
+			atomic.CompareAndSwapInt64(&t.connectStart, 0, timeNow().UnixNano())
+		},
+		ConnectDone: func(network, addr string, err error) {
+			start := atomic.SwapInt64(&t.connectStart, 0)
+			if err != nil || start == 0 {
+				return
+			}
+			d := timeNow().UnixNano() - start
+			atomic.StoreInt64(&t.dialTime, d)
+			t.stats.dialed(t.hostPort(), time.Duration(d))
+		},
+		GotFirstResponseByte: func() { atomic.StoreInt32(&t.gotFirstByte, 1) },
+	}
+}
+
+func (t *attemptTrace) hostPort() string {
+	host, _ := t.host.Load().(string)
+	return host
+}
+
+// wrap 将发送请求返回的错误与这次尝试的进度一起包装为*transportError
+func (t *attemptTrace) wrap(err error) error {
+	return &transportError{
+		err:          err,
+		started:      atomic.LoadInt32(&t.getConn) == 1,
+		gotConn:      atomic.LoadInt32(&t.gotConn) == 1,
+		reused:       atomic.LoadInt32(&t.reused) == 1,
+		gotFirstByte: atomic.LoadInt32(&t.gotFirstByte) == 1,
+	}
+}
+
+// transportError 发送请求失败时的原始错误，附带失败时请求进行到了哪一步
+type transportError struct {
+	err error
+	// started 请求交给了net/http.Transport，自定义的RoundTripper不会设置
+	started bool
+	// gotConn 已经拿到连接，reused表示连接来自连接池
+	gotConn bool
+	reused  bool
+	// gotFirstByte 已经收到响应的第一个字节
+	gotFirstByte bool
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// notSent 在拿到连接之前就失败了(DNS解析、建立连接、TLS握手)，请求一定没有发出
+func (e *transportError) notSent() bool {
+	return e.started && !e.gotConn
+}
+
+// IsRetriableTransportError 判断请求错误是否由连接在应用层收到任何数据之前断开导致
+// 包括connection reset、broken pipe、在收到任何响应字节前的EOF、服务端关闭了复用的空闲连接以及DNS解析超时或临时失败
+// 这类错误说明请求没有被服务端处理，对任何method重试都是安全的；已经收到响应字节之后的错误不在此列
+// err应当是本包发送请求时返回的错误，EOF和空闲连接被关闭需要本包记录的连接信息才能判断
+// 读取响应body过程中的错误不在此列，对非幂等method不能直接重试
+func IsRetriableTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	// 主动取消或超时不属于连接被断开
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var trace *transportError
+	traced := errors.As(err, &trace)
+	// 已经收到了响应，服务端可能已经处理了请求
+	if traced && trace.gotFirstByte {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// DNS解析超时或临时失败时请求还没有发出，域名不存在则重试也没有意义
+	var dnsErr *DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+	}
+	if !traced {
+		return false
+	}
+	// 没有收到任何响应字节时的EOF说明服务端在处理之前就关闭了连接
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// 复用的空闲连接在收到响应之前就被关闭(例如NAT网关回收了连接)
+	return trace.reused && trace.gotConn
+}
@@ -0,0 +1,155 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// sendError 模拟createRequest返回的错误链
+func sendError(err error, trace transportError) error {
+	trace.err = &url.Error{Op: "Post", URL: "http://example.com", Err: err}
+	return fmt.Errorf("send request error:%w", classifyTransportError(&trace))
+}
+
+func opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError(op, err)}
+}
+
+func TestIsRetriableTransportError(t *testing.T) {
+	sent := transportError{started: true, gotConn: true}
+	reused := transportError{started: true, gotConn: true, reused: true}
+	responded := transportError{started: true, gotConn: true, gotFirstByte: true}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection reset", sendError(opError("read", syscall.ECONNRESET), sent), true},
+		{"broken pipe", sendError(opError("write", syscall.EPIPE), sent), true},
+		{"reset without trace", &url.Error{Op: "Get", URL: "http://example.com", Err: opError("read", syscall.ECONNRESET)}, true},
+		{"eof before response bytes", sendError(io.EOF, sent), true},
+		{"unexpected eof before response bytes", sendError(io.ErrUnexpectedEOF, sent), true},
+		{"eof after response bytes", sendError(io.ErrUnexpectedEOF, responded), false},
+		{"reset after response bytes", sendError(opError("read", syscall.ECONNRESET), responded), false},
+		{"eof without trace", &url.Error{Op: "Get", URL: "http://example.com", Err: io.EOF}, false},
+		{"idle connection closed", sendError(errors.New("http: server closed idle connection"), reused), true},
+		{"idle connection message on fresh connection", sendError(errors.New("http: server closed idle connection"), sent), false},
+		{"dns temporary", sendError(&net.DNSError{Name: "example.com", IsTemporary: true}, transportError{started: true}), true},
+		{"dns not found", sendError(&net.DNSError{Name: "example.com", IsNotFound: true}, transportError{started: true}), false},
+		{"canceled", sendError(context.Canceled, sent), false},
+		{"deadline exceeded", sendError(context.DeadlineExceeded, reused), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetriableTransportError(tt.err); got != tt.want {
+				t.Fatalf("IsRetriableTransportError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// hijackServer 读取请求之后写入raw并关闭连接
+func hijackServer(t *testing.T, raw string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		buf.WriteString(raw)
+		buf.Flush()
+		conn.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIsRetriableTransportErrorFromServer(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want bool
+	}{
+		{"closed before response", "", true},
+		{"closed mid headers", "HTTP/1.1 200 OK\r\nContent-", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := hijackServer(t, tt.raw)
+			_, err := Post(server.URL, WithPostStringBody("{}"))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := IsRetriableTransportError(err); got != tt.want {
+				t.Fatalf("IsRetriableTransportError(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransportErrorNotSent(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = Post("http://"+addr, WithPostStringBody("{}"))
+	var trace *transportError
+	if !errors.As(err, &trace) {
+		t.Fatalf("error %v does not carry the attempt trace", err)
+	}
+	if !trace.notSent() {
+		t.Fatalf("connection refused should be reported as not sent: %+v", trace)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatalf("error %v should match ECONNREFUSED", err)
+	}
+}
+
+// hugeHeaderServer 返回一个size字节的Set-Cookie响应头
+func hugeHeaderServer(t *testing.T, size int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "big="+strings.Repeat("x", size))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResponseHeadersTooLarge(t *testing.T) {
+	// 默认上限为1MB
+	server := hugeHeaderServer(t, 2<<20)
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrResponseHeadersTooLarge) {
+		t.Fatalf("default client error = %v, want ErrResponseHeadersTooLarge", err)
+	}
+	if _, err := Get(server.URL); !errors.Is(err, ErrResponseHeadersTooLarge) {
+		t.Fatalf("DefaultClient error = %v, want ErrResponseHeadersTooLarge", err)
+	}
+
+	small := hugeHeaderServer(t, 8<<10)
+	if _, err := Get(small.URL, WithMaxResponseHeaderBytes(4<<10)); !errors.Is(err, ErrResponseHeadersTooLarge) {
+		t.Fatalf("WithMaxResponseHeaderBytes error = %v, want ErrResponseHeadersTooLarge", err)
+	}
+	response, err := Get(small.URL)
+	if err != nil {
+		t.Fatalf("headers under the default limit: %v", err)
+	}
+	response.Body.Close()
+}
@@ -1,17 +1,262 @@
 package nhr
 
-import jsoniter "github.com/json-iterator/go"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	jsoniter "github.com/json-iterator/go"
+)
 
 var fastJson = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// jsonCodec 包内所有JSON编解码使用的接口
+type jsonCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// stdJSONCodec 使用标准库encoding/json
+type stdJSONCodec struct{}
+
+func (stdJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+var (
+	stdCodec  jsonCodec = stdJSONCodec{}
+	fastCodec jsonCodec = fastJson
+)
+
+// JSONCodec 选择JSON编解码的实现
+type JSONCodec int32
+
+const (
+	// DefaultJSONCodec 使用UseStdJSON、UseFastJSON设置的包级别codec
+	DefaultJSONCodec JSONCodec = iota
+	// FastJSONCodec 使用jsoniter
+	FastJSONCodec
+	// StdJSONCodec 使用标准库encoding/json
+	StdJSONCodec
+)
+
+func (c JSONCodec) String() string {
+	if c.resolve() == StdJSONCodec {
+		return "encoding/json"
+	}
+	return "jsoniter"
+}
+
+// packageCodec 包级别的codec，默认为jsoniter
+var packageCodec = int32(FastJSONCodec)
+
+// jsonDiagnostics 为1时反序列化同时使用两个codec，并告警结果不一致的情况
+var jsonDiagnostics int32
+
+// UseStdJSON 包内所有JSON编解码切换为标准库encoding/json，用于规避jsoniter与标准库行为不一致的情况
+// 通过WithJSONCodec单独设置了codec的请求和Client不受影响
+func UseStdJSON() {
+	atomic.StoreInt32(&packageCodec, int32(StdJSONCodec))
+}
+
+// UseFastJSON 包内所有JSON编解码切换为jsoniter，这是默认值
+func UseFastJSON() {
+	atomic.StoreInt32(&packageCodec, int32(FastJSONCodec))
+}
+
+// WithJSONCodec 为单个请求或者Client(作为NewClient、Client.With的配置)选择JSON codec，优先于UseStdJSON、UseFastJSON
+// 影响WithPostJsonBody的序列化，以及ResponseToStruct、ResponseDecode、Response.JSON、DecodeEnvelope、StreamJSON和DownloadAndDecode的反序列化
+// 请求body在WithPostJsonBody执行时序列化，单次请求的WithJSONCodec需要放在它之前；Client的codec总是先于所有配置生效
+func WithJSONCodec(codec JSONCodec) Option {
+	return func(req *HttpRequests) {
+		req.JSONCodec = codec
+	}
+}
+
+// EnableJSONDiagnostics 开启后每次反序列化都会用另一个codec再解析一次，结果不一致时通过SetLogger设置的Logger告警，便于向上游报告问题
+// 告警只包含类型和不一致的字段名，不包含字段的值；会使反序列化的开销翻倍，只应在排查问题时开启
+func EnableJSONDiagnostics(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&jsonDiagnostics, v)
+}
+
+// resolve 返回实际使用的codec，DefaultJSONCodec时为包级别的设置
+func (c JSONCodec) resolve() JSONCodec {
+	if c != DefaultJSONCodec {
+		return c
+	}
+	return JSONCodec(atomic.LoadInt32(&packageCodec))
+}
+
+func (c JSONCodec) impl() jsonCodec {
+	if c.resolve() == StdJSONCodec {
+		return stdCodec
+	}
+	return fastCodec
+}
+
+// other 返回用于诊断比较的另一个codec
+func (c JSONCodec) other() JSONCodec {
+	if c.resolve() == StdJSONCodec {
+		return FastJSONCodec
+	}
+	return StdJSONCodec
+}
+
+func (c JSONCodec) marshal(v interface{}) ([]byte, error) {
+	return c.impl().Marshal(v)
+}
+
+// unmarshal 反序列化，开启诊断时在解析之前保存v的状态，用另一个codec从同样的状态解析后比较
+func (c JSONCodec) unmarshal(data []byte, v interface{}) error {
+	var before reflect.Value
+	if atomic.LoadInt32(&jsonDiagnostics) == 1 {
+		before = snapshotTarget(v)
+	}
+	if err := c.impl().Unmarshal(data, v); err != nil {
+		return err
+	}
+	if before.IsValid() {
+		diagnoseJSON(c, data, v, before)
+	}
+	return nil
+}
+
+// jsonStreamDecoder 流式解析JSON的解码器，标准库和jsoniter的Decoder都满足
+type jsonStreamDecoder interface {
+	Decode(v interface{}) error
+	More() bool
+}
+
+// newDecoder 返回codec对应的流式解码器
+func (c JSONCodec) newDecoder(r io.Reader) jsonStreamDecoder {
+	if c.resolve() == StdJSONCodec {
+		return json.NewDecoder(r)
+	}
+	return fastJson.NewDecoder(r)
+}
+
 // FastJsonMarshal json序列化
 func FastJsonMarshal(v interface{}) ([]byte, error) {
-	ret, err := fastJson.Marshal(v)
-	return ret, err
+	return DefaultJSONCodec.marshal(v)
 }
 
 // FastJsonUnMarshal json反序列化
 func FastJsonUnMarshal(data []byte, v interface{}) error {
-	err := fastJson.Unmarshal(data, v)
-	return err
+	return DefaultJSONCodec.unmarshal(data, v)
+}
+
+// snapshotTarget 复制v指向的值，v不是非nil的指针时返回无效的Value
+func snapshotTarget(v interface{}) reflect.Value {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return reflect.Value{}
+	}
+	return deepCopyValue(rv.Elem())
+}
+
+// deepCopyValue 复制指针、map、切片和导出的结构体字段，另一个codec解析时不会修改调用方的数据
+func deepCopyValue(v reflect.Value) reflect.Value {
+	copied := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			ptr := reflect.New(v.Type().Elem())
+			ptr.Elem().Set(deepCopyValue(v.Elem()))
+			copied.Set(ptr)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			copied.Set(deepCopyValue(v.Elem()))
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			copied.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+			iter := v.MapRange()
+			for iter.Next() {
+				copied.SetMapIndex(iter.Key(), deepCopyValue(iter.Value()))
+			}
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			copied.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				copied.Index(i).Set(deepCopyValue(v.Index(i)))
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(deepCopyValue(v.Index(i)))
+		}
+	case reflect.Struct:
+		copied.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if field := copied.Field(i); field.CanSet() {
+				field.Set(deepCopyValue(v.Field(i)))
+			}
+		}
+	default:
+		copied.Set(v)
+	}
+	return copied
+}
+
+// diagnoseJSON 用另一个codec从解析之前的状态before解析同一份数据，与已解析的结果比较
+func diagnoseJSON(used JSONCodec, data []byte, v interface{}, before reflect.Value) {
+	rv := reflect.ValueOf(v).Elem()
+	other := used.other()
+	check := reflect.New(rv.Type())
+	check.Elem().Set(before)
+	if err := other.impl().Unmarshal(data, check.Interface()); err != nil {
+		logWarning(fmt.Sprintf("json codecs disagree decoding %T: %s succeeded, %s failed: %v", v, used, other, err))
+		return
+	}
+	if fields := differingFields(rv, check.Elem()); fields != nil {
+		logWarning(fmt.Sprintf("json codecs disagree decoding %T: %s and %s differ in %v", v, used, other, fields))
+	}
+}
+
+// differingFields 返回两个值中不一致的顶层字段名或map的key，完全一致时返回nil，告警中不记录字段的值
+func differingFields(a, b reflect.Value) []string {
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return nil
+	}
+	for a.Kind() == reflect.Ptr && b.Kind() == reflect.Ptr && !a.IsNil() && !b.IsNil() {
+		a, b = a.Elem(), b.Elem()
+	}
+	var fields []string
+	switch {
+	case a.Kind() == reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if a.Type().Field(i).IsExported() && !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+				fields = append(fields, a.Type().Field(i).Name)
+			}
+		}
+	case a.Kind() == reflect.Map && a.Type().Key().Kind() == reflect.String:
+		keys := map[string]bool{}
+		for _, key := range append(a.MapKeys(), b.MapKeys()...) {
+			keys[key.String()] = true
+		}
+		for key := range keys {
+			x, y := a.MapIndex(reflect.ValueOf(key).Convert(a.Type().Key())), b.MapIndex(reflect.ValueOf(key).Convert(a.Type().Key()))
+			if x.IsValid() != y.IsValid() || (x.IsValid() && !reflect.DeepEqual(x.Interface(), y.Interface())) {
+				fields = append(fields, key)
+			}
+		}
+		sort.Strings(fields)
+	}
+	if len(fields) == 0 {
+		fields = []string{"(value)"}
+	}
+	return fields
 }
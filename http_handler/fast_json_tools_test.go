@@ -0,0 +1,273 @@
+package nhr
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingCodec 记录调用次数的codec，after不为nil时在解析成功后修改结果
+type countingCodec struct {
+	jsonCodec
+	marshals   int32
+	unmarshals int32
+	after      func(v interface{}) error
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt32(&c.marshals, 1)
+	return c.jsonCodec.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt32(&c.unmarshals, 1)
+	if err := c.jsonCodec.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if c.after != nil {
+		return c.after(v)
+	}
+	return nil
+}
+
+// swapCodecs 用countingCodec包装两个codec，测试结束时恢复，包级别的codec恢复为jsoniter
+func swapCodecs(t *testing.T) (fast, std *countingCodec) {
+	fast, std = &countingCodec{jsonCodec: fastCodec}, &countingCodec{jsonCodec: stdCodec}
+	oldFast, oldStd := fastCodec, stdCodec
+	fastCodec, stdCodec = fast, std
+	t.Cleanup(func() {
+		fastCodec, stdCodec = oldFast, oldStd
+		UseFastJSON()
+		EnableJSONDiagnostics(false)
+	})
+	return fast, std
+}
+
+func TestPackageJSONCodec(t *testing.T) {
+	fast, std := swapCodecs(t)
+	var v map[string]int
+	if err := FastJsonUnMarshal([]byte(`{"a":1}`), &v); err != nil || fast.unmarshals != 1 || std.unmarshals != 0 {
+		t.Fatalf("unmarshals = %v, %v, %v, want jsoniter by default", fast.unmarshals, std.unmarshals, err)
+	}
+	UseStdJSON()
+	if _, err := FastJsonMarshal(v); err != nil || std.marshals != 1 || fast.marshals != 0 {
+		t.Fatalf("marshals = %v, %v, %v, want encoding/json after UseStdJSON", fast.marshals, std.marshals, err)
+	}
+	if DefaultJSONCodec.String() != "encoding/json" || FastJSONCodec.String() != "jsoniter" {
+		t.Fatalf("names = %v, %v", DefaultJSONCodec, FastJSONCodec)
+	}
+	UseFastJSON()
+	if err := FastJsonUnMarshal([]byte(`{"a":1}`), &v); err != nil || fast.unmarshals != 2 {
+		t.Fatalf("unmarshals = %v, want jsoniter after UseFastJSON", fast.unmarshals)
+	}
+}
+
+func TestWithJSONCodec(t *testing.T) {
+	fast, std := swapCodecs(t)
+	server, got := headerServer(t)
+
+	response, err := Post(server.URL, WithJSONCodec(StdJSONCodec), WithPostJsonBody(map[string]interface{}{"a": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if std.marshals != 1 || fast.marshals != 0 || (*got).ContentLength != int64(len(`{"a":1}`)) {
+		t.Fatalf("marshals = %v, %v, want the request body encoded with encoding/json", fast.marshals, std.marshals)
+	}
+
+	body := contentServer(t, "application/json", `{"id":1}`)
+	response, err = Get(body.URL, WithJSONCodec(StdJSONCodec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order decodedOrder
+	if err := ResponseToStruct(response, &order); err != nil || order.ID != 1 || std.unmarshals != 1 || fast.unmarshals != 0 {
+		t.Fatalf("decoded = %+v, %v, unmarshals = %v, %v", order, err, fast.unmarshals, std.unmarshals)
+	}
+}
+
+func TestClientJSONCodec(t *testing.T) {
+	fast, std := swapCodecs(t)
+	server := contentServer(t, "application/json", `{"id":2}`)
+	// WithPostJsonBody写在WithJSONCodec之前，仍然使用Client的codec
+	client, err := NewClient(WithPostJsonBody(map[string]interface{}{"a": 1}), WithJSONCodec(StdJSONCodec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NewClient读取配置时执行过一次默认配置
+	atomic.StoreInt32(&fast.marshals, 0)
+	response, err := client.Fetch(http.MethodPost, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order decodedOrder
+	if err := response.JSON(&order); err != nil || order.ID != 2 {
+		t.Fatalf("decoded = %+v, %v", order, err)
+	}
+	raw, err := client.Post(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ResponseDecode(raw, &order); err != nil {
+		t.Fatal(err)
+	}
+	if fast.marshals != 0 || fast.unmarshals != 0 || std.marshals < 2 || std.unmarshals != 2 {
+		t.Fatalf("fast = %v/%v, std = %v/%v, want only encoding/json", fast.marshals, fast.unmarshals, std.marshals, std.unmarshals)
+	}
+
+	// 单次请求和派生的Client可以覆盖Client的codec
+	response, err = client.Fetch(http.MethodPost, server.URL, WithJSONCodec(FastJSONCodec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.JSON(&order); err != nil || fast.unmarshals != 1 {
+		t.Fatalf("fast unmarshals = %v, %v, want the request codec", fast.unmarshals, err)
+	}
+	derived := client.With(WithJSONCodec(FastJSONCodec))
+	if derived.jsonCodec != FastJSONCodec || client.jsonCodec != StdJSONCodec || client.With().jsonCodec != StdJSONCodec {
+		t.Fatalf("codecs = %v, %v, want the derived client to override only itself", derived.jsonCodec, client.jsonCodec)
+	}
+}
+
+type diagnosedAccount struct {
+	Token    string `json:"token"`
+	Count    int    `json:"count"`
+	Existing int    `json:"existing"`
+}
+
+func TestJSONDiagnostics(t *testing.T) {
+	fast, _ := swapCodecs(t)
+	recorder := &entryRecorder{}
+	SetLogger(recorder)
+	t.Cleanup(func() { SetLogger(nil) })
+	EnableJSONDiagnostics(true)
+
+	// 已经有值的字段两个codec都保留，不应告警
+	account := diagnosedAccount{Existing: 5}
+	if err := FastJsonUnMarshal([]byte(`{"token":"s3cret","count":1}`), &account); err != nil {
+		t.Fatal(err)
+	}
+	if entries := recorder.list(); len(entries) != 0 || account.Existing != 5 {
+		t.Fatalf("warnings = %+v, want none for a prefilled target", entries)
+	}
+
+	fast.after = func(v interface{}) error {
+		if account, ok := v.(*diagnosedAccount); ok {
+			account.Count++
+		}
+		return nil
+	}
+	account = diagnosedAccount{}
+	if err := FastJsonUnMarshal([]byte(`{"token":"s3cret","count":1}`), &account); err != nil {
+		t.Fatal(err)
+	}
+	entries := recorder.list()
+	if len(entries) != 1 || !strings.Contains(entries[0].Warning, "jsoniter and encoding/json differ in [Count]") || strings.Contains(entries[0].Warning, "s3cret") {
+		t.Fatalf("warnings = %+v, want the differing field without values", entries)
+	}
+
+	values := map[string]string{"keep": "1"}
+	fast.after = func(v interface{}) error {
+		if m, ok := v.(*map[string]string); ok {
+			(*m)["extra"] = "x"
+		}
+		return nil
+	}
+	if err := FastJsonUnMarshal([]byte(`{"a":"b"}`), &values); err != nil {
+		t.Fatal(err)
+	}
+	if entries := recorder.list(); len(entries) != 2 || !strings.Contains(entries[1].Warning, "differ in [extra]") {
+		t.Fatalf("warnings = %+v, want the differing map key", entries)
+	}
+
+	// 另一个codec解析失败时告警中的敏感参数被替换
+	UseStdJSON()
+	fast.after = func(interface{}) error { return errors.New("bad callback https://x.test/?token=abc") }
+	if err := FastJsonUnMarshal([]byte(`{"count":1}`), &account); err != nil {
+		t.Fatal(err)
+	}
+	entries = recorder.list()
+	if len(entries) != 3 || !strings.Contains(entries[2].Warning, "encoding/json succeeded, jsoniter failed") || strings.Contains(entries[2].Warning, "token=abc") {
+		t.Fatalf("warnings = %+v, want the failure reported with secrets redacted", entries)
+	}
+}
+
+func TestDeepCopyValue(t *testing.T) {
+	type inner struct{ Tags []string }
+	type outer struct {
+		Items map[string]*inner
+		Any   interface{}
+		hide  int
+	}
+	original := outer{Items: map[string]*inner{"a": {Tags: []string{"x"}}}, Any: []int{1}, hide: 3}
+	copied := deepCopyValue(reflect.ValueOf(&original).Elem()).Interface().(outer)
+	copied.Items["a"].Tags[0] = "y"
+	copied.Items["b"] = nil
+	copied.Any.([]int)[0] = 2
+	if original.Items["a"].Tags[0] != "x" || len(original.Items) != 1 || original.Any.([]int)[0] != 1 || copied.hide != 3 {
+		t.Fatalf("original = %+v, want it untouched by changes to the copy", original)
+	}
+}
+
+// benchmarkPayload 常见的接口响应：信封、列表和嵌套对象
+var benchmarkPayload = []byte(`{"code":0,"msg":"ok","data":{"total":3,"items":[` +
+	`{"id":1,"name":"北京","tags":["a","b"],"price":12.5,"active":true,"owner":{"id":7,"email":"a@example.com"}},` +
+	`{"id":2,"name":"上海","tags":["c"],"price":8,"active":false,"owner":{"id":8,"email":"b@example.com"}},` +
+	`{"id":3,"name":"广州","tags":[],"price":0.1,"active":true,"owner":null}]}}`)
+
+type benchmarkEnvelope struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Total int `json:"total"`
+		Items []struct {
+			ID     int      `json:"id"`
+			Name   string   `json:"name"`
+			Tags   []string `json:"tags"`
+			Price  float64  `json:"price"`
+			Active bool     `json:"active"`
+			Owner  *struct {
+				ID    int    `json:"id"`
+				Email string `json:"email"`
+			} `json:"owner"`
+		} `json:"items"`
+	} `json:"data"`
+}
+
+// BenchmarkJSONUnmarshal 对比两个codec的反序列化开销，jsoniter是默认值的依据
+// 在这份典型的接口响应上jsoniter的反序列化耗时约为encoding/json的一半，分配次数略多
+func BenchmarkJSONUnmarshal(b *testing.B) {
+	for _, codec := range []JSONCodec{FastJSONCodec, StdJSONCodec} {
+		b.Run(codec.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(benchmarkPayload)))
+			for i := 0; i < b.N; i++ {
+				var v benchmarkEnvelope
+				if err := codec.unmarshal(benchmarkPayload, &v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkJSONMarshal 对比两个codec的序列化开销
+func BenchmarkJSONMarshal(b *testing.B) {
+	var v benchmarkEnvelope
+	if err := StdJSONCodec.unmarshal(benchmarkPayload, &v); err != nil {
+		b.Fatal(err)
+	}
+	for _, codec := range []JSONCodec{FastJSONCodec, StdJSONCodec} {
+		b.Run(codec.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := codec.marshal(&v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package nhr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FixtureExistsMode 抓取的fixture文件已经存在时的处理方式
+type FixtureExistsMode int
+
+const (
+	// FixtureFail fixture已经存在时返回ErrFixtureExists
+	FixtureFail FixtureExistsMode = iota
+	// FixtureOverwrite 覆盖已经存在的fixture
+	FixtureOverwrite
+	// FixtureSkipExisting 保留已经存在的fixture，不再写入
+	FixtureSkipExisting
+)
+
+// ErrFixtureExists fixture已经存在且使用FixtureFail模式
+var ErrFixtureExists = errors.New("fixture already exists")
+
+// fixtureRequest 写入<name>.request.json的请求摘要
+type fixtureRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// fixtureResponse 写入<name>.response.json的状态码和响应头
+type fixtureResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+}
+
+// WithFixtureCapture 把每个响应写入dir作为测试fixture，包括<name>.request.json、<name>.response.json和<name>.body三个文件
+// name由method、path和请求的短hash组成，同一个请求总是得到同一个name；敏感的请求头、响应头和URL参数会被替换为***
+// 抓取时会读出完整的响应body，返回的响应body可以正常读取
+func WithFixtureCapture(dir string, mode FixtureExistsMode) Option {
+	return func(req *HttpRequests) {
+		req.FixtureDir = dir
+		req.FixtureMode = mode
+	}
+}
+
+// FixtureName 返回请求对应的fixture名称
+func FixtureName(method, rawURL, body string) string {
+	redactedURL := redactSecrets(rawURL)
+	sum := sha256.Sum256([]byte(method + " " + redactedURL + "\n" + body))
+	path := redactedURL
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+		if j := strings.IndexByte(path, '/'); j >= 0 {
+			path = path[j:]
+		} else {
+			path = ""
+		}
+	}
+	path = strings.SplitN(path, "?", 2)[0]
+	var builder strings.Builder
+	for _, r := range strings.ToLower(path) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+		} else if builder.Len() > 0 && !strings.HasSuffix(builder.String(), "_") {
+			builder.WriteByte('_')
+		}
+	}
+	slug := strings.Trim(builder.String(), "_")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "_")
+	}
+	if slug == "" {
+		slug = "root"
+	}
+	return fmt.Sprintf("%s_%s_%s", strings.ToLower(method), slug, hex.EncodeToString(sum[:4]))
+}
+
+// captureFixture 读出响应body并写入fixture文件，之后用内存中的body替换响应body
+func captureFixture(requestIns *HttpRequests, response *http.Response) error {
+	requestURL := requestIns.URL
+	var requestHeaders http.Header
+	if response.Request != nil {
+		requestURL = response.Request.URL.String()
+		requestHeaders = response.Request.Header
+	}
+	return writeFixture(requestIns.FixtureDir, requestIns.FixtureMode, requestIns.Method, requestURL, requestHeaders, requestIns.PostBody, response)
+}
+
+// WriteFixture 将响应写入dir，格式与WithFixtureCapture相同，可以用于自定义的RoundTripper录制响应
+// response.Request不能为nil，requestBody为请求body，用于计算fixture名称；写入之后响应body可以正常读取
+func WriteFixture(dir string, mode FixtureExistsMode, requestBody string, response *http.Response) error {
+	if response.Request == nil {
+		return errors.New("capture fixture error:response.Request is nil")
+	}
+	request := response.Request
+	return writeFixture(dir, mode, request.Method, request.URL.String(), request.Header, requestBody, response)
+}
+
+func writeFixture(dir string, mode FixtureExistsMode, method, requestURL string, requestHeaders http.Header, requestBody string, response *http.Response) error {
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return fmt.Errorf("read from response.Body failed:%w", err)
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	name := FixtureName(method, requestURL, requestBody)
+	base := filepath.Join(dir, name)
+	if _, err := os.Stat(base + ".response.json"); err == nil {
+		switch mode {
+		case FixtureSkipExisting:
+			return nil
+		case FixtureFail:
+			return fmt.Errorf("capture fixture %v error:%w", name, ErrFixtureExists)
+		}
+	}
+
+	request, err := FastJsonMarshal(fixtureRequest{
+		Method:  method,
+		URL:     redactSecrets(requestURL),
+		Headers: redactHeaders(requestHeaders),
+		Body:    redactSecrets(requestBody),
+	})
+	if err != nil {
+		return err
+	}
+	meta, err := FastJsonMarshal(fixtureResponse{Status: response.StatusCode, Headers: redactHeaders(response.Header)})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("capture fixture %v error:%w", name, err)
+	}
+	for suffix, data := range map[string][]byte{".request.json": request, ".response.json": meta, ".body": []byte(redactSecrets(string(body)))} {
+		if err := writeFileAtomic(base+suffix, data); err != nil {
+			return fmt.Errorf("capture fixture %v error:%w", name, err)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic 先写入临时文件再重命名，避免留下写了一半的fixture
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadFixtureResponse 从WithFixtureCapture写入的文件重建响应，不需要网络，用于测试解析和断言逻辑
+// 返回的响应body可以被ResponseToStruct等函数读取，Request中只包含method和URL
+func LoadFixtureResponse(dir, name string) (*http.Response, error) {
+	base := filepath.Join(dir, name)
+	metaBytes, err := ioutil.ReadFile(base + ".response.json")
+	if err != nil {
+		return nil, fmt.Errorf("load fixture %v error:%w", name, err)
+	}
+	var meta fixtureResponse
+	if err := FastJsonUnMarshal(metaBytes, &meta); err != nil {
+		return nil, fmt.Errorf("load fixture %v error:%w", name, err)
+	}
+	body, err := ioutil.ReadFile(base + ".body")
+	if err != nil {
+		return nil, fmt.Errorf("load fixture %v error:%w", name, err)
+	}
+	response := &http.Response{
+		Status:        fmt.Sprintf("%d %s", meta.Status, http.StatusText(meta.Status)),
+		StatusCode:    meta.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        meta.Headers,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	if response.Header == nil {
+		response.Header = http.Header{}
+	}
+	if requestBytes, err := ioutil.ReadFile(base + ".request.json"); err == nil {
+		var summary fixtureRequest
+		if FastJsonUnMarshal(requestBytes, &summary) == nil {
+			if request, err := http.NewRequest(summary.Method, summary.URL, nil); err == nil {
+				response.Request = request
+			}
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,158 @@
+package nhr
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFixtureName(t *testing.T) {
+	name := FixtureName("GET", "https://api.example.com/v1/Orders/7?token=abc", "")
+	if !strings.HasPrefix(name, "get_v1_orders_7_") || len(name) != len("get_v1_orders_7_")+8 {
+		t.Fatalf("name = %q, want method, path slug and short hash", name)
+	}
+	if FixtureName("GET", "https://api.example.com/v1/Orders/7?token=other", "") != name {
+		t.Fatal("secret parameters should not change the name")
+	}
+	if FixtureName("GET", "https://api.example.com/v1/Orders/7?page=2", "") == name || FixtureName("POST", "https://api.example.com/v1/Orders/7?token=abc", "{}") == name {
+		t.Fatal("the query, method and body should change the name")
+	}
+	if name := FixtureName("GET", "https://api.example.com", ""); !strings.HasPrefix(name, "get_root_") {
+		t.Fatalf("name = %q, want root for an empty path", name)
+	}
+	if name := FixtureName("GET", "https://api.example.com/"+strings.Repeat("a", 100), ""); len(name) != len("get_")+60+1+8 {
+		t.Fatalf("name = %q, want the slug truncated to 60", name)
+	}
+}
+
+func TestFixtureCaptureAndLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":7,"next":"/orders?token=abc"}`))
+	}))
+	defer server.Close()
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	response, err := Post(server.URL+"/orders?api_key=k1", WithPostStringBody(`{"name":"a"}`), WithBearerToken("tok"), WithFixtureCapture(dir, FixtureFail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != `{"id":7,"next":"/orders?token=abc"}` {
+		t.Fatalf("body = %q, want the captured body still readable", body)
+	}
+
+	name := FixtureName(http.MethodPost, server.URL+"/orders?api_key=k1", `{"name":"a"}`)
+	request, err := os.ReadFile(filepath.Join(dir, name+".request.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := string(request); strings.Contains(text, "k1") || strings.Contains(text, "tok\"") || !strings.Contains(text, `api_key=***`) || !strings.Contains(text, `{\"name\":\"a\"}`) {
+		t.Fatalf("request fixture = %s, want the secrets redacted", text)
+	}
+
+	loaded, err := LoadFixtureResponse(dir, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order struct {
+		ID   int    `json:"id"`
+		Next string `json:"next"`
+	}
+	if err := ResponseToStruct(loaded, &order); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.StatusCode != http.StatusCreated || order.ID != 7 || order.Next != "/orders?token=***" {
+		t.Fatalf("loaded = %v, %+v, want the status and redacted body", loaded.StatusCode, order)
+	}
+	if loaded.Header.Get("Set-Cookie") != "***" || loaded.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("headers = %v, want the cookie redacted", loaded.Header)
+	}
+	if loaded.Request == nil || loaded.Request.Method != http.MethodPost || loaded.Request.URL.Path != "/orders" {
+		t.Fatalf("request = %+v, want the method and url restored", loaded.Request)
+	}
+
+	if _, err := LoadFixtureResponse(dir, "missing"); err == nil {
+		t.Fatal("loading a missing fixture should fail")
+	}
+}
+
+func TestFixtureExistsModes(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.Write([]byte("first"))
+			return
+		}
+		w.Write([]byte("second"))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	name := FixtureName(http.MethodGet, server.URL, "")
+	body := func() string {
+		data, err := os.ReadFile(filepath.Join(dir, name+".body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	response, err := Get(server.URL, WithFixtureCapture(dir, FixtureFail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if _, err := Get(server.URL, WithFixtureCapture(dir, FixtureFail)); !errors.Is(err, ErrFixtureExists) {
+		t.Fatalf("error = %v, want ErrFixtureExists", err)
+	}
+	if response, err = Get(server.URL, WithFixtureCapture(dir, FixtureSkipExisting)); err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if body() != "first" {
+		t.Fatalf("fixture body = %q, want the existing fixture kept", body())
+	}
+	if response, err = Get(server.URL, WithFixtureCapture(dir, FixtureOverwrite)); err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if body() != "second" {
+		t.Fatalf("fixture body = %q, want the fixture overwritten", body())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Fatalf("%v files in the fixture dir, want no temporary files left", len(entries))
+	}
+}
+
+func TestWriteFixture(t *testing.T) {
+	if err := WriteFixture(t.TempDir(), FixtureFail, "", &http.Response{Body: http.NoBody}); err == nil {
+		t.Fatal("a response without its request should be rejected")
+	}
+	request, err := http.NewRequest(http.MethodGet, "https://api.example.com/me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	response := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("me")), Request: request}
+	if err := WriteFixture(dir, FixtureFail, "", response); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(response.Body); string(data) != "me" {
+		t.Fatalf("body = %q, want it readable after writing", data)
+	}
+	loaded, err := LoadFixtureResponse(dir, FixtureName(http.MethodGet, "https://api.example.com/me", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(loaded.Body); string(data) != "me" || loaded.Header == nil {
+		t.Fatalf("loaded body = %q, header = %v", data, loaded.Header)
+	}
+}
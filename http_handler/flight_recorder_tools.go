@@ -0,0 +1,141 @@
+package nhr
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FlightRecord 飞行记录器中一次请求的摘要，body最多保留bodyLimit字节，URL和body中的敏感参数会被替换为***
+type FlightRecord struct {
+	Time         time.Time `json:"time"`
+	Method       string    `json:"method"`
+	URL          string    `json:"url"`
+	Status       int       `json:"status,omitempty"`
+	Duration     string    `json:"duration"`
+	RequestBody  string    `json:"request_body,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// FlightRecorder 保存最近n次请求摘要的环形缓冲区，用于事后排查问题
+// 内存占用上限由n和bodyLimit决定，可以在请求进行中并发读取
+type FlightRecorder struct {
+	mu        sync.Mutex
+	records   []FlightRecord
+	seqs      []uint64
+	seq       uint64
+	bodyLimit int
+}
+
+// NewFlightRecorder 创建保存最近n次请求的飞行记录器，请求和响应body各最多保留bodyLimit字节，bodyLimit为0时不记录body
+func NewFlightRecorder(n, bodyLimit int) *FlightRecorder {
+	if n < 1 {
+		n = 1
+	}
+	if bodyLimit < 0 {
+		bodyLimit = 0
+	}
+	return &FlightRecorder{records: make([]FlightRecord, n), seqs: make([]uint64, n), bodyLimit: bodyLimit}
+}
+
+// WithFlightRecorder 将请求摘要记录到recorder，多个请求可以共用同一个recorder
+func WithFlightRecorder(recorder *FlightRecorder) Option {
+	return func(req *HttpRequests) {
+		req.FlightRecorder = recorder
+	}
+}
+
+// Records 按时间从早到晚返回当前保存的请求摘要
+func (r *FlightRecorder) Records() []FlightRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := make([]FlightRecord, 0, len(r.records))
+	for i := range r.records {
+		slot := int((r.seq + uint64(i)) % uint64(len(r.records)))
+		if r.seqs[slot] != 0 {
+			records = append(records, r.records[slot])
+		}
+	}
+	return records
+}
+
+// Dump 以JSON数组的格式输出当前保存的请求摘要
+func (r *FlightRecorder) Dump(w io.Writer) error {
+	data, err := FastJsonMarshal(r.Records())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// record 记录一次请求，响应body在读取时再追加到记录中
+func (r *FlightRecorder) record(requestIns *HttpRequests, start time.Time, response *http.Response, err error) {
+	record := FlightRecord{
+		Time:        start,
+		Method:      requestIns.Method,
+		URL:         redactSecrets(requestIns.URL),
+		Duration:    timeNow().Sub(start).String(),
+		RequestBody: truncateString(redactSecrets(requestIns.PostBody), r.bodyLimit),
+	}
+	if response != nil {
+		record.Status = response.StatusCode
+		if response.Request != nil {
+			record.URL = redactSecrets(response.Request.URL.Redacted())
+		}
+	}
+	if err != nil {
+		record.Error = redactSecrets(err.Error())
+	}
+
+	r.mu.Lock()
+	slot := int(r.seq % uint64(len(r.records)))
+	r.seq++
+	r.records[slot], r.seqs[slot] = record, r.seq
+	seq := r.seq
+	r.mu.Unlock()
+
+	if response != nil && r.bodyLimit > 0 {
+		response.Body = &recordedBody{ReadCloser: response.Body, recorder: r, slot: slot, seq: seq}
+	}
+}
+
+// appendResponseBody 记录未被新请求覆盖时追加响应body，返回是否还需要继续记录
+func (r *FlightRecorder) appendResponseBody(slot int, seq uint64, p []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seqs[slot] != seq {
+		return false
+	}
+	record := &r.records[slot]
+	// 先替换再截断，替换后的***不会让body超出bodyLimit
+	record.ResponseBody = truncateString(redactSecrets(record.ResponseBody+string(p)), r.bodyLimit)
+	return len(record.ResponseBody) < r.bodyLimit
+}
+
+// recordedBody 读取响应body时把前bodyLimit字节追加到飞行记录中
+type recordedBody struct {
+	io.ReadCloser
+	recorder *FlightRecorder
+	slot     int
+	seq      uint64
+	done     bool
+}
+
+func (b *recordedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.done {
+		b.done = !b.recorder.appendResponseBody(b.slot, b.seq, p[:n])
+	}
+	return n, err
+}
+
+// truncateString 截断为最多limit字节
+func truncateString(s string, limit int) string {
+	if len(s) > limit {
+		return s[:limit]
+	}
+	return s
+}
@@ -0,0 +1,114 @@
+package nhr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoPathServer 返回请求的路径和查询参数
+func echoPathServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/404" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("path=" + r.URL.RequestURI()))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFlightRecorderKeepsLatest(t *testing.T) {
+	server := echoPathServer(t)
+	recorder := NewFlightRecorder(3, 64)
+	for i := 0; i < 5; i++ {
+		response, err := Get(fmt.Sprintf("%v/%v", server.URL, i), WithFlightRecorder(recorder))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(response.Body)
+		response.Body.Close()
+	}
+	records := recorder.Records()
+	if len(records) != 3 {
+		t.Fatalf("%v records, want the latest 3", len(records))
+	}
+	for i, record := range records {
+		path := fmt.Sprintf("/%v", i+2)
+		if record.URL != server.URL+path || record.ResponseBody != "path="+path || record.Status != http.StatusOK || record.Method != http.MethodGet {
+			t.Fatalf("record %v = %+v, want %v", i, record, path)
+		}
+	}
+}
+
+func TestFlightRecorderBodiesAndSecrets(t *testing.T) {
+	server := echoPathServer(t)
+	recorder := NewFlightRecorder(4, 16)
+	response, err := Post(server.URL+"/404?token=abc", WithFlightRecorder(recorder), WithPostStringBody("name=a&password=hunter2&note=long"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(response.Body)
+	response.Body.Close()
+	if _, err := Get("http://127.0.0.1:1/x?api_key=k1", WithFlightRecorder(recorder), WithRetry(1, 0)); err == nil {
+		t.Fatal("the request to a closed port should fail")
+	}
+
+	records := recorder.Records()
+	if len(records) != 2 {
+		t.Fatalf("%v records, want 2", len(records))
+	}
+	posted := records[0]
+	if posted.Status != http.StatusNotFound || posted.URL != server.URL+"/404?token=***" {
+		t.Fatalf("record = %+v, want the status and the redacted url", posted)
+	}
+	if posted.RequestBody != "name=a&password=" || posted.ResponseBody != "path=/404?token=" {
+		t.Fatalf("bodies = %q, %q, want both truncated to 16 bytes without the token", posted.RequestBody, posted.ResponseBody)
+	}
+	full := NewFlightRecorder(1, 64)
+	response, err = Post(server.URL+"/ok?token=abc", WithFlightRecorder(full), WithPostStringBody("name=a&password=hunter2&note=long"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(response.Body)
+	response.Body.Close()
+	if record := full.Records()[0]; record.RequestBody != "name=a&password=***&note=long" || record.ResponseBody != "path=/ok?token=***" {
+		t.Fatalf("bodies = %q, %q, want the secrets redacted", record.RequestBody, record.ResponseBody)
+	}
+
+	failed := records[1]
+	if failed.Status != 0 || failed.Error == "" || strings.Contains(failed.URL+failed.Error, "k1") {
+		t.Fatalf("record = %+v, want the error recorded without the key", failed)
+	}
+
+	var buf bytes.Buffer
+	if err := recorder.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var dumped []FlightRecord
+	if err := json.Unmarshal(buf.Bytes(), &dumped); err != nil || len(dumped) != 2 || dumped[1].Error != failed.Error {
+		t.Fatalf("dump = %s, %v", buf.String(), err)
+	}
+}
+
+func TestFlightRecorderWithoutBodies(t *testing.T) {
+	server := echoPathServer(t)
+	recorder := NewFlightRecorder(0, -1)
+	for _, path := range []string{"/a", "/b"} {
+		response, err := Post(server.URL+path, WithFlightRecorder(recorder), WithPostStringBody("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(response.Body)
+		response.Body.Close()
+	}
+	records := recorder.Records()
+	if len(records) != 1 || records[0].URL != server.URL+"/b" || records[0].RequestBody != "" || records[0].ResponseBody != "" {
+		t.Fatalf("records = %+v, want one record without bodies", records)
+	}
+}
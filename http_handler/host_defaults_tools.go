@@ -0,0 +1,123 @@
+package nhr
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// SetHostDefaults 为匹配hostPattern的请求设置默认配置，在Client默认配置之后、单次请求配置之前执行
+// hostPattern为精确的host(example.com、example.com:8443)或者*.example.com形式的通配，通配不匹配example.com本身
+// 同一个hostPattern再次设置时替换之前的配置；一个host匹配多个pattern时先执行通配再执行精确匹配
+// 重定向到其他host时，按落地host重新应用请求头和cookies，只属于原host的默认请求头被移除
+func (c *Client) SetHostDefaults(hostPattern string, options ...Option) {
+	c.hostDefaults.set(strings.ToLower(hostPattern), options)
+}
+
+// hostDefaults Client上按host设置的默认配置
+type hostDefaults struct {
+	mu      sync.RWMutex
+	entries []hostDefault
+}
+
+type hostDefault struct {
+	pattern string
+	options []Option
+}
+
+func (h *hostDefaults) set(pattern string, options []Option) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	options = append([]Option(nil), options...)
+	for i := range h.entries {
+		if h.entries[i].pattern == pattern {
+			h.entries[i].options = options
+			return
+		}
+	}
+	h.entries = append(h.entries, hostDefault{pattern: pattern, options: options})
+}
+
+// match 返回匹配host的默认配置，通配的配置在前
+func (h *hostDefaults) match(host string) []Option {
+	if h == nil {
+		return nil
+	}
+	host = strings.ToLower(host)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var wildcard, exact []Option
+	for _, entry := range h.entries {
+		switch {
+		case entry.pattern == host || (!strings.Contains(entry.pattern, ":") && entry.pattern == hostWithoutPort(host)):
+			exact = append(exact, entry.options...)
+		case strings.HasPrefix(entry.pattern, "*.") && strings.HasSuffix(hostWithoutPort(host), entry.pattern[1:]):
+			wildcard = append(wildcard, entry.options...)
+		}
+	}
+	return append(wildcard, exact...)
+}
+
+// clone 复制按host的默认配置，Client.With派生时使用
+func (h *hostDefaults) clone() *hostDefaults {
+	cloned := &hostDefaults{}
+	if h == nil {
+		return cloned
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	cloned.entries = append([]hostDefault(nil), h.entries...)
+	return cloned
+}
+
+// empty 没有设置任何host的默认配置
+func (h *hostDefaults) empty() bool {
+	if h == nil {
+		return true
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.entries) == 0
+}
+
+// applyRedirect 重定向时移除只属于上一跳host的默认请求头，再设置落地host的请求头和cookies
+// 请求头的值已被单次请求修改时保留
+func (h *hostDefaults) applyRedirect(req *http.Request, previous *http.Request) {
+	if previous.URL.Host == req.URL.Host {
+		return
+	}
+	from := newHttpRequests("", "", h.match(previous.URL.Host)...)
+	to := newHttpRequests("", "", h.match(req.URL.Host)...)
+	for key, value := range from.Headers {
+		if _, ok := to.Headers[key]; !ok && req.Header.Get(key) == value {
+			req.Header.Del(key)
+		}
+	}
+	for key, value := range to.Headers {
+		req.Header.Set(key, value)
+	}
+	for _, cookie := range to.Cookies {
+		if _, err := req.Cookie(cookie.Name); err != nil {
+			req.AddCookie(cookie)
+		}
+	}
+}
+
+// hostOf 返回URL中的host，解析失败时返回空字符串
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// hostWithoutPort 去掉host中的端口
+func hostWithoutPort(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return hostname
+	}
+	return host
+}
@@ -0,0 +1,124 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostDefaultsMatch(t *testing.T) {
+	h := &hostDefaults{}
+	h.set("api.example.com", []Option{WithHeaders(map[string]string{"X-Exact": "1"})})
+	h.set("*.example.com", []Option{WithHeaders(map[string]string{"X-Wildcard": "1"})})
+	h.set("example.com:8443", []Option{WithHeaders(map[string]string{"X-Port": "1"})})
+
+	tests := []struct {
+		host string
+		want []string
+	}{
+		{"api.example.com", []string{"X-Wildcard", "X-Exact"}},
+		{"api.example.com:443", []string{"X-Wildcard", "X-Exact"}},
+		{"www.example.com", []string{"X-Wildcard"}},
+		{"example.com", nil},
+		{"example.com:8443", []string{"X-Port"}},
+		{"evilexample.com", nil},
+	}
+	for _, tt := range tests {
+		options := h.match(tt.host)
+		headers := newHttpRequests("", "", options...).Headers
+		ok := len(options) == len(tt.want)
+		for _, key := range tt.want {
+			_, found := headers[key]
+			ok = ok && found
+		}
+		if !ok {
+			t.Errorf("match(%q) = %v options, headers %v, want %v", tt.host, len(options), headers, tt.want)
+		}
+	}
+}
+
+func TestHostDefaultsMergeOrder(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithHeaders(map[string]string{"X-Client": "client", "X-Layer": "client"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	host := mustHost(t, server.URL)
+	client.SetHostDefaults(host, WithHeaders(map[string]string{"X-Host": "host", "X-Layer": "host"}))
+
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if got.Get("X-Client") != "client" || got.Get("X-Host") != "host" || got.Get("X-Layer") != "host" {
+		t.Fatalf("host defaults should apply after client defaults, got %v", got)
+	}
+
+	response, err = client.Get(server.URL, WithHeaders(map[string]string{"X-Layer": "request"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if got.Get("X-Layer") != "request" || got.Get("X-Host") != "host" {
+		t.Fatalf("request options should apply after host defaults, got %v", got)
+	}
+
+	// 替换同一个pattern的配置
+	client.SetHostDefaults(host, WithHeaders(map[string]string{"X-Other": "1"}))
+	response, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if got.Get("X-Host") != "" || got.Get("X-Other") != "1" {
+		t.Fatalf("SetHostDefaults should replace the pattern's options, got %v", got)
+	}
+}
+
+func TestHostDefaultsAppliedOnRedirect(t *testing.T) {
+	var landed http.Header
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		landed = r.Header.Clone()
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/landing", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	// 两个server都在127.0.0.1上，按host:port区分
+	client.SetHostDefaults(mustHost(t, origin.URL), WithHeaders(map[string]string{"X-Api-Key": "origin-key"}))
+	client.SetHostDefaults(mustHost(t, target.URL), WithCookies([]*http.Cookie{{Name: "session", Value: "target"}}))
+
+	response, err := client.Get(origin.URL, WithHeaders(map[string]string{"X-Trace": "1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if landed == nil {
+		t.Fatal("redirect was not followed")
+	}
+	if landed.Get("X-Api-Key") != "" {
+		t.Fatalf("origin's default header leaked to the redirect target: %v", landed)
+	}
+	if landed.Get("X-Trace") != "1" {
+		t.Fatalf("request header was dropped on redirect: %v", landed)
+	}
+	if !strings.Contains(landed.Get("Cookie"), "session=target") {
+		t.Fatalf("target's default cookie missing on redirect: %v", landed)
+	}
+}
@@ -1,12 +1,16 @@
 package nhr
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,24 +22,280 @@ type HttpRequests struct {
 	Timeout  time.Duration
 	PostBody string
 	Params   string
+
+	// DefaultCookies、DefaultCookiesOverJar WithDefaultCookies设置的按domain发送的cookie，以及是否优先于cookie jar
+	DefaultCookies        []*http.Cookie
+	DefaultCookiesOverJar bool
+
+	// OverallTimeout 整个调用的截止时间，包含所有尝试以及尝试之间的等待，为0时不限制
+	OverallTimeout time.Duration
+
+	// IdleReadTimeout 读取响应body时允许的最长空闲时间，为0时不限制
+	IdleReadTimeout time.Duration
+
+	// Labels 请求的label，只保存在请求的context中，不会发送给服务端
+	Labels map[string]string
+
+	// AcceptEncoding 声明可以解码的响应编码，设置后由本包负责解压响应body
+	AcceptEncoding []string
+
+	// MaxResponseHeaderBytes 允许的响应头最大字节数，为0时为1MB
+	MaxResponseHeaderBytes int64
+
+	// Proxy、TLSConfig、InsecureSkipVerify、ClientCertFile、ClientKeyFile 需要单独配置transport的代理和TLS设置
+	Proxy              string
+	TLSConfig          *tls.Config
+	InsecureSkipVerify bool
+	ClientCertFile     string
+	ClientKeyFile      string
+
+	// MaxIdleConns、MaxIdleConnsPerHost、IdleConnTimeout 连接池的空闲连接设置，为0时使用http.DefaultTransport的设置
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// DisableKeepAlives 不复用连接
+	DisableKeepAlives bool
+
+	// RaceStagger Race中相邻端点的启动间隔
+	RaceStagger time.Duration
+
+	// URLPolicy 发送请求前对URL的校验规则，为nil时不校验
+	URLPolicy *URLPolicy
+
+	// Fragment 请求URL的fragment，为空时保留原始URL中的fragment
+	Fragment string
+
+	// NormalizeURL 发送前按NormalizeURL规范化请求URL
+	NormalizeURL bool
+
+	// BusinessErrorCheck、BusinessCodeRule 解析响应前的业务错误检查
+	BusinessErrorCheck BusinessErrorCheck
+	BusinessCodeRule   *BusinessCodeRule
+
+	// StrictBodySemantics、AllowGetBody、BodyAsQuery 控制GET/HEAD请求上的body
+	StrictBodySemantics bool
+	AllowGetBody        bool
+	BodyAsQuery         bool
+
+	// FlightRecorder 记录最近请求摘要的飞行记录器
+	FlightRecorder *FlightRecorder
+
+	// SandboxHeader、ProductionHosts、AllowProductionWrites 沙箱请求头以及生产环境写保护
+	SandboxHeader         [2]string
+	ProductionHosts       []string
+	AllowProductionWrites bool
+
+	// DeadlineHeader、DeadlineBudget 向下游传递剩余时间，并按剩余时间限制单次尝试的超时
+	DeadlineHeader string
+	DeadlineBudget bool
+	DeadlineMargin time.Duration
+	DeadlineFloor  time.Duration
+
+	// FormFields、Files、MultipartBoundary multipart表单的字段、文件以及指定的boundary
+	FormFields        map[string]string
+	Files             []*FormFile
+	MultipartBoundary string
+
+	// FixtureDir、FixtureMode 把响应写入测试fixture的目录以及文件已存在时的处理方式
+	FixtureDir  string
+	FixtureMode FixtureExistsMode
+
+	// ExpectStatus 可以接受的响应状态码，为空时接受2xx
+	ExpectStatus []int
+
+	// Progress Download、DownloadFile的进度回调
+	Progress ProgressFunc
+
+	// NoRedirect、MaxRedirects、RedirectPolicy 重定向控制，MaxRedirects为0时与net/http相同，最多发送10次请求
+	NoRedirect     bool
+	MaxRedirects   int
+	RedirectPolicy func(req *http.Request, via []*http.Request) error
+
+	// Middlewares 发送请求时依次经过的中间件
+	Middlewares []Middleware
+
+	// RetryPolicy 失败时的重试策略，为nil时不重试
+	RetryPolicy *RetryPolicy
+	// MaxQueued 等待in-flight名额的最大请求数，小于0时不限制，见WithQueue
+	MaxQueued int
+
+	// Backoff WithBackoff设置的退避策略，优先于RetryPolicy.Backoff
+	Backoff Backoff
+	// RetryNonIdempotent 非幂等的method也按RetryPolicy重试
+	RetryNonIdempotent bool
+
+	// NoRetry、NoRateLimit 本次请求跳过重试和WithAdaptiveRateLimit，见WithNoRetry、WithNoRateLimit
+	NoRetry     bool
+	NoRateLimit bool
+
+	// Logger 接收本包的告警，为nil时使用标准库的log输出
+	Logger Logger
+
+	// Context HttpCaller使用的context，为nil时使用context.Background()
+	Context context.Context
+
+	// ContentSniffing 响应的Content-Type缺失或过于宽泛时根据body判断实际类型
+	ContentSniffing bool
+
+	// JSONCodec 请求body和响应使用的JSON codec，DefaultJSONCodec时使用包级别的设置
+	JSONCodec JSONCodec
+
+	// ConfigTrace 记录请求头和查询参数由哪一层配置提供，见WithConfigTrace
+	ConfigTrace bool
+
+	// client Session发起请求时使用会话的http.Client
+	client *http.Client
+
+	// optionErr option执行失败的错误，在发起请求之前返回
+	optionErr error
+
+	// release 请求结束时调用，Client通过它统计进行中的请求，为nil时不调用
+	release func()
+
+	// inFlight WithMaxInFlight设置的并发限制
+	inFlight *inFlightLimiter
+
+	// collectors WithMetrics设置的监控，rateLimiter WithAdaptiveRateLimit记录配额的限速器，costLimiter WithCostBudget记录成本的限速器
+	collectors  []MetricsCollector
+	rateLimiter *adaptiveLimiter
+	costLimiter *costLimiter
+
+	// warned 已经输出过的告警，同一个请求的多次尝试只告警一次
+	warned map[string]bool
+
+	// hostDefaults 发起请求的Client按host设置的默认配置，重定向到其他host时重新应用
+	hostDefaults *hostDefaults
+	// poolStats 发起请求的Client的连接统计
+	poolStats *poolStats
+	// methods 发起请求的Client注册的自定义method
+	methods *methodSet
+
+	// source Client.Transport收到的请求，sourceBodyUsed 第一次尝试已经发送了它的body
+	source         *http.Request
+	sourceBodyUsed bool
+
+	// configTrace WithConfigTrace记录的配置来源，authSource 记录来源时标记刚执行的option是认证选项
+	configTrace *ConfigTrace
+	authSource  bool
 }
 
+// ErrOverallTimeout 整体超时时间已耗尽，本次尝试被直接跳过
+var ErrOverallTimeout error = &kindError{kind: "overall_timeout", message: "overall timeout exhausted, attempt skipped"}
+
+// timeNow 获取当前时间，方便替换为假时钟
+var timeNow = time.Now
+
 type Option func(*HttpRequests)
 
-// WithHeaders 设置请求头
+// WithMethod 设置请求方法，用于Race这类没有method参数的入口
+func WithMethod(method string) Option {
+	return func(req *HttpRequests) {
+		req.Method = normalizeMethod(method)
+	}
+}
+
+// WithNormalizeURL 发送前按NormalizeURL规范化请求URL，合并重复的/、处理.和..并去掉默认端口
+// 通常在NewClient或NewSession时设置，BaseURL与请求路径拼接出的URL同样会被规范化
+func WithNormalizeURL() Option {
+	return func(req *HttpRequests) {
+		req.NormalizeURL = true
+	}
+}
+
+// WithFragment 设置请求URL的fragment
+// 按照HTTP的语义fragment不会发送给服务端，但会保留在最初请求的response.Request.URL中
+func WithFragment(fragment string) Option {
+	return func(req *HttpRequests) {
+		req.Fragment = fragment
+	}
+}
+
+// WithHeaders 设置请求头，合并到已有的请求头中，同名(不区分大小写)的请求头会被覆盖
+// 默认的Content-Type以及WithBearerToken等选项设置的请求头会被保留
 func WithHeaders(headers map[string]string) Option {
 	return func(req *HttpRequests) {
-		req.Headers = headers
+		for key, value := range headers {
+			req.setHeader(key, value)
+		}
+	}
+}
+
+// WithHeader 设置单个请求头，同名(不区分大小写)的请求头会被覆盖
+func WithHeader(key, value string) Option {
+	return func(req *HttpRequests) {
+		req.setHeader(key, value)
+	}
+}
+
+// setHeader 设置请求头并删除大小写不同的同名请求头，避免发送时哪个值生效不确定
+func (r *HttpRequests) setHeader(key, value string) {
+	if r.Headers == nil {
+		r.Headers = map[string]string{}
+	}
+	for existing := range r.Headers {
+		if existing != key && strings.EqualFold(existing, key) {
+			delete(r.Headers, existing)
+		}
+	}
+	r.Headers[key] = value
+}
+
+// hasHeader 是否设置了key请求头，不区分大小写
+func (r *HttpRequests) hasHeader(key string) bool {
+	for existing := range r.Headers {
+		if strings.EqualFold(existing, key) {
+			return true
+		}
 	}
+	return false
 }
 
 // WithTimeout 设置请求超时时间
+// 为了兼容，这里的超时时间指单次尝试的超时时间，等同于WithAttemptTimeout
 func WithTimeout(timeout time.Duration) Option {
+	return WithAttemptTimeout(timeout)
+}
+
+// WithAttemptTimeout 设置单次尝试的超时时间，为0时不限制
+// 单次尝试的有效超时时间会被整体超时的剩余时间截断
+func WithAttemptTimeout(timeout time.Duration) Option {
 	return func(req *HttpRequests) {
 		req.Timeout = timeout
 	}
 }
 
+// WithContext 设置请求的context，ctx取消时正在进行的请求立即返回，错误满足errors.Is(err, ctx.Err())
+// ctx的截止时间与WithTimeout、WithOverallTimeout同时存在时，以较早的为准
+func WithContext(ctx context.Context) Option {
+	return func(req *HttpRequests) {
+		req.Context = ctx
+	}
+}
+
+// WithOverallTimeout 设置整个调用的超时时间，以context deadline的形式包裹所有尝试
+func WithOverallTimeout(timeout time.Duration) Option {
+	return func(req *HttpRequests) {
+		req.OverallTimeout = timeout
+	}
+}
+
+// WithIdleReadTimeout 设置读取响应body的空闲超时时间，默认不开启
+// 服务端超过timeout没有发送任何数据时，读取body会返回ErrBodyIdleTimeout
+// 适用于SSE、NDJSON、大文件下载等长连接响应，这类请求通常还需要配合WithTimeout(0)关闭单次尝试的超时
+func WithIdleReadTimeout(timeout time.Duration) Option {
+	return func(req *HttpRequests) {
+		req.IdleReadTimeout = timeout
+	}
+}
+
+// WithMaxResponseHeaderBytes 设置允许的响应头最大字节数，超过时返回ErrResponseHeadersTooLarge
+// 本包创建的连接池默认上限为1MB；上限相同的请求共用一个独立的连接池
+func WithMaxResponseHeaderBytes(n int64) Option {
+	return func(req *HttpRequests) {
+		req.MaxResponseHeaderBytes = n
+	}
+}
+
 // WithCookies 设置cookies
 func WithCookies(cookies []*http.Cookie) Option {
 	return func(req *HttpRequests) {
@@ -60,9 +320,10 @@ func WithParams(params map[string]string) Option {
 // HTTP会将请求参数以"键-值”"的方式组织的JSON格式数据，放到请求body里面
 func WithPostJsonBody(data map[string]interface{}) Option {
 	return func(req *HttpRequests) {
-		dataToStr, err := json.Marshal(data)
+		dataToStr, err := req.JSONCodec.marshal(data)
 		if err != nil {
-			panic("convert postBody to string error")
+			// option中不能返回错误，记录下来由HttpCaller返回
+			req.optionErr = fmt.Errorf("convert postBody to string error:%w", err)
 			return
 		}
 		req.PostBody = string(dataToStr)
@@ -78,32 +339,183 @@ func WithPostStringBody(data string) Option {
 	}
 }
 
-// createRequest 创建请求
-func createRequest(requestIns *HttpRequests) *http.Response {
+// withTimeout 在timeout大于0时为ctx设置超时时间
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// attemptContext 创建单次尝试使用的context
+// 整体截止时间已经到达时直接返回ErrOverallTimeout，不再发起这次尝试
+// 否则单次尝试的超时时间与整体剩余时间取较小值，由context自动完成截断
+func attemptContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	if deadline, ok := ctx.Deadline(); ok && !timeNow().Before(deadline) {
+		return nil, nil, ErrOverallTimeout
+	}
+	attemptCtx, cancel := withTimeout(ctx, timeout)
+	return attemptCtx, cancel, nil
+}
+
+// cancelOnCloseBody 在响应body关闭时释放对应的context
+// 超时覆盖了读取body的过程，所以不能在返回响应时就取消context
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// ErrInvalidURL 请求URL不合法，可以通过errors.Is与网络错误区分
+var ErrInvalidURL = errors.New("invalid request url")
+
+// invalidURLError 解析请求URL失败，保留原始错误
+type invalidURLError struct {
+	err error
+}
+
+func (e *invalidURLError) Error() string {
+	return fmt.Sprintf("parse url requestUrl failed, err:%v", e.err)
+}
+
+func (e *invalidURLError) Is(target error) bool {
+	return target == ErrInvalidURL
+}
+
+func (e *invalidURLError) Unwrap() error {
+	return e.err
+}
+
+// createRequest 创建请求并发送，失败时返回错误
+func createRequest(ctx context.Context, requestIns *HttpRequests) (*http.Response, error) {
+	rawURL := requestIns.URL
+	if requestIns.NormalizeURL {
+		normalized, err := NormalizeURL(rawURL)
+		if err != nil {
+			return nil, &invalidURLError{err: err}
+		}
+		rawURL = normalized
+	}
+	if requestIns.URLPolicy != nil {
+		if err := ValidateURL(rawURL, *requestIns.URLPolicy); err != nil {
+			return nil, err
+		}
+	}
+
 	// 将url转为URL结构体
-	urlObj, err := url.ParseRequestURI(requestIns.URL)
+	// 使用url.Parse而不是ParseRequestURI，否则#后面的fragment会被混进查询参数中
+	urlObj, err := url.Parse(rawURL)
+	if err == nil && !urlObj.IsAbs() {
+		err = fmt.Errorf("url %q is not absolute", rawURL)
+	}
 	if err != nil {
-		panic(fmt.Sprintf("parse url requestUrl failed, err:%v\n", err))
-		return nil
+		return nil, &invalidURLError{err: err}
+	}
+	// unicode域名在解析DNS之前转为punycode
+	if urlObj.Host, err = toASCIIHostPort(urlObj.Host); err != nil {
+		return nil, &invalidURLError{err: err}
 	}
-	// 将编码后的请求参数赋值给URL结构体的RawQuery字段
-	// RequestObj.Params默认不传就是一个空字符串，要是用option模式传了，就走option模式来给Params字段赋值
-	urlObj.RawQuery = requestIns.Params
+	if err := checkProductionWrite(requestIns, requestIns.Method, urlObj.Hostname(), false); err != nil {
+		return nil, err
+	}
+	var body string
+	var multipartIns *multipartBody
+	// RoundTripper收到的请求已经有自己的查询参数和body，见Client.Transport
+	if requestIns.source == nil {
+		// GET/HEAD请求上的body按配置告警、报错或转为查询参数
+		var bodyQuery string
+		if bodyQuery, body, err = applyBodySemantics(ctx, requestIns); err != nil {
+			return nil, err
+		}
+		// 将编码后的请求参数合并到URL结构体的RawQuery字段，url中原有的查询参数保留在前面
+		// RequestObj.Params默认不传就是一个空字符串，要是用option模式传了，就走option模式来给Params字段赋值
+		for _, query := range []string{requestIns.Params, bodyQuery} {
+			if query == "" {
+				continue
+			}
+			if urlObj.RawQuery != "" {
+				urlObj.RawQuery += "&"
+			}
+			urlObj.RawQuery += query
+		}
+		// fragment不会发送给服务端，但会保留在response.Request.URL中
+		if requestIns.Fragment != "" {
+			urlObj.Fragment, urlObj.RawFragment = requestIns.Fragment, ""
+		}
 
-	// 创建请求，这里需要注意：
-	// 1、RequestObj.PostBody默认不传就是一个空字符串，要是用option模式传了，就走option模式来给PostBody字段赋值
-	// 2、urlObj是URL结构体，并且它的查询请求参数已经被重新赋值过了，所以最终调用URL.String()方法就能拿到编码后的请求URL
-	req, err := http.NewRequest(requestIns.Method, urlObj.String(), strings.NewReader(requestIns.PostBody))
+		// 创建请求，这里需要注意：
+		// 1、RequestObj.PostBody默认不传就是一个空字符串，要是用option模式传了，就走option模式来给PostBody字段赋值
+		//   每次尝试都重新创建body的Reader，重试时可以重复发送
+		// 2、urlObj是URL结构体，并且它的查询请求参数已经被重新赋值过了，所以最终调用URL.String()方法就能拿到编码后的请求URL
+		if requestIns.Method == http.MethodTrace && (body != "" || requestIns.isMultipart()) {
+			return nil, fmt.Errorf("create request error:%w", ErrTraceWithBody)
+		}
+		// 3、multipart表单在发送时通过管道生成，Content-Type中带有boundary，覆盖默认的application/json
+		if requestIns.isMultipart() {
+			if body != "" {
+				return nil, fmt.Errorf("create request error:%w", ErrMultipartWithBody)
+			}
+			if multipartIns, err = newMultipartBody(requestIns); err != nil {
+				return nil, fmt.Errorf("create request error:%w", err)
+			}
+		}
+	}
+	ctx = contextWithConfigTrace(contextWithResponseConfig(contextWithLabels(ctx, requestIns.Labels), requestIns), requestIns.configTrace)
+	ctx = contextWithBypass(ctx, requestIns)
+	timeout, budgetHeader, err := deadlineBudget(ctx, requestIns)
+	if err != nil {
+		return nil, fmt.Errorf("send request error:%w", err)
+	}
+	attemptCtx, cancel, err := attemptContext(ctx, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("send request error:%w", err)
+	}
+	// 记录失败时请求进行到了哪一步，用于判断能否安全地重试
+	trace := &attemptTrace{stats: requestIns.poolStats}
+	attemptCtx = httptrace.WithClientTrace(context.WithValue(attemptCtx, attemptTraceContextKey{}, trace), trace.clientTrace())
+	var req *http.Request
+	if requestIns.source != nil {
+		req, err = requestIns.sourceAttempt(attemptCtx, urlObj)
+	} else {
+		req, err = http.NewRequestWithContext(attemptCtx, requestIns.Method, urlObj.String(), strings.NewReader(body))
+	}
 	if err != nil {
-		fmt.Println("create request instance failed")
-		return nil
+		cancel()
+		return nil, fmt.Errorf("create request error:%w", err)
 	}
 
 	// 对上面创建的请求设置请求头
 	// RequestObj.Headers不传就是默认的application/json
 	// 要是用option模式传了，就走option模式来给Headers字段重新赋值
+	// RoundTripper收到的请求中已有的请求头优先
 	for key, value := range requestIns.Headers {
-		req.Header.Set(key, value)
+		if requestIns.source == nil || req.Header.Get(key) == "" {
+			req.Header.Set(key, value)
+		}
+	}
+	if requestIns.SandboxHeader[0] != "" {
+		req.Header.Set(requestIns.SandboxHeader[0], requestIns.SandboxHeader[1])
+	}
+	if budgetHeader != "" {
+		req.Header.Set(requestIns.DeadlineHeader, budgetHeader)
+	}
+	if multipartIns != nil {
+		req.Header.Set("Content-Type", multipartIns.contentType)
+	}
+
+	// 声明可以解码的编码之后，net/http不再自动解压gzip，统一交给decompressResponse处理
+	if len(requestIns.AcceptEncoding) > 0 {
+		acceptEncoding, err := acceptEncodingHeader(requestIns.AcceptEncoding)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("create request error:%w", err)
+		}
+		req.Header.Set("Accept-Encoding", acceptEncoding)
 	}
 
 	// 添加登录的cookies
@@ -114,76 +526,204 @@ func createRequest(requestIns *HttpRequests) *http.Response {
 	}
 
 	// 真正发起请求，返回http的response对象
-	response, err := http.DefaultClient.Do(req)
+	client, err := httpClientFor(requestIns)
 	if err != nil {
-		panic(fmt.Sprintf("send request error:%v\n", err.Error()))
-		return nil
+		cancel()
+		return nil, fmt.Errorf("create request error:%w", err)
 	}
-	return response
+	client = applyDefaultCookies(req, requestIns, client)
+	if multipartIns != nil {
+		// 在发送之前才开始生成body，之前的步骤出错时不会留下写入body的goroutine
+		req.Body = multipartIns.open()
+		// 有不能重新读取的文件时不设置GetBody，重定向和中间件不能通过它读走正在发送的内容
+		// 也要去掉http.NewRequest为空body设置的GetBody，否则重定向会发送空的body
+		req.GetBody = nil
+		if multipartIns.replayable() {
+			req.GetBody = func() (io.ReadCloser, error) {
+				return multipartIns.open(), nil
+			}
+		}
+	}
+	send := RoundTripFunc(client.Do)
+	if requestIns.source != nil {
+		// 重定向和cookie jar由调用方的http.Client处理
+		send = transportOf(client).RoundTrip
+	}
+	response, err := roundTripFor(send, requestIns.Middlewares)(req)
+	if err != nil {
+		cancel()
+		if host := displayHost(urlObj.Hostname()); host != urlObj.Hostname() {
+			return nil, fmt.Errorf("send request to %v error:%w", host, classifyTransportError(trace.wrap(err)))
+		}
+		return nil, fmt.Errorf("send request error:%w", classifyTransportError(trace.wrap(err)))
+	}
+	if multipartIns != nil && req.GetBody == nil && unfollowedBodyRedirect(requestIns, response) {
+		_ = response.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("follow redirect to %v error:form files must be re-sent:%w", redactSecrets(response.Header.Get("Location")), ErrBodyNotReplayable)
+	}
+	response.Body = &cancelOnCloseBody{ReadCloser: response.Body, cancel: cancel}
+	if requestIns.IdleReadTimeout > 0 {
+		response.Body = newIdleTimeoutBody(response.Body, requestIns.IdleReadTimeout)
+	}
+	if len(requestIns.AcceptEncoding) > 0 {
+		decompressResponse(response)
+	}
+	if requestIns.ContentSniffing {
+		sniffResponse(response)
+	}
+	return response, nil
 }
 
-// HttpCaller 发起请求
-// method: HTTP method (GET, POST, PUT，DELETE)
-// url: 请求的url
-func HttpCaller(method, url string, options ...Option) *http.Response {
+// doRequest 在ctx下完成一次完整的调用
+// 整体超时包裹所有尝试，请求失败时立即释放，成功时在body关闭后释放
+func doRequest(ctx context.Context, requestIns *HttpRequests) (*http.Response, error) {
+	if requestIns.optionErr != nil {
+		requestIns.done()
+		return nil, requestIns.optionErr
+	}
+	if err := validateMethod(requestIns); err != nil {
+		requestIns.done()
+		return nil, err
+	}
+	ctx, cancelTimeout := withTimeout(ctx, requestIns.OverallTimeout)
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			cancelTimeout()
+			if requestIns.inFlight != nil {
+				requestIns.inFlight.release()
+			}
+			requestIns.done()
+		})
+	}
+	if requestIns.inFlight != nil {
+		wait, err := requestIns.inFlight.acquire(ctx, requestIns.MaxQueued)
+		if err != nil {
+			cancelTimeout()
+			requestIns.done()
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, queueWaitContextKey{}, wait)
+	}
+	start := timeNow()
+	response, err := retryRequest(ctx, requestIns)
+	if err == nil && requestIns.FixtureDir != "" {
+		if err = captureFixture(requestIns, response); err != nil {
+			response = nil
+		}
+	}
+	if requestIns.FlightRecorder != nil {
+		requestIns.FlightRecorder.record(requestIns, start, response, err)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	response.Body = &cancelOnCloseBody{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// done 通知请求已经结束
+func (r *HttpRequests) done() {
+	if r.release != nil {
+		r.release()
+	}
+}
+
+// newHttpRequests 创建请求实例，并通过option模式设置HttpRequests的字段
+func newHttpRequests(method, url string, options ...Option) *HttpRequests {
 	RequestIns := &HttpRequests{
-		// Method 请求方法转为大写
-		Method: strings.ToUpper(method),
+		// Method 请求方法转为大写，通过AllowMethods、Client.AllowMethods注册的自定义method保持注册时的大小写
+		Method: normalizeMethod(method),
 
 		// URL 请求URL
 		URL: url,
 
-		// 请求超时默认为3s
+		// 单次尝试的超时默认为3s
 		Timeout: 3 * time.Second,
 
 		// Headers的Content-Type默认为application/json
 		Headers: map[string]string{"Content-Type": "application/json"},
+
+		// 设置了WithMaxInFlight时默认不限制排队的请求数
+		MaxQueued: -1,
 	}
 
-	// 通过option模式来设置HttpRequests的字段
 	// 每一个opt都是func(*HttpRequests)类型，需要传入上面实例化的RequestObj，对RequestIns中的字段进行重新赋值
 	for _, opt := range options {
 		opt(RequestIns)
 	}
-	return createRequest(RequestIns)
+	return RequestIns
 }
 
-// ResponseToBytes 将响应转为字节列表类型，可以反序列化为结构体
-func responseToBytes(responseIns *http.Response) ([]byte, error) {
-	defer responseIns.Body.Close()
-	if responseIns.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request status code not 200，actually status code is %v", responseIns.StatusCode)
+// HttpCaller 发起请求
+// method: HTTP method (GET, POST, PUT，DELETE)
+// url: 请求的url
+// URL不合法时返回的错误满足errors.Is(err, ErrInvalidURL)，网络错误可以通过errors.As取出*url.Error、*DNSError等
+func HttpCaller(method, url string, options ...Option) (*http.Response, error) {
+	return DefaultClient.HttpCaller(method, url, options...)
+}
+
+// HttpCallerWithContext 与HttpCaller相同，使用ctx控制取消和截止时间，等同于在options之后追加WithContext(ctx)
+func HttpCallerWithContext(ctx context.Context, method, url string, options ...Option) (*http.Response, error) {
+	requestIns := DefaultClient.newRequest(method, url, DefaultClient.defaults, options)
+	requestIns.Context = ctx
+	return DefaultClient.call(requestIns)
+}
+
+// callRequest 使用请求上设置的context发起请求
+func callRequest(requestIns *HttpRequests) (*http.Response, error) {
+	ctx := requestIns.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	bodyRet, err := ioutil.ReadAll(responseIns.Body)
+	response, err := doRequest(ctx, requestIns)
 	if err != nil {
-		return nil, fmt.Errorf("read from response.Body failed:%v", err)
+		return nil, err
 	}
-	return bodyRet, nil
+	trackBodyConsumption(response)
+	return response, nil
 }
 
-// ResponseToStruct 将字节切片类型的接口响应转接结构，通过结构体取值
-// response：请求的响应对象
-// v：结构体指针
-func ResponseToStruct(responseIns *http.Response, v interface{}) error {
-	responseBytesSlice, err := responseToBytes(responseIns)
+// HttpCallerOrPanic 与HttpCaller相同，请求失败时panic，用于兼容旧的调用方式
+//
+// Deprecated: 使用HttpCaller并处理返回的错误
+func HttpCallerOrPanic(method, url string, options ...Option) *http.Response {
+	response, err := HttpCaller(method, url, options...)
 	if err != nil {
-		return fmt.Errorf("response to bytes error:%v", err)
+		panic(err.Error())
 	}
-	err = FastJsonUnMarshal(responseBytesSlice, v)
-	if err != nil {
-		return fmt.Errorf("unMarshal response bytes slice error:%v", err)
+	return response
+}
+
+// ResponseToBytes 将响应转为字节列表类型，可以反序列化为结构体，只接受2xx响应
+func responseToBytes(responseIns *http.Response) ([]byte, error) {
+	return readAcceptedBody(responseIns, nil)
+}
+
+// checkResponseStatus 解析响应的函数只接受2xx或WithExpectStatus中的状态码，不读取body
+func checkResponseStatus(responseIns *http.Response) error {
+	if !statusAccepted(responseIns.StatusCode, responseConfigOf(responseIns).expectStatus, nil) {
+		return &StatusError{StatusCode: responseIns.StatusCode}
 	}
 	return nil
 }
 
-// ResponseToMap 将响应结果转为map
-func ResponseToMap(responseIns *http.Response) map[string]interface{} {
-	defer responseIns.Body.Close()
-	// 获取相应结果
-	var ret map[string]interface{}
-	err := json.NewDecoder(responseIns.Body).Decode(&ret)
-	if err != nil {
-		return nil
+// ResponseToStruct 将字节切片类型的接口响应转接结构，通过结构体取值
+// 接受任意2xx响应，body为空(例如204)时不修改v，需要解析4xx的错误信息时使用ResponseToStructAllowing
+// response：请求的响应对象
+// v：结构体指针
+func ResponseToStruct(responseIns *http.Response, v interface{}) error {
+	return ResponseToStructAllowing(responseIns, v)
+}
+
+// ResponseToMap 将响应结果转为map，接受任意2xx响应，body为空时返回空map
+// 状态码、业务错误检查和反序列化失败都会返回错误
+func ResponseToMap(responseIns *http.Response) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	if err := ResponseToStructAllowing(responseIns, &ret); err != nil {
+		return nil, err
 	}
-	return ret
+	return ret, nil
 }
@@ -0,0 +1,227 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock 替换timeNow，测试结束后恢复
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock(t *testing.T) *fakeClock {
+	clock := &fakeClock{now: time.Now()}
+	t.Cleanup(func() { timeNow = time.Now })
+	timeNow = func() time.Time { return clock.now }
+	return clock
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// countingServer 返回固定状态码并统计收到的请求数
+func countingServer(t *testing.T, status int) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestWithTimeoutIsPerAttempt(t *testing.T) {
+	requestIns := newHttpRequests(http.MethodGet, "http://example.com", WithTimeout(2*time.Second), WithOverallTimeout(time.Minute))
+	if requestIns.Timeout != 2*time.Second {
+		t.Fatalf("Timeout = %v, want 2s", requestIns.Timeout)
+	}
+	if requestIns.OverallTimeout != time.Minute {
+		t.Fatalf("OverallTimeout = %v, want 1m", requestIns.OverallTimeout)
+	}
+}
+
+func TestAttemptContextTruncatedByOverallDeadline(t *testing.T) {
+	overall, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	attemptCtx, attemptCancel, err := attemptContext(overall, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer attemptCancel()
+	overallDeadline, _ := overall.Deadline()
+	attemptDeadline, _ := attemptCtx.Deadline()
+	if attemptDeadline.After(overallDeadline) {
+		t.Fatalf("attempt deadline %v after overall deadline %v", attemptDeadline, overallDeadline)
+	}
+}
+
+func TestAttemptSkippedWhenOverallBudgetExhausted(t *testing.T) {
+	clock := newFakeClock(t)
+	server, hits := countingServer(t, http.StatusOK)
+
+	ctx, cancel := context.WithDeadline(context.Background(), clock.now.Add(time.Second))
+	defer cancel()
+	// 假时钟越过整体截止时间，真实的context还没有结束
+	clock.Advance(2 * time.Second)
+
+	_, err := HttpCaller(http.MethodGet, server.URL, WithContext(ctx))
+	if !errors.Is(err, ErrOverallTimeout) {
+		t.Fatalf("error = %v, want ErrOverallTimeout", err)
+	}
+	if n := atomic.LoadInt32(hits); n != 0 {
+		t.Fatalf("server received %v requests, want 0", n)
+	}
+}
+
+func TestRetryNotSleepingPastOverallDeadline(t *testing.T) {
+	server, hits := countingServer(t, http.StatusServiceUnavailable)
+
+	start := time.Now()
+	response, err := HttpCaller(http.MethodGet, server.URL,
+		WithOverallTimeout(time.Second),
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     BackoffFunc(func(int, *http.Response, error) time.Duration { return time.Hour }),
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %v, want 503", response.StatusCode)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Fatalf("server received %v requests, want 1", n)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("retry slept %v past the overall deadline", elapsed)
+	}
+}
+
+// slowServer 等待delay之后才返回响应头，请求被取消时提前返回
+func slowServer(t *testing.T, delay time.Duration) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWithTimeoutFailsFast(t *testing.T) {
+	server := slowServer(t, 2*time.Second)
+	start := time.Now()
+	_, err := Get(server.URL, WithTimeout(50*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request took %v, want it cut off by the 50ms timeout", elapsed)
+	}
+}
+
+func TestWithContextCancel(t *testing.T) {
+	server := slowServer(t, 2*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := Get(server.URL, WithContext(ctx), WithTimeout(0))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("cancel took %v to stop the request", elapsed)
+	}
+}
+
+func TestEarlierDeadlineWins(t *testing.T) {
+	server := slowServer(t, 2*time.Second)
+	tests := []struct {
+		name        string
+		ctxTimeout  time.Duration
+		timeout     time.Duration
+		wantAtLeast time.Duration
+	}{
+		{name: "context deadline earlier", ctxTimeout: 50 * time.Millisecond, timeout: time.Minute, wantAtLeast: 50 * time.Millisecond},
+		{name: "WithTimeout earlier", ctxTimeout: time.Minute, timeout: 50 * time.Millisecond, wantAtLeast: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.ctxTimeout)
+			defer cancel()
+			start := time.Now()
+			_, err := HttpCallerWithContext(ctx, http.MethodGet, server.URL, WithTimeout(tt.timeout))
+			elapsed := time.Since(start)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+			}
+			if elapsed < tt.wantAtLeast || elapsed > time.Second {
+				t.Fatalf("request took %v, want the earlier deadline to apply", elapsed)
+			}
+		})
+	}
+}
+
+func TestWithTimeoutCoversBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("head"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	response, err := Get(server.URL, WithTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if _, err := ioutil.ReadAll(response.Body); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("reading body error = %v, want the attempt timeout to cover the body", err)
+	}
+}
+
+func TestFragmentWithParamsMerged(t *testing.T) {
+	server, got := headerServer(t)
+	tests := []struct {
+		name     string
+		options  []Option
+		fragment string
+		escaped  string
+	}{
+		{name: "fragment from url", fragment: "orig", escaped: "#orig"},
+		{name: "WithFragment", options: []Option{WithFragment("top")}, fragment: "top", escaped: "#top"},
+		{name: "escaped fragment", options: []Option{WithFragment("章节 1/a?b#c")}, fragment: "章节 1/a?b#c", escaped: "#%E7%AB%A0%E8%8A%82%201/a?b%23c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]Option{WithParams(map[string]string{"page": "2 3"})}, tt.options...)
+			response, err := Get(server.URL+"/orders?sort=id#orig", options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			// fragment不会发送给服务端，查询参数合并在原有参数之后
+			if (*got).RequestURI != "/orders?sort=id&page=2+3" {
+				t.Fatalf("request uri = %v, want the params appended without the fragment", (*got).RequestURI)
+			}
+			u := response.Request.URL
+			if u.Fragment != tt.fragment || u.RawQuery != "sort=id&page=2+3" || !strings.HasSuffix(u.String(), "/orders?sort=id&page=2+3"+tt.escaped) {
+				t.Fatalf("url = %v, fragment = %q, want fragment %q after the merged query", u, u.Fragment, tt.fragment)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+)
+
+// LabelOperation 保留的label，表示请求对应的逻辑操作名，如CreateOrder
+// 用于代替原始URL作为日志和指标的维度，避免URL中的ID导致维度爆炸
+const LabelOperation = "operation"
+
+type labelsContextKey struct{}
+
+// WithLabel 给请求添加一个label，label只保存在请求的context中，不会发送给服务端
+func WithLabel(key, value string) Option {
+	return WithLabels(map[string]string{key: value})
+}
+
+// WithLabels 给请求批量添加label，与已有label合并，key相同时后设置的生效
+func WithLabels(labels map[string]string) Option {
+	return func(req *HttpRequests) {
+		if req.Labels == nil {
+			req.Labels = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			req.Labels[k] = v
+		}
+	}
+}
+
+// contextWithLabels 将label存入context
+func contextWithLabels(ctx context.Context, labels map[string]string) context.Context {
+	if len(labels) == 0 {
+		return ctx
+	}
+	merged := LabelsFromContext(ctx)
+	if merged == nil {
+		merged = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, labelsContextKey{}, merged)
+}
+
+// LabelsFromContext 获取context中保存的请求label，返回的是副本，修改不会影响请求
+func LabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsContextKey{}).(map[string]string)
+	return copyLabels(labels)
+}
+
+// copyLabels 复制label，labels为空时返回nil
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	ret := make(map[string]string, len(labels))
+	for k, v := range labels {
+		ret[k] = v
+	}
+	return ret
+}
+
+// ResponseLabels 获取响应对应请求的label
+// 重定向后的请求沿用原始请求的context，所以label在重定向之后依然存在
+func ResponseLabels(responseIns *http.Response) map[string]string {
+	if responseIns == nil || responseIns.Request == nil {
+		return nil
+	}
+	return LabelsFromContext(responseIns.Request.Context())
+}
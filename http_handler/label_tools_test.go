@@ -0,0 +1,99 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	server := redirectServer(t, "")
+	var seen map[string]string
+	response, err := Get(server.URL+"/hop/1",
+		WithLabel(LabelOperation, "GetOrder"),
+		WithLabels(map[string]string{"tenant": "acme", "team": "billing"}),
+		WithLabel("team", "payments"),
+		WithMiddleware(func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				seen = LabelsFromContext(req.Context())
+				return next(req)
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	want := map[string]string{LabelOperation: "GetOrder", "tenant": "acme", "team": "payments"}
+	for _, labels := range []map[string]string{seen, ResponseLabels(response)} {
+		if len(labels) != len(want) {
+			t.Fatalf("labels = %v, want %v", labels, want)
+		}
+		for k, v := range want {
+			if labels[k] != v {
+				t.Fatalf("labels = %v, want %v", labels, want)
+			}
+		}
+	}
+	if response.Request.URL.Path != "/hop/0" {
+		t.Fatalf("path = %v, want the labels kept after the redirect", response.Request.URL.Path)
+	}
+
+	// 返回的是副本，修改不影响请求
+	ResponseLabels(response)["tenant"] = "other"
+	if ResponseLabels(response)["tenant"] != "acme" {
+		t.Fatal("modifying the returned labels should not change the request")
+	}
+}
+
+func TestLabelsMergeWithContext(t *testing.T) {
+	ctx := contextWithLabels(context.Background(), map[string]string{"tenant": "acme", "team": "billing"})
+	ctx = contextWithLabels(ctx, map[string]string{"team": "payments"})
+	if labels := LabelsFromContext(ctx); len(labels) != 2 || labels["tenant"] != "acme" || labels["team"] != "payments" {
+		t.Fatalf("labels = %v, want the inner labels merged over the outer ones", labels)
+	}
+	if labels := LabelsFromContext(context.Background()); labels != nil {
+		t.Fatalf("labels = %v, want nil without labels", labels)
+	}
+	if labels := ResponseLabels(&http.Response{}); labels != nil {
+		t.Fatalf("labels = %v, want nil without a request", labels)
+	}
+}
+
+func TestLabelsInMetricsAndLogs(t *testing.T) {
+	server, hits := countingServer(t, http.StatusServiceUnavailable)
+	recorder := newInFlightRecorder()
+	logs := &requestLogRecorder{}
+	response, err := Get(server.URL, WithLabel(LabelOperation, "SyncInventory"), WithRetry(2, 0), WithMetrics(recorder), WithDebug(logs, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if *hits != 2 {
+		t.Fatalf("hits = %v, want 2 attempts", *hits)
+	}
+	// 每次尝试上报的监控数据和日志都带有label
+	for i := 0; i < 2; i++ {
+		if metrics := recorder.next(t); metrics.Labels[LabelOperation] != "SyncInventory" {
+			t.Fatalf("attempt %v labels = %v, want the operation label", i+1, metrics.Labels)
+		}
+	}
+	if len(logs.entries) != 2 {
+		t.Fatalf("logged %v entries, want 2", len(logs.entries))
+	}
+	for _, entry := range logs.entries {
+		if entry.Labels[LabelOperation] != "SyncInventory" {
+			t.Fatalf("log labels = %v, want the operation label", entry.Labels)
+		}
+	}
+
+	// 没有label时为nil
+	response, err = Get(server.URL, WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if metrics := recorder.next(t); metrics.Labels != nil {
+		t.Fatalf("labels = %v, want nil without labels", metrics.Labels)
+	}
+}
@@ -0,0 +1,182 @@
+package nhr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrTraceWithBody TRACE请求不允许携带body(RFC 9110)
+var ErrTraceWithBody = errors.New("TRACE request must not have a body")
+
+// ErrMethodNotAllowed method不是标准method，也没有通过AllowMethods或Client.AllowMethods注册
+var ErrMethodNotAllowed = errors.New("method not allowed")
+
+// ErrInvalidMethod method不是RFC 7230规定的token，例如为空或者包含空格
+var ErrInvalidMethod = errors.New("invalid method")
+
+// standardMethods 标准的HTTP method，不区分大小写，统一转为大写
+var standardMethods = map[string]string{}
+
+func init() {
+	for _, method := range []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+	} {
+		standardMethods[method] = method
+	}
+}
+
+var (
+	customMethodsMu sync.RWMutex
+	// customMethods 注册的自定义method，key为大写形式，value为注册时的原始大小写
+	customMethods = map[string]string{}
+)
+
+// AllowMethods 为所有请求注册自定义method，比如WebDAV的PROPFIND、MKCOL，只在一个Client上使用时用Client.AllowMethods
+// 注册过的method按注册时的大小写原样发送，适用于要求method大小写完全一致的服务端
+// 没有注册的非标准method在发送前返回ErrMethodNotAllowed
+func AllowMethods(methods ...string) {
+	customMethodsMu.Lock()
+	defer customMethodsMu.Unlock()
+	for _, method := range methods {
+		customMethods[strings.ToUpper(method)] = method
+	}
+}
+
+// AllowMethods 只为Client的请求注册自定义method，规则与包级别的AllowMethods相同，派生的Client继承注册过的method
+func (c *Client) AllowMethods(methods ...string) {
+	c.methods.allow(methods)
+}
+
+// methodSet Client注册的自定义method，key为大写形式，value为注册时的原始大小写
+type methodSet struct {
+	mu      sync.RWMutex
+	methods map[string]string
+}
+
+func (m *methodSet) allow(methods []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.methods == nil {
+		m.methods = map[string]string{}
+	}
+	for _, method := range methods {
+		m.methods[strings.ToUpper(method)] = method
+	}
+}
+
+// lookup 返回注册时的大小写
+func (m *methodSet) lookup(method string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	custom, ok := m.methods[strings.ToUpper(method)]
+	return custom, ok
+}
+
+func (m *methodSet) clone() *methodSet {
+	cloned := &methodSet{}
+	if m == nil {
+		return cloned
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cloned.methods = make(map[string]string, len(m.methods))
+	for key, value := range m.methods {
+		cloned.methods[key] = value
+	}
+	return cloned
+}
+
+// validateMethod 检查method是token，并且是标准method或者注册过的自定义method
+func validateMethod(requestIns *HttpRequests) error {
+	method := requestIns.Method
+	if !isToken(method) {
+		return fmt.Errorf("method %q error:%w", method, ErrInvalidMethod)
+	}
+	upper := strings.ToUpper(method)
+	if _, ok := standardMethods[upper]; ok {
+		return nil
+	}
+	if _, ok := requestIns.methods.lookup(upper); ok {
+		return nil
+	}
+	customMethodsMu.RLock()
+	defer customMethodsMu.RUnlock()
+	if _, ok := customMethods[upper]; ok {
+		return nil
+	}
+	return fmt.Errorf("method %q error:%w, register it with AllowMethods", method, ErrMethodNotAllowed)
+}
+
+// isToken 判断s是否为RFC 7230中的token
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeMethod 规范化请求方法
+// 标准method和未注册的method转为大写，注册过的自定义method使用注册时的大小写
+func normalizeMethod(method string) string {
+	upper := strings.ToUpper(method)
+	if standard, ok := standardMethods[upper]; ok {
+		return standard
+	}
+	customMethodsMu.RLock()
+	defer customMethodsMu.RUnlock()
+	if custom, ok := customMethods[upper]; ok {
+		return custom
+	}
+	return upper
+}
+
+// Do 使用任意标准method或者注册过的自定义method发起请求，等同于HttpCaller(method, url, options...)
+func Do(method, url string, options ...Option) (*http.Response, error) {
+	return HttpCaller(method, url, options...)
+}
+
+// Get 发起GET请求，等同于HttpCaller(http.MethodGet, url, options...)
+func Get(url string, options ...Option) (*http.Response, error) {
+	return HttpCaller(http.MethodGet, url, options...)
+}
+
+// Post 发起POST请求，body通过WithPostStringBody、WithPostJsonBody等选项设置
+func Post(url string, options ...Option) (*http.Response, error) {
+	return HttpCaller(http.MethodPost, url, options...)
+}
+
+// Put 发起PUT请求
+func Put(url string, options ...Option) (*http.Response, error) {
+	return HttpCaller(http.MethodPut, url, options...)
+}
+
+// Patch 发起PATCH请求
+func Patch(url string, options ...Option) (*http.Response, error) {
+	return HttpCaller(http.MethodPatch, url, options...)
+}
+
+// Delete 发起DELETE请求
+func Delete(url string, options ...Option) (*http.Response, error) {
+	return HttpCaller(http.MethodDelete, url, options...)
+}
+
+// Head 发起HEAD请求
+func Head(url string, options ...Option) (*http.Response, error) {
+	return HttpCaller(http.MethodHead, url, options...)
+}
@@ -0,0 +1,82 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// methodEcho 记录请求行中的method
+func methodEcho(t *testing.T) (*httptest.Server, *string) {
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	}))
+	t.Cleanup(server.Close)
+	return server, &method
+}
+
+func TestClientAllowMethods(t *testing.T) {
+	server, got := methodEcho(t)
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	if _, err := client.Do("PROPFIND", server.URL); !errors.Is(err, ErrMethodNotAllowed) {
+		t.Fatalf("unregistered method error = %v, want ErrMethodNotAllowed", err)
+	}
+	client.AllowMethods("PROPFIND", "MkCol")
+	for _, tt := range []struct{ method, want string }{
+		{"PROPFIND", "PROPFIND"},
+		{"propfind", "PROPFIND"},
+		{"mkcol", "MkCol"},
+		{"get", "GET"},
+	} {
+		response, err := client.Do(tt.method, server.URL)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.method, err)
+		}
+		response.Body.Close()
+		if *got != tt.want {
+			t.Fatalf("request line method for %q = %q, want %q", tt.method, *got, tt.want)
+		}
+	}
+
+	// 只对注册的Client生效，派生的Client继承
+	if _, err := Do("MKCOL", server.URL); !errors.Is(err, ErrMethodNotAllowed) {
+		t.Fatalf("DefaultClient error = %v, want ErrMethodNotAllowed", err)
+	}
+	response, err := client.With().Do("MKCOL", server.URL)
+	if err != nil {
+		t.Fatalf("derived client: %v", err)
+	}
+	response.Body.Close()
+}
+
+func TestMethodTokenValidation(t *testing.T) {
+	server, _ := methodEcho(t)
+	for _, method := range []string{"", "GET /", "PROP\tFIND", "MÉTHOD", "a(b)"} {
+		if _, err := Do(method, server.URL); !errors.Is(err, ErrInvalidMethod) {
+			t.Errorf("Do(%q) error = %v, want ErrInvalidMethod", method, err)
+		}
+	}
+}
+
+func TestTraceRefusesBody(t *testing.T) {
+	server, got := methodEcho(t)
+	if _, err := Do(http.MethodTrace, server.URL, WithPostStringBody("payload")); !errors.Is(err, ErrTraceWithBody) {
+		t.Fatalf("TRACE with body error = %v, want ErrTraceWithBody", err)
+	}
+	response, err := Do("trace", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if *got != http.MethodTrace {
+		t.Fatalf("method = %q, want TRACE", *got)
+	}
+}
@@ -0,0 +1,141 @@
+package nhr
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RequestMetrics 一次尝试的监控数据，Status为0表示没有收到响应
+type RequestMetrics struct {
+	Method string
+	// Host 请求的主机名，不包含端口，避免每个端口产生单独的标签
+	Host   string
+	Status int
+	// Duration 发送请求到收到响应头的时间，不包含读取body的时间
+	Duration time.Duration
+	// ResponseSize 实际读取的响应body字节数（解压之前）
+	ResponseSize int64
+	// QueueWait 请求等待WithMaxInFlight名额的时间，同一个请求的每次尝试都是相同的值
+	QueueWait time.Duration
+	// ConnectionReused 使用了复用的连接，DialDuration 新建连接时建立TCP连接的耗时
+	ConnectionReused bool
+	DialDuration     time.Duration
+	// Bypass 请求通过WithNoRetry、WithNoRateLimit跳过的功能，以,分隔，例如"retry,rate_limit"，没有时为空
+	Bypass string
+	// Labels 请求通过WithLabel、WithLabels设置的label，没有时为nil，可以用其中的LabelOperation代替URL作为指标维度
+	Labels map[string]string
+	Err    error
+}
+
+// MetricsCollector 接收请求的监控数据，例如转为Prometheus指标，实现需要可以被多个goroutine同时调用
+// 开启重试时每次尝试分别上报
+type MetricsCollector interface {
+	// RequestStarted 开始发送请求，可以用于统计进行中的请求数
+	RequestStarted(method, host string)
+	// RequestFinished 请求出错，或者响应body读到末尾或被关闭时调用，每次尝试只调用一次
+	RequestFinished(metrics *RequestMetrics)
+}
+
+// WithMetrics 将每次尝试的method、host、状态码、耗时和响应大小上报给collector，见MetricsMiddleware
+// collector实现了RateLimitCollector时，同时接收WithAdaptiveRateLimit记录的配额变化
+func WithMetrics(collector MetricsCollector) Option {
+	middleware := MetricsMiddleware(collector)
+	return func(req *HttpRequests) {
+		req.collectors = append(append([]MetricsCollector(nil), req.collectors...), collector)
+		WithMiddleware(middleware)(req)
+	}
+}
+
+// MetricsMiddleware 上报监控数据的中间件，可以通过Client.Use为Client的所有请求开启
+// 响应body没有读完也没有关闭时，在这次尝试的context结束（超时或取消）时上报，Err为context的错误
+func MetricsMiddleware(collector MetricsCollector) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			metrics := &RequestMetrics{Method: req.Method, Host: req.URL.Hostname(), QueueWait: queueWaitOf(req.Context()), Bypass: bypassOf(req.Context()), Labels: LabelsFromContext(req.Context())}
+			collector.RequestStarted(metrics.Method, metrics.Host)
+			start := timeNow()
+			response, err := next(req)
+			metrics.Duration = timeNow().Sub(start)
+			if trace := attemptTraceOf(req.Context()); trace != nil {
+				metrics.ConnectionReused = atomic.LoadInt32(&trace.reused) == 1
+				metrics.DialDuration = time.Duration(atomic.LoadInt64(&trace.dialTime))
+			}
+			if err != nil || response == nil {
+				metrics.Err = err
+				collector.RequestFinished(metrics)
+				return response, err
+			}
+			metrics.Status = response.StatusCode
+			body := &meteredBody{ReadCloser: response.Body, collector: collector, metrics: metrics, done: make(chan struct{})}
+			if req.Context().Done() != nil {
+				go body.finishOnDone(req.Context())
+			}
+			response.Body = body
+			return response, nil
+		}
+	}
+}
+
+// meteredBody 统计读取的响应body字节数，读到末尾或关闭时上报
+type meteredBody struct {
+	io.ReadCloser
+	collector MetricsCollector
+	// mu 超时等情况下Close可能与Read在不同的goroutine中同时调用
+	mu       sync.Mutex
+	metrics  *RequestMetrics
+	finished bool
+	// done 上报后关闭，结束finishOnDone的goroutine
+	done chan struct{}
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.metrics.ResponseSize += int64(n)
+	if err != nil && err != io.EOF && b.metrics.Err == nil {
+		b.metrics.Err = err
+	}
+	b.mu.Unlock()
+	if err != nil {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *meteredBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *meteredBody) finish() {
+	b.mu.Lock()
+	if b.finished {
+		b.mu.Unlock()
+		return
+	}
+	b.finished = true
+	close(b.done)
+	metrics := *b.metrics
+	b.mu.Unlock()
+	b.collector.RequestFinished(&metrics)
+}
+
+// finishOnDone 调用方丢弃了没有读完的body时，在context结束时上报，避免进行中的请求数一直不减少
+// 正常关闭body时先上报再取消context，不会记录context的错误
+func (b *meteredBody) finishOnDone(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		b.mu.Lock()
+		if !b.finished && b.metrics.Err == nil {
+			b.metrics.Err = ctx.Err()
+		}
+		b.mu.Unlock()
+		b.finish()
+	case <-b.done:
+	}
+}
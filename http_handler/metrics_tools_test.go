@@ -0,0 +1,134 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// inFlightRecorder 按host统计进行中的请求数，并记录上报的监控数据
+type inFlightRecorder struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	finished chan RequestMetrics
+}
+
+func newInFlightRecorder() *inFlightRecorder {
+	return &inFlightRecorder{inFlight: map[string]int{}, finished: make(chan RequestMetrics, 8)}
+}
+
+func (r *inFlightRecorder) RequestStarted(method, host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight[host]++
+}
+
+func (r *inFlightRecorder) RequestFinished(metrics *RequestMetrics) {
+	r.mu.Lock()
+	r.inFlight[metrics.Host]--
+	r.mu.Unlock()
+	r.finished <- *metrics
+}
+
+func (r *inFlightRecorder) count(host string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inFlight[host]
+}
+
+func (r *inFlightRecorder) next(t *testing.T) RequestMetrics {
+	t.Helper()
+	select {
+	case metrics := <-r.finished:
+		return metrics
+	case <-time.After(2 * time.Second):
+		t.Fatal("RequestFinished was not called")
+		return RequestMetrics{}
+	}
+}
+
+func TestMetricsHostWithoutPort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	recorder := newInFlightRecorder()
+	response, err := Get(server.URL, WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(response.Body)
+	response.Body.Close()
+	metrics := recorder.next(t)
+	if metrics.Host != "127.0.0.1" || metrics.Status != http.StatusOK || metrics.ResponseSize != 2 || metrics.Err != nil {
+		t.Fatalf("metrics = %+v, want the host without its port", metrics)
+	}
+	if n := recorder.count("127.0.0.1"); n != 0 {
+		t.Fatalf("in flight = %v after Close", n)
+	}
+}
+
+func TestMetricsAbandonedBodyFinishesOnContextDone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	recorder := newInFlightRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	// 响应body既不读取也不关闭
+	if _, err := Get(server.URL, WithMetrics(recorder), WithContext(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	if n := recorder.count("127.0.0.1"); n != 1 {
+		t.Fatalf("in flight = %v, want 1 while the body is open", n)
+	}
+	cancel()
+	metrics := recorder.next(t)
+	if !errors.Is(metrics.Err, context.Canceled) || metrics.Status != http.StatusOK {
+		t.Fatalf("metrics = %+v, want the ctx error recorded", metrics)
+	}
+	if n := recorder.count("127.0.0.1"); n != 0 {
+		t.Fatalf("in flight = %v after the ctx was canceled", n)
+	}
+}
+
+func TestMetricsAbandonedBodyFinishesOnTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	recorder := newInFlightRecorder()
+	if _, err := Get(server.URL, WithMetrics(recorder), WithTimeout(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if metrics := recorder.next(t); !errors.Is(metrics.Err, context.DeadlineExceeded) {
+		t.Fatalf("metrics = %+v, want the attempt timeout recorded", metrics)
+	}
+}
+
+func TestMetricsCloseReportsOnce(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	recorder := newInFlightRecorder()
+	response, err := Get(server.URL, WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Close会取消这次尝试的context，不应再上报context的错误
+	response.Body.Close()
+	if metrics := recorder.next(t); metrics.Err != nil {
+		t.Fatalf("metrics = %+v, want no error for a closed body", metrics)
+	}
+	select {
+	case metrics := <-recorder.finished:
+		t.Fatalf("RequestFinished called again with %+v", metrics)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,47 @@
+package nhr
+
+import (
+	"errors"
+	"net/http"
+)
+
+// RoundTripFunc 发送请求并返回响应，中间件通过包装RoundTripFunc在请求前后执行逻辑
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware 中间件，例如注入token、签名、日志和监控
+// 开启重试时每次尝试都会经过中间件，中间件看到的是解压之前的原始响应
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// ErrNilMiddlewareResponse 中间件既没有返回响应也没有返回错误
+var ErrNilMiddlewareResponse = errors.New("middleware returned nil response without error")
+
+// WithMiddleware 为请求添加中间件，先添加的中间件在外层，最先看到请求、最后看到响应
+// Client.Use添加的中间件在单次请求添加的中间件外层
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(req *HttpRequests) {
+		req.Middlewares = append(append([]Middleware(nil), req.Middlewares...), middlewares...)
+	}
+}
+
+// Use 为Client的所有请求添加中间件，需要在Client开始发送请求之前调用
+func (c *Client) Use(middlewares ...Middleware) {
+	c.defaults = append(c.defaults, WithMiddleware(middlewares...))
+}
+
+// roundTripFor 按顺序组合中间件，最内层使用send发送请求
+func roundTripFor(send RoundTripFunc, middlewares []Middleware) RoundTripFunc {
+	next := send
+	if len(middlewares) == 0 {
+		return next
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		next = middlewares[i](next)
+	}
+	return func(req *http.Request) (*http.Response, error) {
+		response, err := next(req)
+		if response == nil && err == nil {
+			return nil, ErrNilMiddlewareResponse
+		}
+		return response, err
+	}
+}
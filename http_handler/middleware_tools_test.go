@@ -0,0 +1,110 @@
+package nhr
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// tagMiddleware 把name追加到X-Order请求头，并在响应返回时记录name
+func tagMiddleware(name string, seen *[]string) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Add("X-Order", name)
+			response, err := next(req)
+			*seen = append(*seen, name)
+			return response, err
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	server, got := headerServer(t)
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	client.Use(tagMiddleware("client", &seen))
+	response, err := client.Get(server.URL, WithMiddleware(tagMiddleware("first", &seen), tagMiddleware("second", &seen)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if order := strings.Join((*got).Header.Values("X-Order"), ","); order != "client,first,second" {
+		t.Fatalf("request order = %v, want the client middleware outermost", order)
+	}
+	if order := strings.Join(seen, ","); order != "second,first,client" {
+		t.Fatalf("response order = %v, want the outer middleware to see the response last", order)
+	}
+}
+
+func TestMiddlewareRunsPerAttempt(t *testing.T) {
+	server, hits := countingServer(t, http.StatusServiceUnavailable)
+	var calls int32
+	counter := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&calls, 1)
+			return next(req)
+		}
+	}
+	response, err := Get(server.URL, WithRetry(3, 0), WithMiddleware(counter))
+	if err == nil {
+		response.Body.Close()
+	}
+	if n := atomic.LoadInt32(hits); n < 2 || atomic.LoadInt32(&calls) != n {
+		t.Fatalf("middleware called %v times for %v attempts", atomic.LoadInt32(&calls), n)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	server, hits := countingServer(t, http.StatusOK)
+	cached := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("cached")), Request: req}, nil
+		}
+	}
+	response, err := Get(server.URL, WithMiddleware(cached))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "cached" || atomic.LoadInt32(hits) != 0 {
+		t.Fatalf("body = %q after %v hits, want the middleware response without a request", body, atomic.LoadInt32(hits))
+	}
+
+	errDenied := errors.New("denied")
+	deny := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) { return nil, errDenied }
+	}
+	if _, err := Get(server.URL, WithMiddleware(deny)); !errors.Is(err, errDenied) {
+		t.Fatalf("error = %v, want the middleware error", err)
+	}
+	empty := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) { return nil, nil }
+	}
+	if _, err := Get(server.URL, WithMiddleware(empty)); !errors.Is(err, ErrNilMiddlewareResponse) {
+		t.Fatalf("error = %v, want ErrNilMiddlewareResponse", err)
+	}
+}
+
+func TestWithMiddlewareDoesNotShareSlices(t *testing.T) {
+	var seen []string
+	// 有剩余容量的切片，直接append会被两个请求共享
+	shared := append(make([]Middleware, 0, 2), tagMiddleware("a", &seen))
+	first := &HttpRequests{Middlewares: shared}
+	second := &HttpRequests{Middlewares: shared}
+	WithMiddleware(tagMiddleware("b", &seen))(first)
+	WithMiddleware(tagMiddleware("c", &seen))(second)
+	if len(first.Middlewares) != 2 || len(second.Middlewares) != 2 || len(shared) != 1 {
+		t.Fatal("each request should get its own middleware slice")
+	}
+	roundTripFor(func(req *http.Request) (*http.Response, error) { return &http.Response{}, nil }, first.Middlewares)(&http.Request{Header: http.Header{}})
+	if strings.Join(seen, ",") != "b,a" {
+		t.Fatalf("seen = %v, want the first request's own middlewares", seen)
+	}
+}
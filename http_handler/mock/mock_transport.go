@@ -0,0 +1,268 @@
+// Package mock 提供测试用的http.RoundTripper，不需要启动httptest服务即可测试使用nhr的代码
+package mock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+)
+
+// MockTransport 按注册的Route返回预设的响应，记录收到的所有请求，可以被多个goroutine同时使用
+type MockTransport struct {
+	// Fallback 没有匹配的Route时使用的RoundTripper，为nil时返回错误
+	Fallback http.RoundTripper
+
+	mu     sync.Mutex
+	routes []*Route
+	calls  []*Call
+}
+
+// Call 收到的请求，Body为完整的请求body
+type Call struct {
+	Request *http.Request
+	Body    []byte
+}
+
+// New 创建MockTransport
+func New() *MockTransport {
+	return &MockTransport{}
+}
+
+// Client 返回使用该MockTransport的nhr.Client，options作为每个请求的默认配置
+func (t *MockTransport) Client(options ...nhr.Option) *nhr.Client {
+	// 使用WithHTTPClient时NewClient不会返回错误
+	client, _ := nhr.NewClient(append([]nhr.Option{nhr.WithHTTPClient(t.HTTPClient())}, options...)...)
+	return client
+}
+
+// HTTPClient 返回使用该MockTransport的http.Client
+func (t *MockTransport) HTTPClient() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// On 注册一个Route，method为空时匹配任意method
+// url不带查询参数时忽略请求的查询参数，以*结尾时按前缀匹配；多个Route都匹配时使用先注册的
+func (t *MockTransport) On(method, url string) *Route {
+	route := &Route{owner: t, method: strings.ToUpper(method), url: url, status: http.StatusOK, header: http.Header{}}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = append(t.routes, route)
+	return route
+}
+
+// Calls 返回收到的所有请求
+func (t *MockTransport) Calls() []*Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Call(nil), t.calls...)
+}
+
+// AssertExpectations 检查通过Times设置了次数的Route是否恰好被调用了对应的次数
+func (t *MockTransport) AssertExpectations(tb testing.TB) {
+	tb.Helper()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, route := range t.routes {
+		if route.times > 0 && route.called != route.times {
+			tb.Errorf("mock: %v %v called %v times, expected %v", route.methodName(), route.url, route.called, route.times)
+		}
+	}
+}
+
+// RoundTrip 实现http.RoundTripper
+func (t *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("mock: read request body error:%w", err)
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	t.mu.Lock()
+	t.calls = append(t.calls, &Call{Request: req, Body: body})
+	var matched *Route
+	for _, route := range t.routes {
+		if route.match(req, body) {
+			matched = route
+			route.called++
+			break
+		}
+	}
+	t.mu.Unlock()
+	if matched == nil {
+		if t.Fallback != nil {
+			return t.Fallback.RoundTrip(req)
+		}
+		return nil, fmt.Errorf("mock: no route matches %v %v", req.Method, req.URL)
+	}
+	return matched.respond(req)
+}
+
+// Route 请求的匹配条件和预设的响应
+type Route struct {
+	owner     *MockTransport
+	method    string
+	url       string
+	headers   map[string]string
+	bodyMatch func(body []byte) bool
+	times     int
+	called    int
+
+	status  int
+	header  http.Header
+	body    []byte
+	latency time.Duration
+	err     error
+}
+
+// MatchHeader 请求头key的值为value时才匹配
+func (r *Route) MatchHeader(key, value string) *Route {
+	if r.headers == nil {
+		r.headers = map[string]string{}
+	}
+	r.headers[key] = value
+	return r
+}
+
+// MatchBody fn返回true时才匹配
+func (r *Route) MatchBody(fn func(body []byte) bool) *Route {
+	r.bodyMatch = fn
+	return r
+}
+
+// MatchBodyString 请求body与body完全相同时才匹配
+func (r *Route) MatchBodyString(body string) *Route {
+	return r.MatchBody(func(b []byte) bool { return string(b) == body })
+}
+
+// Times 最多匹配n次，超过之后继续匹配后面的Route，AssertExpectations检查是否恰好匹配了n次
+func (r *Route) Times(n int) *Route {
+	r.times = n
+	return r
+}
+
+// Respond 设置响应的状态码和body
+func (r *Route) Respond(status int, body string) *Route {
+	r.status, r.body = status, []byte(body)
+	return r
+}
+
+// RespondJSON 将v序列化为JSON作为响应body，并设置Content-Type
+func (r *Route) RespondJSON(status int, v interface{}) *Route {
+	body, err := nhr.FastJsonMarshal(v)
+	if err != nil {
+		r.err = fmt.Errorf("mock: marshal response error:%w", err)
+		return r
+	}
+	r.status, r.body = status, body
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+// RespondHeader 设置响应头
+func (r *Route) RespondHeader(key, value string) *Route {
+	r.header.Set(key, value)
+	return r
+}
+
+// Delay 返回响应之前等待d，请求的context结束时提前返回错误
+func (r *Route) Delay(d time.Duration) *Route {
+	r.latency = d
+	return r
+}
+
+// Fail 返回err而不是响应，用于模拟网络错误
+func (r *Route) Fail(err error) *Route {
+	r.err = err
+	return r
+}
+
+// Called 返回该Route被匹配的次数
+func (r *Route) Called() int {
+	r.owner.mu.Lock()
+	defer r.owner.mu.Unlock()
+	return r.called
+}
+
+func (r *Route) methodName() string {
+	if r.method == "" {
+		return "*"
+	}
+	return r.method
+}
+
+// match 在持有MockTransport的锁时调用
+func (r *Route) match(req *http.Request, body []byte) bool {
+	if r.times > 0 && r.called >= r.times {
+		return false
+	}
+	if r.method != "" && r.method != req.Method {
+		return false
+	}
+	if !matchURL(r.url, req) {
+		return false
+	}
+	for key, value := range r.headers {
+		if req.Header.Get(key) != value {
+			return false
+		}
+	}
+	return r.bodyMatch == nil || r.bodyMatch(body)
+}
+
+func matchURL(pattern string, req *http.Request) bool {
+	target := req.URL.String()
+	if !strings.Contains(pattern, "?") {
+		u := *req.URL
+		u.RawQuery, u.Fragment = "", ""
+		target = u.String()
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(target, strings.TrimSuffix(pattern, "*"))
+	}
+	return target == pattern
+}
+
+func (r *Route) respond(req *http.Request) (*http.Response, error) {
+	if r.latency > 0 {
+		if err := sleep(req.Context(), r.latency); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.status, http.StatusText(r.status)),
+		StatusCode:    r.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       req,
+	}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
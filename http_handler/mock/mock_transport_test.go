@@ -0,0 +1,178 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+)
+
+func TestRouteMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   func(m *MockTransport) *Route
+		method  string
+		url     string
+		options []nhr.Option
+		want    bool
+	}{
+		{name: "method and url", route: func(m *MockTransport) *Route { return m.On("get", "https://api.example.com/v1/orders") }, method: http.MethodGet, url: "https://api.example.com/v1/orders", want: true},
+		{name: "other method", route: func(m *MockTransport) *Route { return m.On("GET", "https://api.example.com/v1/orders") }, method: http.MethodPost, url: "https://api.example.com/v1/orders"},
+		{name: "any method", route: func(m *MockTransport) *Route { return m.On("", "https://api.example.com/v1/orders") }, method: http.MethodDelete, url: "https://api.example.com/v1/orders", want: true},
+		{name: "query ignored without ? in pattern", route: func(m *MockTransport) *Route { return m.On("GET", "https://api.example.com/v1/orders") }, method: http.MethodGet, url: "https://api.example.com/v1/orders?page=2", want: true},
+		{name: "query matched with ? in pattern", route: func(m *MockTransport) *Route { return m.On("GET", "https://api.example.com/v1/orders?page=1") }, method: http.MethodGet, url: "https://api.example.com/v1/orders?page=2"},
+		{name: "prefix", route: func(m *MockTransport) *Route { return m.On("GET", "https://api.example.com/v1/*") }, method: http.MethodGet, url: "https://api.example.com/v1/orders/7", want: true},
+		{name: "prefix on other host", route: func(m *MockTransport) *Route { return m.On("GET", "https://api.example.com/v1/*") }, method: http.MethodGet, url: "https://cdn.example.com/v1/orders/7"},
+		{
+			name: "header",
+			route: func(m *MockTransport) *Route {
+				return m.On("GET", "https://api.example.com/me").MatchHeader("Authorization", "Bearer tok")
+			},
+			method:  http.MethodGet,
+			url:     "https://api.example.com/me",
+			options: []nhr.Option{nhr.WithBearerToken("tok")},
+			want:    true,
+		},
+		{
+			name: "header mismatch",
+			route: func(m *MockTransport) *Route {
+				return m.On("GET", "https://api.example.com/me").MatchHeader("Authorization", "Bearer tok")
+			},
+			method:  http.MethodGet,
+			url:     "https://api.example.com/me",
+			options: []nhr.Option{nhr.WithBearerToken("other")},
+		},
+		{
+			name: "body",
+			route: func(m *MockTransport) *Route {
+				return m.On("POST", "https://api.example.com/orders").MatchBodyString(`{"id":1}`)
+			},
+			method:  http.MethodPost,
+			url:     "https://api.example.com/orders",
+			options: []nhr.Option{nhr.WithPostStringBody(`{"id":1}`)},
+			want:    true,
+		},
+		{
+			name: "body mismatch",
+			route: func(m *MockTransport) *Route {
+				return m.On("POST", "https://api.example.com/orders").MatchBodyString(`{"id":1}`)
+			},
+			method:  http.MethodPost,
+			url:     "https://api.example.com/orders",
+			options: []nhr.Option{nhr.WithPostStringBody(`{"id":2}`)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			route := tt.route(m).Respond(http.StatusOK, "matched")
+			response, err := m.Client().Fetch(tt.method, tt.url, tt.options...)
+			if tt.want {
+				if err != nil || response.String() != "matched" || route.Called() != 1 {
+					t.Fatalf("response = %v, %v, called %v times, want the route to match", response, err, route.Called())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "no route matches") || route.Called() != 0 {
+				t.Fatalf("error = %v, called %v times, want no match", err, route.Called())
+			}
+		})
+	}
+}
+
+func TestRouteResponses(t *testing.T) {
+	m := New()
+	m.On("GET", "https://api.example.com/orders/1").RespondJSON(http.StatusCreated, map[string]int{"id": 1}).RespondHeader("X-Request-Id", "r1")
+	m.On("GET", "https://api.example.com/down").Fail(errors.New("connection reset"))
+	m.On("GET", "https://api.example.com/slow").Delay(time.Second)
+	client := m.Client()
+
+	response, err := client.Fetch(http.MethodGet, "https://api.example.com/orders/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode() != http.StatusCreated || response.String() != `{"id":1}` ||
+		response.Headers().Get("Content-Type") != "application/json" || response.Headers().Get("X-Request-Id") != "r1" {
+		t.Fatalf("response = %v %q %v", response.StatusCode(), response.String(), response.Headers())
+	}
+
+	if _, err := client.Get("https://api.example.com/down"); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("error = %v, want the configured error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.Get("https://api.example.com/slow", nhr.WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want the ctx deadline to interrupt the delay", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("delayed response returned after %v", elapsed)
+	}
+}
+
+func TestRouteTimes(t *testing.T) {
+	m := New()
+	first := m.On("GET", "https://api.example.com/flaky").Times(2).Respond(http.StatusServiceUnavailable, "")
+	then := m.On("GET", "https://api.example.com/flaky").Respond(http.StatusOK, "ok")
+	response, err := m.Client().Fetch(http.MethodGet, "https://api.example.com/flaky", nhr.WithRetry(3, 0))
+	if err != nil || response.String() != "ok" {
+		t.Fatalf("response = %v, %v, want the third attempt to reach the second route", response, err)
+	}
+	if first.Called() != 2 || then.Called() != 1 || len(m.Calls()) != 3 {
+		t.Fatalf("called %v and %v times, %v calls", first.Called(), then.Called(), len(m.Calls()))
+	}
+	m.AssertExpectations(t)
+}
+
+// recordingTB 记录Errorf的testing.TB
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertExpectations(t *testing.T) {
+	m := New()
+	m.On("DELETE", "https://api.example.com/orders/1").Times(1)
+	m.On("GET", "https://api.example.com/orders").Respond(http.StatusOK, "[]")
+	tb := &recordingTB{TB: t}
+	m.AssertExpectations(tb)
+	if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], "DELETE https://api.example.com/orders/1 called 0 times, expected 1") {
+		t.Fatalf("errors = %q, want only the DELETE route reported", tb.errors)
+	}
+}
+
+func TestCallsAndFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("real"))
+	}))
+	defer server.Close()
+	m := New()
+	m.Fallback = http.DefaultTransport
+	m.On("POST", server.URL+"/mocked").Respond(http.StatusOK, "mocked")
+	client := m.Client()
+
+	response, err := client.Fetch(http.MethodPost, server.URL+"/mocked", nhr.WithPostStringBody(`{"a":1}`))
+	if err != nil || response.String() != "mocked" {
+		t.Fatalf("response = %v, %v", response, err)
+	}
+	response, err = client.Fetch(http.MethodGet, server.URL+"/real")
+	if err != nil || response.String() != "real" {
+		t.Fatalf("response = %v, %v, want the fallback to reach the server", response, err)
+	}
+	calls := m.Calls()
+	if len(calls) != 2 || string(calls[0].Body) != `{"a":1}` || calls[1].Request.URL.Path != "/real" {
+		t.Fatalf("calls = %+v", calls)
+	}
+}
@@ -0,0 +1,143 @@
+package mock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+)
+
+// Mode Recorder的工作模式
+type Mode int
+
+const (
+	// ModeReplay 只从fixture返回响应，fixture不存在时返回错误，不会访问网络
+	ModeReplay Mode = iota
+	// ModeRecord 总是发送真实的请求，并覆盖fixture
+	ModeRecord
+	// ModeReplayOrRecord fixture存在时回放，否则发送真实的请求并录制
+	ModeReplayOrRecord
+)
+
+// ErrFixtureNotFound ModeReplay下没有请求对应的fixture
+var ErrFixtureNotFound = errors.New("mock: fixture not found")
+
+// Recorder 录制真实的响应并在之后离线回放，fixture格式与nhr.WithFixtureCapture相同
+// fixture名称由method、URL和请求body计算，见nhr.FixtureName
+// multipart请求的随机boundary会被替换为固定值之后再计算名称和写入fixture，重新录制得到相同的fixture
+type Recorder struct {
+	Dir  string
+	Mode Mode
+	// Transport 录制时发送真实请求使用的RoundTripper，为nil时使用http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+// HTTPClient 返回使用该Recorder的http.Client
+func (r *Recorder) HTTPClient() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Client 返回使用该Recorder的nhr.Client，options作为每个请求的默认配置
+func (r *Recorder) Client(options ...nhr.Option) *nhr.Client {
+	client, _ := nhr.NewClient(append([]nhr.Option{nhr.WithHTTPClient(r.HTTPClient())}, options...)...)
+	return client
+}
+
+// RoundTrip 实现http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("mock: read request body error:%w", err)
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	header, fixtureBody, err := normalizeMultipart(req.Header, body)
+	if err != nil {
+		return nil, err
+	}
+	name := nhr.FixtureName(req.Method, req.URL.String(), string(fixtureBody))
+	if r.Mode != ModeRecord {
+		response, err := nhr.LoadFixtureResponse(r.Dir, name)
+		if err == nil {
+			response.Request = req
+			return response, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if r.Mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %v", ErrFixtureNotFound, filepath.Join(r.Dir, name))
+		}
+	}
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	response, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	recorded := req.Clone(req.Context())
+	recorded.Header = header
+	response.Request = recorded
+	err = nhr.WriteFixture(r.Dir, nhr.FixtureOverwrite, string(fixtureBody), response)
+	response.Request = req
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// fixtureBoundary 录制multipart请求时替换随机boundary的固定值
+const fixtureBoundary = "nhr-fixture-boundary"
+
+// normalizeMultipart 使用固定的boundary重新编码multipart的body，并相应地修改Content-Type
+// 内容相同的表单得到相同的body，不是multipart时原样返回
+func normalizeMultipart(header http.Header, body []byte) (http.Header, []byte, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return header, body, nil
+	}
+	var out bytes.Buffer
+	writer := multipart.NewWriter(&out)
+	if err := writer.SetBoundary(fixtureBoundary); err != nil {
+		return nil, nil, err
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("mock: parse multipart body error:%w", err)
+		}
+		target, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := io.Copy(target, part); err != nil {
+			return nil, nil, fmt.Errorf("mock: parse multipart body error:%w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, nil, err
+	}
+	params["boundary"] = fixtureBoundary
+	normalized := header.Clone()
+	normalized.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	return normalized, out.Bytes(), nil
+}
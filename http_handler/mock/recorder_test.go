@@ -0,0 +1,149 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	nhr "github.com/Lyzin/go-requests/http_handler"
+)
+
+// readFixtures 读取dir中所有fixture文件的内容
+func readFixtures(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[filepath.Base(path)] = string(data)
+	}
+	return files
+}
+
+func uploadAvatar(t *testing.T, client *nhr.Client, url string) string {
+	t.Helper()
+	response, err := client.Fetch(http.MethodPost, url,
+		nhr.WithFormFields(map[string]string{"user": "42"}),
+		nhr.WithFileReader("avatar", "me.png", strings.NewReader("png-bytes")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.String()
+}
+
+func TestRecorderMultipartIgnoresBoundary(t *testing.T) {
+	var boundaries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		boundaries = append(boundaries, r.MultipartForm.Value["user"][0]+":"+r.Header.Get("Content-Type"))
+		w.Write([]byte("uploaded"))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	recorder := &Recorder{Dir: dir, Mode: ModeRecord}
+	if got := uploadAvatar(t, recorder.Client(), server.URL+"/avatar"); got != "uploaded" {
+		t.Fatalf("recorded response = %q", got)
+	}
+	first := readFixtures(t, dir)
+	if len(first) != 3 {
+		t.Fatalf("fixtures = %v, want one request/response/body set", first)
+	}
+
+	// 重新录制时boundary不同，fixture的名称和内容都不变
+	uploadAvatar(t, recorder.Client(), server.URL+"/avatar")
+	if len(boundaries) != 2 || boundaries[0] == boundaries[1] {
+		t.Fatalf("server saw %v, want two uploads with different random boundaries", boundaries)
+	}
+	second := readFixtures(t, dir)
+	if len(second) != len(first) {
+		t.Fatalf("re-recording produced %v, want the same fixtures as %v", second, first)
+	}
+	for name, data := range first {
+		if second[name] != data {
+			t.Fatalf("fixture %v changed after re-recording:\n%v\nvs\n%v", name, data, second[name])
+		}
+	}
+
+	server.Close()
+	replay := &Recorder{Dir: dir, Mode: ModeReplay}
+	if got := uploadAvatar(t, replay.Client(), server.URL+"/avatar"); got != "uploaded" {
+		t.Fatalf("replayed response = %q", got)
+	}
+}
+
+func TestRecorderReplayMissingFixture(t *testing.T) {
+	replay := &Recorder{Dir: t.TempDir(), Mode: ModeReplay}
+	_, err := replay.Client().Get("http://api.example.com/v1/orders")
+	if !errors.Is(err, ErrFixtureNotFound) {
+		t.Fatalf("error = %v, want ErrFixtureNotFound", err)
+	}
+}
+
+func TestRecorderReplayOrRecord(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer server.Close()
+
+	recorder := &Recorder{Dir: t.TempDir(), Mode: ModeReplayOrRecord}
+	client := recorder.Client()
+	defer client.Close(context.Background())
+	for i := 0; i < 2; i++ {
+		response, err := client.Fetch(http.MethodGet, server.URL+"/orders/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.String() != `{"id":1}` || response.Headers().Get("Content-Type") != "application/json" {
+			t.Fatalf("response %v = %q %v", i, response.String(), response.Headers())
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("server received %v requests, want the second one replayed", hits)
+	}
+}
+
+func TestRecorderRecordThenReplayOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Echo", string(body))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"created":true}`))
+	}))
+	dir := t.TempDir()
+	recorder := &Recorder{Dir: dir, Mode: ModeRecord}
+	if _, err := recorder.Client().Fetch(http.MethodPost, server.URL+"/orders", nhr.WithPostStringBody(`{"id":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	replay := (&Recorder{Dir: dir, Mode: ModeReplay}).Client()
+	response, err := replay.Fetch(http.MethodPost, server.URL+"/orders", nhr.WithPostStringBody(`{"id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode() != http.StatusCreated || response.String() != `{"created":true}` || response.Headers().Get("X-Echo") != `{"id":1}` {
+		t.Fatalf("replayed %v %q %v", response.StatusCode(), response.String(), response.Headers())
+	}
+	// 请求body不同时对应另一个fixture
+	if _, err := replay.Fetch(http.MethodPost, server.URL+"/orders", nhr.WithPostStringBody(`{"id":2}`)); !errors.Is(err, ErrFixtureNotFound) {
+		t.Fatalf("error = %v, want ErrFixtureNotFound for another body", err)
+	}
+}
@@ -0,0 +1,278 @@
+package nhr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrMultipartWithBody multipart表单不能与WithPostJsonBody、WithPostStringBody同时使用
+var ErrMultipartWithBody = errors.New("multipart form cannot be combined with a request body")
+
+// FormFile multipart表单中的一个文件，Path和Reader二选一
+type FormFile struct {
+	Field    string
+	FileName string
+	Path     string
+	Reader   io.Reader
+
+	mu sync.Mutex
+	// section Reader同时实现io.ReaderAt和io.Seeker时的内容范围，每次打开都使用独立的SectionReader
+	section *io.SectionReader
+	// inUse Reader正在被一次发送读取，sent Reader的内容已经被读出过
+	inUse bool
+	sent  bool
+}
+
+// WithFormFields 设置multipart表单的普通字段，多次调用时合并
+func WithFormFields(fields map[string]string) Option {
+	return func(req *HttpRequests) {
+		if req.FormFields == nil {
+			req.FormFields = make(map[string]string, len(fields))
+		}
+		for key, value := range fields {
+			req.FormFields[key] = value
+		}
+	}
+}
+
+// WithFiles 上传本地文件，key为表单字段名，value为文件路径，文件在发送时边读边写，不会整体读入内存
+func WithFiles(files map[string]string) Option {
+	return func(req *HttpRequests) {
+		fields := make([]string, 0, len(files))
+		for field := range files {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			req.Files = append(req.Files, &FormFile{Field: field, FileName: filepath.Base(files[field]), Path: files[field]})
+		}
+	}
+}
+
+// WithFileReader 上传内存中或其他来源的内容，fileName为表单中的文件名
+// r实现了io.Seeker时，重试和重定向会从头重新发送，否则只能发送一次，需要重新发送时返回的错误满足errors.Is(err, ErrBodyNotReplayable)
+func WithFileReader(field, fileName string, r io.Reader) Option {
+	return func(req *HttpRequests) {
+		req.Files = append(req.Files, &FormFile{Field: field, FileName: fileName, Reader: r})
+	}
+}
+
+// WithMultipartBoundary 指定multipart的boundary，使body的内容可以重现，用于录制和对比测试数据，正常请求不需要设置
+func WithMultipartBoundary(boundary string) Option {
+	return func(req *HttpRequests) {
+		req.MultipartBoundary = boundary
+	}
+}
+
+// isMultipart 是否需要发送multipart表单
+func (r *HttpRequests) isMultipart() bool {
+	return len(r.FormFields) > 0 || len(r.Files) > 0
+}
+
+// multipartBody 生成multipart表单body，每次调用open都重新生成
+type multipartBody struct {
+	fields      map[string]string
+	files       []*FormFile
+	boundary    string
+	contentType string
+}
+
+// newMultipartBody 检查表单配置并确定Content-Type，本地文件在这里确认存在
+func newMultipartBody(requestIns *HttpRequests) (*multipartBody, error) {
+	for _, file := range requestIns.Files {
+		if file.Path == "" {
+			continue
+		}
+		if info, err := os.Stat(file.Path); err != nil {
+			return nil, fmt.Errorf("open form file %v error:%w", file.Field, err)
+		} else if info.IsDir() {
+			return nil, fmt.Errorf("form file %v: %v is a directory", file.Field, file.Path)
+		}
+	}
+	writer := multipart.NewWriter(io.Discard)
+	if requestIns.MultipartBoundary != "" {
+		if err := writer.SetBoundary(requestIns.MultipartBoundary); err != nil {
+			return nil, fmt.Errorf("set multipart boundary error:%w", err)
+		}
+	}
+	return &multipartBody{
+		fields:      requestIns.FormFields,
+		files:       requestIns.Files,
+		boundary:    writer.Boundary(),
+		contentType: writer.FormDataContentType(),
+	}, nil
+}
+
+// replayable 每个文件都可以重新打开时body可以重新生成，此时才设置http.Request.GetBody
+func (b *multipartBody) replayable() bool {
+	for _, file := range b.files {
+		if !file.replayable() {
+			return false
+		}
+	}
+	return true
+}
+
+// open 返回通过管道边生成边发送的body，读取方关闭body时写入方随之退出
+func (b *multipartBody) open() io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(b.write(writer))
+	}()
+	return reader
+}
+
+// write 按字段名顺序写入普通字段，再按添加顺序写入文件
+func (b *multipartBody) write(w io.Writer) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(b.boundary); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(b.fields))
+	for key := range b.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := writer.WriteField(key, b.fields[key]); err != nil {
+			return err
+		}
+	}
+	for _, file := range b.files {
+		if err := writeFormFile(writer, file); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeFormFile 写入一个文件，Content-Type根据文件扩展名判断
+func writeFormFile(writer *multipart.Writer, file *FormFile) (err error) {
+	content, err := file.open()
+	if err != nil {
+		return err
+	}
+	counted := &countingReader{r: content}
+	defer func() {
+		_ = content.Close()
+		// 读出过内容之后Reader已经被消耗，即使写入失败也只能通过Seek重新发送
+		file.release(err == nil || counted.n > 0)
+	}()
+	contentType := mime.TypeByExtension(filepath.Ext(file.FileName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(file.Field), escapeQuotes(file.FileName)))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(part, counted); err != nil {
+		return fmt.Errorf("write form file %v error:%w", file.Field, err)
+	}
+	return nil
+}
+
+// countingReader 记录已经读出的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// replayable 本地文件和实现了io.Seeker的Reader可以重新打开
+func (f *FormFile) replayable() bool {
+	if f.Path != "" {
+		return true
+	}
+	_, ok := f.Reader.(io.Seeker)
+	return ok
+}
+
+// open 打开文件内容，每次打开本地文件或者ReaderAt都得到独立的读取位置
+// 只实现了io.Seeker的Reader同一时间只能被一次发送读取，再次打开时从头开始；不能Seek的Reader只能发送一次
+func (f *FormFile) open() (io.ReadCloser, error) {
+	if f.Path != "" {
+		return os.Open(f.Path)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if section, err := f.sectionLocked(); err != nil {
+		return nil, fmt.Errorf("open form file %v error:%w", f.Field, err)
+	} else if section != nil {
+		return io.NopCloser(io.NewSectionReader(section, 0, section.Size())), nil
+	}
+	if f.inUse {
+		return nil, fmt.Errorf("form file %v is still being sent by another attempt", f.Field)
+	}
+	if f.sent {
+		seeker, ok := f.Reader.(io.Seeker)
+		if !ok {
+			return nil, fmt.Errorf("form file %v cannot be re-sent, use an io.Seeker to allow retries:%w", f.Field, ErrBodyNotReplayable)
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	f.inUse = true
+	return io.NopCloser(f.Reader), nil
+}
+
+// sectionLocked Reader同时实现io.ReaderAt和io.Seeker时返回从当前位置到结尾的内容范围，第一次调用时确定
+func (f *FormFile) sectionLocked() (*io.SectionReader, error) {
+	if f.section != nil {
+		return f.section, nil
+	}
+	readerAt, ok := f.Reader.(io.ReaderAt)
+	seeker, isSeeker := f.Reader.(io.Seeker)
+	if !ok || !isSeeker {
+		return nil, nil
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	f.section = io.NewSectionReader(readerAt, start, end-start)
+	return f.section, nil
+}
+
+// release 一次发送结束，sent为true时标记Reader的内容已经被读出过
+func (f *FormFile) release(sent bool) {
+	if f.Path != "" {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inUse = false
+	f.sent = f.sent || sent
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes 转义反斜杠和双引号，与mime/multipart中的规则相同
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,269 @@
+package nhr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// uploadServer /redirect以307重定向到/upload，/flaky第一次返回503，其他请求记录收到的表单文件
+func uploadServer(t *testing.T) (*httptest.Server, func() []map[string]string) {
+	var mu sync.Mutex
+	var uploads []map[string]string
+	flaky := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/upload", http.StatusTemporaryRedirect)
+			return
+		}
+		if r.URL.Path == "/flaky" {
+			if flaky++; flaky == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		upload := map[string]string{}
+		for field, values := range r.MultipartForm.Value {
+			upload[field] = values[0]
+		}
+		for field, headers := range r.MultipartForm.File {
+			file, _ := headers[0].Open()
+			content, _ := io.ReadAll(file)
+			file.Close()
+			upload[field] = headers[0].Filename + ":" + string(content)
+		}
+		uploads = append(uploads, upload)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]map[string]string(nil), uploads...)
+	}
+}
+
+func multipartOptions(t *testing.T) []Option {
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return []Option{
+		WithFormFields(map[string]string{"kind": "daily"}),
+		WithFiles(map[string]string{"report": path}),
+		WithFileReader("note", "note.txt", bytes.NewReader([]byte("hello"))),
+	}
+}
+
+func checkUploads(t *testing.T, uploads []map[string]string, want int) {
+	t.Helper()
+	if len(uploads) != want {
+		t.Fatalf("server parsed %v uploads, want %v", len(uploads), want)
+	}
+	upload := uploads[want-1]
+	if upload["kind"] != "daily" || upload["report"] != "report.csv:a,b\n1,2\n" || upload["note"] != "note.txt:hello" {
+		t.Fatalf("upload = %q, want every part sent in full", upload)
+	}
+}
+
+func TestMultipartReplayOnRedirect(t *testing.T) {
+	server, uploads := uploadServer(t)
+	response, err := Post(server.URL+"/redirect", multipartOptions(t)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Request.URL.Path != "/upload" {
+		t.Fatalf("status = %v at %v, want 200 after the redirect", response.StatusCode, response.Request.URL.Path)
+	}
+	checkUploads(t, uploads(), 1)
+}
+
+func TestMultipartReplayOnRetry(t *testing.T) {
+	server, uploads := uploadServer(t)
+	options := append(multipartOptions(t), WithRetry(3, 0), WithRetryNonIdempotent())
+	response, err := Post(server.URL+"/flaky", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want 200 after the retry", response.StatusCode)
+	}
+	checkUploads(t, uploads(), 1)
+}
+
+func TestMultipartNonSeekableReaderNotResent(t *testing.T) {
+	server, uploads := uploadServer(t)
+	reader := io.MultiReader(strings.NewReader("hello"))
+	_, err := Post(server.URL+"/flaky", WithFileReader("note", "note.txt", reader), WithRetry(3, 0), WithRetryNonIdempotent())
+	if err == nil || !strings.Contains(err.Error(), "cannot be re-sent") {
+		t.Fatalf("error = %v, want a non-seekable reader to fail on the retry", err)
+	}
+	if n := len(uploads()); n != 0 {
+		t.Fatalf("server parsed %v uploads, want none", n)
+	}
+}
+
+func TestMultipartNonSeekableReaderNotRedirected(t *testing.T) {
+	server, uploads := uploadServer(t)
+	_, err := Post(server.URL+"/redirect", WithFileReader("note", "note.txt", io.MultiReader(strings.NewReader("hello"))))
+	if !errors.Is(err, ErrBodyNotReplayable) {
+		t.Fatalf("error = %v, want ErrBodyNotReplayable for the 307", err)
+	}
+	if n := len(uploads()); n != 0 {
+		t.Fatalf("server parsed %v uploads, want none", n)
+	}
+}
+
+// getBodyMiddleware 发送之前通过GetBody读出完整的body，记录读到的内容
+func getBodyMiddleware(got *string, hasGetBody *bool) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if *hasGetBody = req.GetBody != nil; *hasGetBody {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				data, err := io.ReadAll(body)
+				body.Close()
+				if err != nil {
+					return nil, err
+				}
+				*got = string(data)
+			}
+			return next(req)
+		}
+	}
+}
+
+func TestMultipartGetBodyIndependent(t *testing.T) {
+	server, uploads := uploadServer(t)
+	var replayed string
+	var hasGetBody bool
+	options := append(multipartOptions(t), WithMiddleware(getBodyMiddleware(&replayed, &hasGetBody)))
+	response, err := Post(server.URL+"/upload", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	checkUploads(t, uploads(), 1)
+	if !hasGetBody || !strings.Contains(replayed, "a,b\n1,2\n") || !strings.Contains(replayed, "hello") {
+		t.Fatalf("GetBody = %v, %q, want an independent copy of every part", hasGetBody, replayed)
+	}
+
+	reader := io.MultiReader(strings.NewReader("hello"))
+	response, err = Post(server.URL+"/upload", WithFileReader("note", "note.txt", reader), WithMiddleware(getBodyMiddleware(&replayed, &hasGetBody)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if hasGetBody {
+		t.Fatal("GetBody should be nil for a non-seekable reader")
+	}
+	if got := uploads(); len(got) != 2 || got[1]["note"] != "note.txt:hello" {
+		t.Fatalf("uploads = %q, want the reader sent in full", got)
+	}
+}
+
+// seekOnlyReader 只实现了io.Reader和io.Seeker
+type seekOnlyReader struct {
+	r *strings.Reader
+}
+
+func (s *seekOnlyReader) Read(p []byte) (int, error) { return s.r.Read(p) }
+func (s *seekOnlyReader) Seek(offset int64, whence int) (int64, error) {
+	return s.r.Seek(offset, whence)
+}
+
+func TestFormFileOpen(t *testing.T) {
+	// ReaderAt每次打开都从最初的位置独立读取
+	source := strings.NewReader("xxhello")
+	source.Seek(2, io.SeekStart)
+	file := &FormFile{Field: "note", Reader: source}
+	first, err := file.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := file.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := io.ReadAll(first)
+	b, _ := io.ReadAll(second)
+	if string(a) != "hello" || string(b) != "hello" {
+		t.Fatalf("opened %q and %q, want two independent copies", a, b)
+	}
+
+	// 只能Seek的Reader同一时间只能被一次发送读取
+	seekOnly := &FormFile{Field: "note", Reader: &seekOnlyReader{r: strings.NewReader("hello")}}
+	content, err := seekOnly.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seekOnly.open(); err == nil || !strings.Contains(err.Error(), "still being sent") {
+		t.Fatalf("error = %v, want a concurrent open rejected", err)
+	}
+	io.ReadAll(content)
+	seekOnly.release(true)
+	content, err = seekOnly.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(content); string(data) != "hello" {
+		t.Fatalf("reopened %q, want the reader rewound", data)
+	}
+
+	plain := &FormFile{Field: "note", Reader: io.MultiReader(strings.NewReader("hello"))}
+	if seekOnly.replayable() != true || plain.replayable() || !(&FormFile{Path: "a.txt"}).replayable() {
+		t.Fatal("only paths and seekers should be replayable")
+	}
+	plain.release(true)
+	if _, err := plain.open(); !errors.Is(err, ErrBodyNotReplayable) {
+		t.Fatalf("error = %v, want ErrBodyNotReplayable", err)
+	}
+}
+
+// failingWriter 所有写入都失败
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("connection closed") }
+
+func TestFormFileMarkedSentAfterWrite(t *testing.T) {
+	file := &FormFile{Field: "note", FileName: "note.txt", Reader: io.MultiReader(strings.NewReader("hello"))}
+	if err := writeFormFile(multipart.NewWriter(failingWriter{}), file); err == nil {
+		t.Fatal("writing the part header should fail")
+	}
+	if file.sent {
+		t.Fatal("a file whose part was never written should not be marked as sent")
+	}
+	var body bytes.Buffer
+	if err := writeFormFile(multipart.NewWriter(&body), file); err != nil {
+		t.Fatal(err)
+	}
+	if !file.sent || !strings.Contains(body.String(), "hello") {
+		t.Fatalf("sent = %v, body = %q, want the content written once", file.sent, body.String())
+	}
+	if _, err := file.open(); err == nil {
+		t.Fatal("a non-seekable reader should not be opened again after it was sent")
+	}
+}
+
+func TestEscapeQuotes(t *testing.T) {
+	if got := escapeQuotes(`a"b\c`); got != `a\"b\\c` {
+		t.Fatalf("escapeQuotes = %q", got)
+	}
+}
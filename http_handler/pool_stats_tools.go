@@ -0,0 +1,133 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PoolStats 一个host的连接使用统计
+type PoolStats struct {
+	// Reused 复用已有连接的次数，New 新建连接的次数
+	Reused int64
+	New    int64
+	// IdleHits 直接从连接池的空闲连接中取到连接的次数
+	IdleHits int64
+	// Dials、DialTime 建立TCP连接的次数以及总耗时，不包含TLS握手
+	Dials    int64
+	DialTime time.Duration
+}
+
+// PoolStats 按host:port返回Client发起的请求的连接统计，每次尝试以及重定向都单独计数
+func (c *Client) PoolStats() map[string]PoolStats {
+	return c.poolStats.snapshot()
+}
+
+// ResetPoolStats 清空连接统计
+func (c *Client) ResetPoolStats() {
+	c.poolStats.reset()
+}
+
+// ConnectionReused 返回响应是否使用了复用的连接，重定向时为最后一跳使用的连接
+func ConnectionReused(responseIns *http.Response) bool {
+	if responseIns == nil || responseIns.Request == nil {
+		return false
+	}
+	trace := attemptTraceOf(responseIns.Request.Context())
+	return trace != nil && atomic.LoadInt32(&trace.reused) == 1
+}
+
+type attemptTraceContextKey struct{}
+
+func attemptTraceOf(ctx context.Context) *attemptTrace {
+	trace, _ := ctx.Value(attemptTraceContextKey{}).(*attemptTrace)
+	return trace
+}
+
+// poolStats 按host累计的连接统计，计数使用原子操作，只有新增host时加锁
+type poolStats struct {
+	mu    sync.RWMutex
+	hosts map[string]*hostPoolCounters
+}
+
+type hostPoolCounters struct {
+	reused   int64
+	new      int64
+	idleHits int64
+	dials    int64
+	dialTime int64
+}
+
+func newPoolStats() *poolStats {
+	return &poolStats{hosts: map[string]*hostPoolCounters{}}
+}
+
+func (s *poolStats) counters(host string) *hostPoolCounters {
+	s.mu.RLock()
+	counters, ok := s.hosts[host]
+	s.mu.RUnlock()
+	if ok {
+		return counters
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if counters, ok = s.hosts[host]; !ok {
+		counters = &hostPoolCounters{}
+		s.hosts[host] = counters
+	}
+	return counters
+}
+
+func (s *poolStats) gotConn(host string, reused, wasIdle bool) {
+	if s == nil {
+		return
+	}
+	counters := s.counters(host)
+	if reused {
+		atomic.AddInt64(&counters.reused, 1)
+	} else {
+		atomic.AddInt64(&counters.new, 1)
+	}
+	if wasIdle {
+		atomic.AddInt64(&counters.idleHits, 1)
+	}
+}
+
+func (s *poolStats) dialed(host string, d time.Duration) {
+	if s == nil {
+		return
+	}
+	counters := s.counters(host)
+	atomic.AddInt64(&counters.dials, 1)
+	atomic.AddInt64(&counters.dialTime, int64(d))
+}
+
+func (s *poolStats) snapshot() map[string]PoolStats {
+	stats := map[string]PoolStats{}
+	if s == nil {
+		return stats
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for host, counters := range s.hosts {
+		stats[host] = PoolStats{
+			Reused:   atomic.LoadInt64(&counters.reused),
+			New:      atomic.LoadInt64(&counters.new),
+			IdleHits: atomic.LoadInt64(&counters.idleHits),
+			Dials:    atomic.LoadInt64(&counters.dials),
+			DialTime: time.Duration(atomic.LoadInt64(&counters.dialTime)),
+		}
+	}
+	return stats
+}
+
+func (s *poolStats) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts = map[string]*hostPoolCounters{}
+}
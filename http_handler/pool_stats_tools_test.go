@@ -0,0 +1,93 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// metricsRecorder 记录上报的监控数据
+type metricsRecorder struct {
+	mu      sync.Mutex
+	metrics []RequestMetrics
+}
+
+func (r *metricsRecorder) RequestStarted(method, host string) {}
+
+func (r *metricsRecorder) RequestFinished(metrics *RequestMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, *metrics)
+}
+
+func runSequential(t *testing.T, client *Client, url string, n int) []*Response {
+	t.Helper()
+	responses := make([]*Response, 0, n)
+	for i := 0; i < n; i++ {
+		response, err := client.Fetch(http.MethodGet, url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func TestPoolStatsKeepAlive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	host := mustHost(t, server.URL)
+
+	recorder := &metricsRecorder{}
+	client, err := NewClient(WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	responses := runSequential(t, client, server.URL, 50)
+
+	stats := client.PoolStats()[host]
+	if stats.Reused < 45 || stats.New+stats.Reused != 50 || stats.Dials != stats.New {
+		t.Fatalf("keep-alive stats = %+v, want ~49 reuses", stats)
+	}
+	if stats.IdleHits != stats.Reused || stats.DialTime <= 0 {
+		t.Fatalf("idle hits / dial time = %+v", stats)
+	}
+	if responses[0].ConnectionReused || !responses[49].ConnectionReused {
+		t.Fatalf("ConnectionReused first = %v, last = %v", responses[0].ConnectionReused, responses[49].ConnectionReused)
+	}
+	recorder.mu.Lock()
+	first, last := recorder.metrics[0], recorder.metrics[len(recorder.metrics)-1]
+	recorder.mu.Unlock()
+	if first.ConnectionReused || first.DialDuration <= 0 || !last.ConnectionReused || last.DialDuration != 0 {
+		t.Fatalf("metrics first = %+v, last = %+v", first, last)
+	}
+
+	client.ResetPoolStats()
+	if len(client.PoolStats()) != 0 {
+		t.Fatalf("stats after reset = %v", client.PoolStats())
+	}
+}
+
+func TestPoolStatsDisableKeepAlives(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithDisableKeepAlives())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	runSequential(t, client, server.URL, 50)
+
+	stats := client.PoolStats()[mustHost(t, server.URL)]
+	if stats.Reused != 0 || stats.New != 50 || stats.Dials != 50 {
+		t.Fatalf("stats without keep-alives = %+v, want 50 new connections", stats)
+	}
+}
@@ -0,0 +1,287 @@
+package nhr
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseQuery 将查询字符串解析为map，是WithParams的逆过程
+// rawQuery开头的?会被忽略，解析失败时返回带有原始查询字符串的错误
+func ParseQuery(rawQuery string) (map[string][]string, error) {
+	rawQuery = strings.TrimPrefix(rawQuery, "?")
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("parse query %q failed:%v", rawQuery, err)
+	}
+	return values, nil
+}
+
+// urlTag 结构体字段上url标签的解析结果，格式与WithQueryStruct相同: `url:"name,omitempty,unix"`
+type urlTag struct {
+	name      string
+	omitEmpty bool
+	unix      bool
+}
+
+// parseURLTag 解析字段的url标签，skip为true表示该字段不参与编解码
+func parseURLTag(field reflect.StructField) (tag urlTag, skip bool) {
+	return parseFieldTag(field, "url")
+}
+
+// parseFieldTag 按url标签的规则解析字段的key标签，csv标签使用同样的规则
+func parseFieldTag(field reflect.StructField, key string) (tag urlTag, skip bool) {
+	value, ok := field.Tag.Lookup(key)
+	if value == "-" {
+		return tag, true
+	}
+	parts := strings.Split(value, ",")
+	tag.name = parts[0]
+	if !ok || tag.name == "" {
+		tag.name = field.Name
+	}
+	for _, option := range parts[1:] {
+		switch option {
+		case "omitempty":
+			tag.omitEmpty = true
+		case "unix":
+			tag.unix = true
+		}
+	}
+	return tag, false
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ParseQueryInto 将查询字符串解码到结构体中，字段使用与WithQueryStruct相同的url标签
+// 重复的key解码到切片字段中，支持string、bool、整数、浮点数、time.Time(RFC3339或带unix选项的秒级时间戳)及其指针
+func ParseQueryInto(rawQuery string, v interface{}) error {
+	values, err := ParseQuery(rawQuery)
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("ParseQueryInto requires a non-nil pointer to struct")
+	}
+	return decodeQueryStruct(values, rv.Elem())
+}
+
+// decodeQueryStruct 按字段的url标签从values中取值，匿名嵌入的结构体字段会展开处理
+func decodeQueryStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag, skip := parseURLTag(field)
+		if skip {
+			continue
+		}
+		fv := rv.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Type != timeType {
+			if _, tagged := field.Tag.Lookup("url"); !tagged {
+				if err := decodeQueryStruct(values, fv); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		raw, ok := values[tag.name]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		if err := setQueryField(fv, raw, tag); err != nil {
+			return fmt.Errorf("decode query key %q into field %v failed:%v", tag.name, field.Name, err)
+		}
+	}
+	return nil
+}
+
+// setQueryField 将查询参数的值写入字段，切片字段接收全部的值，其余字段只取第一个值
+func setQueryField(fv reflect.Value, raw []string, tag urlTag) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), len(raw), len(raw))
+		for i, s := range raw {
+			if err := setQueryScalar(slice.Index(i), s, tag); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setQueryScalar(fv, raw[0], tag)
+}
+
+// setQueryScalar 将单个字符串转换为字段对应的类型
+func setQueryScalar(fv reflect.Value, s string, tag urlTag) error {
+	if fv.Kind() == reflect.Ptr {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setQueryScalar(ptr.Elem(), s, tag); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+	if fv.Type() == timeType {
+		if tag.unix {
+			seconds, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return err
+			}
+			fv.Set(reflect.ValueOf(time.Unix(seconds, 0)))
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %v", fv.Type())
+	}
+	return nil
+}
+
+// WithQueryStruct 将结构体编码为查询参数，追加在WithParams设置的参数之后，标签规则见EncodeQuery
+// 编码失败时HttpCaller返回错误
+func WithQueryStruct(v interface{}) Option {
+	return func(req *HttpRequests) {
+		values, err := EncodeQuery(v)
+		if err != nil {
+			req.optionErr = err
+			return
+		}
+		if encoded := values.Encode(); encoded != "" {
+			if req.Params != "" {
+				req.Params += "&"
+			}
+			req.Params += encoded
+		}
+	}
+}
+
+// EncodeQuery 将结构体编码为查询参数，是ParseQueryInto的逆过程
+// 字段使用`url:"name,omitempty,unix"`标签，没有标签时使用字段名，"-"表示忽略；nil指针不输出，omitempty时零值也不输出
+// 切片输出为重复的key，time.Time输出为RFC3339，带unix选项时输出秒级时间戳
+func EncodeQuery(v interface{}) (url.Values, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("EncodeQuery requires a struct or pointer to struct, got %T", v)
+	}
+	values := url.Values{}
+	if err := encodeQueryStruct(values, rv); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// encodeQueryStruct 按字段的url标签写入values，匿名嵌入的结构体字段会展开处理
+func encodeQueryStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag, skip := parseURLTag(field)
+		if skip {
+			continue
+		}
+		fv := rv.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Type != timeType {
+			if _, tagged := field.Tag.Lookup("url"); !tagged {
+				if err := encodeQueryStruct(values, fv); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if tag.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for j := 0; j < fv.Len(); j++ {
+				if err := addQueryScalar(values, fv.Index(j), tag); err != nil {
+					return fmt.Errorf("encode field %v failed:%v", field.Name, err)
+				}
+			}
+			continue
+		}
+		if err := addQueryScalar(values, fv, tag); err != nil {
+			return fmt.Errorf("encode field %v failed:%v", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// addQueryScalar 将单个值转为字符串追加到values，nil指针不输出
+func addQueryScalar(values url.Values, fv reflect.Value, tag urlTag) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	if fv.Type() == timeType {
+		t := fv.Interface().(time.Time)
+		if tag.unix {
+			values.Add(tag.name, strconv.FormatInt(t.Unix(), 10))
+		} else {
+			values.Add(tag.name, t.Format(time.RFC3339))
+		}
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		values.Add(tag.name, fv.String())
+	case reflect.Bool:
+		values.Add(tag.name, strconv.FormatBool(fv.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		values.Add(tag.name, strconv.FormatInt(fv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		values.Add(tag.name, strconv.FormatUint(fv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		values.Add(tag.name, strconv.FormatFloat(fv.Float(), 'f', -1, fv.Type().Bits()))
+	default:
+		return fmt.Errorf("unsupported field type %v", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package nhr
+
+import (
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+type QueryPage struct {
+	Page int `url:"page"`
+}
+
+// queryRoundTrip 覆盖ParseQueryInto支持的所有标量和切片类型
+type queryRoundTrip struct {
+	QueryPage
+	Name    string   `url:"name"`
+	Tags    []string `url:"tag"`
+	Active  bool     `url:"active"`
+	Small   int8     `url:"small"`
+	Count   int64    `url:"count"`
+	Size    uint32   `url:"size"`
+	Ratio   float64  `url:"ratio"`
+	Weights []float32
+	Limit   *int   `url:"limit"`
+	Note    string `url:"note,omitempty"`
+	Skipped string `url:"-"`
+}
+
+func TestEncodeParseQueryRoundTrip(t *testing.T) {
+	roundTrip := func(in queryRoundTrip) bool {
+		in.Skipped = ""
+		if len(in.Tags) == 0 {
+			in.Tags = nil
+		}
+		if len(in.Weights) == 0 {
+			in.Weights = nil
+		}
+		values, err := EncodeQuery(in)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		var out queryRoundTrip
+		if err := ParseQueryInto(values.Encode(), &out); err != nil {
+			t.Log(err)
+			return false
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Logf("encoded %v\nin  %+v\nout %+v", values.Encode(), in, out)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 500}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeParseQueryTimeRoundTrip(t *testing.T) {
+	type window struct {
+		From time.Time  `url:"from"`
+		To   *time.Time `url:"to,unix"`
+	}
+	to := time.Unix(1700000000, 0)
+	in := window{From: time.Date(2024, 3, 1, 8, 30, 0, 0, time.FixedZone("CST", 8*3600)), To: &to}
+	values, err := EncodeQuery(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values.Get("to") != "1700000000" {
+		t.Fatalf("unix time encoded as %q", values.Get("to"))
+	}
+	var out window
+	if err := ParseQueryInto("?"+values.Encode(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.From.Equal(in.From) || !out.To.Equal(*in.To) {
+		t.Fatalf("round trip = %+v, want %+v", out, in)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	if _, err := ParseQuery("a=%zz"); err == nil {
+		t.Fatal("ParseQuery should reject invalid escapes")
+	}
+	values, err := ParseQuery("?a=1&a=2&b=")
+	if err != nil || len(values["a"]) != 2 || values["b"][0] != "" {
+		t.Fatalf("ParseQuery = %v, %v", values, err)
+	}
+
+	var out queryRoundTrip
+	if err := ParseQueryInto("count=abc", &out); err == nil {
+		t.Fatal("ParseQueryInto should reject a non-numeric value for an int field")
+	}
+	if err := ParseQueryInto("count=1", out); err == nil {
+		t.Fatal("ParseQueryInto should require a pointer")
+	}
+}
@@ -0,0 +1,125 @@
+package nhr
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull 等待in-flight名额的请求数已经达到WithQueue设置的上限，请求被直接拒绝
+var ErrQueueFull = errors.New("request queue full")
+
+// QueueFullError 请求被拒绝时的排队情况，errors.Is(err, ErrQueueFull)返回true
+type QueueFullError struct {
+	// Depth 拒绝时正在排队的请求数
+	Depth int
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("%v: %v requests waiting", ErrQueueFull, e.Depth)
+}
+
+func (e *QueueFullError) Is(target error) bool {
+	return target == ErrQueueFull
+}
+
+// WithMaxInFlight 同时进行的请求最多为n个，响应body关闭之后才释放名额，超出的请求按先后顺序等待
+// n个名额由同一个Option的所有请求共享，通常在NewClient时设置；等待时间计入ctx和整体超时
+// n小于1时不限制并发，也可以用于单次请求取消Client设置的限制
+func WithMaxInFlight(n int) Option {
+	var limiter *inFlightLimiter
+	if n >= 1 {
+		limiter = &inFlightLimiter{slots: n}
+	}
+	return func(req *HttpRequests) {
+		req.inFlight = limiter
+	}
+}
+
+// WithQueue 与WithMaxInFlight一起使用，最多maxWaiting个请求等待名额，超出时立即返回*QueueFullError
+// 默认不限制等待的请求数，maxWaiting为0时名额用完就拒绝
+func WithQueue(maxWaiting int) Option {
+	return func(req *HttpRequests) {
+		req.MaxQueued = maxWaiting
+	}
+}
+
+// RequestQueueWait 返回响应对应的请求等待in-flight名额的时间，没有排队时为0
+func RequestQueueWait(responseIns *http.Response) time.Duration {
+	if responseIns == nil || responseIns.Request == nil {
+		return 0
+	}
+	return queueWaitOf(responseIns.Request.Context())
+}
+
+type queueWaitContextKey struct{}
+
+func queueWaitOf(ctx context.Context) time.Duration {
+	wait, _ := ctx.Value(queueWaitContextKey{}).(time.Duration)
+	return wait
+}
+
+// inFlightLimiter 限制进行中的请求数，等待的请求按FIFO顺序获得名额
+type inFlightLimiter struct {
+	slots int
+
+	mu      sync.Mutex
+	active  int
+	waiters list.List
+}
+
+// acquire 获取一个名额并返回等待的时间，maxWaiting小于0时不限制排队的请求数
+// ctx结束时从队列中移除，返回ctx.Err()
+func (l *inFlightLimiter) acquire(ctx context.Context, maxWaiting int) (time.Duration, error) {
+	l.mu.Lock()
+	if l.active < l.slots && l.waiters.Len() == 0 {
+		l.active++
+		l.mu.Unlock()
+		return 0, nil
+	}
+	if maxWaiting >= 0 && l.waiters.Len() >= maxWaiting {
+		depth := l.waiters.Len()
+		l.mu.Unlock()
+		return 0, &QueueFullError{Depth: depth}
+	}
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	start := timeNow()
+	select {
+	case <-ready:
+		return timeNow().Sub(start), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		select {
+		case <-ready:
+			// 取消的同时拿到了名额，交给下一个等待的请求
+			l.releaseLocked()
+		default:
+			l.waiters.Remove(elem)
+		}
+		l.mu.Unlock()
+		return 0, fmt.Errorf("wait for in-flight slot error:%w", ctx.Err())
+	}
+}
+
+// release 释放名额，有请求在等待时直接转交给最早的请求
+func (l *inFlightLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked()
+}
+
+func (l *inFlightLimiter) releaseLocked() {
+	if front := l.waiters.Front(); front != nil {
+		l.waiters.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	l.active--
+}
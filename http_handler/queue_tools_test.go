@@ -0,0 +1,183 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// waitForWaiters 等待排队的请求数达到n
+func waitForWaiters(t *testing.T, l *inFlightLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		got := l.waiters.Len()
+		l.mu.Unlock()
+		if got == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("waiters did not reach %v", n)
+}
+
+func TestInFlightLimiterFIFO(t *testing.T) {
+	l := &inFlightLimiter{slots: 1}
+	if _, err := l.acquire(context.Background(), -1); err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			if _, err := l.acquire(context.Background(), -1); err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+		}(i)
+		waitForWaiters(t, l, i+1)
+	}
+	for want := 0; want < 3; want++ {
+		l.release()
+		if got := <-order; got != want {
+			t.Fatalf("waiter %v got the slot, want %v", got, want)
+		}
+	}
+	l.release()
+	if l.active != 0 {
+		t.Fatalf("active = %v after releasing every slot", l.active)
+	}
+}
+
+func TestInFlightLimiterQueueFull(t *testing.T) {
+	l := &inFlightLimiter{slots: 1}
+	l.acquire(context.Background(), 1)
+	go l.acquire(context.Background(), 1)
+	waitForWaiters(t, l, 1)
+
+	_, err := l.acquire(context.Background(), 1)
+	var full *QueueFullError
+	if !errors.As(err, &full) || full.Depth != 1 || !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("error = %v, want QueueFullError with depth 1", err)
+	}
+}
+
+func TestInFlightLimiterCancelWhileQueued(t *testing.T) {
+	l := &inFlightLimiter{slots: 1}
+	l.acquire(context.Background(), -1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := l.acquire(ctx, -1)
+		errs <- err
+	}()
+	waitForWaiters(t, l, 1)
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("error = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("canceled waiter did not return")
+	}
+	waitForWaiters(t, l, 0)
+
+	// 取消的请求没有占用名额
+	l.release()
+	if wait, err := l.acquire(context.Background(), 0); err != nil || wait != 0 {
+		t.Fatalf("acquire after cancel = %v, %v", wait, err)
+	}
+}
+
+func TestClientMaxInFlightWithQueue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithMaxInFlight(1), WithQueue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	// body没有关闭时一直占用名额
+	first, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := make(chan *http.Response, 1)
+	go func() {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Error(err)
+		}
+		queued <- response
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("third request error = %v, want ErrQueueFull", err)
+	}
+	first.Body.Close()
+	second := <-queued
+	if second == nil {
+		t.Fatal("queued request failed")
+	}
+	defer second.Body.Close()
+	if wait := RequestQueueWait(second); wait < 40*time.Millisecond {
+		t.Fatalf("RequestQueueWait = %v, want the time spent queued", wait)
+	}
+	if wait := RequestQueueWait(first); wait != 0 {
+		t.Fatalf("RequestQueueWait of the first request = %v, want 0", wait)
+	}
+}
+
+func TestMaxInFlightBelowOneIsUnlimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	for _, n := range []int{0, -1} {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		var responses []*http.Response
+		// body都没有关闭，有名额限制时第二个请求会一直等待
+		for i := 0; i < 3; i++ {
+			response, err := Get(server.URL, WithMaxInFlight(n), WithContext(ctx))
+			if err != nil {
+				t.Fatalf("WithMaxInFlight(%v) request %v error = %v, want no limit", n, i, err)
+			}
+			responses = append(responses, response)
+		}
+		for _, response := range responses {
+			response.Body.Close()
+		}
+		cancel()
+	}
+
+	// 单次请求的WithMaxInFlight(0)取消Client的限制
+	client, err := NewClient(WithMaxInFlight(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	first, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Body.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	second, err := client.Get(server.URL, WithMaxInFlight(0), WithContext(ctx))
+	if err != nil {
+		t.Fatalf("error = %v, want the client limit lifted for this request", err)
+	}
+	second.Body.Close()
+}
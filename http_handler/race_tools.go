@@ -0,0 +1,79 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// WithRaceStagger 设置Race中相邻端点的启动间隔，第i个端点延迟i*delay发起请求
+// 在此之前已经有端点成功时，后面的端点不再发起请求
+func WithRaceStagger(delay time.Duration) Option {
+	return func(req *HttpRequests) {
+		req.RaceStagger = delay
+	}
+}
+
+type raceResult struct {
+	index    int
+	response *Response
+	err      error
+}
+
+// Race 使用DefaultClient对多个端点发起同一个请求，见Client.Race
+func Race(ctx context.Context, urls []string, options ...Option) (*Response, error) {
+	return DefaultClient.Race(ctx, urls, options...)
+}
+
+// Race 对多个提供相同数据的端点并发发起同一个请求，返回第一个读完body的2xx响应(可以通过WithExpectStatus修改)，并取消其余请求
+// 请求方法默认为GET，可以通过WithMethod修改；胜出的端点可以通过Response.FinalURL获取
+// 端点返回其他状态码时该端点的错误为*StatusError；其余端点的响应body在后台读完并关闭
+// 只有所有端点都失败时才返回错误，错误类型为*BatchError，Index与传入的urls一一对应
+func (c *Client) Race(ctx context.Context, urls []string, options ...Option) (*Response, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("race requires at least one url")
+	}
+	results := make(chan raceResult, len(urls))
+	cancels := make([]context.CancelFunc, len(urls))
+	for i, u := range urls {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		go func(i int, u string) {
+			defer cancel()
+			stagger := c.newRequest(http.MethodGet, u, c.defaults, options).RaceStagger
+			if delay := time.Duration(i) * stagger; delay > 0 {
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-attemptCtx.Done():
+					timer.Stop()
+					results <- raceResult{index: i, err: attemptCtx.Err()}
+					return
+				}
+			}
+			// Fetch读完并关闭body，被取消的端点读取失败时同样关闭
+			response, err := c.Fetch(http.MethodGet, u, append(append([]Option(nil), options...), WithContext(attemptCtx))...)
+			if err != nil {
+				response = nil
+			}
+			results <- raceResult{index: i, response: response, err: err}
+		}(i, u)
+	}
+
+	errs := make([]*BatchItemError, len(urls))
+	for received := 0; received < len(urls); received++ {
+		result := <-results
+		if result.err != nil {
+			errs[result.index] = &BatchItemError{Index: result.index, URL: redactSecrets(urls[result.index]), Attempts: attemptsOf(result.err), Err: result.err}
+			continue
+		}
+		for i, cancel := range cancels {
+			if i != result.index {
+				cancel()
+			}
+		}
+		return result.response, nil
+	}
+	return nil, &BatchError{Total: len(urls), Errors: errs}
+}
@@ -0,0 +1,124 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRaceReturnsFirstSuccess(t *testing.T) {
+	var slowClosed int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			atomic.StoreInt32(&slowClosed, 1)
+		case <-time.After(time.Second):
+			w.Write([]byte("slow"))
+		}
+	}))
+	defer slow.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	response, err := Race(context.Background(), []string{slow.URL, failing.URL, fast.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.String() != "fast" || response.FinalURL() != fast.URL {
+		t.Fatalf("winner = %q from %v", response.String(), response.FinalURL())
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&slowClosed) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if atomic.LoadInt32(&slowClosed) == 0 {
+		t.Fatal("losing request was not canceled")
+	}
+}
+
+func TestRaceAllFail(t *testing.T) {
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing", http.StatusNotFound)
+	}))
+	defer notFound.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	_, err := Race(context.Background(), []string{notFound.URL, unavailable.URL})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+		t.Fatalf("error = %v, want *BatchError for both endpoints", err)
+	}
+	for i, want := range []int{http.StatusNotFound, http.StatusServiceUnavailable} {
+		var statusErr *StatusError
+		if !errors.As(batchErr.Errors[i].Err, &statusErr) || statusErr.StatusCode != want || len(statusErr.Body) == 0 {
+			t.Fatalf("endpoint %v error = %v, want *StatusError %v with body", i, batchErr.Errors[i].Err, want)
+		}
+	}
+}
+
+func TestRaceStaggerSkipsLaterEndpoints(t *testing.T) {
+	var second int32
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+	}))
+	defer first.Close()
+	later := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&second, 1)
+	}))
+	defer later.Close()
+
+	response, err := Race(context.Background(), []string{first.URL, later.URL}, WithRaceStagger(200*time.Millisecond))
+	if err != nil || response.String() != "first" {
+		t.Fatalf("Race = %v, %v", response, err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if atomic.LoadInt32(&second) != 0 {
+		t.Fatal("staggered endpoint was requested after the first one won")
+	}
+}
+
+func TestClientRace(t *testing.T) {
+	server, got := headerServer(t)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "denied", http.StatusForbidden)
+	}))
+	defer failing.Close()
+
+	client, err := NewClient(WithHeader("X-Tenant", "acme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	response, err := client.Race(context.Background(), []string{server.URL}, WithMethod(http.MethodPut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*got).Header.Get("X-Tenant") != "acme" || (*got).Method != http.MethodPut || response.FinalURL() != server.URL {
+		t.Fatalf("request = %v %v, want the client defaults and the request method", (*got).Method, (*got).Header)
+	}
+
+	// 失败端点的URL中的敏感参数被替换
+	_, err = client.Race(context.Background(), []string{failing.URL + "/?access_token=s3cret", failing.URL + "/b"})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+		t.Fatalf("error = %v, want *BatchError for both endpoints", err)
+	}
+	if item := batchErr.Errors[0]; strings.Contains(item.URL, "s3cret") || strings.Contains(err.Error(), "s3cret") || item.Attempts != 1 {
+		t.Fatalf("item = %+v, error = %v, want the secret query value redacted", item, err)
+	}
+}
@@ -0,0 +1,200 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitHeaderSet 服务端返回配额信息使用的响应头名称
+type RateLimitHeaderSet struct {
+	Limit     string
+	Remaining string
+	// Reset 配额重置的时间，支持Unix时间戳(秒)和距离现在的秒数两种格式，大于10亿时按时间戳解析
+	Reset string
+}
+
+// GitHubRateLimitHeaders GitHub等API使用的X-RateLimit-*响应头
+var GitHubRateLimitHeaders = RateLimitHeaderSet{
+	Limit:     "X-RateLimit-Limit",
+	Remaining: "X-RateLimit-Remaining",
+	Reset:     "X-RateLimit-Reset",
+}
+
+// StandardRateLimitHeaders IETF草案中的RateLimit-*响应头，Reset为秒数
+var StandardRateLimitHeaders = RateLimitHeaderSet{
+	Limit:     "RateLimit-Limit",
+	Remaining: "RateLimit-Remaining",
+	Reset:     "RateLimit-Reset",
+}
+
+// epochResetThreshold Reset的值大于它时按Unix时间戳解析，否则按秒数解析
+const epochResetThreshold = 1_000_000_000
+
+// ErrRateLimitExhausted 配额已经用完，ctx的截止时间早于配额重置的时间
+var ErrRateLimitExhausted = errors.New("rate limit quota exhausted")
+
+// RateLimitState 某个host最近一次响应中的配额信息，Limit未知时为-1
+type RateLimitState struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	// Updated 收到这些配额信息的时间
+	Updated time.Time
+}
+
+// RateLimitCollector 可选的监控接口，MetricsCollector同时实现它时，通过WithMetrics接收配额的变化
+type RateLimitCollector interface {
+	RateLimitUpdated(host string, state RateLimitState)
+}
+
+// WithAdaptiveRateLimit 按响应头中的剩余配额调整发送速度，请求在重置之前的时间内均匀发出，配额用完时暂停到重置
+// 需要等待的时间超过ctx的截止时间时直接返回ErrRateLimitExhausted，不再等待
+// 配额按host分别记录，同一个Option的所有请求共享配额，通常在NewClient时设置，之后通过Client.RateLimitState查询
+func WithAdaptiveRateLimit(headers RateLimitHeaderSet) Option {
+	limiter := &adaptiveLimiter{headers: headers, hosts: map[string]*hostQuota{}}
+	return func(req *HttpRequests) {
+		req.rateLimiter = limiter
+		req.Middlewares = append(append([]Middleware(nil), req.Middlewares...), limiter.middleware(req))
+	}
+}
+
+// RateLimitState 返回host最近一次的配额信息，Client没有设置WithAdaptiveRateLimit或者还没有收到配额信息时返回false
+func (c *Client) RateLimitState(host string) (RateLimitState, bool) {
+	if c.rateLimiter == nil {
+		return RateLimitState{}, false
+	}
+	return c.rateLimiter.state(host)
+}
+
+// adaptiveLimiter 按host记录配额并安排请求发出的时间
+type adaptiveLimiter struct {
+	headers RateLimitHeaderSet
+
+	mu    sync.Mutex
+	hosts map[string]*hostQuota
+}
+
+type hostQuota struct {
+	state RateLimitState
+	// next 下一个请求最早可以发出的时间
+	next time.Time
+}
+
+func (l *adaptiveLimiter) middleware(requestIns *HttpRequests) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if !requestIns.NoRateLimit {
+				if err := l.wait(req.Context(), req.URL.Host); err != nil {
+					return nil, err
+				}
+			}
+			response, err := next(req)
+			if err == nil && response != nil {
+				if state, ok := l.update(req.URL.Host, response.Header); ok {
+					requestIns.reportRateLimit(req.URL.Host, state)
+				}
+			}
+			return response, err
+		}
+	}
+}
+
+// wait 预留host的下一个发送时间并等待，剩余配额分摊到重置之前的时间内
+func (l *adaptiveLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	quota, ok := l.hosts[host]
+	now := timeNow()
+	if !ok || !now.Before(quota.state.Reset) {
+		// 没有配额信息或者已经过了重置时间，等待下一个响应更新配额
+		l.mu.Unlock()
+		return nil
+	}
+	slot := quota.next
+	if slot.Before(now) {
+		slot = now
+	}
+	if quota.state.Remaining <= 0 {
+		slot = quota.state.Reset
+	} else {
+		quota.next = slot.Add(quota.state.Reset.Sub(now) / time.Duration(quota.state.Remaining))
+		quota.state.Remaining--
+	}
+	reset := quota.state.Reset
+	l.mu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(slot) {
+		return fmt.Errorf("%w: %v resets at %v", ErrRateLimitExhausted, host, reset.Format(time.RFC3339))
+	}
+	return sleepContext(ctx, slot.Sub(now))
+}
+
+// update 按响应头更新host的配额，响应中没有Remaining和Reset时返回false
+func (l *adaptiveLimiter) update(host string, header http.Header) (RateLimitState, bool) {
+	state, ok := parseRateLimit(l.headers, header, timeNow())
+	if !ok {
+		return RateLimitState{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	quota, exists := l.hosts[host]
+	if !exists {
+		quota = &hostQuota{}
+		l.hosts[host] = quota
+	}
+	quota.state = state
+	return state, true
+}
+
+func (l *adaptiveLimiter) state(host string) (RateLimitState, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	quota, ok := l.hosts[host]
+	if !ok {
+		return RateLimitState{}, false
+	}
+	return quota.state, true
+}
+
+// parseRateLimit 解析配额响应头，Remaining或Reset缺失、不合法时返回false
+func parseRateLimit(headers RateLimitHeaderSet, header http.Header, now time.Time) (RateLimitState, bool) {
+	remaining, err := strconv.Atoi(strings.TrimSpace(header.Get(headers.Remaining)))
+	if err != nil || remaining < 0 {
+		return RateLimitState{}, false
+	}
+	reset, ok := parseRateLimitReset(header.Get(headers.Reset), now)
+	if !ok {
+		return RateLimitState{}, false
+	}
+	limit := -1
+	if n, err := strconv.Atoi(strings.TrimSpace(header.Get(headers.Limit))); err == nil && n >= 0 {
+		limit = n
+	}
+	return RateLimitState{Limit: limit, Remaining: remaining, Reset: reset, Updated: now}, true
+}
+
+// parseRateLimitReset 解析重置时间，大于epochResetThreshold时按Unix时间戳，否则按距离now的秒数
+func parseRateLimitReset(value string, now time.Time) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, false
+	}
+	if seconds > epochResetThreshold {
+		return time.Unix(seconds, 0), true
+	}
+	return now.Add(time.Duration(seconds) * time.Second), true
+}
+
+// reportRateLimit 将配额的变化上报给实现了RateLimitCollector的监控
+func (r *HttpRequests) reportRateLimit(host string, state RateLimitState) {
+	for _, collector := range r.collectors {
+		if c, ok := collector.(RateLimitCollector); ok {
+			c.RateLimitUpdated(host, state)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitReset(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"30", now.Add(30 * time.Second), true},
+		{"0", now, true},
+		{"1700000060", time.Unix(1_700_000_060, 0), true},
+		{" 1700000060 ", time.Unix(1_700_000_060, 0), true},
+		{"", time.Time{}, false},
+		{"-1", time.Time{}, false},
+		{"soon", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRateLimitReset(tt.value, now)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseRateLimitReset(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	header := http.Header{}
+	header.Set("X-RateLimit-Remaining", "42")
+	header.Set("X-RateLimit-Reset", "60")
+	state, ok := parseRateLimit(GitHubRateLimitHeaders, header, now)
+	if !ok || state.Remaining != 42 || state.Limit != -1 || !state.Reset.Equal(now.Add(time.Minute)) {
+		t.Fatalf("state = %+v, %v", state, ok)
+	}
+	header.Set("X-RateLimit-Limit", "5000")
+	if state, _ := parseRateLimit(GitHubRateLimitHeaders, header, now); state.Limit != 5000 {
+		t.Fatalf("Limit = %v, want 5000", state.Limit)
+	}
+	if _, ok := parseRateLimit(StandardRateLimitHeaders, header, now); ok {
+		t.Fatal("headers of another set should not be parsed")
+	}
+}
+
+// quotaServer 每个响应都返回remaining和距离重置的秒数
+func quotaServer(t *testing.T, remaining, resetSeconds int) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(resetSeconds))
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+// rateLimitRecorder 记录RateLimitUpdated收到的配额
+type rateLimitRecorder struct {
+	mu     sync.Mutex
+	states []RateLimitState
+}
+
+func (r *rateLimitRecorder) RequestStarted(string, string)   {}
+func (r *rateLimitRecorder) RequestFinished(*RequestMetrics) {}
+func (r *rateLimitRecorder) RateLimitUpdated(_ string, state RateLimitState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, state)
+}
+
+func TestAdaptiveRateLimitStateOnClient(t *testing.T) {
+	server, _ := quotaServer(t, 7, 60)
+	recorder := &rateLimitRecorder{}
+	client, err := NewClient(WithMetrics(recorder), WithAdaptiveRateLimit(GitHubRateLimitHeaders))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	host := mustHost(t, server.URL)
+	if _, ok := client.RateLimitState(host); ok {
+		t.Fatal("state should be unknown before the first response")
+	}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	state, ok := client.RateLimitState(host)
+	if !ok || state.Remaining != 7 || state.Limit != 100 {
+		t.Fatalf("state = %+v, %v", state, ok)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.states) != 1 || recorder.states[0].Remaining != 7 {
+		t.Fatalf("collector received %+v", recorder.states)
+	}
+}
+
+func TestAdaptiveRateLimitPausesWhenExhausted(t *testing.T) {
+	server, hits := quotaServer(t, 0, 1)
+	client, err := NewClient(WithAdaptiveRateLimit(GitHubRateLimitHeaders))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	// 截止时间早于重置时间时不等待
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.Get(server.URL, WithContext(ctx))
+	if !errors.Is(err, ErrRateLimitExhausted) {
+		t.Fatalf("error = %v, want ErrRateLimitExhausted", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("waited %v although the deadline is before the reset", elapsed)
+	}
+
+	// 没有截止时间时暂停到重置
+	start = time.Now()
+	response, err = client.Get(server.URL, WithTimeout(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Fatalf("request sent after %v, want a pause until reset", elapsed)
+	}
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Fatalf("server received %v requests, want 2", n)
+	}
+}
+
+func TestAdaptiveRateLimitSpreadsRemaining(t *testing.T) {
+	// 剩余10个请求、1秒后重置，请求之间大约间隔100ms
+	server, _ := quotaServer(t, 10, 1)
+	client, err := NewClient(WithAdaptiveRateLimit(GitHubRateLimitHeaders))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("3 requests took %v, want them spread across the window", elapsed)
+	}
+}
+
+func mustHost(t *testing.T, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
@@ -0,0 +1,132 @@
+package nhr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrTooManyRedirects 重定向次数超过了上限
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// defaultMaxRedirects 与net/http的默认策略一致，最多发送10次请求
+const defaultMaxRedirects = 10
+
+// RedirectHop 重定向链中的一跳，Location为3xx响应指向的地址，URL和Location中的敏感参数会被替换为***
+type RedirectHop struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Location   string
+}
+
+// WithNoRedirect 不跟随重定向，直接返回3xx响应
+func WithNoRedirect() Option {
+	return func(req *HttpRequests) {
+		req.NoRedirect = true
+	}
+}
+
+// WithMaxRedirects 最多跟随n次重定向，超过时返回的错误满足errors.Is(err, ErrTooManyRedirects)，n小于等于0时等同于WithNoRedirect
+func WithMaxRedirects(n int) Option {
+	return func(req *HttpRequests) {
+		req.MaxRedirects = n
+		req.NoRedirect = n <= 0
+	}
+}
+
+// WithRedirectPolicy 自定义重定向策略，与http.Client.CheckRedirect相同，返回http.ErrUseLastResponse时直接返回3xx响应
+// URLPolicy、次数上限和生产环境写保护在policy之前检查
+func WithRedirectPolicy(policy func(req *http.Request, via []*http.Request) error) Option {
+	return func(req *HttpRequests) {
+		req.RedirectPolicy = policy
+	}
+}
+
+// unfollowedBodyRedirect 307、308需要重新发送body，body不能重新读取时net/http不会跟随，直接返回了3xx响应
+func unfollowedBodyRedirect(requestIns *HttpRequests, response *http.Response) bool {
+	if requestIns.NoRedirect || requestIns.source != nil || response.Header.Get("Location") == "" {
+		return false
+	}
+	return response.StatusCode == http.StatusTemporaryRedirect || response.StatusCode == http.StatusPermanentRedirect
+}
+
+// guardRedirects 返回按请求的重定向设置检查重定向的client，与原client共用transport
+func guardRedirects(client *http.Client, requestIns *HttpRequests) *http.Client {
+	production := !requestIns.AllowProductionWrites && len(requestIns.ProductionHosts) > 0
+	perHost := !requestIns.hostDefaults.empty()
+	if !production && !perHost && requestIns.URLPolicy == nil && !requestIns.NoRedirect && requestIns.MaxRedirects == 0 && requestIns.RedirectPolicy == nil {
+		return client
+	}
+	guarded := *client
+	checkRedirect := client.CheckRedirect
+	guarded.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if requestIns.NoRedirect {
+			return http.ErrUseLastResponse
+		}
+		// 重定向的每一跳都按URLPolicy校验，避免被重定向到不允许访问的地址
+		if requestIns.URLPolicy != nil {
+			if err := ValidateURL(req.URL.String(), *requestIns.URLPolicy); err != nil {
+				return err
+			}
+		}
+		if production {
+			if err := checkProductionWrite(requestIns, req.Method, req.URL.Hostname(), true); err != nil {
+				return err
+			}
+		}
+		// via包含最初的请求，跟随第n次重定向时len(via)为n
+		if requestIns.MaxRedirects > 0 && len(via) > requestIns.MaxRedirects {
+			return fmt.Errorf("stopped after %v redirects:%w", requestIns.MaxRedirects, ErrTooManyRedirects)
+		}
+		if requestIns.MaxRedirects <= 0 && len(via) >= defaultMaxRedirects {
+			return fmt.Errorf("stopped after %v redirects:%w", defaultMaxRedirects, ErrTooManyRedirects)
+		}
+		if perHost {
+			requestIns.hostDefaults.applyRedirect(req, via[len(via)-1])
+		}
+		if requestIns.RedirectPolicy != nil {
+			return requestIns.RedirectPolicy(req, via)
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		return nil
+	}
+	return &guarded
+}
+
+// RedirectChain 返回得到该响应之前经过的重定向，按先后顺序排列，没有重定向时返回nil
+func RedirectChain(responseIns *http.Response) []*RedirectHop {
+	var hops []*RedirectHop
+	if responseIns.Request == nil {
+		return nil
+	}
+	for previous := responseIns.Request.Response; previous != nil; {
+		hop := &RedirectHop{StatusCode: previous.StatusCode, Location: redactSecrets(previous.Header.Get("Location"))}
+		if previous.Request == nil {
+			hops = append(hops, hop)
+			break
+		}
+		hop.Method, hop.URL = previous.Request.Method, redactSecrets(previous.Request.URL.String())
+		hops = append(hops, hop)
+		previous = previous.Request.Response
+	}
+	for i, j := 0, len(hops)-1; i < j; i, j = i+1, j-1 {
+		hops[i], hops[j] = hops[j], hops[i]
+	}
+	return hops
+}
+
+// Redirects 返回得到该响应之前经过的重定向，见RedirectChain
+func (r *Response) Redirects() []*RedirectHop {
+	return RedirectChain(r.raw)
+}
+
+// FinalURL 跟随重定向之后最终请求的URL
+func (r *Response) FinalURL() string {
+	if r.raw.Request == nil {
+		return ""
+	}
+	return r.raw.Request.URL.String()
+}
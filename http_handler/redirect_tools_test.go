@@ -0,0 +1,152 @@
+package nhr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// redirectServer /hop/n以302重定向到/hop/n-1，/hop/0返回200，/post以307重定向到target
+func redirectServer(t *testing.T, target string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/post" {
+			http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/hop/%v?token=abc", n-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRedirectLimits(t *testing.T) {
+	server := redirectServer(t, "")
+	tests := []struct {
+		name    string
+		hops    int
+		options []Option
+		status  int
+		// tooMany 没有设置重定向选项时由net/http报错，不一定满足ErrTooManyRedirects
+		tooMany bool
+	}{
+		{name: "default follows", hops: 3, status: http.StatusOK},
+		{name: "default follows nine", hops: 9, status: http.StatusOK},
+		{name: "default limit", hops: 10, tooMany: true},
+		{name: "no redirect", hops: 3, options: []Option{WithNoRedirect()}, status: http.StatusFound},
+		{name: "max redirects reached", hops: 3, options: []Option{WithMaxRedirects(2)}, tooMany: true},
+		{name: "max redirects enough", hops: 3, options: []Option{WithMaxRedirects(3)}, status: http.StatusOK},
+		{name: "max redirects zero", hops: 3, options: []Option{WithMaxRedirects(0)}, status: http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := Get(fmt.Sprintf("%v/hop/%v", server.URL, tt.hops), tt.options...)
+			if tt.tooMany {
+				if err == nil || !strings.Contains(err.Error(), "stopped after") {
+					t.Fatalf("error = %v, want the redirect limit error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != tt.status {
+				t.Fatalf("status = %v, want %v", response.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	server := redirectServer(t, "")
+	var seen int
+	response, err := Get(server.URL+"/hop/3", WithRedirectPolicy(func(req *http.Request, via []*http.Request) error {
+		if seen++; len(via) == 2 {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound || seen != 2 || response.Request.URL.Path != "/hop/2" {
+		t.Fatalf("status = %v at %v after %v checks, want the policy to stop at the second hop", response.StatusCode, response.Request.URL.Path, seen)
+	}
+
+	// 次数上限在自定义策略之前检查
+	errDenied := errors.New("denied")
+	_, err = Get(server.URL+"/hop/3", WithMaxRedirects(1), WithRedirectPolicy(func(req *http.Request, via []*http.Request) error {
+		if len(via) > 1 {
+			return errDenied
+		}
+		return nil
+	}))
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("error = %v, want the limit checked first", err)
+	}
+	if _, err := Get(server.URL+"/hop/1", WithRedirectPolicy(func(*http.Request, []*http.Request) error { return errDenied })); !errors.Is(err, errDenied) {
+		t.Fatalf("error = %v, want the policy error", err)
+	}
+}
+
+func TestRedirectToProductionHostBlocked(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(target.Close)
+	production := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+	server := redirectServer(t, production+"/orders")
+
+	_, err := Post(server.URL+"/post", WithProductionHostBlocklist("localhost"))
+	var writeErr *ProductionWriteError
+	if !errors.As(err, &writeErr) || !writeErr.Redirect || writeErr.Host != "localhost" || !errors.Is(err, ErrProductionWriteBlocked) {
+		t.Fatalf("error = %v, want the redirect to the production host blocked", err)
+	}
+	response, err := Post(server.URL+"/post", WithProductionHostBlocklist("localhost"), WithAllowProductionWrites())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want the write allowed explicitly", response.StatusCode)
+	}
+}
+
+func TestRedirectChain(t *testing.T) {
+	server := redirectServer(t, "")
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Fetch(http.MethodGet, server.URL+"/hop/2?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hops := response.Redirects()
+	if len(hops) != 2 {
+		t.Fatalf("hops = %+v, want 2", hops)
+	}
+	first := hops[0]
+	if first.Method != http.MethodGet || first.StatusCode != http.StatusFound || first.URL != server.URL+"/hop/2?token=***" || first.Location != "/hop/1?token=***" {
+		t.Fatalf("first hop = %+v, want the secrets redacted", first)
+	}
+	if hops[1].URL != server.URL+"/hop/1?token=***" || response.FinalURL() != server.URL+"/hop/0?token=abc" {
+		t.Fatalf("second hop = %+v, final url = %v", hops[1], response.FinalURL())
+	}
+
+	response, err = client.Fetch(http.MethodGet, server.URL+"/hop/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hops := response.Redirects(); hops != nil {
+		t.Fatalf("hops = %+v, want nil without redirects", hops)
+	}
+}
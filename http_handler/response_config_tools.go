@@ -0,0 +1,47 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+)
+
+// responseConfig 保存在请求context中，供解析响应的函数使用的配置
+// declaredType、sniffedType在返回响应之前写入，之后只读
+type responseConfig struct {
+	businessCheck BusinessErrorCheck
+	businessRule  *BusinessCodeRule
+
+	expectStatus []int
+
+	contentSniffing bool
+	declaredType    string
+	sniffedType     string
+
+	jsonCodec JSONCodec
+}
+
+type responseConfigContextKey struct{}
+
+// contextWithResponseConfig 将解析响应需要的配置存入context，没有配置时原样返回
+func contextWithResponseConfig(ctx context.Context, requestIns *HttpRequests) context.Context {
+	if requestIns.BusinessErrorCheck == nil && requestIns.BusinessCodeRule == nil && !requestIns.ContentSniffing && len(requestIns.ExpectStatus) == 0 && requestIns.JSONCodec == DefaultJSONCodec {
+		return ctx
+	}
+	return context.WithValue(ctx, responseConfigContextKey{}, &responseConfig{
+		businessCheck:   requestIns.BusinessErrorCheck,
+		businessRule:    requestIns.BusinessCodeRule,
+		expectStatus:    requestIns.ExpectStatus,
+		contentSniffing: requestIns.ContentSniffing,
+		jsonCodec:       requestIns.JSONCodec,
+	})
+}
+
+// responseConfigOf 获取响应对应请求的配置，没有时返回零值
+func responseConfigOf(responseIns *http.Response) *responseConfig {
+	if responseIns.Request != nil {
+		if config, ok := responseIns.Request.Context().Value(responseConfigContextKey{}).(*responseConfig); ok {
+			return config
+		}
+	}
+	return &responseConfig{}
+}
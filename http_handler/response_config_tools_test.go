@@ -0,0 +1,28 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestResponseConfig(t *testing.T) {
+	ctx := context.Background()
+	if got := contextWithResponseConfig(ctx, newHttpRequests(http.MethodGet, "")); got != ctx {
+		t.Fatal("the context should be returned as is without response options")
+	}
+	if config := responseConfigOf(&http.Response{}); config == nil || config.contentSniffing || config.businessRule != nil {
+		t.Fatalf("config = %+v, want the zero value without a request", config)
+	}
+
+	rule := BusinessCodeRule{CodeField: "code"}
+	requestIns := newHttpRequests(http.MethodGet, "", WithBusinessCodeRule(rule), WithExpectStatus(http.StatusOK, http.StatusNotFound), WithContentSniffing())
+	req, err := http.NewRequestWithContext(contextWithResponseConfig(ctx, requestIns), http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := responseConfigOf(&http.Response{Request: req})
+	if config.businessRule == nil || config.businessRule.CodeField != "code" || len(config.expectStatus) != 2 || !config.contentSniffing {
+		t.Fatalf("config = %+v, want the request options", config)
+	}
+}
@@ -0,0 +1,122 @@
+package nhr
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Response 读取完body的响应，body只读取一次，可以多次获取
+type Response struct {
+	// raw 原始响应，Body已经读取并关闭
+	raw *http.Response
+	// ConnectionReused 请求使用了连接池中复用的连接
+	ConnectionReused bool
+
+	body []byte
+
+	// cookies 第一次调用Cookies时才解析Set-Cookie
+	cookiesOnce sync.Once
+	cookies     []*http.Cookie
+}
+
+// WithExpectStatus 设置可以接受的响应状态码，设置后2xx不再默认接受
+// Fetch、ResponseToStruct、ResponseToMap等函数遇到其他状态码时返回*StatusError
+func WithExpectStatus(codes ...int) Option {
+	return func(req *HttpRequests) {
+		req.ExpectStatus = append([]int(nil), codes...)
+	}
+}
+
+// Fetch 使用DefaultClient发起请求并读取body，见Client.Fetch
+func Fetch(method, url string, options ...Option) (*Response, error) {
+	return DefaultClient.Fetch(method, url, options...)
+}
+
+// Fetch 发起请求并读取整个body
+// 状态码不在可以接受的范围(默认为2xx，可以通过WithExpectStatus设置)时同时返回Response和*StatusError，仍然可以查看响应内容
+func (c *Client) Fetch(method, url string, options ...Option) (*Response, error) {
+	raw, err := c.HttpCaller(method, url, options...)
+	if err != nil {
+		return nil, err
+	}
+	return NewResponse(raw)
+}
+
+// NewResponse 读取raw的body并关闭，返回可以多次读取的Response
+// 状态码不在可以接受的范围时同时返回Response和*StatusError
+func NewResponse(raw *http.Response) (*Response, error) {
+	resp, err := NewResponseFrom(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !statusAccepted(raw.StatusCode, responseConfigOf(raw).expectStatus, nil) {
+		return resp, &StatusError{StatusCode: raw.StatusCode, Body: resp.body}
+	}
+	return resp, nil
+}
+
+// NewResponseFrom 包装从其他地方得到的*http.Response，例如第三方库或httptest.ResponseRecorder.Result()
+// 读取body并关闭，只有读取失败时返回错误，不按状态码判断成功与否，需要时使用IsSuccess
+func NewResponseFrom(raw *http.Response) (*Response, error) {
+	if raw == nil {
+		return nil, errors.New("new response error:nil *http.Response")
+	}
+	result, err := ReadResult(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{raw: raw, ConnectionReused: ConnectionReused(raw), body: result.Body}, nil
+}
+
+// Raw 返回原始响应，Body替换为读取已缓存内容的新Reader，可以交给需要*http.Response的代码，例如httputil.DumpResponse
+// 每次调用返回新的副本，Header和Trailer与Response共用，修改对双方都可见
+func (r *Response) Raw() *http.Response {
+	raw := *r.raw
+	raw.Body = ioutil.NopCloser(bytes.NewReader(r.body))
+	return &raw
+}
+
+// StatusCode 响应状态码
+func (r *Response) StatusCode() int {
+	return r.raw.StatusCode
+}
+
+// Headers 响应头，与原始响应共用，不会复制
+func (r *Response) Headers() http.Header {
+	return r.raw.Header
+}
+
+// Cookies 响应中Set-Cookie设置的cookie，第一次调用时才解析，之后返回同一个结果，不要修改其中的cookie
+func (r *Response) Cookies() []*http.Cookie {
+	r.cookiesOnce.Do(func() {
+		r.cookies = r.raw.Cookies()
+	})
+	return r.cookies
+}
+
+// Bytes 响应body
+func (r *Response) Bytes() []byte {
+	return r.body
+}
+
+// String 以字符串形式返回响应body
+func (r *Response) String() string {
+	return string(r.body)
+}
+
+// IsSuccess 状态码是否为2xx
+func (r *Response) IsSuccess() bool {
+	return r.raw.StatusCode >= 200 && r.raw.StatusCode < 300
+}
+
+// JSON 将body反序列化到v，设置了业务错误检查时先执行检查，body为空时不修改v
+func (r *Response) JSON(v interface{}) error {
+	config := responseConfigOf(r.raw)
+	if err := config.checkBusinessError(r.body); err != nil {
+		return err
+	}
+	return (&Result{Body: r.body, codec: config.jsonCodec}).Decode(v)
+}
@@ -0,0 +1,173 @@
+package nhr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"testing"
+)
+
+func TestResponseRawIsReReadable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Id", "42")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	response, err := Fetch(http.MethodGet, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		dump, err := httputil.DumpResponse(response.Raw(), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(dump, []byte(`{"ok":true}`)) || !bytes.Contains(dump, []byte("X-Id: 42")) {
+			t.Fatalf("dump %v = %s", i, dump)
+		}
+	}
+
+	// Header与Response共用
+	response.Raw().Header.Set("X-Added", "1")
+	if response.Headers().Get("X-Added") != "1" {
+		t.Fatal("header changes through Raw() are not visible on the Response")
+	}
+	if response.String() != `{"ok":true}` {
+		t.Fatalf("body after Raw() = %q", response.String())
+	}
+}
+
+func TestNewResponseFrom(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	recorder.WriteHeader(http.StatusNotFound)
+	recorder.WriteString(`{"error":"missing"}`)
+
+	response, err := NewResponseFrom(recorder.Result())
+	if err != nil {
+		t.Fatalf("NewResponseFrom should not judge the status: %v", err)
+	}
+	var body struct{ Error string }
+	if err := response.JSON(&body); err != nil || body.Error != "missing" || response.IsSuccess() {
+		t.Fatalf("body = %+v, err = %v, success = %v", body, err, response.IsSuccess())
+	}
+	raw, _ := ioutil.ReadAll(response.Raw().Body)
+	if !strings.Contains(string(raw), "missing") {
+		t.Fatalf("Raw body = %q", raw)
+	}
+	if _, err := NewResponseFrom(nil); err == nil {
+		t.Fatal("NewResponseFrom(nil) should fail")
+	}
+
+	// NewResponse按状态码返回*StatusError
+	request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(context.Background())
+	notFound := &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("x")), Request: request}
+	if _, err := NewResponse(notFound); err == nil {
+		t.Fatal("NewResponse should report the 404")
+	}
+}
+
+func TestResponseCookiesParsedLazily(t *testing.T) {
+	raw := &http.Response{StatusCode: http.StatusOK, Header: largeHeader(), Body: ioutil.NopCloser(strings.NewReader("ok"))}
+	response, err := NewResponseFrom(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.cookies != nil {
+		t.Fatal("Set-Cookie parsed before Cookies was called")
+	}
+	cookies := response.Cookies()
+	if len(cookies) != 200 || cookies[199].Name != "session_part_199" {
+		t.Fatalf("Cookies() returned %v cookies", len(cookies))
+	}
+	if again := response.Cookies(); &again[0] != &cookies[0] {
+		t.Fatal("Cookies should reuse the parsed result")
+	}
+	response.Headers().Set("X-Shared", "1")
+	if raw.Header.Get("X-Shared") != "1" {
+		t.Fatal("Headers should share the raw response header")
+	}
+}
+
+func BenchmarkLargeHeaderResponse(b *testing.B) {
+	header := largeHeader()
+	newRaw := func() *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(strings.NewReader("ok"))}
+	}
+	b.Run("wrap", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			response, _ := NewResponseFrom(newRaw())
+			_ = response.Headers().Get("X-Vendor-Trace-1")
+		}
+	})
+	b.Run("wrap+cookies", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			response, _ := NewResponseFrom(newRaw())
+			_ = response.Cookies()
+		}
+	})
+}
+
+func TestFetchExpectStatus(t *testing.T) {
+	server := statusPathServer(t)
+	tests := []struct {
+		path    string
+		options []Option
+		wantErr bool
+	}{
+		{path: "/200"},
+		{path: "/201"},
+		{path: "/204"},
+		{path: "/302", wantErr: true},
+		{path: "/404", wantErr: true},
+		{path: "/302", options: []Option{WithExpectStatus(http.StatusFound)}},
+		{path: "/200", options: []Option{WithExpectStatus(http.StatusFound)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		resp, err := Fetch(http.MethodGet, server.URL+tt.path, tt.options...)
+		var statusErr *StatusError
+		if tt.wantErr != errors.As(err, &statusErr) {
+			t.Fatalf("Fetch(%v) error = %v, want a StatusError: %v", tt.path, err, tt.wantErr)
+		}
+		// 状态码不被接受时依然返回Response
+		if resp == nil || resp.StatusCode() != pathStatus(tt.path) {
+			t.Fatalf("Fetch(%v) = %+v", tt.path, resp)
+		}
+	}
+}
+
+// pathStatus statusPathServer按路径返回的状态码
+func pathStatus(path string) int {
+	var status int
+	fmt.Sscanf(path, "/%d", &status)
+	return status
+}
+
+func TestResponseBodyReadMultipleTimes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":7}`))
+	}))
+	t.Cleanup(server.Close)
+	resp, err := Fetch(http.MethodGet, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first, second struct{ ID int }
+	if err := resp.JSON(&first); err != nil {
+		t.Fatal(err)
+	}
+	if err := resp.JSON(&second); err != nil || second.ID != 7 || first.ID != 7 {
+		t.Fatalf("JSON = %+v, %+v, %v", first, second, err)
+	}
+	if resp.String() != `{"id":7}` || !bytes.Equal(resp.Bytes(), []byte(`{"id":7}`)) || !resp.IsSuccess() {
+		t.Fatalf("String = %q", resp.String())
+	}
+}
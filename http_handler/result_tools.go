@@ -0,0 +1,95 @@
+package nhr
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Result 读取完body之后的响应，不检查状态码，可以用于断言4xx响应中的错误信息
+type Result struct {
+	StatusCode int
+	Headers    http.Header
+	Body       []byte
+
+	// codec Decode使用的JSON codec，ReadResult时取自请求的WithJSONCodec
+	codec JSONCodec
+}
+
+// StatusError 响应状态码不在接受范围内，Body为响应body，方便查看服务端返回的错误信息
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status code %v", e.StatusCode)
+}
+
+// ReadResult 读取响应body并关闭，任何状态码都返回Result
+func ReadResult(responseIns *http.Response) (*Result, error) {
+	if err := checkBodyConsumable(responseIns); err != nil {
+		return nil, err
+	}
+	defer responseIns.Body.Close()
+	body, err := ioutil.ReadAll(responseIns.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read from response.Body failed:%w", err)
+	}
+	return &Result{StatusCode: responseIns.StatusCode, Headers: responseIns.Header, Body: body, codec: responseConfigOf(responseIns).jsonCodec}, nil
+}
+
+// Decode 将body反序列化到v，body为空时不修改v并返回nil
+func (r *Result) Decode(v interface{}) error {
+	if len(bytes.TrimSpace(r.Body)) == 0 {
+		return nil
+	}
+	if err := r.codec.unmarshal(r.Body, v); err != nil {
+		return fmt.Errorf("unMarshal response bytes slice error:%v", err)
+	}
+	return nil
+}
+
+// ResponseToStructAllowing 与ResponseToStruct相同，codes中的非2xx状态码同样会被反序列化
+// 例如ResponseToStructAllowing(resp, &apiErr, 400, 422)可以读取接口返回的错误信息
+func ResponseToStructAllowing(responseIns *http.Response, v interface{}, codes ...int) error {
+	body, err := readAcceptedBody(responseIns, codes)
+	if err != nil {
+		return fmt.Errorf("response to bytes error:%w", err)
+	}
+	config := responseConfigOf(responseIns)
+	if err := config.checkBusinessError(body); err != nil {
+		return err
+	}
+	return (&Result{Body: body, codec: config.jsonCodec}).Decode(v)
+}
+
+// readAcceptedBody 读取body，状态码不是2xx且不在codes中时返回*StatusError
+func readAcceptedBody(responseIns *http.Response, codes []int) ([]byte, error) {
+	result, err := ReadResult(responseIns)
+	if err != nil {
+		return nil, err
+	}
+	if !statusAccepted(result.StatusCode, responseConfigOf(responseIns).expectStatus, codes) {
+		return nil, &StatusError{StatusCode: result.StatusCode, Body: result.Body}
+	}
+	return result.Body, nil
+}
+
+// statusAccepted 请求设置了WithExpectStatus时只接受expect中的状态码，否则接受2xx，codes中的状态码总是可以解析
+func statusAccepted(code int, expect, codes []int) bool {
+	if len(expect) == 0 && code >= 200 && code < 300 {
+		return true
+	}
+	return containsStatus(expect, code) || containsStatus(codes, code)
+}
+
+func containsStatus(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package nhr
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// failingBody 读取prefix之后返回err
+type failingBody struct {
+	io.Reader
+	err error
+}
+
+func (b *failingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		return n, b.err
+	}
+	return n, err
+}
+
+func (b *failingBody) Close() error { return nil }
+
+func TestReadResultWrapsReadError(t *testing.T) {
+	response := &http.Response{StatusCode: http.StatusOK, Body: &failingBody{Reader: strings.NewReader("partial"), err: ErrBodyIdleTimeout}}
+	_, err := ReadResult(response)
+	if !errors.Is(err, ErrBodyIdleTimeout) {
+		t.Fatalf("ReadResult error = %v, want it to wrap ErrBodyIdleTimeout", err)
+	}
+}
+
+func TestWriteFixtureWrapsReadError(t *testing.T) {
+	response := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: &failingBody{Reader: strings.NewReader("partial"), err: io.ErrUnexpectedEOF}}
+	err := writeFixture(t.TempDir(), FixtureOverwrite, http.MethodGet, "http://example.com", nil, "", response)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("writeFixture error = %v, want it to wrap io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestReadResultAnyStatus(t *testing.T) {
+	response := &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{"X-Id": {"1"}}, Body: ioutil.NopCloser(strings.NewReader(`{"error":"missing"}`))}
+	result, err := ReadResult(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct{ Error string }
+	if err := result.Decode(&body); err != nil || body.Error != "missing" || result.StatusCode != 404 {
+		t.Fatalf("result = %+v, body = %+v, err = %v", result, body, err)
+	}
+}
@@ -0,0 +1,278 @@
+package nhr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryableStatus RetryPolicy.RetryableStatus为空时重试的状态码
+var DefaultRetryableStatus = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// RetryPolicy 重试策略
+type RetryPolicy struct {
+	// MaxAttempts 最多尝试的次数，包含第一次请求，小于等于1时不重试
+	MaxAttempts int
+
+	// Backoff 两次尝试之间的等待时间，为nil时使用100ms起步的指数退避
+	Backoff Backoff
+
+	// RetryableStatus 需要重试的响应状态码，为空时使用DefaultRetryableStatus
+	RetryableStatus []int
+
+	// Decider 判断这一次尝试的结果是否需要重试，设置后RetryableStatus和BusinessCodeRule.RetriableCodes不再生效
+	// 不论Decider如何判断，ctx结束后都不再重试，非幂等的请求仍然需要通过MethodFilter
+	Decider RetryDecider
+
+	// RetryNonIdempotent 为true时POST、PATCH等非幂等的请求也会重试，默认只重试GET、HEAD、PUT、DELETE、OPTIONS、TRACE
+	RetryNonIdempotent bool
+
+	// MethodFilter 判断method是否允许重试，为nil时只允许幂等的method
+	// 请求带有Idempotency-Key请求头、设置了WithRetryNonIdempotent或者请求一定没有发出(DNS解析、连接被拒绝、TLS握手失败)时不再检查
+	MethodFilter func(method string) bool
+}
+
+// IdempotencyKeyHeader 带有该请求头的请求由服务端去重，任何method都可以重试
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryDecider 自定义的重试判断，attempt从1开始，resp和err为这一次尝试的结果，两者中只有一个不为nil
+// resp.Request.Method可以取到请求的method
+type RetryDecider interface {
+	ShouldRetry(attempt int, resp *http.Response, err error) bool
+}
+
+// RetryDeciderFunc 将普通函数转为RetryDecider
+type RetryDeciderFunc func(attempt int, resp *http.Response, err error) bool
+
+func (f RetryDeciderFunc) ShouldRetry(attempt int, resp *http.Response, err error) bool {
+	return f(attempt, resp, err)
+}
+
+// DefaultShouldRetry 默认的重试判断，可以在自定义的RetryDecider中使用
+// 可重试的网络错误、单次尝试超时、连接被拒绝以及DefaultRetryableStatus中的状态码需要重试
+func DefaultShouldRetry(resp *http.Response, err error) bool {
+	return retryableResult(resp, err, DefaultRetryableStatus)
+}
+
+// RetryError 开启重试后请求最终失败时返回，Attempts为实际尝试的次数
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("request failed after %v attempts:%v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// WithRetry 网络错误或状态码为429、502、503、504时最多尝试maxAttempts次
+// 第n次重试前等待backoff*2^(n-1)左右的时间(等量抖动)，响应带有Retry-After时按服务端的要求等待
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return WithRetryPolicy(RetryPolicy{
+		MaxAttempts: maxAttempts,
+		Backoff:     RespectRetryAfter(&EqualJitterBackoff{Min: backoff}),
+	})
+}
+
+// WithRetryPolicy 设置重试策略
+// 每次尝试都受单次超时限制，所有尝试和等待都受WithOverallTimeout和ctx的截止时间限制
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(req *HttpRequests) {
+		req.RetryPolicy = &policy
+	}
+}
+
+// WithBackoff 设置重试之间的退避策略，优先于RetryPolicy.Backoff，与WithRetry、WithRetryPolicy的先后顺序无关
+// 响应带有Retry-After时按服务端的要求等待，不再使用b
+func WithBackoff(b Backoff) Option {
+	return func(req *HttpRequests) {
+		req.Backoff = RespectRetryAfter(b)
+	}
+}
+
+// WithRetryNonIdempotent 允许POST、PATCH等非幂等的请求按重试策略重试，调用方需要确认重复发送是安全的
+func WithRetryNonIdempotent() Option {
+	return func(req *HttpRequests) {
+		req.RetryNonIdempotent = true
+	}
+}
+
+// isIdempotentMethod 重复发送不会产生额外影响的method
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// retryRequest 按重试策略发起请求，返回最后一次尝试的响应
+func retryRequest(ctx context.Context, requestIns *HttpRequests) (*http.Response, error) {
+	policy := requestIns.RetryPolicy
+	if policy == nil || policy.MaxAttempts <= 1 || requestIns.NoRetry {
+		return createRequest(ctx, requestIns)
+	}
+	backoff := requestIns.Backoff
+	if backoff == nil {
+		backoff = policy.Backoff
+	}
+	if backoff == nil {
+		backoff = RespectRetryAfter(&EqualJitterBackoff{Min: 100 * time.Millisecond, Max: 10 * time.Second})
+	}
+	for attempt := 1; ; attempt++ {
+		response, err := createRequest(ctx, requestIns)
+		if attempt >= policy.MaxAttempts || !policy.shouldRetry(ctx, requestIns, attempt, response, err) {
+			return response, retryResult(attempt, err)
+		}
+		delay := backoff.NextDelay(attempt, response, err)
+		// 等待之后已经超过截止时间时不再重试，直接返回这一次的结果
+		if deadline, ok := ctx.Deadline(); ok && !timeNow().Add(delay).Before(deadline) {
+			return response, retryResult(attempt, err)
+		}
+		if response != nil {
+			drainBody(response.Body)
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, &RetryError{Attempts: attempt, Err: fmt.Errorf("wait for retry error:%w", err)}
+		}
+	}
+}
+
+func retryResult(attempts int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryError{Attempts: attempts, Err: err}
+}
+
+// shouldRetry 判断这一次尝试的结果是否需要重试
+// 先按错误和状态码判断是否可以重试，再检查method是否允许重试，因为method被跳过的重试会告警一次
+// 请求一定没有发出并且body可以重新发送时任何method都可以重试
+func (p *RetryPolicy) shouldRetry(ctx context.Context, requestIns *HttpRequests, attempt int, response *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if !p.retryable(requestIns, attempt, response, err) {
+		return false
+	}
+	if requestNotSent(err) && requestIns.sourceReplayable() || p.allowsMethod(requestIns) {
+		return true
+	}
+	requestIns.warnOnce(ctx, "retry-non-idempotent", fmt.Sprintf("retry skipped for non-idempotent method %v, use WithRetryNonIdempotent or set the %v header", requestIns.Method, IdempotencyKeyHeader))
+	return false
+}
+
+// retryable 按Decider判断这一次尝试的结果，没有Decider时按RetryableStatus和业务码判断
+func (p *RetryPolicy) retryable(requestIns *HttpRequests, attempt int, response *http.Response, err error) bool {
+	if p.Decider != nil {
+		return p.Decider.ShouldRetry(attempt, response, err)
+	}
+	statuses := p.RetryableStatus
+	if len(statuses) == 0 {
+		statuses = DefaultRetryableStatus
+	}
+	return retryableResult(response, err, statuses) || retriableBusinessCode(requestIns.BusinessCodeRule, response)
+}
+
+// maxBusinessRetryBody 判断业务码时最多读取的响应body，更大的body不按业务码重试
+const maxBusinessRetryBody = 1 << 20
+
+// retriableBusinessCode 2xx响应的业务码是否在rule.RetriableCodes中
+// 读出的body放回响应前面，不重试时调用方仍然可以读取完整的body
+func retriableBusinessCode(rule *BusinessCodeRule, response *http.Response) bool {
+	if rule == nil || len(rule.RetriableCodes) == 0 || response == nil || response.StatusCode < 200 || response.StatusCode >= 300 {
+		return false
+	}
+	head, err := ioutil.ReadAll(io.LimitReader(response.Body, maxBusinessRetryBody))
+	var rest io.Reader = response.Body
+	if err != nil {
+		rest = errReader{err}
+	}
+	response.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(head), rest), closer: response.Body}
+	if err != nil || len(head) == maxBusinessRetryBody {
+		return false
+	}
+	var businessErr *BusinessError
+	if !errors.As(rule.Check(head), &businessErr) {
+		return false
+	}
+	for _, code := range rule.RetriableCodes {
+		if businessErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsMethod 请求的method是否允许重试
+func (p *RetryPolicy) allowsMethod(requestIns *HttpRequests) bool {
+	if p.RetryNonIdempotent || requestIns.RetryNonIdempotent || requestIns.hasHeader(IdempotencyKeyHeader) {
+		return true
+	}
+	if requestIns.source != nil && requestIns.source.Header.Get(IdempotencyKeyHeader) != "" {
+		return true
+	}
+	if p.MethodFilter != nil {
+		return p.MethodFilter(requestIns.Method)
+	}
+	return isIdempotentMethod(requestIns.Method)
+}
+
+// requestNotSent 请求一定没有发出：在拿到连接之前失败(DNS解析、建立连接、TLS握手)或者连接被拒绝
+func requestNotSent(err error) bool {
+	if err == nil {
+		return false
+	}
+	var trace *transportError
+	if errors.As(err, &trace) && trace.notSent() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// retryableResult 网络错误按类型判断，响应按状态码判断
+func retryableResult(response *http.Response, err error, statuses []int) bool {
+	if err != nil {
+		// ctx没有结束时的DeadlineExceeded来自单次尝试的超时；连接被拒绝时请求还没有发出
+		return IsRetriableTransportError(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNREFUSED)
+	}
+	if response == nil {
+		return false
+	}
+	for _, status := range statuses {
+		if response.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// drainBody 读取少量剩余内容后关闭body，使连接可以复用
+func drainBody(body io.ReadCloser) {
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(body, 64<<10))
+	_ = body.Close()
+}
+
+// sleepContext 等待d，ctx结束时提前返回ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
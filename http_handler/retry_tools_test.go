@@ -0,0 +1,278 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// noWait 不等待的退避，测试中重试立即发生
+var noWait = BackoffFunc(func(int, *http.Response, error) time.Duration { return 0 })
+
+// warningRecorder 记录Logger收到的告警
+type warningRecorder struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (w *warningRecorder) LogRequest(_ context.Context, entry *LogEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if entry.Warning != "" {
+		w.warnings = append(w.warnings, entry.Warning)
+	}
+}
+
+func (w *warningRecorder) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.warnings)
+}
+
+func TestRetryMethodGate(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		options []Option
+		policy  RetryPolicy
+		want    int32
+	}{
+		{name: "failing POST attempted once", method: http.MethodPost, want: 1},
+		{name: "failing PATCH attempted once", method: http.MethodPatch, want: 1},
+		{name: "GET retried", method: http.MethodGet, want: 3},
+		{name: "PUT retried", method: http.MethodPut, want: 3},
+		{name: "POST with WithRetryNonIdempotent", method: http.MethodPost, options: []Option{WithRetryNonIdempotent()}, want: 3},
+		{name: "POST with policy opt-in", method: http.MethodPost, policy: RetryPolicy{RetryNonIdempotent: true}, want: 3},
+		{name: "POST with Idempotency-Key", method: http.MethodPost, options: []Option{WithHeader("idempotency-key", "k1")}, want: 3},
+		{
+			name:   "MethodFilter allows POST",
+			method: http.MethodPost,
+			policy: RetryPolicy{MethodFilter: func(method string) bool { return method == http.MethodPost }},
+			want:   3,
+		},
+		{
+			name:   "MethodFilter rejects GET",
+			method: http.MethodGet,
+			policy: RetryPolicy{MethodFilter: func(method string) bool { return method == http.MethodPost }},
+			want:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, hits := countingServer(t, http.StatusServiceUnavailable)
+			policy := tt.policy
+			policy.MaxAttempts = 3
+			policy.Backoff = noWait
+			options := append([]Option{WithRetryPolicy(policy), WithLogger(&warningRecorder{})}, tt.options...)
+			response, err := HttpCaller(tt.method, server.URL, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if n := atomic.LoadInt32(hits); n != tt.want {
+				t.Fatalf("server received %v requests, want %v", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetrySkippedForPostWarnsOnce(t *testing.T) {
+	server, _ := countingServer(t, http.StatusServiceUnavailable)
+	logger := &warningRecorder{}
+	response, err := Post(server.URL, WithRetry(3, 0), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if n := logger.count(); n != 1 {
+		t.Fatalf("got %v warnings, want 1", n)
+	}
+
+	// 不需要重试时不告警
+	okServer, _ := countingServer(t, http.StatusOK)
+	logger = &warningRecorder{}
+	response, err = Post(okServer.URL, WithRetry(3, 0), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if n := logger.count(); n != 0 {
+		t.Fatalf("got %v warnings for a successful POST, want 0", n)
+	}
+}
+
+func TestRetryClassifiesBeforeMethodGate(t *testing.T) {
+	sent := transportError{started: true, gotConn: true}
+	notSent := transportError{started: true}
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable}
+	tests := []struct {
+		name     string
+		method   string
+		response *http.Response
+		err      error
+		want     bool
+	}{
+		{"connection refused POST", http.MethodPost, nil, sendError(opError("dial", syscall.ECONNREFUSED), notSent), true},
+		{"connection refused without trace", http.MethodPost, nil, opError("dial", syscall.ECONNREFUSED), true},
+		{"dns temporary POST", http.MethodPost, nil, sendError(&net.DNSError{Name: "example.com", IsTemporary: true}, notSent), true},
+		{"dns not found POST", http.MethodPost, nil, sendError(&net.DNSError{Name: "example.com", IsNotFound: true}, notSent), false},
+		{"eof during tls handshake POST", http.MethodPost, nil, sendError(io.EOF, notSent), true},
+		{"dial timeout POST", http.MethodPost, nil, sendError(context.DeadlineExceeded, notSent), true},
+		{"reset after sending POST", http.MethodPost, nil, sendError(opError("read", syscall.ECONNRESET), sent), false},
+		{"reset after sending GET", http.MethodGet, nil, sendError(opError("read", syscall.ECONNRESET), sent), true},
+		{"503 POST", http.MethodPost, unavailable, nil, false},
+		{"503 GET", http.MethodGet, unavailable, nil, true},
+		{"200 GET", http.MethodGet, &http.Response{StatusCode: http.StatusOK}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &RetryPolicy{MaxAttempts: 3}
+			requestIns := newHttpRequests(tt.method, "http://example.com", WithLogger(&warningRecorder{}))
+			if got := policy.shouldRetry(context.Background(), requestIns, 1, tt.response, tt.err); got != tt.want {
+				t.Fatalf("shouldRetry(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// closingListener 接受连接后立即关闭，TLS握手无法完成，返回地址和接受的连接数
+func closingListener(t *testing.T) (string, *int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var accepted int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String(), &accepted
+}
+
+func TestRetryPostWhenNeverSent(t *testing.T) {
+	addr, accepted := closingListener(t)
+	_, err := Post("https://"+addr, WithRetry(3, 0), WithPostStringBody("{}"))
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || retryErr.Attempts != 3 {
+		t.Fatalf("error = %v, want 3 attempts for a failed TLS handshake", err)
+	}
+	if n := atomic.LoadInt32(accepted); n != 3 {
+		t.Fatalf("listener accepted %v connections, want 3", n)
+	}
+
+	// 连接被拒绝
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := listener.Addr().String()
+	listener.Close()
+	_, err = Post("http://"+refused, WithRetry(3, 0), WithPostStringBody("{}"))
+	if !errors.As(err, &retryErr) || retryErr.Attempts != 3 {
+		t.Fatalf("error = %v, want 3 attempts for a refused connection", err)
+	}
+}
+
+func TestRoundTripperNeverSentWithoutGetBody(t *testing.T) {
+	addr, accepted := closingListener(t)
+	transport, err := NewRoundTripper(WithRetry(3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://"+addr, io.NopCloser(strings.NewReader("{}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = transport.RoundTrip(req)
+	if err == nil || errors.Is(err, ErrBodyNotReplayable) {
+		t.Fatalf("error = %v, want the handshake error without a retry", err)
+	}
+	if n := atomic.LoadInt32(accepted); n != 1 {
+		t.Fatalf("listener accepted %v connections, want 1 because the body cannot be replayed", n)
+	}
+}
+
+func TestRetryDecider(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		method   string
+		decide   func(attempt int, resp *http.Response) bool
+		hits     int32
+		attempts []int
+	}{
+		{
+			name:   "retry a status the default skips",
+			status: http.StatusInternalServerError,
+			decide: func(attempt int, resp *http.Response) bool {
+				return resp != nil && resp.StatusCode == http.StatusInternalServerError
+			},
+			hits:     3,
+			attempts: []int{1, 2},
+		},
+		{
+			name:     "veto a default retry",
+			status:   http.StatusServiceUnavailable,
+			decide:   func(int, *http.Response) bool { return false },
+			hits:     1,
+			attempts: []int{1},
+		},
+		{
+			name:     "stop after the first retry",
+			status:   http.StatusServiceUnavailable,
+			decide:   func(attempt int, _ *http.Response) bool { return attempt < 2 },
+			hits:     2,
+			attempts: []int{1, 2},
+		},
+		{
+			name:     "non-idempotent method still gated",
+			status:   http.StatusInternalServerError,
+			method:   http.MethodPost,
+			decide:   func(int, *http.Response) bool { return true },
+			hits:     1,
+			attempts: []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, hits := countingServer(t, tt.status)
+			var attempts []int
+			decider := RetryDeciderFunc(func(attempt int, resp *http.Response, err error) bool {
+				attempts = append(attempts, attempt)
+				return tt.decide(attempt, resp)
+			})
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			response, err := Do(method, server.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: noWait, Decider: decider}), WithLogger(&warningRecorder{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if *hits != tt.hits || response.StatusCode != tt.status || len(attempts) != len(tt.attempts) {
+				t.Fatalf("hits = %v, status = %v, decider attempts = %v, want %v hits and attempts %v", *hits, response.StatusCode, attempts, tt.hits, tt.attempts)
+			}
+			for i := range attempts {
+				if attempts[i] != tt.attempts[i] {
+					t.Fatalf("decider attempts = %v, want %v", attempts, tt.attempts)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ErrBodyNotReplayable 开启了重试，但RoundTripper收到的请求有body却没有设置GetBody，无法在重试时重新发送
+var ErrBodyNotReplayable = errors.New("request body cannot be replayed, set http.Request.GetBody to enable retries")
+
+// Transport 返回按Client的默认配置发送请求的http.RoundTripper，可以放进任意http.Client，例如OpenAPI生成的客户端和AWS SDK
+// 经过Client的中间件、重试、WithAdaptiveRateLimit、WithMaxInFlight、WithMetrics、WithDebug和日志的脱敏
+// 请求自己的请求头优先于默认请求头，不会添加默认的Content-Type；重定向和cookie jar由外层的http.Client处理
+// 重试需要重新发送body，有body的请求必须设置GetBody，http.NewRequest对bytes、strings的Reader会自动设置，否则返回ErrBodyNotReplayable
+// 响应body关闭之前单次尝试的超时仍然有效，长时间的流式响应需要在默认配置中设置WithTimeout(0)
+func (c *Client) Transport() http.RoundTripper {
+	return &roundTripper{client: c}
+}
+
+// NewRoundTripper 与NewClient使用相同的options创建Client，返回它的Transport
+func NewRoundTripper(options ...Option) (http.RoundTripper, error) {
+	client, err := NewClient(options...)
+	if err != nil {
+		return nil, err
+	}
+	return client.Transport(), nil
+}
+
+type roundTripper struct {
+	client *Client
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	defaults := append([]Option{withoutDefaultHeaders}, t.client.defaults...)
+	requestIns := t.client.newRequest(method, req.URL.String(), defaults, nil)
+	requestIns.source = req
+	requestIns.Context = req.Context()
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if policy := requestIns.RetryPolicy; hasBody && req.GetBody == nil && policy != nil && policy.MaxAttempts > 1 && policy.allowsMethod(requestIns) {
+		_ = req.Body.Close()
+		return nil, fmt.Errorf("round trip %v %v error:%w", method, redactSecrets(req.URL.String()), ErrBodyNotReplayable)
+	}
+	response, err := t.client.call(requestIns)
+	// RoundTripper出错时需要关闭请求的body，已经发送过时再次关闭没有影响
+	if err != nil && hasBody {
+		_ = req.Body.Close()
+	}
+	return response, err
+}
+
+// withoutDefaultHeaders 去掉本包默认的Content-Type，RoundTripper使用请求自己的请求头
+func withoutDefaultHeaders(req *HttpRequests) {
+	req.Headers = map[string]string{}
+}
+
+// sourceAttempt 为一次尝试复制RoundTripper收到的请求，第一次尝试使用原始body，之后通过GetBody重新获取
+func (r *HttpRequests) sourceAttempt(ctx context.Context, urlObj *url.URL) (*http.Request, error) {
+	req := r.source.Clone(ctx)
+	req.URL = urlObj
+	if r.source.Body == nil || r.source.Body == http.NoBody {
+		return req, nil
+	}
+	if !r.sourceBodyUsed {
+		r.sourceBodyUsed = true
+		return req, nil
+	}
+	if r.source.GetBody == nil {
+		return nil, ErrBodyNotReplayable
+	}
+	body, err := r.source.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("replay request body error:%w", err)
+	}
+	req.Body = body
+	return req, nil
+}
+
+// sourceReplayable 不是RoundTripper收到的请求，或者请求没有body、可以通过GetBody重新获取body
+func (r *HttpRequests) sourceReplayable() bool {
+	source := r.source
+	return source == nil || source.Body == nil || source.Body == http.NoBody || source.GetBody != nil
+}
+
+// transportOf 返回client使用的RoundTripper
+func transportOf(client *http.Client) http.RoundTripper {
+	if client.Transport != nil {
+		return client.Transport
+	}
+	return http.DefaultTransport
+}
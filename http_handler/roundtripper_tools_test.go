@@ -0,0 +1,111 @@
+package nhr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransportRetriesForPlainHTTPClient(t *testing.T) {
+	var hits int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-Seen", r.Header.Get("Content-Type")+"|"+r.Header.Get("X-Team"))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: noWait}),
+		WithHeaders(map[string]string{"X-Team": "core", "Content-Type": "text/plain"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	plain := &http.Client{Transport: client.Transport()}
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/v1", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/vnd.sdk+json")
+	response, err := plain.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || atomic.LoadInt32(&hits) != 3 {
+		t.Fatalf("status %v after %v attempts, want 200 after 3", response.StatusCode, hits)
+	}
+	for i, body := range bodies {
+		if body != `{"a":1}` {
+			t.Fatalf("attempt %v body = %q, want the replayed body", i+1, body)
+		}
+	}
+	if seen := response.Header.Get("X-Seen"); seen != "application/vnd.sdk+json|core" {
+		t.Fatalf("server saw %q, want the request's Content-Type and the default X-Team", seen)
+	}
+}
+
+func TestTransportRequiresGetBodyForRetries(t *testing.T) {
+	server, hits := countingServer(t, http.StatusServiceUnavailable)
+	transport, err := NewRoundTripper(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: noWait}), WithLogger(&warningRecorder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := &http.Client{Transport: transport}
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL, io.MultiReader(bytes.NewReader([]byte("data"))))
+	_, err = plain.Do(req)
+	if !errors.Is(err, ErrBodyNotReplayable) || atomic.LoadInt32(hits) != 0 {
+		t.Fatalf("error = %v after %v requests, want ErrBodyNotReplayable before sending", err, *hits)
+	}
+
+	// 不会重试的method不需要GetBody
+	req, _ = http.NewRequest(http.MethodPost, server.URL, io.MultiReader(bytes.NewReader([]byte("data"))))
+	response, err := plain.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if atomic.LoadInt32(hits) != 1 {
+		t.Fatalf("POST sent %v times, want once", *hits)
+	}
+}
+
+func TestTransportLeavesRedirectsToCaller(t *testing.T) {
+	var redirected int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		atomic.AddInt32(&redirected, 1)
+	}))
+	defer server.Close()
+	transport, err := NewRoundTripper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := &http.Client{Transport: transport, CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := plain.Get(server.URL + "/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound || atomic.LoadInt32(&redirected) != 0 {
+		t.Fatalf("status %v, redirect followed %v times, want the caller's CheckRedirect to apply", response.StatusCode, redirected)
+	}
+}
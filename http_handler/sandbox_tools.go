@@ -0,0 +1,72 @@
+package nhr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrProductionWriteBlocked 向生产环境host发送写请求被拦截
+var ErrProductionWriteBlocked = errors.New("write request to production host blocked")
+
+// ProductionWriteError 写请求的目标host在生产环境名单中，Redirect为true时表示是重定向后的目标被拦截
+type ProductionWriteError struct {
+	Method   string
+	Host     string
+	Redirect bool
+}
+
+func (e *ProductionWriteError) Error() string {
+	if e.Redirect {
+		return fmt.Sprintf("%v: %v redirected to %v", ErrProductionWriteBlocked, e.Method, e.Host)
+	}
+	return fmt.Sprintf("%v: %v %v", ErrProductionWriteBlocked, e.Method, e.Host)
+}
+
+// Is errors.Is(err, ErrProductionWriteBlocked)返回true
+func (e *ProductionWriteError) Is(target error) bool {
+	return target == ErrProductionWriteBlocked
+}
+
+// WithSandboxHeader 设置沙箱请求头，如X-Sandbox: true，在WithHeaders之后设置，不会被覆盖
+func WithSandboxHeader(name, value string) Option {
+	return func(req *HttpRequests) {
+		req.SandboxHeader = [2]string{name, value}
+	}
+}
+
+// WithProductionHostBlocklist 禁止向这些host发送POST、PUT、PATCH、DELETE请求，包括重定向之后的目标
+// host的匹配规则与URLPolicy.AllowedHosts相同，支持*.example.com
+func WithProductionHostBlocklist(hosts ...string) Option {
+	return func(req *HttpRequests) {
+		req.ProductionHosts = append(req.ProductionHosts, hosts...)
+	}
+}
+
+// WithAllowProductionWrites 本次请求明确允许向生产环境host写入
+func WithAllowProductionWrites() Option {
+	return func(req *HttpRequests) {
+		req.AllowProductionWrites = true
+	}
+}
+
+// isUnsafeMethod 会修改服务端数据的method
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// checkProductionWrite 在发送请求之前检查写请求的目标host
+func checkProductionWrite(requestIns *HttpRequests, method, host string, redirect bool) error {
+	if requestIns.AllowProductionWrites || len(requestIns.ProductionHosts) == 0 || !isUnsafeMethod(method) {
+		return nil
+	}
+	if hostAllowed(strings.ToLower(strings.TrimSuffix(host, ".")), requestIns.ProductionHosts) {
+		return &ProductionWriteError{Method: method, Host: host, Redirect: redirect}
+	}
+	return nil
+}
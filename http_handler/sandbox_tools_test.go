@@ -0,0 +1,67 @@
+package nhr
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSandboxHeader(t *testing.T) {
+	server, got := headerServer(t)
+	response, err := Get(server.URL, WithSandboxHeader("X-Sandbox", "true"), WithHeaders(map[string]string{"X-Sandbox": "false"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if values := (*got).Header.Values("X-Sandbox"); len(values) != 1 || values[0] != "true" {
+		t.Fatalf("X-Sandbox = %v, want the sandbox header to win over WithHeaders", values)
+	}
+}
+
+func TestProductionWriteBlocked(t *testing.T) {
+	server, count := countingServer(t, http.StatusOK)
+	tests := []struct {
+		name    string
+		method  string
+		options []Option
+		blocked bool
+	}{
+		{name: "post blocked", method: http.MethodPost, options: []Option{WithProductionHostBlocklist("127.0.0.1")}, blocked: true},
+		{name: "delete blocked by suffix", method: http.MethodDelete, options: []Option{WithProductionHostBlocklist("api.example.com", "*.0.0.1")}, blocked: true},
+		{name: "get allowed", method: http.MethodGet, options: []Option{WithProductionHostBlocklist("127.0.0.1")}},
+		{name: "other host", method: http.MethodPut, options: []Option{WithProductionHostBlocklist("api.example.com")}},
+		{name: "explicitly allowed", method: http.MethodPatch, options: []Option{WithProductionHostBlocklist("127.0.0.1"), WithAllowProductionWrites()}},
+		{name: "no blocklist", method: http.MethodPost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := atomic.LoadInt32(count)
+			response, err := HttpCaller(tt.method, server.URL, tt.options...)
+			sent := atomic.LoadInt32(count) - before
+			if tt.blocked {
+				var writeErr *ProductionWriteError
+				if !errors.Is(err, ErrProductionWriteBlocked) || !errors.As(err, &writeErr) || writeErr.Redirect || writeErr.Method != tt.method || sent != 0 {
+					t.Fatalf("error = %v, %v requests sent, want the write blocked before sending", err, sent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if sent != 1 {
+				t.Fatalf("%v requests sent, want 1", sent)
+			}
+		})
+	}
+}
+
+func TestProductionWriteErrorMessage(t *testing.T) {
+	if msg := (&ProductionWriteError{Method: "POST", Host: "api.example.com"}).Error(); msg != "write request to production host blocked: POST api.example.com" {
+		t.Fatalf("Error() = %q", msg)
+	}
+	if msg := (&ProductionWriteError{Method: "POST", Host: "api.example.com", Redirect: true}).Error(); msg != "write request to production host blocked: POST redirected to api.example.com" {
+		t.Fatalf("Error() = %q", msg)
+	}
+}
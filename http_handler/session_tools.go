@@ -0,0 +1,102 @@
+package nhr
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Session 保持登录状态的会话，服务端设置的cookie会在之后的请求中自动带上，同一个会话的请求共用连接池
+// Session可以被多个goroutine同时使用
+type Session struct {
+	// BaseURL 相对路径按照ResolveURL的规则拼接到BaseURL上
+	BaseURL string
+
+	client   *http.Client
+	jar      *recordingJar
+	defaults []Option
+	err      error
+}
+
+// NewSession 创建会话，options作为每个请求的默认配置，如WithHeaders、WithTimeout
+// 单次请求的options在默认配置之后执行；请求头按key合并，单次请求设置的值优先
+// 与NewClient一样，options中transport相关的配置用于创建会话的连接池，配置不合法时会话的每个请求都返回该错误
+func NewSession(baseURL string, options ...Option) *Session {
+	// 使用publicsuffix时cookiejar.New不会返回错误
+	stdJar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	jar := newRecordingJar(stdJar)
+	var roundTripper http.RoundTripper = http.DefaultTransport
+	transport, err := newTransport(requestTransportKey(newHttpRequests("", "", options...)))
+	if err == nil {
+		roundTripper = transport
+	}
+	return &Session{
+		BaseURL:  baseURL,
+		client:   &http.Client{Transport: roundTripper, Jar: jar},
+		jar:      jar,
+		defaults: append([]Option(nil), options...),
+		err:      err,
+	}
+}
+
+// Jar 返回会话使用的cookie jar
+func (s *Session) Jar() http.CookieJar {
+	return s.client.Jar
+}
+
+// Do 使用会话发起请求，path可以是完整的URL，也可以是相对BaseURL的路径
+func (s *Session) Do(method, path string, options ...Option) (*http.Response, error) {
+	requestIns, err := s.newRequest(method, path, options)
+	if err != nil {
+		return nil, err
+	}
+	return callRequest(requestIns)
+}
+
+// Get 使用会话发起GET请求
+func (s *Session) Get(path string, options ...Option) (*http.Response, error) {
+	return s.Do(http.MethodGet, path, options...)
+}
+
+// Post 使用会话发起POST请求
+func (s *Session) Post(path string, options ...Option) (*http.Response, error) {
+	return s.Do(http.MethodPost, path, options...)
+}
+
+// Put 使用会话发起PUT请求
+func (s *Session) Put(path string, options ...Option) (*http.Response, error) {
+	return s.Do(http.MethodPut, path, options...)
+}
+
+// Patch 使用会话发起PATCH请求
+func (s *Session) Patch(path string, options ...Option) (*http.Response, error) {
+	return s.Do(http.MethodPatch, path, options...)
+}
+
+// Delete 使用会话发起DELETE请求
+func (s *Session) Delete(path string, options ...Option) (*http.Response, error) {
+	return s.Do(http.MethodDelete, path, options...)
+}
+
+// Head 使用会话发起HEAD请求
+func (s *Session) Head(path string, options ...Option) (*http.Response, error) {
+	return s.Do(http.MethodHead, path, options...)
+}
+
+// newRequest 按BaseURL拼接请求地址，再依次执行默认配置和单次请求的配置
+func (s *Session) newRequest(method, path string, options []Option) (*HttpRequests, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	requestURL := path
+	if s.BaseURL != "" {
+		resolved, err := ResolveURL(s.BaseURL, path)
+		if err != nil {
+			return nil, &invalidURLError{err: err}
+		}
+		requestURL = resolved
+	}
+	requestIns := newRequestWithDefaults(method, requestURL, s.client, s.defaults, options)
+	return requestIns, nil
+}
@@ -0,0 +1,87 @@
+package nhr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// loginServer /login设置会话cookie，/profile没有该cookie时返回401，同时记录收到的X-Trace
+func loginServer(t *testing.T) (*httptest.Server, *[]string) {
+	var traces []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traces = append(traces, r.Header.Get("X-Trace"))
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s3cr3t", Path: "/"})
+		case "/profile":
+			if cookie, err := r.Cookie("sid"); err != nil || cookie.Value != "s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("welcome"))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &traces
+}
+
+func TestSessionKeepsLoginCookie(t *testing.T) {
+	server, _ := loginServer(t)
+	session := NewSession(server.URL)
+	response, err := session.Get("/profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status before login = %v, want 401", response.StatusCode)
+	}
+
+	response, err = session.Post("/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	response, err = session.Get("/profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status after login = %v, want the session cookie to be sent", response.StatusCode)
+	}
+
+	// 其他会话和包级别的函数不共享cookie
+	response, err = NewSession(server.URL).Get("/profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status of a new session = %v, want 401", response.StatusCode)
+	}
+}
+
+func TestSessionOptionsDoNotMutateDefaults(t *testing.T) {
+	server, traces := loginServer(t)
+	session := NewSession(server.URL+"/api/", WithHeaders(map[string]string{"X-Trace": "default"}))
+	for _, option := range [][]Option{nil, {WithHeaders(map[string]string{"X-Trace": "override"})}, nil} {
+		response, err := session.Get("profile", option...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+	if got := strings.Join(*traces, ","); got != "default,override,default" {
+		t.Fatalf("X-Trace = %v, want the per-call header to apply only to its own request", got)
+	}
+}
+
+func TestSessionInvalidTransportConfig(t *testing.T) {
+	session := NewSession("http://127.0.0.1:1", WithProxy("://bad"))
+	if _, err := session.Get("/"); err == nil {
+		t.Fatal("an invalid proxy should fail every request of the session")
+	}
+}
@@ -0,0 +1,231 @@
+package nhr
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// SnapshotUpdateEnv 设置为非空值时SnapshotJSON重新写入golden文件
+const SnapshotUpdateEnv = "NHR_UPDATE_SNAPSHOTS"
+
+// snapshotMasked 被屏蔽的字段在快照中的值
+const snapshotMasked = "<masked>"
+
+// maxSnapshotDiffs 失败报告中最多列出的差异数
+const maxSnapshotDiffs = 50
+
+// SnapshotOptions SnapshotJSONWithOptions的配置
+// 路径使用点号分隔，*匹配任意key或数组下标，例如items.*.id
+type SnapshotOptions struct {
+	// Mask 值替换为<masked>的路径，例如id、时间戳等每次都会变化的字段
+	Mask []string
+	// Unordered 比较时忽略元素顺序的数组路径，数组元素按规范化之后的JSON排序
+	Unordered []string
+}
+
+// SnapshotJSON 将响应的JSON body与goldenPath中的快照比较，mask中的路径替换为<masked>后再比较
+// 测试定义了-update标志并传入时，或者设置了NHR_UPDATE_SNAPSHOTS环境变量时，改为写入快照：
+//
+//	var _ = flag.Bool("update", false, "update golden files")
+func SnapshotJSON(t testing.TB, resp *Response, goldenPath string, mask ...string) {
+	t.Helper()
+	SnapshotJSONWithOptions(t, resp, goldenPath, SnapshotOptions{Mask: mask})
+}
+
+// SnapshotJSONWithOptions 与SnapshotJSON相同，可以指定忽略顺序的数组路径
+// 快照中保存的是规范化之后的JSON：key按字典序排列、缩进两个空格
+func SnapshotJSONWithOptions(t testing.TB, resp *Response, goldenPath string, opts SnapshotOptions) {
+	t.Helper()
+	got, err := normalizeSnapshot(resp.Bytes(), opts)
+	if err != nil {
+		t.Fatalf("snapshot %v: decode response body error:%v", goldenPath, err)
+	}
+	if snapshotUpdating() {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0o755); err != nil {
+			t.Fatalf("snapshot %v: create directory error:%v", goldenPath, err)
+		}
+		if err := writeFileAtomic(goldenPath, marshalSnapshot(got)); err != nil {
+			t.Fatalf("snapshot %v: write golden file error:%v", goldenPath, err)
+		}
+		return
+	}
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("snapshot %v: read golden file error:%v, run the test with -update or %v=1 to create it", goldenPath, err, SnapshotUpdateEnv)
+	}
+	want, err := normalizeSnapshot(golden, opts)
+	if err != nil {
+		t.Fatalf("snapshot %v: decode golden file error:%v", goldenPath, err)
+	}
+	if diffs := diffJSON("$", want, got, nil); len(diffs) > 0 {
+		if len(diffs) > maxSnapshotDiffs {
+			diffs = append(diffs[:maxSnapshotDiffs], fmt.Sprintf("... and %v more", len(diffs)-maxSnapshotDiffs))
+		}
+		t.Errorf("snapshot %v does not match the response body:\n  %v", goldenPath, strings.Join(diffs, "\n  "))
+	}
+}
+
+// snapshotUpdating 是否需要重新写入快照
+func snapshotUpdating() bool {
+	if os.Getenv(SnapshotUpdateEnv) != "" {
+		return true
+	}
+	if f := flag.Lookup("update"); f != nil {
+		update, _ := strconv.ParseBool(f.Value.String())
+		return update
+	}
+	return false
+}
+
+// normalizeSnapshot 解码JSON，屏蔽mask中的路径，并对忽略顺序的数组排序
+func normalizeSnapshot(data []byte, opts SnapshotOptions) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	for _, path := range opts.Mask {
+		v = applySnapshotPath(v, splitSnapshotPath(path), func(interface{}) interface{} { return snapshotMasked })
+	}
+	for _, path := range opts.Unordered {
+		v = applySnapshotPath(v, splitSnapshotPath(path), sortSnapshotArray)
+	}
+	return v, nil
+}
+
+func splitSnapshotPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// applySnapshotPath 将fn应用到path匹配的所有值上，不存在的路径不做处理
+func applySnapshotPath(v interface{}, path []string, fn func(interface{}) interface{}) interface{} {
+	if len(path) == 0 {
+		return fn(v)
+	}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			if path[0] == "*" || path[0] == key {
+				node[key] = applySnapshotPath(child, path[1:], fn)
+			}
+		}
+	case []interface{}:
+		for i, child := range node {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				node[i] = applySnapshotPath(child, path[1:], fn)
+			}
+		}
+	}
+	return v
+}
+
+// sortSnapshotArray 按元素规范化之后的JSON排序，不是数组时原样返回
+func sortSnapshotArray(v interface{}) interface{} {
+	items, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = snapshotText(item)
+	}
+	sort.Sort(snapshotSorter{items: items, keys: keys})
+	return items
+}
+
+type snapshotSorter struct {
+	items []interface{}
+	keys  []string
+}
+
+func (s snapshotSorter) Len() int           { return len(s.items) }
+func (s snapshotSorter) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s snapshotSorter) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// marshalSnapshot 输出快照文件的内容，encoding/json会按字典序输出map的key，不转义<>&
+func marshalSnapshot(v interface{}) []byte {
+	return encodeSnapshot(v, "  ")
+}
+
+func encodeSnapshot(v interface{}, indent string) []byte {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(v); err != nil {
+		return []byte(fmt.Sprint(v))
+	}
+	return buf.Bytes()
+}
+
+// diffJSON 比较两个解码之后的JSON值，返回路径和差异的列表
+func diffJSON(path string, want, got interface{}, diffs []string) []string {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return append(diffs, fmt.Sprintf("%v: want object, got %v", path, snapshotText(got)))
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for key := range w {
+			keys = append(keys, key)
+		}
+		for key := range g {
+			if _, ok := w[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			wv, inWant := w[key]
+			gv, inGot := g[key]
+			switch {
+			case !inGot:
+				diffs = append(diffs, fmt.Sprintf("%v.%v: missing, want %v", path, key, snapshotText(wv)))
+			case !inWant:
+				diffs = append(diffs, fmt.Sprintf("%v.%v: unexpected %v", path, key, snapshotText(gv)))
+			default:
+				diffs = diffJSON(path+"."+key, wv, gv, diffs)
+			}
+		}
+		return diffs
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return append(diffs, fmt.Sprintf("%v: want array, got %v", path, snapshotText(got)))
+		}
+		if len(w) != len(g) {
+			diffs = append(diffs, fmt.Sprintf("%v: want %v elements, got %v", path, len(w), len(g)))
+		}
+		for i := 0; i < len(w) && i < len(g); i++ {
+			diffs = diffJSON(fmt.Sprintf("%v.%v", path, i), w[i], g[i], diffs)
+		}
+		return diffs
+	}
+	if snapshotText(want) != snapshotText(got) {
+		diffs = append(diffs, fmt.Sprintf("%v: want %v, got %v", path, snapshotText(want), snapshotText(got)))
+	}
+	return diffs
+}
+
+// snapshotText 差异报告中值的文本
+func snapshotText(v interface{}) string {
+	return strings.TrimSuffix(string(encodeSnapshot(v, "")), "\n")
+}
@@ -0,0 +1,119 @@
+package nhr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingTB 记录SnapshotJSON报告的失败，Fatalf与testing.T一样结束当前goroutine
+type recordingTB struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// runSnapshot 在单独的goroutine中执行fn，返回报告的失败
+func runSnapshot(t *testing.T, fn func(tb testing.TB)) []string {
+	tb := &recordingTB{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(tb)
+	}()
+	<-done
+	return tb.errors
+}
+
+func jsonResponse(body string) *Response {
+	return &Response{body: []byte(body)}
+}
+
+func TestSnapshotJSONWriteAndCompare(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "testdata", "user.golden.json")
+	t.Setenv(SnapshotUpdateEnv, "1")
+	errs := runSnapshot(t, func(tb testing.TB) {
+		SnapshotJSON(tb, jsonResponse(`{"name":"alice","id":17,"meta":{"created_at":"2024-01-01"}}`), golden, "id", "meta.created_at")
+	})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"id\": \"<masked>\",\n  \"meta\": {\n    \"created_at\": \"<masked>\"\n  },\n  \"name\": \"alice\"\n}\n"
+	if string(data) != want {
+		t.Fatalf("golden file:\n%s\nwant:\n%s", data, want)
+	}
+
+	t.Setenv(SnapshotUpdateEnv, "")
+	// 屏蔽的字段变化、key顺序变化都不影响比较
+	errs = runSnapshot(t, func(tb testing.TB) {
+		SnapshotJSON(tb, jsonResponse(`{"meta":{"created_at":"2025-06-30"},"id":99,"name":"alice"}`), golden, "id", "meta.created_at")
+	})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected failure: %v", errs)
+	}
+
+	errs = runSnapshot(t, func(tb testing.TB) {
+		SnapshotJSON(tb, jsonResponse(`{"meta":{"created_at":"x"},"id":1,"name":"bob","extra":true}`), golden, "id", "meta.created_at")
+	})
+	if len(errs) != 1 {
+		t.Fatalf("got %v failures, want 1", len(errs))
+	}
+	for _, want := range []string{`$.name: want "alice", got "bob"`, `$.extra: unexpected true`} {
+		if !strings.Contains(errs[0], want) {
+			t.Fatalf("report %q does not contain %q", errs[0], want)
+		}
+	}
+}
+
+func TestSnapshotJSONUnorderedAndWildcard(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "list.golden.json")
+	opts := SnapshotOptions{Mask: []string{"items.*.id"}, Unordered: []string{"items", "tags"}}
+	t.Setenv(SnapshotUpdateEnv, "1")
+	runSnapshot(t, func(tb testing.TB) {
+		SnapshotJSONWithOptions(tb, jsonResponse(`{"items":[{"id":1,"n":"a"},{"id":2,"n":"b"}],"tags":["x","y"],"order":[1,2]}`), golden, opts)
+	})
+	t.Setenv(SnapshotUpdateEnv, "")
+
+	errs := runSnapshot(t, func(tb testing.TB) {
+		SnapshotJSONWithOptions(tb, jsonResponse(`{"items":[{"id":7,"n":"b"},{"id":8,"n":"a"}],"tags":["y","x"],"order":[1,2]}`), golden, opts)
+	})
+	if len(errs) > 0 {
+		t.Fatalf("unordered arrays should match: %v", errs)
+	}
+
+	// 没有标记为忽略顺序的数组仍然按顺序比较
+	errs = runSnapshot(t, func(tb testing.TB) {
+		SnapshotJSONWithOptions(tb, jsonResponse(`{"items":[{"id":7,"n":"a"},{"id":8,"n":"b"}],"tags":["x","y"],"order":[2,1]}`), golden, opts)
+	})
+	if len(errs) != 1 || !strings.Contains(errs[0], "$.order.0: want 1, got 2") {
+		t.Fatalf("failures = %v", errs)
+	}
+}
+
+func TestSnapshotJSONMissingGolden(t *testing.T) {
+	errs := runSnapshot(t, func(tb testing.TB) {
+		SnapshotJSON(tb, jsonResponse(`{}`), filepath.Join(t.TempDir(), "missing.json"))
+	})
+	if len(errs) != 1 || !strings.Contains(errs[0], SnapshotUpdateEnv) {
+		t.Fatalf("failures = %v", errs)
+	}
+}
@@ -0,0 +1,129 @@
+package nhr
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffLen 判断内容类型时最多检查的字节数，与http.DetectContentType一致
+const sniffLen = 512
+
+// WithContentSniffing 响应的Content-Type缺失或为text/plain、application/octet-stream时，根据body开头的内容判断实际类型
+// 明确的Content-Type不会被覆盖，判断结果通过ResponseContentType获取
+func WithContentSniffing() Option {
+	return func(req *HttpRequests) {
+		req.ContentSniffing = true
+	}
+}
+
+// ResponseContentType 返回响应声明的媒体类型以及实际使用的媒体类型，不含charset等参数
+// 没有开启WithContentSniffing时两者都是声明的类型
+func ResponseContentType(responseIns *http.Response) (declared, effective string) {
+	config := responseConfigOf(responseIns)
+	if config.contentSniffing {
+		return config.declaredType, config.sniffedType
+	}
+	declared = mediaType(responseIns.Header.Get("Content-Type"))
+	return declared, declared
+}
+
+// isGenericContentType 是否是需要进一步判断的类型
+func isGenericContentType(media string) bool {
+	switch media {
+	case "", "text/plain", "application/octet-stream":
+		return true
+	}
+	return false
+}
+
+// mediaType 返回不含参数的小写媒体类型
+func mediaType(contentType string) string {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	}
+	return media
+}
+
+// SniffContentType 根据声明的Content-Type和body开头的内容返回实际的媒体类型
+// 声明的类型明确时直接返回；否则识别UTF BOM之后的JSON对象/数组、XML声明和HTML，其余交给http.DetectContentType
+func SniffContentType(declared string, head []byte) string {
+	if media := mediaType(declared); !isGenericContentType(media) {
+		return media
+	}
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	text := head
+	for _, bom := range [][]byte{{0xEF, 0xBB, 0xBF}, {0xFE, 0xFF}, {0xFF, 0xFE}} {
+		if bytes.HasPrefix(text, bom) {
+			text = text[len(bom):]
+			if len(bom) == 2 {
+				// UTF-16时去掉0字节再判断
+				text = bytes.ReplaceAll(text, []byte{0}, nil)
+			}
+			break
+		}
+	}
+	text = bytes.TrimLeft(text, " \t\r\n")
+	lower := bytes.ToLower(text[:minInt(len(text), 16)])
+	switch {
+	case len(text) > 0 && text[0] == '{':
+		return "application/json"
+	case len(text) > 0 && text[0] == '[' && looksLikeJSONArray(text[1:]):
+		return "application/json"
+	case bytes.HasPrefix(lower, []byte("<?xml")):
+		return "application/xml"
+	case bytes.HasPrefix(lower, []byte("<!doctype html")), bytes.HasPrefix(lower, []byte("<html")):
+		return "text/html"
+	}
+	return mediaType(http.DetectContentType(head))
+}
+
+// looksLikeJSONArray [之后的第一个非空白字符是否可以作为JSON值的开头
+func looksLikeJSONArray(rest []byte) bool {
+	rest = bytes.TrimLeft(rest, " \t\r\n")
+	if len(rest) == 0 {
+		return true
+	}
+	switch c := rest[0]; {
+	case c == '{' || c == '[' || c == '"' || c == ']' || c == '-' || (c >= '0' && c <= '9'):
+		return true
+	case c == 't' || c == 'f' || c == 'n':
+		return true
+	}
+	return false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// peekedBody 已经预读了开头部分的body
+type peekedBody struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// sniffResponse 预读body开头的内容判断媒体类型，结果保存在响应对应请求的配置中
+func sniffResponse(responseIns *http.Response) {
+	config := responseConfigOf(responseIns)
+	config.declaredType = mediaType(responseIns.Header.Get("Content-Type"))
+	config.sniffedType = config.declaredType
+	if !isGenericContentType(config.declaredType) {
+		return
+	}
+	reader := bufio.NewReaderSize(responseIns.Body, sniffLen)
+	head, _ := reader.Peek(sniffLen)
+	responseIns.Body = &peekedBody{Reader: reader, Closer: responseIns.Body}
+	if len(head) > 0 {
+		config.sniffedType = SniffContentType(config.declaredType, head)
+	}
+}
@@ -0,0 +1,72 @@
+package nhr
+
+import (
+	"io"
+	"testing"
+)
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared string
+		head     string
+		want     string
+	}{
+		{name: "explicit type kept", declared: "application/xml; charset=utf-8", head: `{"a":1}`, want: "application/xml"},
+		{name: "json object", declared: "text/plain", head: " \n{\"a\":1}", want: "application/json"},
+		{name: "json array", declared: "", head: `[{"a":1}]`, want: "application/json"},
+		{name: "json array of numbers", declared: "application/octet-stream", head: `[ -1, 2]`, want: "application/json"},
+		{name: "empty json array", declared: "", head: `[]`, want: "application/json"},
+		{name: "bracketed text", declared: "text/plain", head: `[INFO] started`, want: "text/plain"},
+		{name: "utf8 bom", declared: "", head: "\xef\xbb\xbf{\"a\":1}", want: "application/json"},
+		{name: "utf16 bom", declared: "", head: "\xff\xfe{\x00\"\x00a\x00\"\x00}\x00", want: "application/json"},
+		{name: "xml declaration", declared: "text/plain", head: `<?XML version="1.0"?><a/>`, want: "application/xml"},
+		{name: "html doctype", declared: "", head: "<!DOCTYPE html><html></html>", want: "text/html"},
+		{name: "html tag", declared: "", head: "<HTML><body>", want: "text/html"},
+		{name: "png", declared: "application/octet-stream", head: "\x89PNG\r\n\x1a\n", want: "image/png"},
+		{name: "malformed declared", declared: "Text/Plain;;", head: `{"a":1}`, want: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SniffContentType(tt.declared, []byte(tt.head)); got != tt.want {
+				t.Fatalf("SniffContentType(%q, %q) = %q, want %q", tt.declared, tt.head, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithContentSniffing(t *testing.T) {
+	body := `{"id":7}`
+	server := contentServer(t, "text/plain; charset=utf-8", body)
+	response, err := Get(server.URL, WithContentSniffing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if declared, effective := ResponseContentType(response); declared != "text/plain" || effective != "application/json" {
+		t.Fatalf("content type = %q, %q, want text/plain sniffed as json", declared, effective)
+	}
+	// 预读的内容仍然可以从body中读到
+	if got, err := io.ReadAll(response.Body); err != nil || string(got) != body {
+		t.Fatalf("body = %q, %v, want the peeked bytes kept", got, err)
+	}
+	response.Body.Close()
+
+	response, err = Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if declared, effective := ResponseContentType(response); declared != "text/plain" || effective != "text/plain" {
+		t.Fatalf("content type = %q, %q, want the declared type without sniffing", declared, effective)
+	}
+
+	empty := contentServer(t, "", "")
+	response, err = Get(empty.URL, WithContentSniffing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if declared, effective := ResponseContentType(response); declared != "" || effective != "" {
+		t.Fatalf("content type = %q, %q, want nothing sniffed from an empty body", declared, effective)
+	}
+}
@@ -0,0 +1,209 @@
+package nhr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// StreamElementError 流中单个元素解析失败，Index为元素下标，Raw为元素的原始内容
+type StreamElementError struct {
+	Index int
+	Raw   []byte
+	Err   error
+}
+
+func (e *StreamElementError) Error() string {
+	return fmt.Sprintf("decode stream element %v error:%v", e.Index, e.Err)
+}
+
+func (e *StreamElementError) Unwrap() error {
+	return e.Err
+}
+
+// StreamOption StreamJSON的配置
+type StreamOption func(*streamConfig)
+
+type streamConfig struct {
+	buffer          int
+	continueOnError bool
+}
+
+// WithStreamBuffer 设置值channel的缓冲区大小，默认为0，慢的消费者会直接限制body的读取速度
+func WithStreamBuffer(n int) StreamOption {
+	return func(c *streamConfig) {
+		c.buffer = n
+	}
+}
+
+// WithStreamContinueOnError 单个元素解析失败时上报错误并继续读取，默认上报后停止
+func WithStreamContinueOnError() StreamOption {
+	return func(c *streamConfig) {
+		c.continueOnError = true
+	}
+}
+
+// StreamJSON 逐个解析响应body中的元素并发送到channel，支持NDJSON、SSE的data以及顶层JSON数组
+// Content-Type为text/event-stream时按SSE解析，body以[开头时按数组解析，其余按NDJSON解析
+// 流结束、出错或ctx取消时关闭两个channel并关闭body；提前放弃读取时需要取消ctx，否则goroutine会一直等待发送
+func StreamJSON[T any](ctx context.Context, responseIns *http.Response, options ...StreamOption) (<-chan T, <-chan error) {
+	config := &streamConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	if config.buffer < 0 {
+		config.buffer = 0
+	}
+	codec := responseConfigOf(responseIns).jsonCodec
+	values := make(chan T, config.buffer)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(errs)
+		defer close(values)
+		defer responseIns.Body.Close()
+
+		index := 0
+		emit := func(raw []byte) bool {
+			var value T
+			if err := codec.unmarshal(raw, &value); err != nil {
+				elementErr := &StreamElementError{Index: index, Raw: append([]byte(nil), raw...), Err: err}
+				index++
+				return sendStreamError(ctx, errs, elementErr) && config.continueOnError
+			}
+			index++
+			select {
+			case values <- value:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if err := readStreamElements(responseIns, emit); err != nil && ctx.Err() == nil {
+			sendStreamError(ctx, errs, fmt.Errorf("read stream error:%w", err))
+		}
+	}()
+	// ctx取消时关闭body，让阻塞中的读取立即返回
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = responseIns.Body.Close()
+		case <-done:
+		}
+	}()
+	return values, errs
+}
+
+// sendStreamError 发送错误，ctx取消时返回false
+func sendStreamError(ctx context.Context, errs chan<- error, err error) bool {
+	select {
+	case errs <- err:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// readStreamElements 按格式拆分body中的元素，emit返回false时停止
+func readStreamElements(responseIns *http.Response, emit func(raw []byte) bool) error {
+	reader := bufio.NewReader(responseIns.Body)
+	if mediaType, _, _ := mime.ParseMediaType(responseIns.Header.Get("Content-Type")); mediaType == "text/event-stream" {
+		return readSSEData(reader, emit)
+	}
+	if first, err := peekNonSpace(reader); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	} else if first == '[' {
+		return readJSONArray(reader, emit)
+	}
+	return readNDJSON(reader, emit)
+}
+
+// peekNonSpace 跳过开头的空白，返回第一个非空白字节但不消费它
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, reader.UnreadByte()
+		}
+	}
+}
+
+// readNDJSON 每行一个元素，跳过空行
+func readNDJSON(reader *bufio.Reader, emit func(raw []byte) bool) error {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 && !emit(line) {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readSSEData 每个事件的data行合并为一个元素，忽略注释和其他字段
+func readSSEData(reader *bufio.Reader, emit func(raw []byte) bool) error {
+	var data [][]byte
+	dispatch := func() bool {
+		if len(data) == 0 {
+			return true
+		}
+		raw := bytes.Join(data, []byte("\n"))
+		data = data[:0]
+		return emit(raw)
+	}
+	for {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(line) == 0:
+			if err == nil && !dispatch() {
+				return nil
+			}
+		case bytes.HasPrefix(line, []byte("data:")):
+			value := bytes.TrimPrefix(line[len("data:"):], []byte(" "))
+			data = append(data, append([]byte(nil), value...))
+		}
+		if err == io.EOF {
+			dispatch()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readJSONArray 顶层数组的每个元素为一个元素
+func readJSONArray(reader io.Reader, emit func(raw []byte) bool) error {
+	decoder := json.NewDecoder(reader)
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return err
+		}
+		if !emit(raw) {
+			return nil
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
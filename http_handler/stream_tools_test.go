@@ -0,0 +1,136 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type streamEvent struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// collectStream 读完两个channel，返回所有值和错误
+func collectStream(t *testing.T, values <-chan streamEvent, errs <-chan error) ([]streamEvent, []error) {
+	t.Helper()
+	var got []streamEvent
+	var gotErrs []error
+	timeout := time.After(2 * time.Second)
+	for values != nil || errs != nil {
+		select {
+		case value, ok := <-values:
+			if !ok {
+				values = nil
+				continue
+			}
+			got = append(got, value)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			gotErrs = append(gotErrs, err)
+		case <-timeout:
+			t.Fatal("the stream did not finish")
+		}
+	}
+	return got, gotErrs
+}
+
+func TestStreamJSONFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{name: "ndjson", contentType: "application/x-ndjson", body: "{\"id\":1,\"name\":\"a\"}\n\n{\"id\":2,\"name\":\"b\"}\r\n{\"id\":3,\"name\":\"c\"}"},
+		{name: "sse", contentType: "text/event-stream; charset=utf-8", body: ": keep-alive\n\nevent: order\ndata: {\"id\":1,\"name\":\"a\"}\n\nid: 7\ndata: {\"id\":2,\ndata: \"name\":\"b\"}\r\n\r\ndata:{\"id\":3,\"name\":\"c\"}"},
+		{name: "array", contentType: "application/json", body: " \n[{\"id\":1,\"name\":\"a\"}, {\"id\":2,\"name\":\"b\"},{\"id\":3,\"name\":\"c\"}]"},
+	}
+	want := []streamEvent{{1, "a"}, {2, "b"}, {3, "c"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := contentServer(t, tt.contentType, tt.body)
+			response, err := Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, errs := StreamJSON[streamEvent](context.Background(), response, WithStreamBuffer(1))
+			got, gotErrs := collectStream(t, values, errs)
+			if len(gotErrs) != 0 || len(got) != len(want) {
+				t.Fatalf("values = %+v, errors = %v, want %+v", got, gotErrs, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("values = %+v, want %+v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamJSONEmptyBody(t *testing.T) {
+	server := contentServer(t, "application/json", "  \n")
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, errs := StreamJSON[streamEvent](context.Background(), response)
+	if got, errs := collectStream(t, values, errs); len(got) != 0 || len(errs) != 0 {
+		t.Fatalf("values = %+v, errors = %v, want nothing for an empty body", got, errs)
+	}
+}
+
+func TestStreamJSONElementErrors(t *testing.T) {
+	server := contentServer(t, "application/x-ndjson", "{\"id\":1}\nnot json\n{\"id\":3}\n")
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, errs := StreamJSON[streamEvent](context.Background(), response)
+	got, gotErrs := collectStream(t, values, errs)
+	var elementErr *StreamElementError
+	if len(got) != 1 || len(gotErrs) != 1 || !errors.As(gotErrs[0], &elementErr) || elementErr.Index != 1 || string(elementErr.Raw) != "not json" {
+		t.Fatalf("values = %+v, errors = %v, want the stream to stop at element 1", got, gotErrs)
+	}
+
+	response, err = Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// errs的缓冲只有1个，继续读取时需要同时消费两个channel
+	values, errs = StreamJSON[streamEvent](context.Background(), response, WithStreamContinueOnError())
+	got, gotErrs = collectStream(t, values, errs)
+	if len(got) != 2 || got[1].ID != 3 || len(gotErrs) != 1 {
+		t.Fatalf("values = %+v, errors = %v, want the bad element skipped", got, gotErrs)
+	}
+}
+
+func TestStreamJSONCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"id\":1}\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	response, err := Get(server.URL, WithTimeout(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	values, errs := StreamJSON[streamEvent](ctx, response)
+	if first := <-values; first.ID != 1 {
+		t.Fatalf("first = %+v", first)
+	}
+	// 服务端不再发送数据，取消ctx后读取立即结束，不上报读取错误
+	cancel()
+	got, gotErrs := collectStream(t, values, errs)
+	if len(got) != 0 || len(gotErrs) != 0 {
+		t.Fatalf("values = %+v, errors = %v, want nothing after cancel", got, gotErrs)
+	}
+}
@@ -0,0 +1,104 @@
+package nhr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// TransferError 传输被取消或中断，errors.Is(err, context.Canceled)可以判断是否为主动取消
+type TransferError struct {
+	// Transferred 中断时已经写入的字节数，断点续传时包含文件已有的部分
+	Transferred int64
+	Err         error
+}
+
+func (e *TransferError) Error() string {
+	return fmt.Sprintf("transfer aborted after %v bytes:%v", e.Transferred, e.Err)
+}
+
+func (e *TransferError) Unwrap() error {
+	return e.Err
+}
+
+// Transfer 后台进行中的下载，Cancel中断请求和body的读取，Wait等待结束并返回结果
+// 可以被多个goroutine同时使用
+type Transfer struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu          sync.Mutex
+	transferred int64
+	err         error
+}
+
+// Cancel 中断下载，Wait返回的错误为*TransferError并满足errors.Is(err, context.Canceled)
+// 下载已经结束时什么都不做，可以重复调用
+func (t *Transfer) Cancel() {
+	t.cancel()
+}
+
+// Done 下载结束(完成、失败或取消)时关闭
+func (t *Transfer) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait 等待下载结束，返回写入的字节数以及错误
+func (t *Transfer) Wait() (int64, error) {
+	<-t.done
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.transferred, t.err
+}
+
+// DownloadAsync 使用DefaultClient在后台下载，见Client.DownloadAsync
+func DownloadAsync(rawURL string, dest io.Writer, options ...Option) *Transfer {
+	return DefaultClient.DownloadAsync(rawURL, dest, options...)
+}
+
+// DownloadFileAsync 使用DefaultClient在后台下载到文件，见Client.DownloadFileAsync
+func DownloadFileAsync(rawURL, path string, options ...Option) *Transfer {
+	return DefaultClient.DownloadFileAsync(rawURL, path, options...)
+}
+
+// DownloadAsync 在后台执行Download并立即返回，options中WithContext设置的context结束时同样中断下载
+func (c *Client) DownloadAsync(rawURL string, dest io.Writer, options ...Option) *Transfer {
+	return startTransfer(options, func(ctx context.Context) (int64, error) {
+		return c.Download(ctx, rawURL, dest, options...)
+	})
+}
+
+// DownloadFileAsync 在后台执行DownloadFile并立即返回，取消之后已经写入的部分保留在文件中，可以再次下载续传
+func (c *Client) DownloadFileAsync(rawURL, path string, options ...Option) *Transfer {
+	return startTransfer(options, func(ctx context.Context) (int64, error) {
+		return c.DownloadFile(ctx, rawURL, path, options...)
+	})
+}
+
+// startTransfer 以options中的context为父context启动后台传输
+func startTransfer(options []Option, run func(ctx context.Context) (int64, error)) *Transfer {
+	parent := newHttpRequests("", "", options...).Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	t := &Transfer{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		defer cancel()
+		n, err := run(ctx)
+		if err != nil && ctx.Err() != nil {
+			cause := err
+			if !errors.Is(err, ctx.Err()) {
+				cause = fmt.Errorf("%v:%w", err, ctx.Err())
+			}
+			err = &TransferError{Transferred: n, Err: cause}
+		}
+		t.mu.Lock()
+		t.transferred, t.err = n, err
+		t.mu.Unlock()
+	}()
+	return t
+}
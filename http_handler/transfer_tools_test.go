@@ -0,0 +1,142 @@
+package nhr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trickleServer 先写chunk，之后一直阻塞到客户端断开
+func trickleServer(t *testing.T, chunk string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(chunk))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransferCancelDuringBody(t *testing.T) {
+	server := trickleServer(t, strings.Repeat("a", 1024))
+	var dest syncBuffer
+	progressed := make(chan struct{}, 1)
+	transfer := DownloadAsync(server.URL, &dest, WithProgress(func(transferred, total int64) {
+		if transferred > 0 {
+			select {
+			case progressed <- struct{}{}:
+			default:
+			}
+		}
+	}))
+	select {
+	case <-progressed:
+	case <-time.After(time.Second):
+		t.Fatal("download did not start")
+	}
+	transfer.Cancel()
+	select {
+	case <-transfer.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Cancel did not abort the body copy")
+	}
+	n, err := transfer.Wait()
+	var transferErr *TransferError
+	if !errors.As(err, &transferErr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait error = %v, want *TransferError wrapping context.Canceled", err)
+	}
+	if n != 1024 || transferErr.Transferred != 1024 {
+		t.Fatalf("transferred = %v (%v in error), want 1024", n, transferErr.Transferred)
+	}
+}
+
+func TestTransferCancelBeforeResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	transfer := DownloadFileAsync(server.URL, filepath.Join(t.TempDir(), "out"))
+	time.Sleep(20 * time.Millisecond)
+	transfer.Cancel()
+	if _, err := transfer.Wait(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait error = %v, want context.Canceled", err)
+	}
+}
+
+func TestTransferHonorsWithContext(t *testing.T) {
+	server := trickleServer(t, "partial")
+	ctx, cancel := context.WithCancel(context.Background())
+	transfer := DownloadAsync(server.URL, &syncBuffer{}, WithContext(ctx))
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if _, err := transfer.Wait(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait error = %v, want context.Canceled from WithContext", err)
+	}
+}
+
+func TestTransferCancelAfterCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	var dest syncBuffer
+	transfer := DownloadAsync(server.URL, &dest)
+	n, err := transfer.Wait()
+	transfer.Cancel()
+	transfer.Cancel()
+	if again, againErr := transfer.Wait(); err != nil || n != 4 || again != n || againErr != nil {
+		t.Fatalf("after Cancel: %v, %v; before: %v, %v", again, againErr, n, err)
+	}
+	if dest.String() != "done" {
+		t.Fatalf("body = %q", dest.String())
+	}
+}
+
+func TestTransferCancelRacesCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	for i := 0; i < 50; i++ {
+		var dest syncBuffer
+		transfer := DownloadAsync(server.URL, &dest)
+		go transfer.Cancel()
+		go func() { <-transfer.Done() }()
+		n, err := transfer.Wait()
+		// 取消与完成先后不定，但结果必须一致：要么完整成功，要么是取消错误
+		if err == nil && n != 4 {
+			t.Fatalf("successful transfer wrote %v bytes", n)
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			t.Fatalf("Wait error = %v, want nil or context.Canceled", err)
+		}
+	}
+}
+
+// syncBuffer 可以在写入的同时被其他goroutine读取
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
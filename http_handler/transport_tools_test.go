@@ -0,0 +1,90 @@
+package nhr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTLSOptions(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// 默认client拒绝证书时服务端会记录握手错误
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	if _, err := Get(server.URL); err == nil {
+		t.Fatal("the default client should reject the self-signed certificate")
+	}
+	tests := []struct {
+		name    string
+		options []Option
+	}{
+		{name: "insecure skip verify", options: []Option{WithInsecureSkipVerify()}},
+		{name: "server cert pool", options: []Option{WithTLSConfig(&tls.Config{RootCAs: pool})}},
+		{name: "composes with timeout", options: []Option{WithTimeout(5 * time.Second), WithInsecureSkipVerify()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := Get(server.URL, tt.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("status = %v", response.StatusCode)
+			}
+		})
+	}
+}
+
+func TestWithTLSConfigDoesNotModifyConfig(t *testing.T) {
+	cfg := &tls.Config{}
+	if _, err := tlsConfigFor(requestTransportKey(newHttpRequests(http.MethodGet, "", WithTLSConfig(cfg), WithInsecureSkipVerify()))); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.InsecureSkipVerify {
+		t.Fatal("WithInsecureSkipVerify should apply to a copy of the config")
+	}
+}
+
+func TestWithProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 代理收到的是完整的URL
+		if r.URL.Host == "upstream.example" {
+			atomic.AddInt32(&proxied, 1)
+		}
+	}))
+	t.Cleanup(proxy.Close)
+	response, err := Get("http://upstream.example/v1", WithProxy(proxy.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if atomic.LoadInt32(&proxied) != 1 {
+		t.Fatal("the request should go through the proxy")
+	}
+
+	for _, proxyURL := range []string{"://bad", "ftp://proxy:21", "http://"} {
+		if _, err := Get("http://upstream.example", WithProxy(proxyURL)); err == nil || !strings.Contains(err.Error(), "proxy url") {
+			t.Fatalf("WithProxy(%q) error = %v, want a proxy url error", proxyURL, err)
+		}
+	}
+}
+
+func TestWithClientCertMissingFile(t *testing.T) {
+	_, err := Get("https://127.0.0.1:1", WithClientCert("missing.crt", "missing.key"))
+	if err == nil || !strings.Contains(err.Error(), "load client certificate") {
+		t.Fatalf("error = %v, want a certificate load error", err)
+	}
+}
@@ -0,0 +1,204 @@
+package nhr
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// URLBuilder 逐步拼接接口URL，在Build时统一校验并返回错误
+// NewURL("https://host/").Path("/api/users").PathParams(42).Query(map[string]string{"q": "a b"}).Build()
+// 得到 https://host/api/users/42?q=a+b
+type URLBuilder struct {
+	spec       URLSpec
+	basePath   string
+	path       string
+	pathParams []interface{}
+	err        error
+}
+
+// NewURL 创建URLBuilder，host可以带scheme、端口、路径前缀和末尾的/，如 http://host:8080/api/
+// host中的scheme可以被Scheme覆盖，没有scheme时默认为https
+func NewURL(host string) *URLBuilder {
+	b := &URLBuilder{}
+	var err error
+	if b.spec.Scheme, b.spec.Host, b.basePath, err = splitHostBase(host); err != nil {
+		b.setErr(err)
+	}
+	return b
+}
+
+// splitHostBase 拆分host中的scheme、host:port和路径前缀，路径前缀去掉末尾的/
+// 重复的scheme(如 https://https://host)以及带有:但没有端口的host返回错误
+func splitHostBase(host string) (scheme, hostport, basePath string, err error) {
+	rest := host
+	if i := strings.Index(rest, "://"); i >= 0 && !strings.Contains(rest[:i], "/") {
+		scheme, rest = rest[:i], rest[i+3:]
+	}
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		if strings.HasSuffix(rest[:i], ":") && strings.HasPrefix(rest[i:], "//") {
+			return "", "", "", fmt.Errorf("host %q contains more than one scheme", host)
+		}
+		rest, basePath = rest[:i], strings.TrimRight(rest[i:], "/")
+	}
+	if rest != "" {
+		if _, _, err := SplitHostPort(rest); err != nil {
+			return "", "", "", err
+		}
+	}
+	return scheme, rest, basePath, nil
+}
+
+// Scheme 设置scheme，如http、https
+func (b *URLBuilder) Scheme(scheme string) *URLBuilder {
+	b.spec.Scheme = scheme
+	return b
+}
+
+// Path 设置接口路径，开头的/可以省略，路径中的查询参数会合并到Query中
+// 路径中的{name}由PathVars替换，完整的URL应该传给NewURL
+func (b *URLBuilder) Path(apiUrl string) *URLBuilder {
+	if strings.Contains(apiUrl, "://") {
+		b.setErr(fmt.Errorf("apiUrl %q must be a path, pass absolute urls to NewURL", apiUrl))
+		return b
+	}
+	path, rawQuery := apiUrl, ""
+	if i := strings.IndexByte(apiUrl, '?'); i >= 0 {
+		path, rawQuery = apiUrl[:i], apiUrl[i+1:]
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		b.setErr(fmt.Errorf("invalid query in apiUrl %q:%v", apiUrl, err))
+		return b
+	}
+	b.path = path
+	b.addQuery(values)
+	return b
+}
+
+// PathParams 按顺序在路径之后追加路径参数，每个参数都会经过url.PathEscape转义
+func (b *URLBuilder) PathParams(pathParam ...interface{}) *URLBuilder {
+	b.pathParams = append(b.pathParams, pathParam...)
+	return b
+}
+
+// PathVars 设置路径中{name}的值，值会经过url.PathEscape转义
+func (b *URLBuilder) PathVars(vars map[string]string) *URLBuilder {
+	if b.spec.PathVars == nil {
+		b.spec.PathVars = make(map[string]string, len(vars))
+	}
+	for key, value := range vars {
+		b.spec.PathVars[key] = value
+	}
+	return b
+}
+
+// Query 追加查询参数，多次调用时同名参数会保留多个值，输出时按参数名排序
+func (b *URLBuilder) Query(params map[string]string) *URLBuilder {
+	values := make(url.Values, len(params))
+	for key, value := range params {
+		values.Set(key, value)
+	}
+	b.addQuery(values)
+	return b
+}
+
+func (b *URLBuilder) addQuery(values url.Values) {
+	for key, list := range values {
+		if b.spec.Query == nil {
+			b.spec.Query = make(map[string][]string)
+		}
+		b.spec.Query[key] = append(b.spec.Query[key], list...)
+	}
+}
+
+// setErr 只记录第一个错误
+func (b *URLBuilder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Build 校验并生成最终的URL，host为空、scheme或路径参数不合法时返回错误
+func (b *URLBuilder) Build() (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+	spec := b.spec
+	spec.PathTemplate = b.basePath
+	if path := strings.TrimLeft(b.path, "/"); path != "" {
+		spec.PathTemplate += "/" + path
+	}
+	params := escapePathParams(b.pathParams)
+	if params != "" {
+		spec.PathTemplate = strings.TrimRight(spec.PathTemplate, "/") + params
+	}
+	return spec.Build()
+}
+
+// BuildURL 将URL模板中的{name}替换为vars中的值，如 BuildURL("https://{host}/users/{id}/posts", vars)
+// host部分的值不能包含/、?、#、@、\、%和空白等会改变URL结构的字符，替换后按IDNA转换并校验
+// path和fragment中的值经过url.PathEscape转义，查询参数中的值经过url.QueryEscape转义
+// 缺少变量、括号不匹配、host变量不合法或结果不是完整的URL时返回错误
+func BuildURL(tmpl string, vars map[string]string) (string, error) {
+	rest, prefix := tmpl, ""
+	if i := strings.Index(rest, "://"); i >= 0 {
+		authorityEnd := strings.IndexAny(rest[i+3:], "/?#")
+		if authorityEnd < 0 {
+			authorityEnd = len(rest) - i - 3
+		}
+		var hostErr error
+		authority, err := expandTemplate(rest[:i+3+authorityEnd], vars, func(s string) string {
+			if hostErr == nil && !validHostVar(s) {
+				hostErr = &URLSpecError{Field: "PathVars", Value: s, Reason: "host variable must not contain URL delimiters, escapes or spaces"}
+			}
+			return s
+		})
+		if err != nil {
+			return "", err
+		}
+		if hostErr != nil {
+			return "", hostErr
+		}
+		prefix, rest = authority, rest[i+3+authorityEnd:]
+	}
+	var fragment, query string
+	if i := strings.IndexByte(rest, '#'); i >= 0 {
+		rest, fragment = rest[:i], rest[i:]
+	}
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest, query = rest[:i], rest[i:]
+	}
+	path, err := expandPathTemplate(rest, vars)
+	if err != nil {
+		return "", err
+	}
+	if query, err = expandTemplate(query, vars, url.QueryEscape); err != nil {
+		return "", err
+	}
+	if fragment, err = expandTemplate(fragment, vars, url.PathEscape); err != nil {
+		return "", err
+	}
+	raw := prefix + path + query + fragment
+	urlObj, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q built from template %q:%v", raw, tmpl, err)
+	}
+	if !urlObj.IsAbs() || urlObj.Host == "" {
+		return "", fmt.Errorf("url %q built from template %q must be absolute", raw, tmpl)
+	}
+	if urlObj.Host, err = toASCIIHostPort(urlObj.Host); err != nil {
+		return "", err
+	}
+	return urlObj.String(), nil
+}
+
+// validHostVar host变量的值不能改变URL的结构，例如通过@把原来的host变成userinfo
+func validHostVar(value string) bool {
+	for _, r := range value {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune("/?#@\\%", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package nhr
+
+import "testing"
+
+func TestURLBuilder(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   *URLBuilder
+		want    string
+		wantErr bool
+	}{
+		{name: "path and query", build: NewURL("api.example.com").Path("/v1/users").Query(map[string]string{"q": "a b", "page": "2"}), want: "https://api.example.com/v1/users?page=2&q=a+b"},
+		{name: "host with scheme and trailing slash", build: NewURL("https://api.example.com/").Path("/api"), want: "https://api.example.com/api"},
+		{name: "scheme override", build: NewURL("https://api.example.com").Scheme("http").Path("v1"), want: "http://api.example.com/v1"},
+		{name: "base path", build: NewURL("http://api.example.com:8080/base/").Path("/v1"), want: "http://api.example.com:8080/base/v1"},
+		{name: "unicode path params", build: NewURL("api.example.com").Path("/files").PathParams("报告 2024", 7), want: "https://api.example.com/files/%E6%8A%A5%E5%91%8A%202024/7"},
+		{name: "reserved characters in path params", build: NewURL("api.example.com").Path("/files/").PathParams("a/b?c#d"), want: "https://api.example.com/files/a%2Fb%3Fc%23d"},
+		{name: "reserved characters in query", build: NewURL("api.example.com").Path("/search").Query(map[string]string{"q": "a&b=c#d"}), want: "https://api.example.com/search?q=a%26b%3Dc%23d"},
+		{name: "query in path merged", build: NewURL("api.example.com").Path("/search?page=1").Query(map[string]string{"page": "2"}), want: "https://api.example.com/search?page=1&page=2"},
+		{name: "path vars", build: NewURL("api.example.com").Path("/users/{id}/posts").PathVars(map[string]string{"id": "a/b"}), want: "https://api.example.com/users/a%2Fb/posts"},
+		{name: "unicode host", build: NewURL("bücher.example").Path("/v1"), want: "https://xn--bcher-kva.example/v1"},
+		{name: "empty host", build: NewURL("").Path("/v1"), wantErr: true},
+		{name: "absolute path", build: NewURL("api.example.com").Path("https://other.example.com/v1"), wantErr: true},
+		{name: "invalid query in path", build: NewURL("api.example.com").Path("/v1?a=%zz"), wantErr: true},
+		{name: "invalid scheme", build: NewURL("api.example.com").Scheme("ht tp").Path("/v1"), wantErr: true},
+		{name: "duplicated scheme", build: NewURL("https://https://api.example.com").Path("/v1"), wantErr: true},
+		{name: "colon without port", build: NewURL("api.example.com:").Path("/v1"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.build.Build()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Build() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Build() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		vars    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "host and path vars", tmpl: "https://{host}/users/{id}/posts", vars: map[string]string{"host": "api.example.com", "id": "42"}, want: "https://api.example.com/users/42/posts"},
+		{name: "host with port var", tmpl: "http://{host}:{port}/v1", vars: map[string]string{"host": "127.0.0.1", "port": "8080"}, want: "http://127.0.0.1:8080/v1"},
+		{name: "subdomain var", tmpl: "https://{tenant}.example.com/v1", vars: map[string]string{"tenant": "acme"}, want: "https://acme.example.com/v1"},
+		{name: "unicode host var", tmpl: "https://{host}/v1", vars: map[string]string{"host": "bücher.example"}, want: "https://xn--bcher-kva.example/v1"},
+		{name: "path var escaped", tmpl: "https://api.example.com/files/{name}", vars: map[string]string{"name": "a/b c?"}, want: "https://api.example.com/files/a%2Fb%20c%3F"},
+		{name: "query var escaped", tmpl: "https://api.example.com/search?q={q}", vars: map[string]string{"q": "a&b=c"}, want: "https://api.example.com/search?q=a%26b%3Dc"},
+		{name: "fragment var escaped", tmpl: "https://api.example.com/doc#{anchor}", vars: map[string]string{"anchor": "a b"}, want: "https://api.example.com/doc#a%20b"},
+		{name: "host var with userinfo", tmpl: "https://{host}/v1", vars: map[string]string{"host": "evil.example@api.example.com"}, wantErr: true},
+		{name: "host var with path", tmpl: "https://{host}/v1", vars: map[string]string{"host": "evil.example/x"}, wantErr: true},
+		{name: "host var with query", tmpl: "https://{host}/v1", vars: map[string]string{"host": "evil.example?x="}, wantErr: true},
+		{name: "host var with fragment", tmpl: "https://{tenant}.example.com/v1", vars: map[string]string{"tenant": "evil.example#"}, wantErr: true},
+		{name: "host var with space", tmpl: "https://{host}/v1", vars: map[string]string{"host": "api example.com"}, wantErr: true},
+		{name: "host var with escape", tmpl: "https://{host}/v1", vars: map[string]string{"host": "api%2eexample.com"}, wantErr: true},
+		{name: "empty host", tmpl: "https://{host}/v1", vars: map[string]string{"host": ""}, wantErr: true},
+		{name: "missing var", tmpl: "https://api.example.com/users/{id}", vars: map[string]string{}, wantErr: true},
+		{name: "unclosed brace", tmpl: "https://api.example.com/users/{id", vars: map[string]string{"id": "1"}, wantErr: true},
+		{name: "relative template", tmpl: "/users/{id}", vars: map[string]string{"id": "1"}, wantErr: true},
+		{name: "bad port", tmpl: "http://{host}:{port}/v1", vars: map[string]string{"host": "127.0.0.1", "port": "99999"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildURL(tt.tmpl, tt.vars)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("BuildURL(%q) = %q, want an error", tt.tmpl, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("BuildURL(%q) = %q, %v, want %q", tt.tmpl, got, err, tt.want)
+			}
+		})
+	}
+}
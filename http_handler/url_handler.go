@@ -2,26 +2,331 @@ package nhr
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
 )
 
 // MontageUrl 拼接测试的接口URL，但是不拼接查询参数，主要是为了拼接最终的url
 // 路径参数格式为列表 ["334","456"]
 // 当路径参数没有时，拼接的路径为 https://host/apiUrl
 // 当路径参数参数有时，按路径顺序拼接的路径为 https://host/apiUrl/pathParam/334/456
+// apiUrl是带scheme的完整URL时，直接在其后拼接路径参数
+// 拼接失败时通过SetLogger设置的Logger告警并返回空字符串，需要知道失败原因时使用JoinURL或NewURL
 func MontageUrl(host, apiUrl string, pathParam ...interface{}) string {
-	if string(apiUrl[0]) != "/" || strings.Contains(apiUrl, host) {
+	ret, err := JoinURL(host, apiUrl, pathParam...)
+	if err != nil {
+		logWarning(fmt.Sprintf("MontageUrl: %v", err))
 		return ""
 	}
+	return ret
+}
+
+// JoinURL 与MontageUrl相同，但是在拼接失败时返回错误
+// apiUrl带有scheme时视为完整URL，忽略host，只在path后拼接路径参数，原有的查询参数保持不变
+// apiUrl以/开头时视为接口路径，拼接为 https://host/apiUrl，host可以带端口，IPv6地址会自动加上方括号
+// host也可以带scheme和路径前缀，如 http://host/api/，末尾的/不会产生重复的/
+// 其余情况(比如不带scheme的example.com/path)无法判断意图，返回错误
+// 每个路径参数都会经过url.PathEscape转义，拼接结果无法被url.Parse解析时返回错误
+// 需要拼接查询参数时使用NewURL，或者在请求时使用WithParams
+func JoinURL(host, apiUrl string, pathParam ...interface{}) (string, error) {
+	urlObj, err := url.Parse(apiUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid apiUrl %q:%v", apiUrl, err)
+	}
+
+	switch {
+	case urlObj.IsAbs() && urlObj.Host != "":
+		// 完整URL，直接使用
+	case urlObj.IsAbs() || urlObj.Host != "" || !strings.HasPrefix(apiUrl, "/"):
+		return "", fmt.Errorf("apiUrl %q is neither an absolute url with scheme nor a path starting with /", apiUrl)
+	case host == "":
+		return "", fmt.Errorf("host is empty for apiUrl %q", apiUrl)
+	default:
+		scheme, hostport, basePath, err := splitHostBase(host)
+		if err != nil {
+			return "", err
+		}
+		if scheme == "" {
+			scheme = "https"
+		}
+		if hostport == "" {
+			return "", fmt.Errorf("host is empty for apiUrl %q", apiUrl)
+		}
+		escapedPath := basePath + urlObj.EscapedPath()
+		path, err := url.PathUnescape(escapedPath)
+		if err != nil {
+			return "", fmt.Errorf("invalid path prefix in host %q:%v", host, err)
+		}
+		urlObj.Scheme, urlObj.Host = strings.ToLower(scheme), hostport
+		urlObj.Path, urlObj.RawPath = path, escapedPath
+	}
+	urlHost, err := toASCIIHostPort(urlObj.Host)
+	if err != nil {
+		return "", err
+	}
+	urlObj.Host = urlHost
+
+	// 只在path部分拼接路径参数，apiUrl中的查询参数保持不变
+	escapedPath := urlObj.EscapedPath()
+	if escapedParams := escapePathParams(pathParam); escapedParams != "" {
+		escapedPath = strings.TrimRight(escapedPath, "/") + escapedParams
+	}
+	path, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		return "", fmt.Errorf("join path params to %q failed:%v", apiUrl, err)
+	}
+	urlObj.Path, urlObj.RawPath = path, escapedPath
+	// host是直接拼进URL结构体的，重新解析一遍，非法字符在拼接时就报错而不是等到发送请求时
+	ret := urlObj.String()
+	if _, err := url.Parse(ret); err != nil {
+		return "", fmt.Errorf("invalid host %q:%v", host, err)
+	}
+	return ret, nil
+}
+
+// SplitHostPort 安全地拆分host和port，port可以省略
+// 支持 example.com、example.com:8080、[fd00::12]、[fd00::12]:8443 以及不带方括号的IPv6地址 fd00::12
+// 返回的host不带方括号，IPv6的zone使用未编码的形式，如fe80::1%eth0
+// 带有:但没有端口时返回错误，如 example.com:
+func SplitHostPort(hostport string) (host, port string, err error) {
+	hostport = strings.Replace(hostport, "%25", "%", 1)
+	withPort := false
+	switch {
+	case strings.HasPrefix(hostport, "["):
+		if strings.HasSuffix(hostport, "]") {
+			host = hostport[1 : len(hostport)-1]
+		} else if host, port, err = net.SplitHostPort(hostport); err != nil {
+			return "", "", fmt.Errorf("invalid host %q:%v", hostport, err)
+		} else {
+			withPort = true
+		}
+	case strings.Count(hostport, ":") > 1:
+		// 不带方括号的IPv6地址，不可能带有端口
+		host = hostport
+	case strings.Contains(hostport, ":"):
+		if host, port, err = net.SplitHostPort(hostport); err != nil {
+			return "", "", fmt.Errorf("invalid host %q:%v", hostport, err)
+		}
+		withPort = true
+	default:
+		host = hostport
+	}
+	// 带有:或者方括号的host必须是IPv6地址
+	if (strings.Contains(host, ":") || strings.HasPrefix(hostport, "[")) && (!strings.Contains(host, ":") || net.ParseIP(strings.SplitN(host, "%", 2)[0]) == nil) {
+		return "", "", fmt.Errorf("invalid IPv6 host %q", hostport)
+	}
+	if withPort {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", "", fmt.Errorf("invalid port %q in host %q", port, hostport)
+		}
+	}
+	return host, port, nil
+}
+
+// joinHostPort 拼接URL中的host部分，IPv6地址会加上方括号，port为空时省略
+func joinHostPort(host, port string) string {
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
 
-	if len(pathParam) == 0 {
-		return fmt.Sprintf("https://%v%v", host, apiUrl)
+// toASCIIHostPort 将host:port转为可以直接放入url.URL.Host的形式
+// unicode域名按IDNA 2008转为punycode(xn--)，IP地址和纯ASCII的域名保持不变
+func toASCIIHostPort(hostport string) (string, error) {
+	host, port, err := SplitHostPort(hostport)
+	if err != nil {
+		return "", err
+	}
+	asciiHost, err := toASCIIHost(host)
+	if err != nil {
+		return "", err
+	}
+	return joinHostPort(asciiHost, port), nil
+}
+
+// idnaProfile 按IDNA 2008做DNS查询前的转换，同时校验label的长度，空label视为非法
+var idnaProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+// toASCIIHost 将unicode域名转为punycode，非法的label返回错误
+func toASCIIHost(host string) (string, error) {
+	if isASCII(host) || net.ParseIP(strings.SplitN(host, "%", 2)[0]) != nil {
+		return host, nil
+	}
+	asciiHost, err := idnaProfile.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid internationalized host %q:%v", host, err)
+	}
+	return asciiHost, nil
+}
+
+// displayHost 返回用于日志和错误信息展示的unicode形式的域名，转换失败时原样返回
+func displayHost(host string) string {
+	if !strings.Contains(host, "xn--") {
+		return host
+	}
+	unicodeHost, err := idna.Display.ToUnicode(host)
+	if err != nil {
+		return host
 	}
+	return unicodeHost
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// escapePathParams 转义路径参数，并按顺序拼接为 /p1/p2
+func escapePathParams(pathParam []interface{}) string {
 	var newPathParam string
-	if len(pathParam) >= 1 {
-		for _, v := range pathParam {
-			newPathParam += fmt.Sprintf("/%v", v)
+	for _, v := range pathParam {
+		newPathParam += "/" + url.PathEscape(fmt.Sprint(v))
+	}
+	return newPathParam
+}
+
+// defaultPorts 各scheme的默认端口，NormalizeURL会去掉这些端口
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// NormalizeURL 规范化URL，避免拼接出的 https://host//v1/./orders/../orders/123 被严格的网关拒绝
+// 1、合并path中重复的/，scheme后面的//不受影响
+// 2、按RFC 3986处理path中的.和..
+// 3、scheme和host转为小写，去掉默认端口(https的443，http的80)
+// 查询参数和fragment保持不变
+func NormalizeURL(raw string) (string, error) {
+	urlObj, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("parse url %q failed:%v", raw, err)
+	}
+	urlObj.Scheme = strings.ToLower(urlObj.Scheme)
+	urlObj.Host = strings.ToLower(urlObj.Host)
+	if port := urlObj.Port(); port != "" && defaultPorts[urlObj.Scheme] == port {
+		urlObj.Host = strings.TrimSuffix(urlObj.Host, ":"+port)
+	}
+	if urlObj.Opaque == "" {
+		escapedPath := normalizePath(urlObj.EscapedPath())
+		path, err := url.PathUnescape(escapedPath)
+		if err != nil {
+			return "", fmt.Errorf("normalize path of %q failed:%v", raw, err)
+		}
+		urlObj.Path, urlObj.RawPath = path, escapedPath
+	}
+	return urlObj.String(), nil
+}
+
+// normalizePath 合并重复的/并处理.和..，保留末尾的/
+// ..超出根路径时停留在根路径
+func normalizePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	absolute := strings.HasPrefix(path, "/")
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	trailingSlash := false
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case "":
+			trailingSlash = last && i > 0
+			continue
+		case ".":
+			trailingSlash = last
+			continue
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			trailingSlash = last
+			continue
+		}
+		trailingSlash = false
+		out = append(out, segment)
+	}
+	ret := strings.Join(out, "/")
+	if absolute {
+		ret = "/" + ret
+	}
+	if trailingSlash && !strings.HasSuffix(ret, "/") {
+		ret += "/"
+	}
+	return ret
+}
+
+// ResolveURL 按RFC 3986将ref解析为相对于base的URL，规则如下:
+// 1、ref是带scheme的完整URL时直接使用ref
+// 2、ref以/开头时替换base的整个path，如 https://host/api/v2 + /users/1 = https://host/users/1
+// 3、其余相对路径追加在base的path之后，base的path始终视为目录，如 https://host/api/v2 + users/1 = https://host/api/v2/users/1
+// 需要保证请求始终落在base的路径前缀之下时使用StrictJoinURL
+func ResolveURL(base, ref string) (string, error) {
+	baseObj, refObj, err := parseBaseAndRef(base, ref)
+	if err != nil {
+		return "", err
+	}
+	return baseObj.ResolveReference(refObj).String(), nil
+}
+
+// StrictJoinURL 将ref始终视为base路径前缀之下的子路径，这也是大多数API客户端真正需要的行为
+// ref开头的/会被忽略，ref不能是完整URL，..超出base的路径前缀时返回错误
+func StrictJoinURL(base, ref string) (string, error) {
+	baseObj, refObj, err := parseBaseAndRef(base, ref)
+	if err != nil {
+		return "", err
+	}
+	if refObj.Scheme != "" || refObj.Host != "" {
+		return "", fmt.Errorf("ref %q must be a path relative to base %q", ref, base)
+	}
+	prefix := strings.TrimRight(baseObj.EscapedPath(), "/")
+	escapedPath := normalizePath(prefix + "/" + strings.TrimLeft(refObj.EscapedPath(), "/"))
+	if escapedPath != prefix && !strings.HasPrefix(escapedPath, prefix+"/") {
+		return "", fmt.Errorf("ref %q escapes base path %q", ref, prefix)
+	}
+	path, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		return "", fmt.Errorf("join ref %q to base %q failed:%v", ref, base, err)
+	}
+	joined := *baseObj
+	joined.Path, joined.RawPath = path, escapedPath
+	joined.RawQuery, joined.Fragment, joined.RawFragment = refObj.RawQuery, refObj.Fragment, refObj.RawFragment
+	return joined.String(), nil
+}
+
+// parseBaseAndRef 解析base和ref，base必须是完整URL，并统一以/结尾以便相对路径追加在其后
+func parseBaseAndRef(base, ref string) (*url.URL, *url.URL, error) {
+	baseObj, err := url.Parse(base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid base url %q:%v", base, err)
+	}
+	if !baseObj.IsAbs() || baseObj.Host == "" {
+		return nil, nil, fmt.Errorf("base url %q must be absolute", base)
+	}
+	refObj, err := url.Parse(ref)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ref %q:%v", ref, err)
+	}
+	if !strings.HasSuffix(baseObj.Path, "/") {
+		baseObj.Path += "/"
+		if baseObj.RawPath != "" {
+			baseObj.RawPath += "/"
 		}
 	}
-	return fmt.Sprintf("https://%v%v%v", host, apiUrl, newPathParam)
+	return baseObj, refObj, nil
 }
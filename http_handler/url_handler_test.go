@@ -0,0 +1,259 @@
+package nhr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJoinURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		apiUrl  string
+		params  []interface{}
+		want    string
+		wantErr bool
+	}{
+		{name: "relative path", host: "api.example.com", apiUrl: "/v1/orders", want: "https://api.example.com/v1/orders"},
+		{name: "path params escaped", host: "api.example.com", apiUrl: "/v1/orders", params: []interface{}{"a b", 12}, want: "https://api.example.com/v1/orders/a%20b/12"},
+		{name: "host with scheme and prefix", host: "http://api.example.com/base/", apiUrl: "/v1", want: "http://api.example.com/base/v1"},
+		{name: "host with port", host: "api.example.com:8443", apiUrl: "/v1", want: "https://api.example.com:8443/v1"},
+		{name: "ipv6 host", host: "fd00::12", apiUrl: "/v1", want: "https://[fd00::12]/v1"},
+		{name: "path contains host", host: "example.com", apiUrl: "/mirror/example.com/index", want: "https://example.com/mirror/example.com/index"},
+		{name: "absolute url passthrough", host: "ignored.example.com", apiUrl: "https://api.qa.example.com/v1/orders", want: "https://api.qa.example.com/v1/orders"},
+		{name: "absolute url with params and query", apiUrl: "https://api.qa.example.com/v1/orders/?page=2", params: []interface{}{"123"}, want: "https://api.qa.example.com/v1/orders/123?page=2"},
+		{name: "absolute url same host", host: "api.example.com", apiUrl: "https://api.example.com/v1", want: "https://api.example.com/v1"},
+		{name: "unicode host", host: "bücher.example", apiUrl: "/v1", want: "https://xn--bcher-kva.example/v1"},
+		{name: "ambiguous host-like path", host: "api.example.com", apiUrl: "example.com/path", wantErr: true},
+		{name: "relative without slash", host: "api.example.com", apiUrl: "v1/orders", wantErr: true},
+		{name: "scheme without host", host: "api.example.com", apiUrl: "mailto:someone@example.com", wantErr: true},
+		{name: "protocol relative", host: "api.example.com", apiUrl: "//cdn.example.com/a", wantErr: true},
+		{name: "empty host", apiUrl: "/v1", wantErr: true},
+		{name: "malformed apiUrl", host: "api.example.com", apiUrl: "https://[::1/x", wantErr: true},
+		{name: "bad port", host: "api.example.com:99999", apiUrl: "/v1", wantErr: true},
+		{name: "scheme and port", host: "http://127.0.0.1:8080", apiUrl: "/v1/orders", params: []interface{}{7}, want: "http://127.0.0.1:8080/v1/orders/7"},
+		{name: "ipv6 host with port", host: "[fd00::12]:8443", apiUrl: "/v1", want: "https://[fd00::12]:8443/v1"},
+		{name: "path param with slash and query characters", host: "api.example.com", apiUrl: "/v1/files", params: []interface{}{"a/b?c#d"}, want: "https://api.example.com/v1/files/a%2Fb%3Fc%23d"},
+		{name: "host with space", host: "bad host", apiUrl: "/v1", wantErr: true},
+		{name: "host with control character", host: "api.example.com\n", apiUrl: "/v1", wantErr: true},
+		{name: "duplicated scheme", host: "https://https://api.example.com", apiUrl: "/api", wantErr: true},
+		{name: "colon without port", host: "api.example.com:", apiUrl: "/api", wantErr: true},
+		{name: "colon without port before prefix", host: "http://api.example.com:/base", apiUrl: "/api", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JoinURL(tt.host, tt.apiUrl, tt.params...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("JoinURL(%q, %q) = %q, want an error", tt.host, tt.apiUrl, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("JoinURL(%q, %q) = %q, %v, want %q", tt.host, tt.apiUrl, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMontageUrlReturnsEmptyOnError(t *testing.T) {
+	if got := MontageUrl("api.example.com", "example.com/path"); got != "" {
+		t.Fatalf("MontageUrl = %q, want empty string", got)
+	}
+	if got := MontageUrl("api.example.com", "/v1", "x"); got != "https://api.example.com/v1/x" {
+		t.Fatalf("MontageUrl = %q", got)
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "https://host//v1/./orders/../orders/123", want: "https://host/v1/orders/123"},
+		{raw: "https://host/v1//orders///", want: "https://host/v1/orders/"},
+		{raw: "https://host", want: "https://host"},
+		{raw: "https://host/", want: "https://host/"},
+		{raw: "https://host/a/b/..", want: "https://host/a/"},
+		{raw: "https://host/a/./", want: "https://host/a/"},
+		{raw: "https://host/../../a", want: "https://host/a"},
+		{raw: "https://host/a/%2F/b", want: "https://host/a/%2F/b"},
+		{raw: "https://host/a%20b/../c", want: "https://host/c"},
+		{raw: "HTTPS://Example.COM:443/A", want: "https://example.com/A"},
+		{raw: "http://example.com:80/a", want: "http://example.com/a"},
+		{raw: "http://example.com:443/a", want: "http://example.com:443/a"},
+		{raw: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{raw: "wss://example.com:443/socket", want: "wss://example.com/socket"},
+		{raw: "http://[FD00::1]:80/a", want: "http://[fd00::1]/a"},
+		{raw: "https://host//a?next=//b/../c#frag//x", want: "https://host/a?next=//b/../c#frag//x"},
+		{raw: "https://host/a?Q=Upper", want: "https://host/a?Q=Upper"},
+		{raw: "mailto:Someone@Example.com", want: "mailto:Someone@Example.com"},
+		{raw: "https://host/%zz", wantErr: true},
+		{raw: "https://[::1/x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeURL(tt.raw)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NormalizeURL(%q) = %q, want an error", tt.raw, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestWithNormalizeURL(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.RawPath
+		if path == "" {
+			path = r.URL.Path
+		}
+	}))
+	defer server.Close()
+
+	session := NewSession(server.URL+"/api/", WithNormalizeURL())
+	response, err := session.Get("./v1//orders/../orders/123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if path != "/api/v1/orders/123" {
+		t.Fatalf("path = %q, want the normalized path", path)
+	}
+
+	response, err = Get(server.URL + "//a/./b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if path != "//a/./b" {
+		t.Fatalf("path without WithNormalizeURL = %q, want it unchanged", path)
+	}
+}
+
+func TestResolveAndStrictJoinURL(t *testing.T) {
+	// 每种base分别有不带和带结尾/两种写法，结果应该相同
+	bases := []struct {
+		name  string
+		bases []string
+		// resolve、strict 与refs一一对应，strict为空表示StrictJoinURL返回错误
+		resolve []string
+		strict  []string
+	}{
+		{
+			name:    "host only",
+			bases:   []string{"https://h.test", "https://h.test/"},
+			resolve: []string{"https://h.test/users/1", "https://h.test/users/1", "https://h.test/users", "https://h.test/users?id=1&q=a%20b", "https://other.test/x"},
+			strict:  []string{"https://h.test/users/1", "https://h.test/users/1", "https://h.test/users", "https://h.test/users?id=1&q=a%20b", ""},
+		},
+		{
+			name:    "path prefix",
+			bases:   []string{"https://h.test/api/v2", "https://h.test/api/v2/"},
+			resolve: []string{"https://h.test/api/v2/users/1", "https://h.test/users/1", "https://h.test/api/users", "https://h.test/api/v2/users?id=1&q=a%20b", "https://other.test/x"},
+			strict:  []string{"https://h.test/api/v2/users/1", "https://h.test/api/v2/users/1", "", "https://h.test/api/v2/users?id=1&q=a%20b", ""},
+		},
+	}
+	refs := []string{"users/1", "/users/1", "../users", "users?id=1&q=a%20b", "https://other.test/x"}
+	for _, tt := range bases {
+		for _, base := range tt.bases {
+			for i, ref := range refs {
+				got, err := ResolveURL(base, ref)
+				if err != nil || got != tt.resolve[i] {
+					t.Errorf("%v: ResolveURL(%q, %q) = %q, %v, want %q", tt.name, base, ref, got, err, tt.resolve[i])
+				}
+				got, err = StrictJoinURL(base, ref)
+				if tt.strict[i] == "" {
+					if err == nil {
+						t.Errorf("%v: StrictJoinURL(%q, %q) = %q, want an error", tt.name, base, ref, got)
+					}
+					continue
+				}
+				if err != nil || got != tt.strict[i] {
+					t.Errorf("%v: StrictJoinURL(%q, %q) = %q, %v, want %q", tt.name, base, ref, got, err, tt.strict[i])
+				}
+			}
+		}
+	}
+}
+
+func TestStrictJoinURLErrors(t *testing.T) {
+	tests := []struct {
+		base, ref string
+		want      string
+	}{
+		{base: "/api", ref: "users", want: "must be absolute"},
+		{base: "https://h.test/api", ref: "https://other.test/users", want: "must be a path relative to base"},
+		{base: "https://h.test/api", ref: "//other.test/users", want: "must be a path relative to base"},
+		{base: "https://h.test/api/v2", ref: "users/../../../admin", want: "escapes base path"},
+		{base: "https://h.test/api/v2", ref: "/../v1/users", want: "escapes base path"},
+		{base: "https://h.test/api", ref: "%zz", want: "invalid ref"},
+		{base: "://h.test", ref: "users", want: "invalid base url"},
+	}
+	for _, tt := range tests {
+		got, err := StrictJoinURL(tt.base, tt.ref)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("StrictJoinURL(%q, %q) = %q, %v, want an error containing %q", tt.base, tt.ref, got, err, tt.want)
+		}
+	}
+	// 回到base路径前缀之内的..是允许的
+	if got, err := StrictJoinURL("https://h.test/api/v2", "users/../orders"); err != nil || got != "https://h.test/api/v2/orders" {
+		t.Fatalf("StrictJoinURL = %q, %v, want the path kept under the prefix", got, err)
+	}
+}
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		hostport   string
+		host, port string
+		ascii      string
+		wantErr    string
+	}{
+		{hostport: "example.com", host: "example.com", ascii: "example.com"},
+		{hostport: "example.com:8080", host: "example.com", port: "8080", ascii: "example.com:8080"},
+		{hostport: "[fd00::12]", host: "fd00::12", ascii: "[fd00::12]"},
+		{hostport: "[fd00::12]:8443", host: "fd00::12", port: "8443", ascii: "[fd00::12]:8443"},
+		{hostport: "fd00::12", host: "fd00::12", ascii: "[fd00::12]"},
+		{hostport: "fd00::", host: "fd00::", ascii: "[fd00::]"},
+		{hostport: "[fe80::1%25eth0]:443", host: "fe80::1%eth0", port: "443", ascii: "[fe80::1%eth0]:443"},
+		{hostport: "[fe80::1%eth0]", host: "fe80::1%eth0", ascii: "[fe80::1%eth0]"},
+		{hostport: "bücher.example:8080", host: "bücher.example", port: "8080", ascii: "xn--bcher-kva.example:8080"},
+		{hostport: "例子.测试", host: "例子.测试", ascii: "xn--fsqu00a.xn--0zwm56d"},
+		{hostport: "example.com:", wantErr: `invalid port ""`},
+		{hostport: "[fd00::12]:", wantErr: `invalid port ""`},
+		{hostport: "example.com:0", wantErr: "invalid port"},
+		{hostport: "example.com:65536", wantErr: "invalid port"},
+		{hostport: "example.com:http", wantErr: "invalid port"},
+		{hostport: "[fd00::12", wantErr: "invalid host"},
+		{hostport: "[fd00::12]x", wantErr: "invalid host"},
+		{hostport: "fd00::zz", wantErr: "invalid IPv6 host"},
+		{hostport: "[example.com]:80", wantErr: "invalid IPv6 host"},
+		{hostport: "[127.0.0.1]", wantErr: "invalid IPv6 host"},
+	}
+	for _, tt := range tests {
+		host, port, err := SplitHostPort(tt.hostport)
+		ascii, asciiErr := toASCIIHostPort(tt.hostport)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || asciiErr == nil {
+				t.Errorf("SplitHostPort(%q) = %q, %q, %v and toASCIIHostPort error %v, want %q", tt.hostport, host, port, err, asciiErr, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || host != tt.host || port != tt.port {
+			t.Errorf("SplitHostPort(%q) = %q, %q, %v, want %q, %q", tt.hostport, host, port, err, tt.host, tt.port)
+		}
+		if asciiErr != nil || ascii != tt.ascii {
+			t.Errorf("toASCIIHostPort(%q) = %q, %v, want %q", tt.hostport, ascii, asciiErr, tt.ascii)
+		}
+	}
+	// 合法的端口但非法的国际化域名
+	if _, err := toASCIIHostPort("bücher..example:443"); err == nil || !strings.Contains(err.Error(), "invalid internationalized host") {
+		t.Fatalf("error = %v, want the empty label rejected", err)
+	}
+}
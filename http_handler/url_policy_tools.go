@@ -0,0 +1,115 @@
+package nhr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrURLPolicy URL不符合URLPolicy，可以通过errors.Is判断，通过errors.As获取*URLPolicyError查看具体原因
+var ErrURLPolicy = errors.New("url violates policy")
+
+// URLPolicy URL校验规则，零值表示不做任何限制
+// 对根据用户输入拼接URL的服务，也可以作为简单的SSRF防护
+type URLPolicy struct {
+	// RequireHTTPS 只允许https
+	RequireHTTPS bool
+	// AllowedHosts 允许访问的host，支持精确匹配和*.example.com形式的后缀匹配，为空时不限制
+	AllowedHosts []string
+	// ForbidUserinfo 禁止URL中带有user:password@
+	ForbidUserinfo bool
+	// ForbidIPLiterals 禁止直接使用IP地址作为host
+	ForbidIPLiterals bool
+	// MaxLength URL的最大长度，为0时不限制
+	MaxLength int
+}
+
+// URLPolicyError 列出URL违反的所有规则
+type URLPolicyError struct {
+	URL        string
+	Violations []string
+}
+
+func (e *URLPolicyError) Error() string {
+	display := e.URL
+	if urlObj, err := url.Parse(e.URL); err == nil {
+		display = urlObj.Redacted()
+	}
+	return fmt.Sprintf("%v %q: %v", ErrURLPolicy, redactSecrets(display), strings.Join(e.Violations, "; "))
+}
+
+func (e *URLPolicyError) Is(target error) bool {
+	return target == ErrURLPolicy
+}
+
+// WithURLPolicy 发送请求之前按policy校验URL，不符合时不会发起任何网络请求，直接返回ErrURLPolicy
+// 跟随重定向时每一跳的地址同样按policy校验
+func WithURLPolicy(policy URLPolicy) Option {
+	return func(req *HttpRequests) {
+		req.URLPolicy = &policy
+	}
+}
+
+// ValidateURL 按policy校验URL，返回的错误会列出所有违反的规则，而不只是第一条
+func ValidateURL(raw string, policy URLPolicy) error {
+	var violations []string
+	if policy.MaxLength > 0 && len(raw) > policy.MaxLength {
+		violations = append(violations, fmt.Sprintf("length %v exceeds max length %v", len(raw), policy.MaxLength))
+	}
+	urlObj, err := url.Parse(raw)
+	if err != nil {
+		violations = append(violations, fmt.Sprintf("parse url failed:%v", err))
+		return &URLPolicyError{URL: raw, Violations: violations}
+	}
+	if urlObj.Scheme == "" || urlObj.Host == "" {
+		violations = append(violations, "url must be absolute with scheme and host")
+	}
+	if policy.RequireHTTPS && !strings.EqualFold(urlObj.Scheme, "https") {
+		violations = append(violations, fmt.Sprintf("scheme %q is not https", urlObj.Scheme))
+	}
+	if policy.ForbidUserinfo && urlObj.User != nil {
+		violations = append(violations, "userinfo is not allowed")
+	}
+	host, _, err := SplitHostPort(urlObj.Host)
+	if err != nil {
+		violations = append(violations, err.Error())
+	} else if host != "" {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if asciiHost, err := toASCIIHost(host); err != nil {
+			violations = append(violations, err.Error())
+		} else {
+			host = asciiHost
+		}
+		isIP := net.ParseIP(strings.SplitN(host, "%", 2)[0]) != nil
+		if policy.ForbidIPLiterals && isIP {
+			violations = append(violations, fmt.Sprintf("ip literal host %q is not allowed", host))
+		}
+		if len(policy.AllowedHosts) > 0 && !hostAllowed(host, policy.AllowedHosts) {
+			violations = append(violations, fmt.Sprintf("host %q is not in allowed hosts", host))
+		}
+	}
+	if len(violations) > 0 {
+		return &URLPolicyError{URL: raw, Violations: violations}
+	}
+	return nil
+}
+
+// hostAllowed 判断host是否匹配allowedHosts中的任意一项
+// *.example.com 匹配example.com的所有子域名，但不匹配example.com本身
+func hostAllowed(host string, allowedHosts []string) bool {
+	for _, pattern := range allowedHosts {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package nhr
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// URLSpec 以数据的形式声明接口地址，可以直接由json/yaml配置文件填充
+// PathTemplate中的{name}会被PathVars中对应的值替换，替换的值会经过url.PathEscape转义
+type URLSpec struct {
+	Scheme       string              `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+	Host         string              `json:"host" yaml:"host"`
+	Port         int                 `json:"port,omitempty" yaml:"port,omitempty"`
+	PathTemplate string              `json:"path_template,omitempty" yaml:"path_template,omitempty"`
+	PathVars     map[string]string   `json:"path_vars,omitempty" yaml:"path_vars,omitempty"`
+	Query        map[string][]string `json:"query,omitempty" yaml:"query,omitempty"`
+	Fragment     string              `json:"fragment,omitempty" yaml:"fragment,omitempty"`
+}
+
+// URLSpecError URLSpec校验失败，Field为出错的字段名
+type URLSpecError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *URLSpecError) Error() string {
+	return fmt.Sprintf("invalid URLSpec.%v %q: %v", e.Field, e.Value, e.Reason)
+}
+
+// Build 校验各个字段并生成最终的URL字符串
+func (s URLSpec) Build() (string, error) {
+	urlObj, err := s.URL()
+	if err != nil {
+		return "", err
+	}
+	return urlObj.String(), nil
+}
+
+// URL 校验各个字段并生成*url.URL，Scheme为空时默认为https
+func (s URLSpec) URL() (*url.URL, error) {
+	scheme := strings.ToLower(s.Scheme)
+	if scheme == "" {
+		scheme = "https"
+	}
+	if !validScheme(scheme) {
+		return nil, &URLSpecError{Field: "Scheme", Value: s.Scheme, Reason: "scheme must start with a letter and contain only letters, digits, +, - or ."}
+	}
+	if s.Host == "" {
+		return nil, &URLSpecError{Field: "Host", Value: s.Host, Reason: "host is required"}
+	}
+	if strings.ContainsAny(s.Host, "/?#@ ") {
+		return nil, &URLSpecError{Field: "Host", Value: s.Host, Reason: "host must not contain scheme, path, query, userinfo or spaces"}
+	}
+	if s.Port < 0 || s.Port > 65535 {
+		return nil, &URLSpecError{Field: "Port", Value: strconv.Itoa(s.Port), Reason: "port must be between 1 and 65535"}
+	}
+	hostname, port, err := SplitHostPort(s.Host)
+	if err != nil {
+		return nil, &URLSpecError{Field: "Host", Value: s.Host, Reason: err.Error()}
+	}
+	if s.Port > 0 {
+		if port != "" {
+			return nil, &URLSpecError{Field: "Port", Value: strconv.Itoa(s.Port), Reason: "host already contains port " + port}
+		}
+		port = strconv.Itoa(s.Port)
+	}
+	asciiHost, err := toASCIIHost(hostname)
+	if err != nil {
+		return nil, &URLSpecError{Field: "Host", Value: s.Host, Reason: err.Error()}
+	}
+	host := joinHostPort(asciiHost, port)
+	if s.PathTemplate != "" && !strings.HasPrefix(s.PathTemplate, "/") {
+		return nil, &URLSpecError{Field: "PathTemplate", Value: s.PathTemplate, Reason: "path template must start with /"}
+	}
+	escapedPath, err := expandPathTemplate(s.PathTemplate, s.PathVars)
+	if err != nil {
+		return nil, err
+	}
+	path, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		return nil, &URLSpecError{Field: "PathTemplate", Value: s.PathTemplate, Reason: err.Error()}
+	}
+	return &url.URL{
+		Scheme:   scheme,
+		Host:     host,
+		Path:     path,
+		RawPath:  escapedPath,
+		RawQuery: url.Values(s.Query).Encode(),
+		Fragment: s.Fragment,
+	}, nil
+}
+
+// validScheme 校验scheme是否符合RFC 3986
+func validScheme(scheme string) bool {
+	for i, c := range scheme {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return scheme != ""
+}
+
+// expandPathTemplate 将路径模板中的{name}替换为转义后的变量值，返回转义后的path
+func expandPathTemplate(tmpl string, vars map[string]string) (string, error) {
+	return expandTemplate(tmpl, vars, url.PathEscape)
+}
+
+// expandTemplate 将模板中的{name}替换为经过escape转换的变量值
+func expandTemplate(tmpl string, vars map[string]string, escape func(string) string) (string, error) {
+	var builder strings.Builder
+	rest := tmpl
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return "", &URLSpecError{Field: "PathTemplate", Value: tmpl, Reason: "unmatched }"}
+			}
+			builder.WriteString(rest)
+			return builder.String(), nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", &URLSpecError{Field: "PathTemplate", Value: tmpl, Reason: "unclosed {"}
+		}
+		name := rest[start+1 : start+end]
+		value, ok := vars[name]
+		if !ok {
+			return "", &URLSpecError{Field: "PathVars", Value: name, Reason: "missing value for path variable"}
+		}
+		builder.WriteString(rest[:start])
+		builder.WriteString(escape(value))
+		rest = rest[start+end+1:]
+	}
+}
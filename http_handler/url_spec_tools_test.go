@@ -0,0 +1,70 @@
+package nhr
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestURLSpecBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  URLSpec
+		want  string
+		field string
+	}{
+		{name: "host only", spec: URLSpec{Host: "api.example.com"}, want: "https://api.example.com"},
+		{name: "full", spec: URLSpec{
+			Scheme:       "HTTP",
+			Host:         "api.example.com",
+			Port:         8080,
+			PathTemplate: "/v1/users/{id}/files/{name}",
+			PathVars:     map[string]string{"id": "42", "name": "a b/c"},
+			Query:        map[string][]string{"tag": {"x", "y"}, "q": {"a&b"}},
+			Fragment:     "top",
+		}, want: "http://api.example.com:8080/v1/users/42/files/a%20b%2Fc?q=a%26b&tag=x&tag=y#top"},
+		{name: "port in host", spec: URLSpec{Host: "api.example.com:8443", PathTemplate: "/v1"}, want: "https://api.example.com:8443/v1"},
+		{name: "ipv6", spec: URLSpec{Host: "fd00::12", Port: 8443}, want: "https://[fd00::12]:8443"},
+		{name: "unicode host", spec: URLSpec{Host: "bücher.example"}, want: "https://xn--bcher-kva.example"},
+		{name: "bad scheme", spec: URLSpec{Scheme: "1http", Host: "api.example.com"}, field: "Scheme"},
+		{name: "missing host", spec: URLSpec{PathTemplate: "/v1"}, field: "Host"},
+		{name: "host with path", spec: URLSpec{Host: "api.example.com/v1"}, field: "Host"},
+		{name: "host with userinfo", spec: URLSpec{Host: "user@api.example.com"}, field: "Host"},
+		{name: "port out of range", spec: URLSpec{Host: "api.example.com", Port: 70000}, field: "Port"},
+		{name: "port twice", spec: URLSpec{Host: "api.example.com:8443", Port: 8080}, field: "Port"},
+		{name: "relative template", spec: URLSpec{Host: "api.example.com", PathTemplate: "v1"}, field: "PathTemplate"},
+		{name: "unclosed brace", spec: URLSpec{Host: "api.example.com", PathTemplate: "/v1/{id"}, field: "PathTemplate"},
+		{name: "unmatched brace", spec: URLSpec{Host: "api.example.com", PathTemplate: "/v1/id}"}, field: "PathTemplate"},
+		{name: "missing var", spec: URLSpec{Host: "api.example.com", PathTemplate: "/v1/{id}"}, field: "PathVars"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.spec.Build()
+			if tt.field != "" {
+				var specErr *URLSpecError
+				if !errors.As(err, &specErr) || specErr.Field != tt.field {
+					t.Fatalf("Build() = %q, %v, want a URLSpecError for %v", got, err, tt.field)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Build() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLSpecFromJSON(t *testing.T) {
+	var spec URLSpec
+	config := `{"host":"api.example.com","path_template":"/v1/orders/{id}","path_vars":{"id":"7"},"query":{"expand":["items"]}}`
+	if err := json.Unmarshal([]byte(config), &spec); err != nil {
+		t.Fatal(err)
+	}
+	urlObj, err := spec.URL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if urlObj.String() != "https://api.example.com/v1/orders/7?expand=items" || urlObj.Path != "/v1/orders/7" {
+		t.Fatalf("url = %v, path = %v", urlObj, urlObj.Path)
+	}
+}
@@ -0,0 +1,108 @@
+package nhr
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WarmupResult 预热一个host的结果，Err不为nil时表示预热失败，不影响之后的请求
+type WarmupResult struct {
+	Host     string
+	Duration time.Duration
+	Err      error
+}
+
+// WarmupOption 预热的配置
+type WarmupOption func(*warmupConfig)
+
+type warmupConfig struct {
+	path     string
+	interval time.Duration
+}
+
+// WithWarmupPath 预热时HEAD请求的路径，默认为/
+func WithWarmupPath(path string) WarmupOption {
+	return func(c *warmupConfig) {
+		c.path = path
+	}
+}
+
+// WithRewarm 每隔interval重新预热一次，interval应当小于连接池的空闲超时，Client.Close时停止
+func WithRewarm(interval time.Duration) WarmupOption {
+	return func(c *warmupConfig) {
+		c.interval = interval
+	}
+}
+
+// Warmup 向每个host发送HEAD请求，建立连接(DNS、TCP、TLS)并放回连接池，之后的请求可以直接复用
+// host可以是example.com、example.com:8443或者带scheme的https://example.com，没有scheme时使用https
+// 返回每个host的结果，任何状态码都算预热成功
+func (c *Client) Warmup(ctx context.Context, hosts ...string) []WarmupResult {
+	return c.WarmupWith(ctx, hosts)
+}
+
+// WarmupWith 与Warmup相同，可以设置预热路径以及定时重新预热
+func (c *Client) WarmupWith(ctx context.Context, hosts []string, options ...WarmupOption) []WarmupResult {
+	config := &warmupConfig{path: "/"}
+	for _, option := range options {
+		option(config)
+	}
+	results := c.warmup(ctx, hosts, config.path)
+	if config.interval > 0 && c.state != nil {
+		hosts = append([]string(nil), hosts...)
+		c.state.goBackground(func(ctx context.Context) {
+			ticker := time.NewTicker(config.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					c.warmup(ctx, hosts, config.path)
+				}
+			}
+		})
+	}
+	return results
+}
+
+// warmup 并发预热所有host
+func (c *Client) warmup(ctx context.Context, hosts []string, path string) []WarmupResult {
+	results := make([]WarmupResult, len(hosts))
+	done := make(chan struct{}, len(hosts))
+	for i, host := range hosts {
+		go func(i int, host string) {
+			defer func() { done <- struct{}{} }()
+			start := timeNow()
+			results[i] = WarmupResult{Host: host, Err: c.warmOne(ctx, warmupURL(host, path))}
+			results[i].Duration = timeNow().Sub(start)
+		}(i, host)
+	}
+	for range hosts {
+		<-done
+	}
+	return results
+}
+
+// warmOne 预热失败时不重试，读完body使连接回到连接池
+func (c *Client) warmOne(ctx context.Context, rawURL string) error {
+	response, err := c.HttpCaller(http.MethodHead, rawURL, WithContext(ctx), WithRetryPolicy(RetryPolicy{}))
+	if err != nil {
+		return err
+	}
+	drainBody(response.Body)
+	return nil
+}
+
+// warmupURL 将host和path拼接为预热请求的URL
+func warmupURL(host, path string) string {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return strings.TrimRight(host, "/") + path
+}
@@ -0,0 +1,102 @@
+package nhr
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestWarmupURL(t *testing.T) {
+	tests := []struct{ host, path, want string }{
+		{"example.com", "/", "https://example.com/"},
+		{"example.com:8443", "healthz", "https://example.com:8443/healthz"},
+		{"http://127.0.0.1:8080/", "/ping", "http://127.0.0.1:8080/ping"},
+	}
+	for _, tt := range tests {
+		if got := warmupURL(tt.host, tt.path); got != tt.want {
+			t.Errorf("warmupURL(%q, %q) = %q, want %q", tt.host, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWarmupConnectionReused(t *testing.T) {
+	var heads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt32(&heads, 1)
+		}
+	}))
+	defer server.Close()
+
+	// 一个无法连接的地址，预热失败但不影响其他host
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := "http://" + listener.Addr().String()
+	listener.Close()
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+	results := client.Warmup(context.Background(), server.URL, closedAddr)
+	if results[0].Err != nil || results[0].Host != server.URL {
+		t.Fatalf("warmup of %v: %+v", server.URL, results[0])
+	}
+	if results[1].Err == nil {
+		t.Fatalf("warmup of %v should fail", closedAddr)
+	}
+	if atomic.LoadInt32(&heads) != 1 {
+		t.Fatalf("server received %v HEAD requests, want 1", heads)
+	}
+
+	var reused bool
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused },
+	})
+	response, err := client.Get(server.URL, WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if !reused {
+		t.Fatal("first request after warmup did not reuse the warmed connection")
+	}
+}
+
+func TestWarmupRewarmStopsOnClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var heads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&heads, 1)
+	}))
+	defer server.Close()
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.WarmupWith(context.Background(), []string{server.URL}, WithWarmupPath("/healthz"), WithRewarm(20*time.Millisecond))
+	time.Sleep(110 * time.Millisecond)
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	n := atomic.LoadInt32(&heads)
+	if n < 3 {
+		t.Fatalf("server received %v warmup requests, want periodic rewarming", n)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if after := atomic.LoadInt32(&heads); after != n {
+		t.Fatalf("rewarming continued after Close: %v -> %v", n, after)
+	}
+}